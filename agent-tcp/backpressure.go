@@ -0,0 +1,107 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+// DefaultMaxPendingBytes is the default limit of the total bytes of incoming
+// consensus messages awaiting to be verified by the consensus core(64MB)
+const DefaultMaxPendingBytes = 16 * DefaultMaxMessageSize
+
+// SetMaxPendingBytes limits the total bytes of incoming consensus messages
+// awaiting to be verified by the consensus core, when the limit is reached,
+// the agent is saturated and peers stop reading new frames until the queue
+// drains, so the backpressure is propagated to the senders by the transport.
+// A size of 0 disables the limit, the default is DefaultMaxPendingBytes.
+func (agent *TCPAgent) SetMaxPendingBytes(size int) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.maxPendingBytes = size
+	if !agent.saturated() {
+		agent.notifyDrained()
+	}
+}
+
+// Saturated returns true if the incoming consensus messages awaiting to be
+// verified by the consensus core have reached the limit set by
+// SetMaxPendingBytes.
+func (agent *TCPAgent) Saturated() bool {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.saturated()
+}
+
+func (agent *TCPAgent) saturated() bool {
+	return agent.maxPendingBytes > 0 && agent.pendingBytes >= agent.maxPendingBytes
+}
+
+// takeConsensusMessages removes all consensus messages awaiting to be
+// processed from the queue, and wakes up the peers waiting for the queue
+// to drain, the agent must be locked.
+func (agent *TCPAgent) takeConsensusMessages() []channelMessage {
+	msgs := agent.consensusMessages
+	agent.consensusMessages = nil
+	agent.pendingBytes = 0
+	agent.notifyDrained()
+	return msgs
+}
+
+// notifyDrained wakes up all peers waiting in waitDrained
+func (agent *TCPAgent) notifyDrained() {
+	if agent.chDrained != nil {
+		close(agent.chDrained)
+		agent.chDrained = nil
+	}
+}
+
+// waitDrained blocks the peer while the agent is saturated, returns false
+// if the peer or the agent has been closed.
+func (p *TCPPeer) waitDrained() bool {
+	agent := p.agent
+	for {
+		agent.Lock()
+		if !agent.saturated() {
+			agent.Unlock()
+			return true
+		}
+		if agent.chDrained == nil {
+			agent.chDrained = make(chan struct{})
+		}
+		drained := agent.chDrained
+		agent.Unlock()
+
+		select {
+		case <-drained:
+		case <-p.die:
+			return false
+		case <-agent.die:
+			return false
+		}
+	}
+}
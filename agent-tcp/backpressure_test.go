@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackpressure(t *testing.T) {
+	// agent without consensus message receiver, as a stalled core
+	agent := &TCPAgent{chConsensusMessages: make(chan struct{}, 1), die: make(chan struct{})}
+	defer agent.Close()
+	agent.SetMaxPendingBytes(16 * 1024)
+	agent.maxMessageSize = DefaultMaxMessageSize
+
+	privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	p := NewTCPPeer(c1, agent)
+	p.Lock()
+	p.peerAuthStatus = peerAuthenticated
+	p.peerPublicKey = &privateKey.PublicKey
+	p.Unlock()
+
+	// flood distinct 1KB consensus messages
+	const flood = 1000
+	sent := make(chan int, flood)
+	go func() {
+		for i := 0; i < flood; i++ {
+			msg := make([]byte, 1024)
+			binary.LittleEndian.PutUint32(msg, uint32(i))
+			bts, err := proto.Marshal(&Gossip{Command: CommandType_CONSENSUS, Message: msg})
+			if err != nil {
+				return
+			}
+			frame := make([]byte, MessageLength+len(bts))
+			binary.LittleEndian.PutUint32(frame, uint32(len(bts)))
+			copy(frame[MessageLength:], bts)
+			if _, err := c2.Write(frame); err != nil {
+				return
+			}
+			sent <- i
+		}
+	}()
+
+	// the peer stops reading once saturated
+	for !agent.Saturated() {
+		<-time.After(time.Millisecond)
+	}
+	<-time.After(50 * time.Millisecond)
+	agent.Lock()
+	assert.True(t, agent.pendingBytes <= 16*1024+1024)
+	assert.True(t, len(sent) < flood)
+	agent.Unlock()
+
+	// reading resumes as the queue drains
+	received := 0
+	for received < flood {
+		agent.Lock()
+		assert.True(t, agent.pendingBytes <= 16*1024+1024)
+		received += len(agent.takeConsensusMessages())
+		agent.Unlock()
+		<-time.After(time.Millisecond)
+	}
+	assert.Equal(t, flood, received)
+	assert.False(t, agent.Saturated())
+}
@@ -0,0 +1,76 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"github.com/Sperax/bdls"
+)
+
+// channelMessage is a consensus message of the consensus instance on a channel,
+// channel 0 is the default consensus instance of the agent.
+type channelMessage struct {
+	channel uint32
+	bts     []byte
+}
+
+// channelPeer is a TCPPeer seen by the consensus instance on a channel
+type channelPeer struct {
+	*TCPPeer
+	channel uint32
+}
+
+// Send implements PeerInterface, to send message on the channel to this peer
+func (p *channelPeer) Send(out []byte) error { return p.TCPPeer.send(p.channel, out) }
+
+// Register multiplexes the consensus instance on channel id over all connections
+// of this agent, inbound messages on the channel will be routed to it, and it
+// will be updated along with the default consensus instance on channel 0.
+// Both ends of a connection must register the same id for the same instance.
+func (agent *TCPAgent) Register(id uint32, c *bdls.Consensus) error {
+	agent.Lock()
+	defer agent.Unlock()
+
+	if id == 0 {
+		return ErrChannelReserved
+	}
+	if _, ok := agent.channels[id]; ok {
+		return ErrChannelRegistered
+	}
+
+	if agent.channels == nil {
+		agent.channels = make(map[uint32]*bdls.Consensus)
+	}
+	agent.channels[id] = c
+	for k := range agent.peers {
+		c.Join(&channelPeer{agent.peers[k], id})
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	const numPeers = 4
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < numPeers; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	newConsensus := func(i int) *bdls.Consensus {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = participants[i]
+		config.Participants = coords
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(50 * time.Millisecond)
+		return consensus
+	}
+
+	// a default instance and a multiplexed one on each agent
+	agents := make([]*TCPAgent, numPeers)
+	shards := make([]*bdls.Consensus, numPeers)
+	for i := 0; i < numPeers; i++ {
+		agents[i] = NewTCPAgent(newConsensus(i), participants[i])
+		shards[i] = newConsensus(i)
+	}
+
+	// register before and after connecting
+	for i := 0; i < numPeers/2; i++ {
+		assert.Nil(t, agents[i].Register(7, shards[i]))
+	}
+
+	var peers []*TCPPeer
+	for i := 0; i < numPeers; i++ {
+		for j := i + 1; j < numPeers; j++ {
+			c1, c2 := net.Pipe()
+			p1 := NewTCPPeer(c1, agents[i])
+			p2 := NewTCPPeer(c2, agents[j])
+			assert.True(t, agents[i].AddPeer(p1))
+			assert.True(t, agents[j].AddPeer(p2))
+			p1.InitiatePublicKeyAuthentication()
+			p2.InitiatePublicKeyAuthentication()
+			peers = append(peers, p1, p2)
+		}
+	}
+
+	for i := numPeers / 2; i < numPeers; i++ {
+		assert.Nil(t, agents[i].Register(7, shards[i]))
+	}
+	assert.Equal(t, ErrChannelReserved, agents[0].Register(0, shards[0]))
+	assert.Equal(t, ErrChannelRegistered, agents[0].Register(7, shards[0]))
+
+	for _, p := range peers {
+		for p.GetPublicKey() == nil {
+			<-time.After(time.Millisecond)
+		}
+	}
+
+	for i := 0; i < numPeers; i++ {
+		agents[i].Update()
+		agents[i].Propose([]byte("default"))
+		agents[i].Lock()
+		shards[i].Propose([]byte("shard"))
+		agents[i].Unlock()
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for i := 0; i < numPeers; i++ {
+		for {
+			agents[i].Lock()
+			height, _, _ := agents[i].consensus.CurrentState()
+			shardHeight, _, _ := shards[i].CurrentState()
+			agents[i].Unlock()
+			if height > 0 && shardHeight > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("agent %v failed to decide", i)
+			}
+			<-time.After(20 * time.Millisecond)
+		}
+
+		agents[i].Lock()
+		_, _, state := agents[i].consensus.CurrentState()
+		_, _, shardState := shards[i].CurrentState()
+		agents[i].Unlock()
+		assert.Equal(t, bdls.State("default"), state)
+		assert.Equal(t, bdls.State("shard"), shardState)
+	}
+
+	for i := 0; i < numPeers; i++ {
+		agents[i].Close()
+	}
+}
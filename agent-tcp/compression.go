@@ -0,0 +1,114 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// DefaultCompressionThreshold is the default min length of consensus messages
+// to be compressed, smaller messages are sent as is to avoid the overhead.
+const DefaultCompressionThreshold = 1024
+
+// SetCompression enables the compression of outgoing consensus messages of at
+// least threshold bytes, a threshold of 0 is DefaultCompressionThreshold.
+// The compression is negotiated at connect time: it's announced in the
+// public key authentication, and messages are compressed only to the peers
+// announced the same compression, so agents without it interoperate.
+// CompressionType_NONE disables the compression, which is the default.
+// It applies to peers added afterwards.
+func (agent *TCPAgent) SetCompression(compression CompressionType, threshold int) {
+	agent.Lock()
+	defer agent.Unlock()
+	if threshold <= 0 {
+		threshold = DefaultCompressionThreshold
+	}
+	agent.compression = compression
+	agent.compressionThreshold = threshold
+}
+
+// compress compresses a consensus message to this peer if the compression
+// has been negotiated and the message is not too small, the returned bytes
+// are valid until next call. The message is sent as is if compression
+// doesn't make it smaller.
+func (p *TCPPeer) compress(bts []byte) ([]byte, CompressionType) {
+	p.Lock()
+	negotiated := p.compression == CompressionType_GZIP && p.peerCompression == CompressionType_GZIP
+	p.Unlock()
+	if !negotiated || len(bts) < p.compressionThreshold {
+		return bts, CompressionType_NONE
+	}
+
+	p.compressBuffer.Reset()
+	if p.gzipWriter == nil {
+		p.gzipWriter = gzip.NewWriter(&p.compressBuffer)
+	} else {
+		p.gzipWriter.Reset(&p.compressBuffer)
+	}
+	if _, err := p.gzipWriter.Write(bts); err != nil {
+		return bts, CompressionType_NONE
+	}
+	if err := p.gzipWriter.Close(); err != nil {
+		return bts, CompressionType_NONE
+	}
+
+	if p.compressBuffer.Len() >= len(bts) {
+		return bts, CompressionType_NONE
+	}
+	return p.compressBuffer.Bytes(), CompressionType_GZIP
+}
+
+// decompress decompresses a consensus message from this peer, messages
+// decompressed beyond the max length of incoming messages are rejected.
+func (p *TCPPeer) decompress(compression CompressionType, bts []byte) ([]byte, error) {
+	switch compression {
+	case CompressionType_NONE:
+		return bts, nil
+	case CompressionType_GZIP:
+		r, err := gzip.NewReader(bytes.NewReader(bts))
+		if err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		n, err := io.Copy(&out, io.LimitReader(r, int64(p.maxMessageSize)+1))
+		if err != nil {
+			return nil, err
+		}
+		if n > int64(p.maxMessageSize) {
+			return nil, ErrMessageLengthExceed
+		}
+		return out.Bytes(), nil
+	default:
+		return nil, ErrCompressionUnknown
+	}
+}
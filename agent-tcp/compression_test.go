@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	p := &TCPPeer{compression: CompressionType_GZIP, compressionThreshold: DefaultCompressionThreshold, maxMessageSize: DefaultMaxMessageSize}
+	large := bytes.Repeat([]byte("decide"), 1024)
+
+	// not negotiated
+	out, compression := p.compress(large)
+	assert.Equal(t, CompressionType_NONE, compression)
+	assert.Equal(t, large, out)
+
+	p.peerCompression = CompressionType_GZIP
+	out, compression = p.compress(large)
+	assert.Equal(t, CompressionType_GZIP, compression)
+	assert.True(t, len(out) < len(large))
+	decompressed, err := p.decompress(compression, out)
+	assert.Nil(t, err)
+	assert.Equal(t, large, decompressed)
+
+	// below threshold
+	small := []byte("commit")
+	out, compression = p.compress(small)
+	assert.Equal(t, CompressionType_NONE, compression)
+	assert.Equal(t, small, out)
+
+	// incompressible
+	random := make([]byte, 4096)
+	_, err = rand.Read(random)
+	assert.Nil(t, err)
+	out, compression = p.compress(random)
+	assert.Equal(t, CompressionType_NONE, compression)
+	assert.Equal(t, random, out)
+
+	// decompressed beyond limit
+	out, _ = p.compress(large)
+	p.maxMessageSize = uint32(len(large) - 1)
+	_, err = p.decompress(CompressionType_GZIP, out)
+	assert.Equal(t, ErrMessageLengthExceed, err)
+
+	_, err = p.decompress(CompressionType(100), out)
+	assert.Equal(t, ErrCompressionUnknown, err)
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	var agents []*TCPAgent
+	for i := 0; i < 3; i++ {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = keys[i]
+		config.Participants = participants
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		agent := NewTCPAgent(consensus, keys[i])
+		defer agent.Close()
+		agents = append(agents, agent)
+	}
+	agents[0].SetCompression(CompressionType_GZIP, 0)
+	agents[1].SetCompression(CompressionType_GZIP, 0)
+
+	connect := func(a, b *TCPAgent) (*TCPPeer, *TCPPeer) {
+		c1, c2 := net.Pipe()
+		p1 := NewTCPPeer(c1, a)
+		p2 := NewTCPPeer(c2, b)
+		assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+		assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+		for p1.GetPublicKey() == nil || p2.GetPublicKey() == nil {
+			<-time.After(time.Millisecond)
+		}
+		return p1, p2
+	}
+
+	// both enabled
+	p1, p2 := connect(agents[0], agents[1])
+	_, compression := p1.compress(bytes.Repeat([]byte("decide"), 1024))
+	assert.Equal(t, CompressionType_GZIP, compression)
+	_, compression = p2.compress(bytes.Repeat([]byte("decide"), 1024))
+	assert.Equal(t, CompressionType_GZIP, compression)
+
+	// compressed messages are delivered decompressed
+	message := bytes.Repeat([]byte("decide"), 1024)
+	assert.Nil(t, p1.Send(message))
+	<-time.After(100 * time.Millisecond)
+	assert.Equal(t, uint64(0), agents[1].Duplicates())
+	assert.Nil(t, p1.Send(message))
+	for agents[1].Duplicates() == 0 {
+		<-time.After(time.Millisecond)
+	}
+
+	// one side disabled
+	p1, p3 := connect(agents[0], agents[2])
+	_, compression = p1.compress(bytes.Repeat([]byte("decide"), 1024))
+	assert.Equal(t, CompressionType_NONE, compression)
+	_, compression = p3.compress(bytes.Repeat([]byte("decide"), 1024))
+	assert.Equal(t, CompressionType_NONE, compression)
+}
+
+// createDecideProof creates an encoded <decide> message carrying the <commit>
+// messages of n validators
+func createDecideProof(tb testing.TB, n int) []byte {
+	state := bytes.Repeat([]byte{0xab}, 32)
+	decide := &bdls.Message{Type: bdls.MessageType_Decide, Height: 1000, Round: 2, State: state}
+	var first *ecdsa.PrivateKey
+	for i := 0; i < n; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(tb, err)
+		if first == nil {
+			first = privateKey
+		}
+		commit := new(bdls.SignedProto)
+		commit.Sign(&bdls.Message{Type: bdls.MessageType_Commit, Height: 1000, Round: 2, State: state}, privateKey)
+		decide.Proof = append(decide.Proof, commit)
+	}
+	signed := new(bdls.SignedProto)
+	signed.Sign(decide, first)
+	bts, err := proto.Marshal(signed)
+	assert.Nil(tb, err)
+	return bts
+}
+
+// BenchmarkCompressDecideProof measures the compression ratio and the cost
+// of gzip on a <decide> proof of 200 validators
+func BenchmarkCompressDecideProof(b *testing.B) {
+	proof := createDecideProof(b, 200)
+	p := &TCPPeer{compression: CompressionType_GZIP, peerCompression: CompressionType_GZIP, compressionThreshold: DefaultCompressionThreshold}
+	out, compression := p.compress(proof)
+	if compression != CompressionType_GZIP {
+		b.Fatal("not compressed")
+	}
+	ratio := float64(len(out)) / float64(len(proof))
+
+	b.SetBytes(int64(len(proof)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.compress(proof)
+	}
+	b.ReportMetric(ratio, "ratio")
+}
+
+// BenchmarkDecompressDecideProof measures the cost to decompress a <decide>
+// proof of 200 validators
+func BenchmarkDecompressDecideProof(b *testing.B) {
+	proof := createDecideProof(b, 200)
+	p := &TCPPeer{compression: CompressionType_GZIP, peerCompression: CompressionType_GZIP, compressionThreshold: DefaultCompressionThreshold, maxMessageSize: DefaultMaxMessageSize}
+	out, _ := p.compress(proof)
+	compressed := append([]byte{}, out...)
+
+	b.SetBytes(int64(len(proof)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.decompress(CompressionType_GZIP, compressed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/Sperax/bdls/crypto/blake2b"
+)
+
+const (
+	// DefaultDedupSize is the default number of message hashes kept for deduplication
+	DefaultDedupSize = 4096
+	// DefaultDedupTTL is the default window in which identical messages are dropped
+	DefaultDedupTTL = time.Second
+)
+
+// dedupCache is a bounded cache of message hashes seen within a time window,
+// the oldest entry is evicted first when it's full.
+type dedupCache struct {
+	size    int
+	ttl     time.Duration
+	entries map[[32]byte]time.Time
+	order   [][32]byte // insertion order for eviction
+}
+
+// newDedupCache creates a dedup cache holding at most size hashes for ttl
+func newDedupCache(size int, ttl time.Duration) *dedupCache {
+	d := new(dedupCache)
+	d.size = size
+	d.ttl = ttl
+	d.entries = make(map[[32]byte]time.Time)
+	return d
+}
+
+// seen returns true if the hash has been seen within ttl, otherwise it's recorded.
+func (d *dedupCache) seen(hash [32]byte, now time.Time) bool {
+	if t, ok := d.entries[hash]; ok && now.Sub(t) < d.ttl {
+		return true
+	}
+
+	// remove expired & overflowed entries
+	for len(d.order) > 0 {
+		oldest := d.order[0]
+		if len(d.order) < d.size && now.Sub(d.entries[oldest]) < d.ttl {
+			break
+		}
+		delete(d.entries, oldest)
+		d.order = d.order[1:]
+	}
+
+	if _, ok := d.entries[hash]; !ok {
+		d.order = append(d.order, hash)
+	}
+	d.entries[hash] = now
+	return false
+}
+
+// messageHash returns the dedup key of a consensus message on the channel
+func messageHash(channel uint32, bts []byte) (hash [32]byte) {
+	if channel == 0 {
+		return blake2b.Sum256(bts)
+	}
+
+	var id [4]byte
+	binary.LittleEndian.PutUint32(id[:], channel)
+	h, _ := blake2b.New256(nil)
+	h.Write(id[:])
+	h.Write(bts)
+	h.Sum(hash[:0])
+	return
+}
+
+// SetDedup configures the cache dropping identical consensus messages seen
+// within ttl before they reach the consensus core, at most size message
+// hashes are kept. A size of 0 disables deduplication.
+func (agent *TCPAgent) SetDedup(size int, ttl time.Duration) {
+	agent.Lock()
+	defer agent.Unlock()
+	if size > 0 {
+		agent.dedup = newDedupCache(size, ttl)
+	} else {
+		agent.dedup = nil
+	}
+}
+
+// Duplicates returns the number of consensus messages dropped as duplicates
+func (agent *TCPAgent) Duplicates() uint64 {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.duplicates
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/Sperax/bdls/crypto/blake2b"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupCache(t *testing.T) {
+	now := time.Now()
+	d := newDedupCache(2, time.Second)
+	a := blake2b.Sum256([]byte("a"))
+	b := blake2b.Sum256([]byte("b"))
+	c := blake2b.Sum256([]byte("c"))
+
+	assert.False(t, d.seen(a, now))
+	assert.True(t, d.seen(a, now))
+	assert.False(t, d.seen(b, now))
+	assert.True(t, d.seen(b, now))
+
+	// a is evicted when full
+	assert.False(t, d.seen(c, now))
+	assert.Equal(t, 2, len(d.entries))
+	assert.False(t, d.seen(a, now))
+
+	// expired after ttl
+	now = now.Add(time.Second)
+	assert.False(t, d.seen(a, now))
+	assert.True(t, d.seen(a, now))
+}
+
+func TestDedup(t *testing.T) {
+	// agent without consensus message receiver
+	agent := &TCPAgent{chConsensusMessages: make(chan struct{}, 1)}
+	agent.SetDedup(DefaultDedupSize, DefaultDedupTTL)
+	agent.handleConsensusMessage(0, []byte("message"))
+	agent.handleConsensusMessage(0, []byte("message"))
+	assert.Equal(t, uint64(1), agent.Duplicates())
+
+	agent.SetDedup(0, 0)
+	agent.handleConsensusMessage(0, []byte("message"))
+	assert.Equal(t, uint64(1), agent.Duplicates())
+}
+
+// runMesh drives a full mesh of n nodes over pipes to decide one height,
+// returns the number of messages reaching verification in all consensus cores and
+// the number of duplicates dropped by all agents.
+func runMesh(tb testing.TB, n int, dedup bool) (verified uint64, duplicates uint64) {
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < n; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(tb, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	epoch := time.Now()
+	agents := make([]*TCPAgent, n)
+	metrics := make([]*bdls.MemoryMetrics, n)
+	for i := 0; i < n; i++ {
+		metrics[i] = bdls.NewMemoryMetrics()
+		config := new(bdls.Config)
+		config.Epoch = epoch
+		config.PrivateKey = participants[i]
+		config.Participants = coords
+		config.Metrics = metrics[i]
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(tb, err)
+		consensus.SetLatency(50 * time.Millisecond)
+		agents[i] = NewTCPAgent(consensus, participants[i])
+		if !dedup {
+			agents[i].SetDedup(0, 0)
+		}
+	}
+
+	var peers []*TCPPeer
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			c1, c2 := net.Pipe()
+			p1 := NewTCPPeer(c1, agents[i])
+			p2 := NewTCPPeer(c2, agents[j])
+			agents[i].AddPeer(p1)
+			agents[j].AddPeer(p2)
+			p1.InitiatePublicKeyAuthentication()
+			p2.InitiatePublicKeyAuthentication()
+			peers = append(peers, p1, p2)
+		}
+	}
+
+	// wait for authentication
+	for _, p := range peers {
+		for p.GetPublicKey() == nil {
+			<-time.After(time.Millisecond)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		agents[i].Update()
+		agents[i].Propose([]byte("dedup"))
+	}
+
+	for i := 0; i < n; i++ {
+		for {
+			if height, _, _ := agents[i].GetLatestState(); height > 0 {
+				break
+			}
+			<-time.After(5 * time.Millisecond)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		agents[i].Close()
+		for t := bdls.MessageType_Nop; t <= bdls.MessageType_Resync; t++ {
+			verified += metrics[i].Received(t)
+		}
+		duplicates += agents[i].Duplicates()
+	}
+	return
+}
+
+func benchmarkDedup(b *testing.B, dedup bool) {
+	var verified, duplicates uint64
+	for i := 0; i < b.N; i++ {
+		v, d := runMesh(b, 7, dedup)
+		verified += v
+		duplicates += d
+	}
+	b.ReportMetric(float64(verified)/float64(b.N), "verifies/op")
+	b.ReportMetric(float64(duplicates)/float64(b.N), "duplicates/op")
+}
+
+func BenchmarkMesh7NoDedup(b *testing.B) { benchmarkDedup(b, false) }
+func BenchmarkMesh7Dedup(b *testing.B)   { benchmarkDedup(b, true) }
@@ -1,3 +1,29 @@
 // Package agent-tcp implements a TCP based agent to participate in consensus
 // Challenge-Response scheme has been adopted to do interactive authentication
+//
+// # Wire format
+//
+// Each frame on the connection is a little-endian uint32 length followed by
+// a protobuf encoded Gossip message of that length, see gossip.proto:
+//
+//	|Length(4 bytes)|Gossip{Command, Message}(Length bytes)|
+//
+// # Handshake
+//
+// Each side proves ownership of a participant private key independently,
+// peer A authenticates to peer B as below, (X, Y) are big-endian coordinates
+// of secp256k1 points without leading zeros:
+//
+//  1. A -> B KEY_AUTH_INIT:            KeyAuthInit{X, Y} of A's public key P.
+//     B closes the connection if P is not a participant of consensus.
+//  2. B -> A KEY_AUTH_CHALLENGE:       KeyAuthChallenge{X, Y, Challenge}, where
+//     (X, Y) is an ephemeral public key E = e*G, Challenge is 1024 random bytes.
+//  3. A -> B KEY_AUTH_CHALLENGE_REPLY: KeyAuthChallengeReply{HMAC}, where
+//     HMAC = blake2b-256(key = X of ECDH(a, E), Challenge).
+//     B verifies HMAC with the key X of ECDH(e, P).
+//
+// CONSENSUS frames carry a SignedProto in Message for the consensus instance
+// on Channel, 0 is the default instance. Those from a peer which has not
+// authenticated are dropped, and the connection is closed if the peer has
+// not authenticated in 10 seconds.
 package agent
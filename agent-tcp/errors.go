@@ -39,5 +39,16 @@ var (
 	ErrPeerKeyAuthChallenge         = errors.New("incorrect state for peer KeyAuthChallenge message")
 	ErrPeerKeyAuthChallengeResponse = errors.New("incorrect state for peer KeyAuthChallengeResponse message")
 	ErrPeerAuthenticatedFailed      = errors.New("public key authentication failed for peer")
+	ErrPeerNotParticipant           = errors.New("peer public key is not a participant")
+	ErrPeerNotAuthenticated         = errors.New("peer has not authenticated it's public key in time")
 	ErrMessageLengthExceed          = errors.New("message size exceeded maximum")
+	ErrDatagramTooLarge             = errors.New("message size exceeded datagram MTU")
+	ErrTLSNotConfigured             = errors.New("TLS has not been configured for the agent")
+	ErrTLSNoPeerCertificate         = errors.New("peer has not presented TLS certificate")
+	ErrTLSUnknownIdentity           = errors.New("peer certificate identity is not a participant")
+	ErrTLSIdentityMismatch          = errors.New("peer public key does not match it's certificate identity")
+	ErrAgentClosed                  = errors.New("agent has been closed")
+	ErrChannelReserved              = errors.New("channel 0 is reserved for the default consensus")
+	ErrChannelRegistered            = errors.New("channel has already been registered")
+	ErrCompressionUnknown           = errors.New("unknown compression of consensus message")
 )
@@ -57,13 +57,43 @@ func (CommandType) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_878fa4887b90140c, []int{0}
 }
 
+// CompressionType defines supported compressions of consensus messages
+type CompressionType int32
+
+const (
+	CompressionType_NONE CompressionType = 0
+	CompressionType_GZIP CompressionType = 1
+)
+
+var CompressionType_name = map[int32]string{
+	0: "NONE",
+	1: "GZIP",
+}
+
+var CompressionType_value = map[string]int32{
+	"NONE": 0,
+	"GZIP": 1,
+}
+
+func (x CompressionType) String() string {
+	return proto.EnumName(CompressionType_name, int32(x))
+}
+
+func (CompressionType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{1}
+}
+
 // Gossip defines a stream based protocol
 type Gossip struct {
-	Command              CommandType `protobuf:"varint,1,opt,name=Command,proto3,enum=agent.CommandType" json:"Command,omitempty"`
-	Message              []byte      `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
-	XXX_unrecognized     []byte      `json:"-"`
-	XXX_sizecache        int32       `json:"-"`
+	Command CommandType `protobuf:"varint,1,opt,name=Command,proto3,enum=agent.CommandType" json:"Command,omitempty"`
+	Message []byte      `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	// the consensus instance of a CONSENSUS message, 0 for the default instance
+	Channel uint32 `protobuf:"varint,3,opt,name=Channel,proto3" json:"Channel,omitempty"`
+	// the compression of Message in a CONSENSUS message
+	Compression          CompressionType `protobuf:"varint,4,opt,name=Compression,proto3,enum=agent.CompressionType" json:"Compression,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
 }
 
 func (m *Gossip) Reset()         { *m = Gossip{} }
@@ -113,13 +143,29 @@ func (m *Gossip) GetMessage() []byte {
 	return nil
 }
 
+func (m *Gossip) GetChannel() uint32 {
+	if m != nil {
+		return m.Channel
+	}
+	return 0
+}
+
+func (m *Gossip) GetCompression() CompressionType {
+	if m != nil {
+		return m.Compression
+	}
+	return CompressionType_NONE
+}
+
 type KeyAuthInit struct {
 	// client public key
-	X                    []byte   `protobuf:"bytes,1,opt,name=X,proto3" json:"X,omitempty"`
-	Y                    []byte   `protobuf:"bytes,2,opt,name=Y,proto3" json:"Y,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	X []byte `protobuf:"bytes,1,opt,name=X,proto3" json:"X,omitempty"`
+	Y []byte `protobuf:"bytes,2,opt,name=Y,proto3" json:"Y,omitempty"`
+	// the compression the client accepts for consensus messages
+	Compression          CompressionType `protobuf:"varint,3,opt,name=Compression,proto3,enum=agent.CompressionType" json:"Compression,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
 }
 
 func (m *KeyAuthInit) Reset()         { *m = KeyAuthInit{} }
@@ -169,6 +215,13 @@ func (m *KeyAuthInit) GetY() []byte {
 	return nil
 }
 
+func (m *KeyAuthInit) GetCompression() CompressionType {
+	if m != nil {
+		return m.Compression
+	}
+	return CompressionType_NONE
+}
+
 type KeyAuthChallenge struct {
 	// server ephermal publickey for client authentication
 	X []byte `protobuf:"bytes,1,opt,name=X,proto3" json:"X,omitempty"`
@@ -283,6 +336,7 @@ func (m *KeyAuthChallengeReply) GetHMAC() []byte {
 
 func init() {
 	proto.RegisterEnum("agent.CommandType", CommandType_name, CommandType_value)
+	proto.RegisterEnum("agent.CompressionType", CompressionType_name, CompressionType_value)
 	proto.RegisterType((*Gossip)(nil), "agent.Gossip")
 	proto.RegisterType((*KeyAuthInit)(nil), "agent.KeyAuthInit")
 	proto.RegisterType((*KeyAuthChallenge)(nil), "agent.KeyAuthChallenge")
@@ -292,25 +346,30 @@ func init() {
 func init() { proto.RegisterFile("gossip.proto", fileDescriptor_878fa4887b90140c) }
 
 var fileDescriptor_878fa4887b90140c = []byte{
-	// 285 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x91, 0xcd, 0x6a, 0x83, 0x50,
-	0x10, 0x85, 0x7b, 0x63, 0x1a, 0xc9, 0xc4, 0x94, 0xdb, 0x81, 0x16, 0x17, 0x41, 0x82, 0xab, 0xf4,
-	0x07, 0x17, 0xed, 0x13, 0x58, 0x91, 0x28, 0x31, 0x46, 0xd4, 0x40, 0x5c, 0x89, 0xa5, 0x17, 0x13,
-	0x30, 0x2a, 0xd5, 0x2e, 0x7c, 0xc3, 0x2e, 0xfb, 0x08, 0xc5, 0x27, 0x29, 0xbd, 0x98, 0xb4, 0xb4,
-	0x90, 0xdd, 0x9c, 0x8f, 0x6f, 0x0e, 0x0c, 0x03, 0x52, 0x5a, 0x54, 0xd5, 0xae, 0xd4, 0xca, 0xd7,
-	0xa2, 0x2e, 0xf0, 0x3c, 0x49, 0x59, 0x5e, 0xab, 0x1e, 0x0c, 0xe6, 0x1c, 0xe3, 0x3d, 0x88, 0x46,
-	0xb1, 0xdf, 0x27, 0xf9, 0x8b, 0x4c, 0xa6, 0x64, 0x76, 0xf1, 0x80, 0x1a, 0x57, 0xb4, 0x8e, 0x86,
-	0x4d, 0xc9, 0xfc, 0x83, 0x82, 0x32, 0x88, 0x4b, 0x56, 0x55, 0x49, 0xca, 0xe4, 0xde, 0x94, 0xcc,
-	0x24, 0xff, 0x10, 0xd5, 0x1b, 0x18, 0x2d, 0x58, 0xa3, 0xbf, 0xd5, 0x5b, 0x3b, 0xdf, 0xd5, 0x28,
-	0x01, 0xd9, 0xf0, 0x42, 0xc9, 0x27, 0x9b, 0xef, 0x14, 0x75, 0x0b, 0x24, 0x52, 0x1d, 0xa0, 0x9d,
-	0x6a, 0x6c, 0x93, 0x2c, 0x63, 0x79, 0xca, 0x4e, 0xf9, 0x38, 0x81, 0xe1, 0x51, 0x94, 0x05, 0x4e,
-	0x7f, 0x80, 0x7a, 0x07, 0x57, 0x7f, 0xdb, 0x7c, 0x56, 0x66, 0x0d, 0x22, 0xf4, 0xad, 0xa5, 0x6e,
-	0x74, 0xad, 0x7c, 0xbe, 0xcd, 0x61, 0xf4, 0xeb, 0x2e, 0x14, 0x41, 0x70, 0x57, 0x1e, 0x3d, 0xc3,
-	0x4b, 0x18, 0x2f, 0xcc, 0x28, 0xd6, 0xd7, 0xa1, 0x15, 0xdb, 0xae, 0x1d, 0x52, 0x82, 0xd7, 0x80,
-	0x47, 0x64, 0x58, 0xba, 0xe3, 0x98, 0xee, 0xdc, 0xa4, 0x3d, 0x9c, 0x80, 0xfc, 0x9f, 0xc7, 0xbe,
-	0xe9, 0x39, 0x11, 0x15, 0x70, 0x0c, 0x43, 0x63, 0xe5, 0x06, 0xa6, 0x1b, 0xac, 0x03, 0xda, 0x7f,
-	0x92, 0xde, 0x5b, 0x85, 0x7c, 0xb4, 0x0a, 0xf9, 0x6c, 0x15, 0xf2, 0x3c, 0xe0, 0x3f, 0x78, 0xfc,
-	0x0a, 0x00, 0x00, 0xff, 0xff, 0x96, 0x66, 0x6e, 0x1f, 0x93, 0x01, 0x00, 0x00,
+	// 353 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0xc1, 0x6a, 0xf2, 0x40,
+	0x14, 0x85, 0x1d, 0x93, 0x5f, 0x7f, 0xaf, 0xb1, 0x9d, 0x5e, 0xa8, 0x64, 0x21, 0x22, 0x42, 0x41,
+	0x6c, 0x71, 0xd1, 0x6e, 0xba, 0x4d, 0x43, 0xd0, 0x60, 0x8c, 0x12, 0x15, 0x4c, 0x37, 0x92, 0xb6,
+	0x43, 0x14, 0xe2, 0x24, 0x98, 0x74, 0xe1, 0xfb, 0xf4, 0x61, 0xba, 0xec, 0x23, 0x14, 0x9f, 0xa4,
+	0x64, 0x48, 0xb4, 0x58, 0x28, 0xdd, 0xcd, 0x39, 0xf7, 0x70, 0xbf, 0xc3, 0x65, 0x40, 0xf1, 0xc3,
+	0x38, 0x5e, 0x47, 0xbd, 0x68, 0x1b, 0x26, 0x21, 0xfe, 0xf3, 0x7c, 0xc6, 0x93, 0xf6, 0x1b, 0x81,
+	0x52, 0x5f, 0xf8, 0x78, 0x03, 0x65, 0x3d, 0xdc, 0x6c, 0x3c, 0xfe, 0xa2, 0x92, 0x16, 0xe9, 0x9c,
+	0xdd, 0x62, 0x4f, 0x64, 0x7a, 0x99, 0x3b, 0xdb, 0x45, 0xcc, 0xc9, 0x23, 0xa8, 0x42, 0x79, 0xc4,
+	0xe2, 0xd8, 0xf3, 0x99, 0x5a, 0x6c, 0x91, 0x8e, 0xe2, 0xe4, 0x32, 0x9d, 0xe8, 0x2b, 0x8f, 0x73,
+	0x16, 0xa8, 0x52, 0x8b, 0x74, 0x6a, 0x4e, 0x2e, 0xf1, 0x1e, 0xaa, 0x7a, 0xb8, 0x89, 0xb6, 0x2c,
+	0x8e, 0xd7, 0x21, 0x57, 0x65, 0x41, 0xa9, 0x1f, 0x29, 0xf9, 0x44, 0x90, 0xbe, 0x47, 0xdb, 0xcf,
+	0x50, 0x1d, 0xb2, 0x9d, 0xf6, 0x9a, 0xac, 0x4c, 0xbe, 0x4e, 0x50, 0x01, 0xb2, 0x10, 0x25, 0x15,
+	0x87, 0x2c, 0x52, 0xe5, 0x66, 0x25, 0x88, 0x7b, 0x0a, 0x91, 0xfe, 0x0e, 0xb1, 0x80, 0x66, 0x10,
+	0x7d, 0xe5, 0x05, 0x01, 0xe3, 0x3e, 0xfb, 0x95, 0xd4, 0x80, 0xca, 0x21, 0x28, 0x38, 0x8a, 0x73,
+	0x34, 0xda, 0xd7, 0x70, 0x79, 0xba, 0xcd, 0x61, 0x51, 0xb0, 0x43, 0x04, 0x79, 0x30, 0xd2, 0xf4,
+	0x6c, 0xab, 0x78, 0x77, 0x39, 0x54, 0xb3, 0xc3, 0xa6, 0xb5, 0xb0, 0x0c, 0x92, 0x3d, 0x9e, 0xd0,
+	0x02, 0x5e, 0x40, 0x6d, 0x68, 0xb8, 0x4b, 0x6d, 0x3e, 0x1b, 0x2c, 0x4d, 0xdb, 0x9c, 0x51, 0x82,
+	0x75, 0xc0, 0x83, 0xa5, 0x0f, 0x34, 0xcb, 0x32, 0xec, 0xbe, 0x41, 0x8b, 0xd8, 0x00, 0xf5, 0xa7,
+	0xbf, 0x74, 0x8c, 0x89, 0xe5, 0x52, 0x09, 0x6b, 0x50, 0xd1, 0xc7, 0xf6, 0xd4, 0xb0, 0xa7, 0xf3,
+	0x29, 0x95, 0xbb, 0x57, 0x70, 0x7e, 0x72, 0x0a, 0xfc, 0x0f, 0xb2, 0x3d, 0xb6, 0x0d, 0x5a, 0x48,
+	0x5f, 0xfd, 0x47, 0x73, 0x42, 0xc9, 0x83, 0xf2, 0xbe, 0x6f, 0x92, 0x8f, 0x7d, 0x93, 0x7c, 0xee,
+	0x9b, 0xe4, 0xa9, 0x24, 0x7e, 0xce, 0xdd, 0xd7, 0x00, 0xe7, 0x17, 0xa1, 0xff, 0x49, 0x02, 0x00,
+	0x00,
 }
 
 func (m *Gossip) Marshal() (dAtA []byte, err error) {
@@ -337,6 +396,16 @@ func (m *Gossip) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i -= len(m.XXX_unrecognized)
 		copy(dAtA[i:], m.XXX_unrecognized)
 	}
+	if m.Compression != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Compression))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.Channel != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Channel))
+		i--
+		dAtA[i] = 0x18
+	}
 	if len(m.Message) > 0 {
 		i -= len(m.Message)
 		copy(dAtA[i:], m.Message)
@@ -376,6 +445,11 @@ func (m *KeyAuthInit) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i -= len(m.XXX_unrecognized)
 		copy(dAtA[i:], m.XXX_unrecognized)
 	}
+	if m.Compression != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Compression))
+		i--
+		dAtA[i] = 0x18
+	}
 	if len(m.Y) > 0 {
 		i -= len(m.Y)
 		copy(dAtA[i:], m.Y)
@@ -499,6 +573,12 @@ func (m *Gossip) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovGossip(uint64(l))
 	}
+	if m.Channel != 0 {
+		n += 1 + sovGossip(uint64(m.Channel))
+	}
+	if m.Compression != 0 {
+		n += 1 + sovGossip(uint64(m.Compression))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -519,6 +599,9 @@ func (m *KeyAuthInit) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovGossip(uint64(l))
 	}
+	if m.Compression != 0 {
+		n += 1 + sovGossip(uint64(m.Compression))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -653,6 +736,44 @@ func (m *Gossip) Unmarshal(dAtA []byte) error {
 				m.Message = []byte{}
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Channel", wireType)
+			}
+			m.Channel = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Channel |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Compression", wireType)
+			}
+			m.Compression = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Compression |= CompressionType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipGossip(dAtA[iNdEx:])
@@ -775,6 +896,25 @@ func (m *KeyAuthInit) Unmarshal(dAtA []byte) error {
 				m.Y = []byte{}
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Compression", wireType)
+			}
+			m.Compression = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Compression |= CompressionType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipGossip(dAtA[iNdEx:])
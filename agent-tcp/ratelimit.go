@@ -0,0 +1,97 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// tokenBucket is a token-bucket rate limiter, refilled at rate tokens per
+// second up to burst tokens.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full token bucket
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// allow takes one token from the bucket, returns false if the bucket is empty
+func (b *tokenBucket) allow(now time.Time) bool {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// SetRateLimit limits consensus messages from each peer to messagesPerSecond,
+// with bursts up to burst messages, over-limit messages are dropped before
+// reaching the consensus core. A messagesPerSecond of 0 disables the limiter,
+// which is the default. It applies to peers added afterwards.
+func (agent *TCPAgent) SetRateLimit(messagesPerSecond float64, burst int) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.rateLimit = messagesPerSecond
+	agent.rateBurst = burst
+}
+
+// RateLimited returns the number of consensus messages dropped by the rate limiter
+func (agent *TCPAgent) RateLimited() uint64 { return atomic.LoadUint64(&agent.rateLimited) }
+
+// allowConsensusMessage checks the rate limit of this peer
+func (p *TCPPeer) allowConsensusMessage() bool {
+	if p.limiter == nil {
+		return true
+	}
+
+	p.Lock()
+	ok := p.limiter.allow(time.Now())
+	p.Unlock()
+
+	if !ok {
+		atomic.AddUint64(&p.agent.rateLimited, 1)
+	}
+	return ok
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(10, 5, now)
+	for i := 0; i < 5; i++ {
+		assert.True(t, b.allow(now))
+	}
+	assert.False(t, b.allow(now))
+
+	// refilled by 1 token every 100ms
+	now = now.Add(100 * time.Millisecond)
+	assert.True(t, b.allow(now))
+	assert.False(t, b.allow(now))
+
+	// capped at burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 5; i++ {
+		assert.True(t, b.allow(now))
+	}
+	assert.False(t, b.allow(now))
+}
+
+func TestRateLimit(t *testing.T) {
+	agent := NewTCPAgent(nil, nil)
+	defer agent.Close()
+
+	// disabled by default
+	c1, c2 := net.Pipe()
+	p := NewTCPPeer(c1, agent)
+	defer c2.Close()
+	for i := 0; i < 100; i++ {
+		assert.True(t, p.allowConsensusMessage())
+	}
+	assert.Equal(t, uint64(0), agent.RateLimited())
+
+	agent.SetRateLimit(1, 10)
+	c3, c4 := net.Pipe()
+	p = NewTCPPeer(c3, agent)
+	defer c4.Close()
+	for i := 0; i < 10; i++ {
+		assert.True(t, p.allowConsensusMessage())
+	}
+	assert.False(t, p.allowConsensusMessage())
+	assert.False(t, p.allowConsensusMessage())
+	assert.Equal(t, uint64(2), agent.RateLimited())
+}
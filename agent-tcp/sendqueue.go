@@ -0,0 +1,178 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"sync"
+
+	"github.com/Sperax/bdls"
+	proto "github.com/gogo/protobuf/proto"
+)
+
+const (
+	// DefaultSendQueueSize is the default number of outgoing consensus messages queued for a peer
+	DefaultSendQueueSize = 1024
+)
+
+// priorities of outgoing consensus messages, higher first
+const (
+	priorityRoundChange = iota
+	prioritySelect
+	priorityLock
+	priorityCommit
+	priorityDecide
+	numPriorities
+)
+
+// messagePriority returns the sending priority of a consensus message by it's type,
+// undecodable messages have the lowest priority.
+func messagePriority(bts []byte) int {
+	var sp bdls.SignedProto
+	if err := proto.Unmarshal(bts, &sp); err != nil {
+		return priorityRoundChange
+	}
+	var m bdls.Message
+	if err := proto.Unmarshal(sp.Message, &m); err != nil {
+		return priorityRoundChange
+	}
+
+	switch m.Type {
+	case bdls.MessageType_Decide:
+		return priorityDecide
+	case bdls.MessageType_Commit:
+		return priorityCommit
+	case bdls.MessageType_Lock, bdls.MessageType_LockRelease:
+		return priorityLock
+	case bdls.MessageType_Select:
+		return prioritySelect
+	default:
+		return priorityRoundChange
+	}
+}
+
+// priorityCache remembers the priority of the last outgoing consensus message,
+// as a broadcast sends the same buffer to all peers, the message is decoded only
+// once per broadcast rather than once per peer.
+type priorityCache struct {
+	data     *byte // first byte of the last message
+	length   int
+	priority int
+	sync.Mutex
+}
+
+// get returns the priority of the message, from the cache if it's the last one
+func (pc *priorityCache) get(bts []byte) int {
+	if len(bts) == 0 {
+		return messagePriority(bts)
+	}
+
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.data != &bts[0] || pc.length != len(bts) {
+		pc.data = &bts[0]
+		pc.length = len(bts)
+		pc.priority = messagePriority(bts)
+	}
+	return pc.priority
+}
+
+// sendQueue is a bounded priority queue of outgoing consensus messages,
+// FIFO within the same priority. When it's full, the oldest message of
+// the lowest priority is dropped to make room for higher priority ones.
+type sendQueue struct {
+	queues  [numPriorities][]channelMessage
+	depth   int
+	size    int
+	dropped uint64
+}
+
+// push enqueues a message with the priority
+func (q *sendQueue) push(m channelMessage, priority int) {
+	if q.depth >= q.size {
+		lowest := 0
+		for len(q.queues[lowest]) == 0 {
+			lowest++
+		}
+
+		// the new message is dropped if it's the lowest
+		if lowest >= priority {
+			q.dropped++
+			return
+		}
+
+		q.queues[lowest][0] = channelMessage{}
+		q.queues[lowest] = q.queues[lowest][1:]
+		q.depth--
+		q.dropped++
+	}
+
+	q.queues[priority] = append(q.queues[priority], m)
+	q.depth++
+}
+
+// pop dequeues the oldest message of the highest priority
+func (q *sendQueue) pop() (m channelMessage, ok bool) {
+	for i := numPriorities - 1; i >= 0; i-- {
+		if len(q.queues[i]) > 0 {
+			m = q.queues[i][0]
+			q.queues[i][0] = channelMessage{}
+			q.queues[i] = q.queues[i][1:]
+			q.depth--
+			return m, true
+		}
+	}
+	return
+}
+
+// SetSendQueueSize sets the max number of outgoing consensus messages queued
+// for each peer, it applies to peers added afterwards, sizes below 1 are set to 1.
+func (agent *TCPAgent) SetSendQueueSize(size int) {
+	agent.Lock()
+	defer agent.Unlock()
+	if size < 1 {
+		size = 1
+	}
+	agent.sendQueueSize = size
+}
+
+// QueueDepth returns the number of outgoing consensus messages queued for this peer
+func (p *TCPPeer) QueueDepth() int {
+	p.Lock()
+	defer p.Unlock()
+	return p.consensusMessages.depth
+}
+
+// SendDropped returns the number of outgoing consensus messages dropped for this peer
+func (p *TCPPeer) SendDropped() uint64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.consensusMessages.dropped
+}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// createMessage creates a signed consensus message of msgType
+func createMessage(t *testing.T, key *ecdsa.PrivateKey, msgType bdls.MessageType) []byte {
+	var sp bdls.SignedProto
+	sp.Sign(&bdls.Message{Type: msgType, Height: 1}, key)
+	bts, err := proto.Marshal(&sp)
+	assert.Nil(t, err)
+	return bts
+}
+
+func TestSendQueue(t *testing.T) {
+	q := sendQueue{size: 3}
+	q.push(channelMessage{bts: []byte("r1")}, priorityRoundChange)
+	q.push(channelMessage{bts: []byte("r2")}, priorityRoundChange)
+	q.push(channelMessage{bts: []byte("c")}, priorityCommit)
+
+	// full, the oldest round change is dropped for decide
+	q.push(channelMessage{bts: []byte("d")}, priorityDecide)
+	// full, the new round change is dropped
+	q.push(channelMessage{bts: []byte("r3")}, priorityRoundChange)
+	assert.Equal(t, 3, q.depth)
+	assert.Equal(t, uint64(2), q.dropped)
+
+	for _, expected := range []string{"d", "c", "r2"} {
+		m, ok := q.pop()
+		assert.True(t, ok)
+		assert.Equal(t, expected, string(m.bts))
+	}
+	_, ok := q.pop()
+	assert.False(t, ok)
+	assert.Equal(t, 0, q.depth)
+}
+
+func TestSendQueueOrdering(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := NewTCPAgent(nil, key)
+	defer agent.Close()
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	p := NewTCPPeer(c1, agent)
+
+	// saturate the writer, nobody reads the pipe
+	assert.Nil(t, p.Send(createMessage(t, key, bdls.MessageType_Nop)))
+	for p.QueueDepth() > 0 {
+		<-time.After(time.Millisecond)
+	}
+
+	for _, msgType := range []bdls.MessageType{
+		bdls.MessageType_RoundChange,
+		bdls.MessageType_Select,
+		bdls.MessageType_Lock,
+		bdls.MessageType_Commit,
+		bdls.MessageType_Decide,
+	} {
+		assert.Nil(t, p.Send(createMessage(t, key, msgType)))
+	}
+	assert.Equal(t, 5, p.QueueDepth())
+
+	expected := []bdls.MessageType{
+		bdls.MessageType_Nop,
+		bdls.MessageType_Decide,
+		bdls.MessageType_Commit,
+		bdls.MessageType_Lock,
+		bdls.MessageType_Select,
+		bdls.MessageType_RoundChange,
+	}
+	msgLength := make([]byte, MessageLength)
+	for _, msgType := range expected {
+		_, err := io.ReadFull(c2, msgLength)
+		assert.Nil(t, err)
+		bts := make([]byte, binary.LittleEndian.Uint32(msgLength))
+		_, err = io.ReadFull(c2, bts)
+		assert.Nil(t, err)
+
+		var g Gossip
+		assert.Nil(t, proto.Unmarshal(bts, &g))
+		var sp bdls.SignedProto
+		assert.Nil(t, proto.Unmarshal(g.Message, &sp))
+		var m bdls.Message
+		assert.Nil(t, proto.Unmarshal(sp.Message, &m))
+		assert.Equal(t, msgType, m.Type)
+	}
+	assert.Equal(t, uint64(0), p.SendDropped())
+}
+
+func TestSendQueueSize(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := NewTCPAgent(nil, key)
+	defer agent.Close()
+
+	// sizes below 1 are set to 1
+	agent.SetSendQueueSize(0)
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	p := NewTCPPeer(c1, agent)
+	assert.Equal(t, 1, p.consensusMessages.size)
+
+	p.Lock()
+	p.consensusMessages.push(channelMessage{bts: []byte("r")}, priorityRoundChange)
+	p.consensusMessages.push(channelMessage{bts: []byte("d")}, priorityDecide)
+	assert.Equal(t, 1, p.consensusMessages.depth)
+	assert.Equal(t, uint64(1), p.consensusMessages.dropped)
+	p.Unlock()
+}
+
+func TestPriorityCache(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	var pc priorityCache
+	decide := createMessage(t, key, bdls.MessageType_Decide)
+	assert.Equal(t, priorityDecide, pc.get(decide))
+	// the same buffer of a broadcast is not decoded again
+	pc.priority = priorityLock
+	assert.Equal(t, priorityLock, pc.get(decide))
+
+	// a different buffer is decoded
+	assert.Equal(t, priorityDecide, pc.get(append([]byte{}, decide...)))
+	assert.Equal(t, priorityCommit, pc.get(createMessage(t, key, bdls.MessageType_Commit)))
+	assert.Equal(t, priorityRoundChange, pc.get(nil))
+}
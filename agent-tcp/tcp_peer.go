@@ -31,9 +31,12 @@
 package agent
 
 import (
+	"bytes"
+	"compress/gzip"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/subtle"
+	"crypto/tls"
 	"encoding/binary"
 	fmt "fmt"
 	io "io"
@@ -57,10 +60,16 @@ const (
 
 	// Message max length(32MB)
 	MaxMessageLength = 32 * 1024 * 1024
+	// Default max length of incoming messages(4MB)
+	DefaultMaxMessageSize = 4 * 1024 * 1024
 
 	// timeout for a unresponsive connection
 	defaultReadTimeout  = 60 * time.Second
 	defaultWriteTimeout = 60 * time.Second
+	// timeout to flush pending messages while closing
+	defaultDrainTimeout = 5 * time.Second
+	// timeout for a peer to authenticate it's public key
+	defaultAuthTimeout = 10 * time.Second
 
 	// challengeSize
 	challengeSize = 1024
@@ -93,15 +102,39 @@ const (
 
 // A TCPAgent binds consensus core to a TCPAgent object, which may have multiple TCPPeer
 type TCPAgent struct {
-	consensus           *bdls.Consensus   // the consensus core
-	privateKey          *ecdsa.PrivateKey // a private key to sign messages
-	peers               []*TCPPeer        // connected peers
-	consensusMessages   [][]byte          // all consensus message awaiting to be processed
-	chConsensusMessages chan struct{}     // notification of new consensus message
+	consensus           *bdls.Consensus            // the consensus core
+	privateKey          *ecdsa.PrivateKey          // a private key to sign messages
+	peers               []*TCPPeer                 // connected peers
+	channels            map[uint32]*bdls.Consensus // consensus instances registered on channels
+	consensusMessages   []channelMessage           // all consensus message awaiting to be processed
+	chConsensusMessages chan struct{}              // notification of new consensus message
+	pendingBytes        int                        // total bytes of consensusMessages
+	maxPendingBytes     int                        // max pendingBytes before peers stop reading, 0 to disable
+	chDrained           chan struct{}              // closed when consensusMessages drained, nil if nobody waits
+
+	tlsConfig    *tls.Config      // TLS config for NewTLSPeer
+	certIdentity CertIdentityFunc // maps peer certificates to participant identities
+
+	rateLimit   float64 // consensus messages per second from each peer, 0 to disable
+	rateBurst   int     // burst of consensus messages from each peer
+	rateLimited uint64  // number of messages dropped by rate limiter, accessed atomically
+
+	dedup      *dedupCache // recently seen consensus messages, nil if disabled
+	duplicates uint64      // number of messages dropped as duplicates
+
+	maxMessageSize uint32 // max length of incoming messages
+	sendQueueSize  int    // max number of outgoing consensus messages queued for each peer
+
+	priorities priorityCache // priority of the last outgoing consensus message
+
+	compression          CompressionType // compression of outgoing consensus messages, NONE to disable
+	compressionThreshold int             // min length of consensus messages to be compressed
+
+	listeners []net.Listener // listeners accepting connections by Serve
+	wg        sync.WaitGroup // all goroutines of this agent and it's peers
 
 	die        chan struct{} // tcp agent closing
-	dieOnce    sync.Once
-	sync.Mutex // fields lock
+	sync.Mutex               // fields lock
 }
 
 // NewTCPAgent initiate a TCPAgent which talks consensus protocol with peers
@@ -111,10 +144,85 @@ func NewTCPAgent(consensus *bdls.Consensus, privateKey *ecdsa.PrivateKey) *TCPAg
 	agent.privateKey = privateKey
 	agent.die = make(chan struct{})
 	agent.chConsensusMessages = make(chan struct{}, 1)
+	agent.dedup = newDedupCache(DefaultDedupSize, DefaultDedupTTL)
+	agent.maxMessageSize = DefaultMaxMessageSize
+	agent.sendQueueSize = DefaultSendQueueSize
+	agent.maxPendingBytes = DefaultMaxPendingBytes
+	agent.wg.Add(1)
 	go agent.inputConsensusMessage()
 	return agent
 }
 
+// Serve accepts incoming connections on the listener, creates TCPPeers on
+// them and initiates public key authentication, TLS is used if the agent
+// has been configured by SetTLSConfig, handshakes run in their own goroutines
+// and are aborted when the agent closes. Serve blocks until the listener fails
+// or the agent is closed.
+func (agent *TCPAgent) Serve(l net.Listener) error {
+	agent.Lock()
+	select {
+	case <-agent.die:
+		agent.Unlock()
+		return ErrAgentClosed
+	default:
+		agent.listeners = append(agent.listeners, l)
+		agent.wg.Add(1)
+		defer agent.wg.Done()
+	}
+	useTLS := agent.tlsConfig != nil
+	agent.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-agent.die:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		// handshakes run concurrently, so a slow or silent client
+		// can't stall accepting of others.
+		agent.wg.Add(1)
+		go agent.accept(conn, useTLS)
+	}
+}
+
+// accept creates a TCPPeer on an accepted connection, with the TLS handshake
+// if useTLS is set, and initiates public key authentication.
+func (agent *TCPAgent) accept(conn net.Conn, useTLS bool) {
+	defer agent.wg.Done()
+
+	var p *TCPPeer
+	if useTLS {
+		// abort the handshake if the agent closes
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-agent.die:
+				conn.Close()
+			case <-done:
+			}
+		}()
+
+		var err error
+		p, err = NewTLSPeer(conn, agent, false)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	} else {
+		p = NewTCPPeer(conn, agent)
+	}
+
+	if agent.AddPeer(p) {
+		p.InitiatePublicKeyAuthentication()
+	}
+}
+
 // AddPeer adds a peer to this agent
 func (agent *TCPAgent) AddPeer(p *TCPPeer) bool {
 	agent.Lock()
@@ -125,6 +233,9 @@ func (agent *TCPAgent) AddPeer(p *TCPPeer) bool {
 		return false
 	default:
 		agent.peers = append(agent.peers, p)
+		for channel, consensus := range agent.channels {
+			consensus.Join(&channelPeer{p, channel})
+		}
 		return agent.consensus.Join(p)
 	}
 }
@@ -139,24 +250,73 @@ func (agent *TCPAgent) RemovePeer(p *TCPPeer) bool {
 		if agent.peers[k].RemoteAddr().String() == peerAddress {
 			copy(agent.peers[k:], agent.peers[k+1:])
 			agent.peers = agent.peers[:len(agent.peers)-1]
+			for _, consensus := range agent.channels {
+				consensus.Leave(p.RemoteAddr())
+			}
 			return agent.consensus.Leave(p.RemoteAddr())
 		}
 	}
 	return false
 }
 
-// Close stops all activities on this agent
-func (agent *TCPAgent) Close() {
+// isParticipant checks if the public key belongs to a participant of consensus
+func (agent *TCPAgent) isParticipant(pubkey *ecdsa.PublicKey) bool {
 	agent.Lock()
 	defer agent.Unlock()
+	_, ok := agent.consensus.IsParticipantKey(pubkey)
+	return ok
+}
 
-	agent.dieOnce.Do(func() {
-		close(agent.die)
-		// close all peers
-		for k := range agent.peers {
-			agent.peers[k].Close()
-		}
-	})
+// isParticipantIdentity checks if the public key belongs to the participant
+// of the identity in consensus
+func (agent *TCPAgent) isParticipantIdentity(pubkey *ecdsa.PublicKey, identity bdls.Identity) bool {
+	agent.Lock()
+	defer agent.Unlock()
+	keyIndex, ok := agent.consensus.IsParticipantKey(pubkey)
+	if !ok {
+		return false
+	}
+	index, ok := agent.consensus.HasParticipant(identity)
+	return ok && index == keyIndex
+}
+
+// SetMaxMessageSize sets the max length of incoming messages, connections
+// declaring a longer message are closed before the message is read.
+// It applies to peers added afterwards, and can't exceed MaxMessageLength,
+// sizes below 1 restore DefaultMaxMessageSize.
+func (agent *TCPAgent) SetMaxMessageSize(size int) {
+	agent.Lock()
+	defer agent.Unlock()
+	if size > MaxMessageLength {
+		size = MaxMessageLength
+	}
+	if size < 1 {
+		size = DefaultMaxMessageSize
+	}
+	agent.maxMessageSize = uint32(size)
+}
+
+// Close stops accepting connections, closes all peers after draining their
+// pending consensus messages, and returns once all goroutines of this agent
+// have exited. Closing a closed agent returns ErrAgentClosed.
+func (agent *TCPAgent) Close() error {
+	agent.Lock()
+	select {
+	case <-agent.die:
+		agent.Unlock()
+		return ErrAgentClosed
+	default:
+	}
+
+	// peers will drain and close themselves on this signal
+	close(agent.die)
+	for k := range agent.listeners {
+		agent.listeners[k].Close()
+	}
+	agent.Unlock()
+
+	agent.wg.Wait()
+	return nil
 }
 
 // Update is the consensus updater
@@ -169,15 +329,19 @@ func (agent *TCPAgent) Update() {
 	default:
 		// call consensus update
 		agent.consensus.Update(time.Now())
+		for _, consensus := range agent.channels {
+			consensus.Update(time.Now())
+		}
 		timer.SystemTimedSched.Put(agent.Update, time.Now().Add(20*time.Millisecond))
 	}
 }
 
-// Propose a state, awaiting to be finalized at next height.
-func (agent *TCPAgent) Propose(s bdls.State) {
+// Propose a state, awaiting to be finalized at next height, errors of
+// Consensus.Propose are returned.
+func (agent *TCPAgent) Propose(s bdls.State) error {
 	agent.Lock()
 	defer agent.Unlock()
-	agent.consensus.Propose(s)
+	return agent.consensus.Propose(s)
 }
 
 // GetLatestState returns latest state
@@ -187,11 +351,16 @@ func (agent *TCPAgent) GetLatestState() (height uint64, round uint64, data bdls.
 	return agent.consensus.CurrentState()
 }
 
-// handleConsensusMessage will be called if TCPPeer received a consensus message
-func (agent *TCPAgent) handleConsensusMessage(bts []byte) {
+// handleConsensusMessage will be called if TCPPeer received a consensus message on a channel
+func (agent *TCPAgent) handleConsensusMessage(channel uint32, bts []byte) {
 	agent.Lock()
 	defer agent.Unlock()
-	agent.consensusMessages = append(agent.consensusMessages, bts)
+	if agent.dedup != nil && agent.dedup.seen(messageHash(channel, bts), time.Now()) {
+		agent.duplicates++
+		return
+	}
+	agent.consensusMessages = append(agent.consensusMessages, channelMessage{channel, bts})
+	agent.pendingBytes += len(bts)
 	agent.notifyConsensus()
 }
 
@@ -204,15 +373,30 @@ func (agent *TCPAgent) notifyConsensus() {
 
 // consensus message receiver
 func (agent *TCPAgent) inputConsensusMessage() {
+	defer agent.wg.Done()
 	for {
 		select {
 		case <-agent.chConsensusMessages:
 			agent.Lock()
-			msgs := agent.consensusMessages
-			agent.consensusMessages = nil
+			msgs := agent.takeConsensusMessages()
 
+			// group messages by channel in arrival order, each
+			// consensus instance verifies its batch in parallel.
+			var channels []uint32
+			batches := make(map[uint32][][]byte)
 			for _, msg := range msgs {
-				agent.consensus.ReceiveMessage(msg, time.Now())
+				if _, ok := batches[msg.channel]; !ok {
+					channels = append(channels, msg.channel)
+				}
+				batches[msg.channel] = append(batches[msg.channel], msg.bts)
+			}
+
+			for _, channel := range channels {
+				if channel == 0 {
+					agent.consensus.ReceiveMessages(batches[channel], time.Now())
+				} else if consensus, ok := agent.channels[channel]; ok {
+					consensus.ReceiveMessages(batches[channel], time.Now())
+				}
 			}
 			agent.Unlock()
 		case <-agent.die:
@@ -234,6 +418,9 @@ type TCPPeer struct {
 	peerAuthStatus authenticationState // peer authentication status
 	// the announced public key of the peer, only becomes valid if peerAuthStatus == peerAuthenticated
 	peerPublicKey *ecdsa.PublicKey
+	// the identity of the peer's TLS certificate if checked, the public key
+	// announced by the peer must be of this identity
+	certIdentity *bdls.Identity
 
 	// local authentication status
 	localAuthState authenticationState
@@ -241,8 +428,25 @@ type TCPPeer struct {
 	// the HMAC of the challenge text if peer has requested key authentication
 	hmac []byte
 
+	// rate limiter for incoming consensus messages, nil if disabled
+	limiter *tokenBucket
+
+	// max length of incoming messages
+	maxMessageSize uint32
+
+	// the compression enabled locally, and the one announced by the peer,
+	// consensus messages are compressed only if they match
+	compression          CompressionType
+	peerCompression      CompressionType
+	compressionThreshold int
+	gzipWriter           *gzip.Writer // reused by sendLoop
+	compressBuffer       bytes.Buffer // reused by sendLoop
+
+	// closes the connection if the peer has not authenticated in time
+	authTimer *time.Timer
+
 	// message queues and their notifications
-	consensusMessages  [][]byte      // all pending outgoing consensus messages to this peer
+	consensusMessages  sendQueue     // all pending outgoing consensus messages to this peer
 	chConsensusMessage chan struct{} // notification on new consensus data
 
 	// agent messages
@@ -259,13 +463,48 @@ type TCPPeer struct {
 
 // NewTCPPeer creates a TCPPeer with protocol over this connection
 func NewTCPPeer(conn net.Conn, agent *TCPAgent) *TCPPeer {
+	return newTCPPeer(conn, agent, nil)
+}
+
+// newTCPPeer creates a TCPPeer whose public key must be of certIdentity if
+// it's not nil
+func newTCPPeer(conn net.Conn, agent *TCPAgent, certIdentity *bdls.Identity) *TCPPeer {
 	p := new(TCPPeer)
+	p.certIdentity = certIdentity
 	p.chConsensusMessage = make(chan struct{}, 1)
 	p.chAgentMessage = make(chan struct{}, 1)
 	p.conn = conn
 	p.agent = agent
 	p.die = make(chan struct{})
+
+	agent.Lock()
+	defer agent.Unlock()
+	select {
+	case <-agent.die:
+		// closed agent accepts no connections
+		conn.Close()
+		close(p.die)
+		return p
+	default:
+	}
+
+	if agent.rateLimit > 0 {
+		p.limiter = newTokenBucket(agent.rateLimit, agent.rateBurst, time.Now())
+	}
+	p.maxMessageSize = agent.maxMessageSize
+	p.compression = agent.compression
+	p.compressionThreshold = agent.compressionThreshold
+	p.consensusMessages.size = agent.sendQueueSize
+
+	p.authTimer = time.AfterFunc(defaultAuthTimeout, func() {
+		if p.GetPublicKey() == nil {
+			log.Println(ErrPeerNotAuthenticated)
+			p.Close()
+		}
+	})
+
 	// we start readLoop & sendLoop for each connection
+	agent.wg.Add(2)
 	go p.readLoop()
 	go p.sendLoop()
 	return p
@@ -291,11 +530,22 @@ func (p *TCPPeer) RemoteAddr() net.Addr {
 	return p.conn.RemoteAddr()
 }
 
-// Send implements PeerInterface, to send message to this peer
-func (p *TCPPeer) Send(out []byte) error {
+// Send implements PeerInterface, to send message to this peer,
+// returns ErrAgentClosed if the agent has closed.
+func (p *TCPPeer) Send(out []byte) error { return p.send(0, out) }
+
+// send a consensus message on the channel to this peer
+func (p *TCPPeer) send(channel uint32, out []byte) error {
+	select {
+	case <-p.agent.die:
+		return ErrAgentClosed
+	default:
+	}
+
+	priority := p.agent.priorities.get(out)
 	p.Lock()
 	defer p.Unlock()
-	p.consensusMessages = append(p.consensusMessages, out)
+	p.consensusMessages.push(channelMessage{channel, out}, priority)
 	p.notifyConsensusMessage()
 	return nil
 }
@@ -321,8 +571,23 @@ func (p *TCPPeer) Close() {
 	p.dieOnce.Do(func() {
 		p.conn.Close()
 		close(p.die)
+		if p.authTimer != nil {
+			p.authTimer.Stop()
+		}
 	})
-	go p.agent.RemovePeer(p)
+
+	p.agent.Lock()
+	defer p.agent.Unlock()
+	select {
+	case <-p.agent.die:
+		// peers are dropped along with the closing agent
+	default:
+		p.agent.wg.Add(1)
+		go func() {
+			defer p.agent.wg.Done()
+			p.agent.RemovePeer(p)
+		}()
+	}
 }
 
 // InitiatePublicKeyAuthentication will initate a procedure to convince
@@ -334,6 +599,7 @@ func (p *TCPPeer) InitiatePublicKeyAuthentication() error {
 		auth := KeyAuthInit{}
 		auth.X = p.agent.privateKey.PublicKey.X.Bytes()
 		auth.Y = p.agent.privateKey.PublicKey.Y.Bytes()
+		auth.Compression = p.compression
 
 		// proto marshal
 		bts, err := proto.Marshal(&auth)
@@ -370,6 +636,16 @@ func (p *TCPPeer) handleGossip(msg *Gossip) error {
 			return err
 		}
 
+		// only participants can authenticate, checked before locking
+		// the peer to keep the agent->peer lock order
+		peerPublicKey := &ecdsa.PublicKey{Curve: bdls.S256Curve, X: big.NewInt(0).SetBytes(m.X), Y: big.NewInt(0).SetBytes(m.Y)}
+		if !p.agent.isParticipant(peerPublicKey) {
+			return ErrPeerNotParticipant
+		}
+		if p.certIdentity != nil && !p.agent.isParticipantIdentity(peerPublicKey, *p.certIdentity) {
+			return ErrTLSIdentityMismatch
+		}
+
 		err = p.handleKeyAuthInit(&m)
 		if err != nil {
 			return err
@@ -401,8 +677,15 @@ func (p *TCPPeer) handleGossip(msg *Gossip) error {
 		}
 
 	case CommandType_CONSENSUS:
-		// received a consensus message from this peer
-		p.agent.handleConsensusMessage(msg.Message)
+		// received a consensus message from this peer, messages
+		// from unauthenticated peers are dropped
+		if p.GetPublicKey() != nil && p.allowConsensusMessage() {
+			bts, err := p.decompress(msg.Compression, msg.Message)
+			if err != nil {
+				return err
+			}
+			p.agent.handleConsensusMessage(msg.Channel, bts)
+		}
 	default:
 		panic(msg)
 	}
@@ -425,6 +708,7 @@ func (p *TCPPeer) handleKeyAuthInit(authKey *KeyAuthInit) error {
 		}
 		// temporarily stored announced key
 		p.peerPublicKey = peerPublicKey
+		p.peerCompression = authKey.Compression
 
 		// create ephermal key for authentication
 		ephemeral, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
@@ -541,6 +825,7 @@ func (p *TCPPeer) handleKeyAuthChallengeReply(response *KeyAuthChallengeReply) e
 
 // readLoop keeps reading messages from peer
 func (p *TCPPeer) readLoop() {
+	defer p.agent.wg.Done()
 	defer p.Close()
 	msgLength := make([]byte, MessageLength)
 
@@ -549,6 +834,11 @@ func (p *TCPPeer) readLoop() {
 		case <-p.die:
 			return
 		default:
+			// stop reading while the consensus core is saturated
+			if !p.waitDrained() {
+				return
+			}
+
 			// read message size
 			p.conn.SetReadDeadline(time.Now().Add(defaultReadTimeout))
 			_, err := io.ReadFull(p.conn, msgLength)
@@ -556,10 +846,10 @@ func (p *TCPPeer) readLoop() {
 				return
 			}
 
-			// check length
+			// check length before allocation
 			length := binary.LittleEndian.Uint32(msgLength)
-			if length > MaxMessageLength {
-				log.Println(err)
+			if length > p.maxMessageSize {
+				log.Println(ErrMessageLengthExceed, length)
 				return
 			}
 
@@ -595,49 +885,25 @@ func (p *TCPPeer) readLoop() {
 
 // sendLoop keeps sending consensus message to this peer
 func (p *TCPPeer) sendLoop() {
+	defer p.agent.wg.Done()
 	defer p.Close()
 
 	var pending [][]byte
-	var msg Gossip
-	msg.Command = CommandType_CONSENSUS
 	msgLength := make([]byte, MessageLength)
 
 	for {
 		select {
 		case <-p.chConsensusMessage:
-			p.Lock()
-			pending = p.consensusMessages
-			p.consensusMessages = nil
-			p.Unlock()
-
-			for _, bts := range pending {
-				// we need to encapsulate consensus messages
-				msg.Message = bts
-				out, err := proto.Marshal(&msg)
-				if err != nil {
-					panic(err)
-				}
-
-				if len(out) > MaxMessageLength {
-					panic("maximum message size exceeded")
-				}
-
-				binary.LittleEndian.PutUint32(msgLength, uint32(len(out)))
-				p.conn.SetWriteDeadline(time.Now().Add(defaultWriteTimeout))
-				// write length
-				_, err = p.conn.Write(msgLength)
-				if err != nil {
-					log.Println(err)
-					return
-				}
-
-				// write message
-				_, err = p.conn.Write(out)
-				if err != nil {
-					log.Println(err)
-					return
-				}
+			if err := p.sendConsensusMessages(defaultWriteTimeout); err != nil {
+				log.Println(err)
+				return
 			}
+		case <-p.agent.die:
+			// flush pending consensus messages before closing
+			if err := p.sendConsensusMessages(defaultDrainTimeout); err != nil {
+				log.Println(err)
+			}
+			return
 		case <-p.chAgentMessage:
 			p.Lock()
 			pending = p.agentMessages
@@ -666,3 +932,46 @@ func (p *TCPPeer) sendLoop() {
 		}
 	}
 }
+
+// sendConsensusMessages writes all pending consensus messages to the connection
+func (p *TCPPeer) sendConsensusMessages(timeout time.Duration) error {
+	var msg Gossip
+	msg.Command = CommandType_CONSENSUS
+	msgLength := make([]byte, MessageLength)
+	for {
+		// messages are dequeued one by one, so higher priority
+		// messages arrived during writing can preempt
+		p.Lock()
+		m, ok := p.consensusMessages.pop()
+		p.Unlock()
+		if !ok {
+			return nil
+		}
+
+		// we need to encapsulate consensus messages
+		msg.Message, msg.Compression = p.compress(m.bts)
+		msg.Channel = m.channel
+		out, err := proto.Marshal(&msg)
+		if err != nil {
+			panic(err)
+		}
+
+		if len(out) > MaxMessageLength {
+			panic("maximum message size exceeded")
+		}
+
+		binary.LittleEndian.PutUint32(msgLength, uint32(len(out)))
+		p.conn.SetWriteDeadline(time.Now().Add(timeout))
+		// write length
+		_, err = p.conn.Write(msgLength)
+		if err != nil {
+			return err
+		}
+
+		// write message
+		_, err = p.conn.Write(out)
+		if err != nil {
+			return err
+		}
+	}
+}
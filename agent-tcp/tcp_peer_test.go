@@ -11,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -18,6 +19,7 @@ import (
 	"github.com/Sperax/bdls"
 	"github.com/Sperax/bdls/crypto/blake2b"
 	"github.com/davecgh/go-spew/spew"
+	proto "github.com/gogo/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -216,3 +218,160 @@ func testConsensus(t *testing.T, param *testParam) {
 
 	t.Logf("consensus stopped at height:%v for %v peers %v participants", param.stopHeight, param.numPeers, param.numParticipants)
 }
+
+func TestTCPAgentClose(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	agents := make([]*TCPAgent, 2)
+	for i := range agents {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = participants[i]
+		config.Participants = coords
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		agents[i] = NewTCPAgent(consensus, participants[i])
+	}
+
+	// agent 0 accepts, agent 1 connects
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	served := make(chan error)
+	go func() { served <- agents[0].Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	p := NewTCPPeer(conn, agents[1])
+	assert.True(t, agents[1].AddPeer(p))
+	assert.Nil(t, p.InitiatePublicKeyAuthentication())
+
+	for p.GetPublicKey() == nil {
+		<-time.After(10 * time.Millisecond)
+	}
+	assert.Nil(t, p.Send([]byte("in-flight")))
+
+	assert.Nil(t, agents[0].Close())
+	assert.Nil(t, <-served)
+	assert.Nil(t, agents[1].Close())
+
+	// subsequent operations
+	assert.Equal(t, ErrAgentClosed, p.Send([]byte("message")))
+	assert.Equal(t, ErrAgentClosed, agents[1].Close())
+	assert.Equal(t, ErrAgentClosed, agents[0].Serve(l))
+	assert.False(t, agents[1].AddPeer(p))
+
+	// no goroutine leak
+	for i := 0; i < 100 && runtime.NumGoroutine() > baseline; i++ {
+		<-time.After(10 * time.Millisecond)
+	}
+	assert.Equal(t, baseline, runtime.NumGoroutine())
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	agent := NewTCPAgent(nil, nil)
+	defer agent.Close()
+
+	// dropped returns true if the connection has been closed by the peer
+	dropped := func(conn net.Conn) bool {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err := conn.Read(make([]byte, 1))
+		return err == io.EOF
+	}
+
+	// declared 1GB message
+	c1, c2 := net.Pipe()
+	NewTCPPeer(c1, agent)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	msgLength := make([]byte, MessageLength)
+	binary.LittleEndian.PutUint32(msgLength, 1<<30)
+	_, err := c2.Write(msgLength)
+	assert.Nil(t, err)
+	assert.True(t, dropped(c2))
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(DefaultMaxMessageSize))
+
+	// configured limit
+	agent.SetMaxMessageSize(16)
+	c3, c4 := net.Pipe()
+	NewTCPPeer(c3, agent)
+	binary.LittleEndian.PutUint32(msgLength, 17)
+	_, err = c4.Write(msgLength)
+	assert.Nil(t, err)
+	assert.True(t, dropped(c4))
+
+	// sizes below 1 restore the default
+	agent.SetMaxMessageSize(0)
+	assert.Equal(t, uint32(DefaultMaxMessageSize), agent.maxMessageSize)
+	agent.SetMaxMessageSize(-1)
+	assert.Equal(t, uint32(DefaultMaxMessageSize), agent.maxMessageSize)
+	agent.SetMaxMessageSize(MaxMessageLength + 1)
+	assert.Equal(t, uint32(MaxMessageLength), agent.maxMessageSize)
+}
+
+func TestPeerAuthentication(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = participants[0]
+	config.Participants = coords
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	agent := NewTCPAgent(consensus, participants[0])
+	defer agent.Close()
+
+	// write a frame to conn
+	writeGossip := func(conn net.Conn, g *Gossip) {
+		out, err := proto.Marshal(g)
+		assert.Nil(t, err)
+		msgLength := make([]byte, MessageLength)
+		binary.LittleEndian.PutUint32(msgLength, uint32(len(out)))
+		_, err = conn.Write(append(msgLength, out...))
+		assert.Nil(t, err)
+	}
+
+	// consensus messages from unauthenticated peer are dropped
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	p := NewTCPPeer(c1, agent)
+	assert.True(t, agent.AddPeer(p))
+	// the agent would count the second one as duplicate if they were not dropped
+	writeGossip(c2, &Gossip{Command: CommandType_CONSENSUS, Message: []byte("message")})
+	writeGossip(c2, &Gossip{Command: CommandType_CONSENSUS, Message: []byte("message")})
+	<-time.After(100 * time.Millisecond)
+	assert.Equal(t, uint64(0), agent.Duplicates())
+
+	// non-participant is dropped on authentication
+	outsider, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	c3, c4 := net.Pipe()
+	NewTCPPeer(c3, agent)
+	bts, err := proto.Marshal(&KeyAuthInit{X: outsider.PublicKey.X.Bytes(), Y: outsider.PublicKey.Y.Bytes()})
+	assert.Nil(t, err)
+	writeGossip(c4, &Gossip{Command: CommandType_KEY_AUTH_INIT, Message: bts})
+	c4.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = c4.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,119 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"github.com/Sperax/bdls"
+)
+
+const (
+	// timeout for TLS handshake
+	defaultHandshakeTimeout = 10 * time.Second
+)
+
+// CertIdentityFunc maps a verified peer certificate to a participant identity
+type CertIdentityFunc func(cert *x509.Certificate) (bdls.Identity, error)
+
+// SetTLSConfig sets the TLS config for connections wrapped by NewTLSPeer.
+//
+// For mutual TLS, config.ClientAuth should be set to tls.RequireAndVerifyClientCert,
+// and certIdentity must be provided to map peer certificates to participant identities,
+// connections whose certificate identity is not a participant, or whose
+// peer announces a public key of another identity in key authentication,
+// will be dropped.
+// A nil certIdentity disables the identity check.
+func (agent *TCPAgent) SetTLSConfig(config *tls.Config, certIdentity CertIdentityFunc) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.tlsConfig = config
+	agent.certIdentity = certIdentity
+}
+
+// NewTLSPeer wraps conn with TLS as client or server, and creates a TCPPeer
+// with protocol over the secured connection once the handshake and the
+// identity check have completed, conn will be closed on failure.
+func NewTLSPeer(conn net.Conn, agent *TCPAgent, client bool) (*TCPPeer, error) {
+	agent.Lock()
+	config := agent.tlsConfig
+	certIdentity := agent.certIdentity
+	agent.Unlock()
+
+	if config == nil {
+		conn.Close()
+		return nil, ErrTLSNotConfigured
+	}
+
+	var tlsConn *tls.Conn
+	if client {
+		tlsConn = tls.Client(conn, config)
+	} else {
+		tlsConn = tls.Server(conn, config)
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(defaultHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	var identity *bdls.Identity
+	if certIdentity != nil {
+		certs := tlsConn.ConnectionState().PeerCertificates
+		if len(certs) == 0 {
+			tlsConn.Close()
+			return nil, ErrTLSNoPeerCertificate
+		}
+
+		id, err := certIdentity(certs[0])
+		if err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+
+		agent.Lock()
+		_, ok := agent.consensus.HasParticipant(id)
+		agent.Unlock()
+		if !ok {
+			tlsConn.Close()
+			return nil, ErrTLSUnknownIdentity
+		}
+		identity = &id
+	}
+
+	// the public key authenticated later must be of the certificate identity
+	return newTCPPeer(tlsConn, agent, identity), nil
+}
@@ -0,0 +1,246 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/stretchr/testify/assert"
+)
+
+// createSelfSignedCert creates a self-signed certificate with the hex encoded identity as common name
+func createSelfSignedCert(t *testing.T, identity bdls.Identity) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: hex.EncodeToString(identity[:])},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+// certIdentity decodes the identity from the common name
+func certIdentity(cert *x509.Certificate) (identity bdls.Identity, err error) {
+	bts, err := hex.DecodeString(cert.Subject.CommonName)
+	if err != nil {
+		return identity, err
+	}
+	copy(identity[:], bts)
+	return identity, nil
+}
+
+func TestTLSPeer(t *testing.T) {
+	const numPeers = 4
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < numPeers; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	// certificates for all participants, and a rogue one
+	pool := x509.NewCertPool()
+	var certs []tls.Certificate
+	for i := 0; i < numPeers; i++ {
+		cert := createSelfSignedCert(t, coords[i])
+		pool.AddCert(cert.Leaf)
+		certs = append(certs, cert)
+	}
+	rogueKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	rogue := createSelfSignedCert(t, bdls.DefaultPubKeyToIdentity(&rogueKey.PublicKey))
+	pool.AddCert(rogue.Leaf)
+
+	tlsConfig := func(cert tls.Certificate) *tls.Config {
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ServerName:   "127.0.0.1",
+		}
+	}
+
+	epoch := time.Now()
+	agents := make([]*TCPAgent, numPeers)
+	listeners := make([]net.Listener, numPeers)
+	for i := 0; i < numPeers; i++ {
+		config := new(bdls.Config)
+		config.Epoch = epoch
+		config.PrivateKey = participants[i]
+		config.Participants = coords
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(100 * time.Millisecond)
+		agents[i] = NewTCPAgent(consensus, participants[i])
+		agents[i].SetTLSConfig(tlsConfig(certs[i]), certIdentity)
+
+		listeners[i], err = net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer listeners[i].Close()
+	}
+
+	// accept connections
+	serverErrs := make(chan error, numPeers*numPeers)
+	for i := 0; i < numPeers; i++ {
+		go func(i int) {
+			for {
+				conn, err := listeners[i].Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					p, err := NewTLSPeer(conn, agents[i], false)
+					serverErrs <- err
+					if err == nil {
+						agents[i].AddPeer(p)
+						p.InitiatePublicKeyAuthentication()
+					}
+				}()
+			}
+		}(i)
+	}
+
+	// rogue connection with a trusted certificate whose identity is not a participant
+	conn, err := net.Dial("tcp", listeners[0].Addr().String())
+	assert.Nil(t, err)
+	rogueConn := tls.Client(conn, &tls.Config{Certificates: []tls.Certificate{rogue}, RootCAs: pool, ServerName: "127.0.0.1"})
+	assert.Nil(t, rogueConn.Handshake())
+	assert.Equal(t, ErrTLSUnknownIdentity, <-serverErrs)
+	rogueConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = rogueConn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	rogueConn.Close()
+
+	// impostor presenting the certificate of a participant, while
+	// authenticating the key of another
+	impostorConfig := new(bdls.Config)
+	impostorConfig.Epoch = epoch
+	impostorConfig.PrivateKey = participants[2]
+	impostorConfig.Participants = coords
+	impostorConfig.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	impostorConfig.StateValidate = func(a bdls.State) bool { return true }
+	consensus, err := bdls.NewConsensus(impostorConfig)
+	assert.Nil(t, err)
+	impostor := NewTCPAgent(consensus, participants[2])
+	impostor.SetTLSConfig(tlsConfig(certs[1]), nil)
+	conn, err = net.Dial("tcp", listeners[0].Addr().String())
+	assert.Nil(t, err)
+	ip, err := NewTLSPeer(conn, impostor, true)
+	assert.Nil(t, err)
+	assert.Nil(t, <-serverErrs)
+	ip.InitiatePublicKeyAuthentication()
+	select {
+	case <-ip.die:
+	case <-time.After(defaultAuthTimeout / 2):
+		t.Fatal("impostor has not been dropped")
+	}
+	impostor.Close()
+
+	// full mesh over TLS
+	for i := 0; i < numPeers; i++ {
+		for j := i + 1; j < numPeers; j++ {
+			conn, err := net.Dial("tcp", listeners[j].Addr().String())
+			assert.Nil(t, err)
+			p, err := NewTLSPeer(conn, agents[i], true)
+			assert.Nil(t, err)
+			assert.Nil(t, <-serverErrs)
+			assert.True(t, agents[i].AddPeer(p))
+			p.InitiatePublicKeyAuthentication()
+		}
+	}
+
+	<-time.After(time.Second)
+
+	for i := 0; i < numPeers; i++ {
+		agents[i].Update()
+		assert.Nil(t, agents[i].Propose([]byte("tls")))
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for i := 0; i < numPeers; i++ {
+		for {
+			height, _, state := agents[i].GetLatestState()
+			if height > 0 {
+				assert.Equal(t, bdls.State("tls"), state)
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("agent %v failed to decide", i)
+			}
+			<-time.After(20 * time.Millisecond)
+		}
+	}
+
+	for i := 0; i < numPeers; i++ {
+		agents[i].Close()
+	}
+}
+
+func TestTLSPeerNotConfigured(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	_, err := NewTLSPeer(c1, NewTCPAgent(nil, nil), true)
+	assert.Equal(t, ErrTLSNotConfigured, err)
+}
+
+func TestTLSServeSlowHandshake(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	cert := createSelfSignedCert(t, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+
+	agent := NewTCPAgent(nil, key)
+	agent.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}, nil)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	served := make(chan error)
+	go func() { served <- agent.Serve(l) }()
+
+	// a silent client doesn't block accepting others
+	silent, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	defer silent.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	client := tls.Client(conn, &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"})
+	client.SetDeadline(time.Now().Add(time.Second))
+	assert.Nil(t, client.Handshake())
+	client.Close()
+
+	// pending handshakes are aborted on close
+	start := time.Now()
+	assert.Nil(t, agent.Close())
+	assert.Nil(t, <-served)
+	assert.True(t, time.Since(start) < defaultHandshakeTimeout)
+}
@@ -0,0 +1,279 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/Sperax/bdls/timer"
+)
+
+const (
+	// MaxDatagramSize is the default maximum payload of a single UDP datagram,
+	// 65535 - 8(UDP header) - 20(IP header)
+	MaxDatagramSize = 65507
+)
+
+// A UDPAgent binds consensus core to a UDP socket, each consensus message is
+// sent as a single datagram to UDPPeers.
+//
+// UDP is connectionless, the public key of a UDPPeer is provided when adding
+// the peer instead of being authenticated interactively, messages from
+// unknown addresses are dropped.
+type UDPAgent struct {
+	consensus           *bdls.Consensus // the consensus core
+	conn                *net.UDPConn    // the socket to send & receive datagrams
+	mtu                 int32           // maximum datagram payload, accessed atomically
+	peers               []*UDPPeer      // known peers
+	consensusMessages   [][]byte        // all consensus message awaiting to be processed
+	chConsensusMessages chan struct{}   // notification of new consensus message
+
+	wg         sync.WaitGroup // all goroutines of this agent
+	die        chan struct{}  // udp agent closing
+	sync.Mutex                // fields lock
+}
+
+// NewUDPAgent initiate a UDPAgent which talks consensus protocol with peers over conn
+func NewUDPAgent(consensus *bdls.Consensus, conn *net.UDPConn) *UDPAgent {
+	agent := new(UDPAgent)
+	agent.consensus = consensus
+	agent.conn = conn
+	agent.mtu = MaxDatagramSize
+	agent.die = make(chan struct{})
+	agent.chConsensusMessages = make(chan struct{}, 1)
+	agent.wg.Add(2)
+	go agent.readLoop()
+	go agent.inputConsensusMessage()
+	return agent
+}
+
+// SetMTU sets the maximum payload of a datagram, messages exceeding
+// it will be rejected with ErrDatagramTooLarge.
+func (agent *UDPAgent) SetMTU(mtu int) { atomic.StoreInt32(&agent.mtu, int32(mtu)) }
+
+// AddPeer adds a peer to this agent
+func (agent *UDPAgent) AddPeer(p *UDPPeer) bool {
+	agent.Lock()
+	defer agent.Unlock()
+
+	select {
+	case <-agent.die:
+		return false
+	default:
+		agent.peers = append(agent.peers, p)
+		return agent.consensus.Join(p)
+	}
+}
+
+// RemovePeer removes a UDPPeer from this agent
+func (agent *UDPAgent) RemovePeer(p *UDPPeer) bool {
+	agent.Lock()
+	defer agent.Unlock()
+
+	peerAddress := p.RemoteAddr().String()
+	for k := range agent.peers {
+		if agent.peers[k].RemoteAddr().String() == peerAddress {
+			copy(agent.peers[k:], agent.peers[k+1:])
+			agent.peers = agent.peers[:len(agent.peers)-1]
+			return agent.consensus.Leave(p.RemoteAddr())
+		}
+	}
+	return false
+}
+
+// Close closes the socket, and returns once all goroutines of this agent
+// have exited. Closing a closed agent returns ErrAgentClosed.
+func (agent *UDPAgent) Close() error {
+	agent.Lock()
+	select {
+	case <-agent.die:
+		agent.Unlock()
+		return ErrAgentClosed
+	default:
+	}
+	close(agent.die)
+	agent.conn.Close()
+	agent.Unlock()
+
+	agent.wg.Wait()
+	return nil
+}
+
+// Update is the consensus updater
+func (agent *UDPAgent) Update() {
+	agent.Lock()
+	defer agent.Unlock()
+
+	select {
+	case <-agent.die:
+	default:
+		// call consensus update
+		agent.consensus.Update(time.Now())
+		timer.SystemTimedSched.Put(agent.Update, time.Now().Add(20*time.Millisecond))
+	}
+}
+
+// Propose a state, awaiting to be finalized at next height, errors of
+// Consensus.Propose are returned.
+func (agent *UDPAgent) Propose(s bdls.State) error {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.consensus.Propose(s)
+}
+
+// GetLatestState returns latest state
+func (agent *UDPAgent) GetLatestState() (height uint64, round uint64, data bdls.State) {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.consensus.CurrentState()
+}
+
+// knownAddr checks if addr belongs to a peer of this agent
+func (agent *UDPAgent) knownAddr(addr *net.UDPAddr) bool {
+	agent.Lock()
+	defer agent.Unlock()
+
+	for k := range agent.peers {
+		if agent.peers[k].addr.IP.Equal(addr.IP) && agent.peers[k].addr.Port == addr.Port {
+			return true
+		}
+	}
+	return false
+}
+
+// readLoop keeps reading datagrams from the socket
+func (agent *UDPAgent) readLoop() {
+	defer agent.wg.Done()
+	// one extra byte to detect datagrams exceeding MaxDatagramSize
+	buf := make([]byte, MaxDatagramSize+1)
+	for {
+		n, addr, err := agent.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-agent.die:
+			default:
+				log.Println(err)
+			}
+			return
+		}
+
+		if n > int(atomic.LoadInt32(&agent.mtu)) {
+			continue
+		}
+
+		if !agent.knownAddr(addr) {
+			continue
+		}
+
+		bts := make([]byte, n)
+		copy(bts, buf[:n])
+		agent.handleConsensusMessage(bts)
+	}
+}
+
+// handleConsensusMessage will be called if a datagram has been received from a UDPPeer
+func (agent *UDPAgent) handleConsensusMessage(bts []byte) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.consensusMessages = append(agent.consensusMessages, bts)
+	agent.notifyConsensus()
+}
+
+func (agent *UDPAgent) notifyConsensus() {
+	select {
+	case agent.chConsensusMessages <- struct{}{}:
+	default:
+	}
+}
+
+// consensus message receiver
+func (agent *UDPAgent) inputConsensusMessage() {
+	defer agent.wg.Done()
+	for {
+		select {
+		case <-agent.chConsensusMessages:
+			agent.Lock()
+			msgs := agent.consensusMessages
+			agent.consensusMessages = nil
+
+			agent.consensus.ReceiveMessages(msgs, time.Now())
+			agent.Unlock()
+		case <-agent.die:
+			return
+		}
+	}
+}
+
+// UDPPeer represents a peer(endpoint) reachable at a UDP address
+type UDPPeer struct {
+	agent         *UDPAgent        // the agent it belongs to
+	addr          *net.UDPAddr     // the address of this peer
+	peerPublicKey *ecdsa.PublicKey // the public key of this peer
+}
+
+// NewUDPPeer creates a UDPPeer at addr with the given public key
+func NewUDPPeer(addr *net.UDPAddr, publicKey *ecdsa.PublicKey, agent *UDPAgent) *UDPPeer {
+	p := new(UDPPeer)
+	p.agent = agent
+	p.addr = addr
+	p.peerPublicKey = publicKey
+	return p
+}
+
+// GetPublicKey implements PeerInterface, returns peer's public key
+func (p *UDPPeer) GetPublicKey() *ecdsa.PublicKey { return p.peerPublicKey }
+
+// RemoteAddr implements PeerInterface, returns peer's address as connection identity
+func (p *UDPPeer) RemoteAddr() net.Addr { return p.addr }
+
+// Send implements PeerInterface, to send message to this peer in a single datagram,
+// messages exceeding the MTU are rejected with ErrDatagramTooLarge.
+func (p *UDPPeer) Send(out []byte) error {
+	select {
+	case <-p.agent.die:
+		return ErrAgentClosed
+	default:
+	}
+
+	// Send is called by consensus core with agent locked
+	if len(out) > int(atomic.LoadInt32(&p.agent.mtu)) {
+		return ErrDatagramTooLarge
+	}
+
+	_, err := p.agent.conn.WriteToUDP(out, p.addr)
+	return err
+}
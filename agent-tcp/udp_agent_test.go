@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPAgent(t *testing.T) {
+	// 4 participants with only 3 running instances, 2t+1 = 3 can still decide
+	const numParticipants = 4
+	const numPeers = 3
+
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < numParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	epoch := time.Now()
+	agents := make([]*UDPAgent, numPeers)
+	for i := 0; i < numPeers; i++ {
+		config := new(bdls.Config)
+		config.Epoch = epoch
+		config.PrivateKey = participants[i]
+		config.Participants = coords
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(100 * time.Millisecond)
+
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		assert.Nil(t, err)
+		agents[i] = NewUDPAgent(consensus, conn)
+	}
+
+	for i := 0; i < numPeers; i++ {
+		for j := 0; j < numPeers; j++ {
+			if i != j {
+				addr := agents[j].conn.LocalAddr().(*net.UDPAddr)
+				ok := agents[i].AddPeer(NewUDPPeer(addr, &participants[j].PublicKey, agents[i]))
+				assert.True(t, ok)
+			}
+		}
+	}
+
+	for i := 0; i < numPeers; i++ {
+		agents[i].Update()
+		agents[i].Propose([]byte("udp"))
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for i := 0; i < numPeers; i++ {
+		for {
+			height, _, state := agents[i].GetLatestState()
+			if height > 0 {
+				assert.Equal(t, bdls.State("udp"), state)
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("agent %v failed to decide", i)
+			}
+			<-time.After(20 * time.Millisecond)
+		}
+	}
+
+	for i := 0; i < numPeers; i++ {
+		agents[i].Close()
+	}
+}
+
+func TestUDPPeerMTU(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+	agent := &UDPAgent{conn: conn, mtu: MaxDatagramSize}
+	defer conn.Close()
+
+	peer := NewUDPPeer(conn.LocalAddr().(*net.UDPAddr), &privateKey.PublicKey, agent)
+	assert.Nil(t, peer.Send(make([]byte, 1024)))
+	assert.Equal(t, ErrDatagramTooLarge, peer.Send(make([]byte, MaxDatagramSize+1)))
+
+	agent.SetMTU(1472)
+	assert.Nil(t, peer.Send(make([]byte, 1472)))
+	assert.Equal(t, ErrDatagramTooLarge, peer.Send(make([]byte, 1473)))
+}
@@ -0,0 +1,128 @@
+package bdls
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditSink(t *testing.T) {
+	type audited struct {
+		signed *SignedProto
+		m      *Message
+	}
+	audits := make([][]audited, 4)
+	var index int
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		i := index
+		index++
+		config.AuditSink = func(sp *SignedProto, m *Message) {
+			assert.True(t, sp.Verify(S256Curve))
+			audits[i] = append(audits[i], audited{sp, m})
+		}
+	})
+
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	var leaders int
+	for i, node := range net.nodes {
+		_, round, _ := node.CurrentState()
+		var commits []Identity
+		var decides int
+		roundChanges := make(map[uint64]map[Identity]int)
+		for _, a := range audits[i] {
+			if a.m.Height != 1 {
+				continue
+			}
+			switch a.m.Type {
+			case MessageType_RoundChange:
+				if roundChanges[a.m.Round] == nil {
+					roundChanges[a.m.Round] = make(map[Identity]int)
+				}
+				roundChanges[a.m.Round][node.pubKeyToIdentity(a.signed.PublicKey(node.curve))]++
+			case MessageType_LockRelease:
+				t.Fatal("no lock has been released")
+			case MessageType_Commit:
+				assert.Equal(t, round, a.m.Round)
+				assert.Equal(t, State("state"), State(a.m.State))
+				commits = append(commits, node.pubKeyToIdentity(a.signed.PublicKey(node.curve)))
+			case MessageType_Decide:
+				decides++
+			}
+		}
+
+		// the <roundchange> messages of the decided round are audited once
+		// they have formed the quorum, exactly 2t+1 from distinct signers
+		assert.NotNil(t, roundChanges[round])
+		for _, signers := range roundChanges {
+			assert.Equal(t, 3, len(signers))
+			for _, n := range signers {
+				assert.Equal(t, 1, n)
+			}
+		}
+
+		if len(commits) > 0 {
+			// the leader audits exactly the <commit> messages in the proof
+			leaders++
+			sort.Slice(commits, func(i, j int) bool { return bytes.Compare(commits[i][:], commits[j][:]) < 0 })
+			signers, ok := node.DecideSigners(1)
+			assert.True(t, ok)
+			assert.Equal(t, signers, commits)
+			assert.Equal(t, 0, decides)
+		} else {
+			// others audit the <decide> from the leader only once
+			assert.Equal(t, 1, decides)
+		}
+	}
+	assert.Equal(t, 1, leaders)
+
+	// replayed messages are not audited again
+	var replayed *SignedProto
+	for _, node := range net.nodes {
+		node.Propose([]byte("next"))
+	}
+	for i := 0; i < 100 && replayed == nil; i++ {
+		net.step(20 * time.Millisecond)
+		for _, a := range audits[0] {
+			if a.m.Type == MessageType_RoundChange && a.m.Height == 2 && net.nodes[0].pubKeyToIdentity(a.signed.PublicKey(S256Curve)) != net.nodes[0].identity {
+				replayed = a.signed
+			}
+		}
+	}
+	if assert.NotNil(t, replayed) {
+		n := len(audits[0])
+		assert.Nil(t, net.nodes[0].ReceiveMessage(replayed.Bytes(), net.now))
+		assert.Equal(t, n, len(audits[0]))
+	}
+
+	// <lock-release> messages are audited once they have updated the locks
+	_, sp, privateKey, proofKeys := createLockReleaseMessage(t, 20, 1, 10, 1, 10)
+	var released []*SignedProto
+	consensus := createConsensus(t, 0, 1, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.currentRound.Stage = stageLockRelease
+	consensus.auditSink = func(sp *SignedProto, m *Message) {
+		if m.Type == MessageType_LockRelease {
+			released = append(released, sp)
+		}
+	}
+	assert.Nil(t, consensus.ReceiveMessage(sp.Bytes(), time.Now()))
+	assert.Nil(t, consensus.ReceiveMessage(sp.Bytes(), time.Now()))
+	assert.Equal(t, 1, len(consensus.locks))
+	assert.Equal(t, 1, len(released))
+
+	// rejected messages are not audited
+	n := len(audits[0])
+	_, sp, _ = createCommitMessage(t, 2, 0, []byte("state"))
+	assert.NotNil(t, net.nodes[0].ReceiveMessage(sp.Bytes(), net.now))
+	assert.Equal(t, n, len(audits[0]))
+}
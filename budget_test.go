@@ -0,0 +1,65 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// tickingClock is a Clock advancing by step on every reading
+type tickingClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *tickingClock) Now() time.Time {
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func TestMaxMessageProcessTime(t *testing.T) {
+	t.Log("test a message exceeding the processing budget in an expensive validator is rejected")
+	run := func(budget time.Duration) error {
+		_, sp, privateKey := createRoundChangeMessage(t, 1, 0)
+		consensus := createConsensus(t, 0, 0, []*ecdsa.PublicKey{&privateKey.PublicKey})
+		clock := &simulatedClock{now: time.Now()}
+		consensus.clock = clock
+		consensus.maxMessageProcessTime = budget
+		consensus.messageValidator = func(c *Consensus, m *Message, signed *SignedProto) bool {
+			// artificially expensive
+			clock.now = clock.now.Add(time.Second)
+			return true
+		}
+
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		return consensus.ReceiveMessage(bts, clock.Now())
+	}
+
+	assert.Nil(t, run(0))
+	assert.Nil(t, run(2*time.Second))
+	assert.Equal(t, ErrMessageTooExpensive, run(500*time.Millisecond))
+}
+
+func TestMaxMessageProcessTimeProofs(t *testing.T) {
+	t.Log("test verifying the proofs of a message is aborted once the budget is exceeded")
+	_, sp, privateKey, proofKeys := createLockMessage(t, 20, 1, 10, 1, 10)
+	consensus := createConsensus(t, 0, 1, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.AddParticipant(&privateKey.PublicKey)
+	consensus.clock = &tickingClock{now: time.Now(), step: time.Millisecond}
+	consensus.maxMessageProcessTime = 5 * time.Millisecond
+
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMessageTooExpensive, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, 0, len(consensus.locks))
+
+	// enough budget for all proofs
+	consensus.maxMessageProcessTime = time.Second
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, 1, len(consensus.locks))
+}
@@ -0,0 +1,55 @@
+package bdls
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// run with -race to check the getters against message delivery
+func TestCurrentStateConcurrent(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, node := range net.nodes {
+		wg.Add(1)
+		go func(node *Consensus) {
+			defer wg.Done()
+			var last uint64
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				height, _, state := node.CurrentState()
+				assert.True(t, height >= last)
+				if height > 0 {
+					assert.Equal(t, State{byte(height)}, state)
+				}
+				last = height
+				assert.True(t, node.CurrentHeight() >= height)
+				node.CurrentRound()
+			}
+		}(node)
+	}
+
+	for h := uint64(1); h <= 3; h++ {
+		for _, node := range net.nodes {
+			node.Propose(State{byte(h)})
+		}
+		for i := 0; i < 10000 && !net.decided(h); i++ {
+			net.step(20 * time.Millisecond)
+		}
+		assert.True(t, net.decided(h))
+	}
+	close(done)
+	wg.Wait()
+
+	for _, node := range net.nodes {
+		height, _, _ := node.CurrentState()
+		assert.Equal(t, height, node.CurrentHeight())
+	}
+}
@@ -32,6 +32,11 @@ package bdls
 
 import (
 	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
 	"time"
 )
 
@@ -46,56 +51,457 @@ type Config struct {
 	Epoch time.Time
 	// CurrentHeight
 	CurrentHeight uint64
+	// CurrentRound is the round to start consensus with at height CurrentHeight+1,
+	// for testnets and fuzzing to enter a problematic round directly, the leader
+	// and timers of the round apply from Epoch. Participants starting at lower
+	// rounds catch up on 2*t+1 <roundchange> messages of this round. It's ignored
+	// by LoadConsensus, as the round is restored from the snapshot.
+	// (optional). Default to 0
+	CurrentRound uint64
 	// PrivateKey
 	PrivateKey *ecdsa.PrivateKey
+
+	// MessageSigner signs messages in place of PrivateKey, to sign in another
+	// signature scheme like SchemeEd25519, messages signed in other schemes
+	// will be rejected with ErrMessageScheme. It cannot sign compact messages.
+	// (optional). Default to secp256k1 ECDSA signing with PrivateKey
+	MessageSigner Signer
+
+	// Signer signs messages in place of PrivateKey with a secp256k1 key which
+	// is never exposed, like a key kept in an HSM or by a remote signer, and
+	// PrivateKey is ignored. It cannot sign compact messages, nor be set along
+	// with MessageSigner. Messages failed to be signed are logged, counted by
+	// Consensus.SignErrors and not sent, the protocol recovers by timeouts.
+	// (optional). Default to NewSoftwareSigner with PrivateKey
+	Signer KeySigner
+
+	// Rand is the source of entropy to sign messages with PrivateKey, a seeded
+	// reader makes signatures on secp256k1 reproducible for deterministic
+	// simulations, or it reads from a hardware RNG, see NewSoftwareSigner.
+	// It's not used by compact messages, which are signed with nonces derived
+	// from the message as described in RFC6979, nor by MessageSigner.
+	// (optional). Default to crypto/rand.Reader
+	Rand io.Reader
+
+	// Follower runs the consensus without a key to sign, it processes and
+	// verifies messages, and tracks the decisions of participants, but never
+	// signs, proposes or votes, PrivateKey and MessageSigner are ignored.
+	// (optional). Default to false
+	Follower bool
 	// Consensus Group
 	Participants []Identity
 	// EnableCommitUnicast sets to true to enable <commit> message to be delivered via unicast
 	// if not(by default), <commit> message will be broadcasted
 	EnableCommitUnicast bool
 
+	// EnableCompactMessage sets to true to sign messages in compact form, the
+	// signer's public key is recovered from the signature instead of being carried
+	// in the message, all participants MUST enable it at the same time.
+	// if not(by default), compact messages will be rejected.
+	EnableCompactMessage bool
+
 	// StateCompare is a function from user to compare states,
 	// The result will be 0 if a==b, -1 if a < b, and +1 if a > b.
 	// Usually this will lead to block header comparsion in blockchain, or replication log in database,
 	// users should check fields in block header to make comparison.
+	//
+	// The function MUST be deterministic. Distinct states compared equal, eg: by
+	// a "highest fee" policy, are ordered by their state hashes, the one with the
+	// greater hash is selected, so all participants break ties the same way
+	// regardless of the arrival order of proposals.
 	StateCompare func(a State, b State) int
 
 	// StateValidate is a function from user to validate the integrity of
 	// state data.
 	StateValidate func(State) bool
 
+	// StateValidateErr validates states as StateValidate, and returns the reason
+	// of rejection, which can be retrieved by Consensus.LastRejectedState(),
+	// one of StateValidate and StateValidateErr must be set.
+	// (optional). Default to StateValidate, with ErrStateRejected as the reason
+	StateValidateErr func(State) error
+
 	// MessageValidator is an external validator to be called when a message inputs into ReceiveMessage
 	MessageValidator func(c *Consensus, m *Message, signed *SignedProto) bool
 
-	// MessageOutCallback will be called if not nil before a message send out
+	// StuckThreshold is the duration of a round to be reported as stuck by
+	// Health.
+	// (optional). Default to DefaultStuckThreshold
+	StuckThreshold time.Duration
+
+	// LivenessTimeout is the duration of a height without decision to be
+	// reported as stalled to OnStall, the height is watched since it's first
+	// observed by Update.
+	// (optional). Default to 0, stalls are not reported
+	LivenessTimeout time.Duration
+
+	// OnStall will be called if not nil by Update once the height being
+	// decided has stalled beyond LivenessTimeout, and again every
+	// LivenessTimeout until the height is decided, for alerting.
+	// The callback MUST NOT call methods of the Consensus object.
+	OnStall func(height, round uint64, stalledFor time.Duration)
+
+	// AcceptedVersions is the set of protocol versions of incoming messages
+	// to accept, messages of other versions will be rejected with
+	// ErrProtocolVersion. For rolling upgrades, participants upgraded to a
+	// new ProtocolVersion may accept the previous version till all the
+	// participants have upgraded. Messages are always signed in the
+	// ProtocolVersion, which must be in the set.
+	// (optional). Default to ProtocolVersion only
+	AcceptedVersions []uint32
+
+	// MessageFilter will be called if not nil for each incoming message of
+	// ReceiveMessage and ReceiveMessages before any verification, messages
+	// will be dropped silently if it returns false, to reject unwanted
+	// messages cheaply, eg: from a jailed participant. The signer of the
+	// message is not authenticated yet.
+	// (optional). Default to accept all messages
+	MessageFilter func(sp *SignedProto) bool
+
+	// MessageOutCallback will be called if not nil before a message send out,
+	// it's the integration point for transports other than the peers joined
+	// via Join. Every message to be sent on the wire, including the <decide>
+	// messages propagated from other participants, is delivered exactly once,
+	// and signed.Bytes() returns the marshalled bytes sent to the peers, which
+	// are shared and MUST NOT be modified, copy them if retained.
+	//
+	// The callback is invoked synchronously in the order the messages are
+	// emitted by Update, ReceiveMessage and ReceiveMessages, before they are
+	// sent to the peers and looped back to this participant itself. All
+	// messages are addressed to all participants, except <commit> messages
+	// with EnableCommitUnicast, which are addressed to the leader of m.Round
+	// only, and those addressed to this participant itself are not delivered.
+	// The callback MUST NOT call methods of the Consensus object.
 	MessageOutCallback func(m *Message, signed *SignedProto)
 
-	// Identity derviation from ecdsa.PublicKey
+	// AuditSink will be called if not nil for every message accepted and
+	// counted toward decisions, which is the minimal input set to prove each
+	// decision for post-incident forensics, keyed by m.Height & m.Round:
+	// <roundchange> messages of a round once they have formed the 2*t+1 quorum
+	// to enter the lock stage, <commit> messages to the locked state collected
+	// by the leader, verified <lock>, <select> & <decide> messages, and
+	// <lock-release> messages updating the locks. Messages rejected, replayed or
+	// outdated on arrival are never reported, neither are the messages of
+	// decided heights recorded by StaleAcceptWindow.
+	//
+	// The messages are retained by the consensus core and MUST NOT be
+	// modified. The callback MUST NOT call methods of the Consensus object.
+	// (optional). Default to no audit
+	AuditSink func(sp *SignedProto, m *Message)
+
+	// MaxStateSize limits the bytes of a state, oversize states are rejected
+	// by Propose, and the messages carrying them, including as proofs, are
+	// rejected on arrival before verifying signatures, with ErrStateTooLarge.
+	// (optional). Default to 0, no limit
+	MaxStateSize int
+
+	// DecidedChSize is the capacity of the channel returned by DecidedCh, the
+	// events of decisions are dropped while the channel is full.
+	// (optional). Default to DefaultDecidedChSize
+	DecidedChSize int
+
+	// MaxMessageProcessTime is a soft budget to verify & validate a single
+	// message, checked between the proofs it carries and the validation
+	// phases, a message exceeding it is rejected with ErrMessageTooExpensive
+	// before changing any state, so crafted messages with huge proof sets
+	// can't monopolize the consensus core. The time is read from Clock.
+	// (optional). Default to 0, no limit
+	MaxMessageProcessTime time.Duration
+
+	// ExternalLoopback stops looping the messages broadcasted by this
+	// participant back internally, the transport MUST deliver them back via
+	// ReceiveMessage as the messages from peers, so they're validated and
+	// counted by the identical path, including MessageFilter. Messages
+	// addressed to this participant only, like the <commit> messages to
+	// itself as the leader with EnableCommitUnicast, are still looped back.
+	// (optional). Default to false
+	ExternalLoopback bool
+
+	// DecideCallback will be called if not nil exactly once for each height
+	// decided, with the <decide> message as the proof of the state.
+	// The callback is invoked synchronously inside Update or ReceiveMessage.
+	DecideCallback func(height uint64, round uint64, state State, proof *SignedProto)
+
+	// RoundChangeCallback will be called if not nil when the round being decided
+	// advances, reason is RoundChangeTimeout if the lock-release timer fired in
+	// Update, RoundChangeQuorum if 2*t+1 <roundchange> messages were received,
+	// or RoundChangeLock & RoundChangeSelect if the leader's <lock> or <select>
+	// of a higher round was received.
+	// The callback is invoked synchronously, and is purely observational.
+	RoundChangeCallback func(height, oldRound, newRound uint64, reason string)
+
+	// Identity derviation from ecdsa.PublicKey, the identities of this
+	// participant and the signers of all messages are derived by it, so
+	// Participants, Weights and the identities passed to the methods must be
+	// in the same form, eg: the network identifies participants by address.
+	// Standalone proofs are verified with the same derivation by ProofVerifier.
 	// (optional). Default to DefaultPubKeyToIdentity
 	PubKeyToIdentity func(pubkey *ecdsa.PublicKey) (ret Identity)
+
+	// Hasher to digest messages for signing & verification, all participants
+	// MUST use the same hasher.
+	// (optional). Default to DefaultHasher
+	Hasher *Hasher
+
+	// DomainSeparator replaces SignaturePrefix in message digests, to prevent
+	// messages from being replayed across independent networks using the same keys.
+	// (optional). Default to SignaturePrefix
+	DomainSeparator []byte
+
+	// Weights defines stake weights of participants, a decision requires more than
+	// 2/3 of total weight of participants instead of 2*t+1 participants, identities
+	// absent from Weights have zero weight. All weights must sum to at most
+	// math.MaxUint64.
+	// (optional). Default to equal weighting
+	Weights map[Identity]uint64
+
+	// QuorumSize returns the number of participants required out of n to
+	// lock, commit and decide, for fault models other than byzantine, eg: a
+	// simple majority for crash faults only. Thresholds not above n/2 are
+	// unsafe, as two disjoint quorums may decide different states, and will
+	// be rejected by Validate and raised to n/2+1 if the group changes.
+	// It cannot be used along with Weights.
+	// (optional). Default to DefaultQuorumSize
+	QuorumSize func(n int) int
+
+	// RoundChangeBackoff returns the <roundchange> timeout of the given round,
+	// operators can implement exponential or capped backoff to reduce traffic
+	// under sustained packet loss.
+	// (optional). Default to 2*latency*2^round, capped by MaxConsensusLatency
+	RoundChangeBackoff func(round uint64) time.Duration
+
+	// LeaderFunc elects the expected proposer of the given height and round
+	// from the participants, to plug in stake-weighted or VRF based election,
+	// all participants MUST use the same deterministic function.
+	// (optional). Default to participants[round % len(participants)]
+	LeaderFunc func(height, round uint64, participants []Identity) Identity
+
+	// MaxPendingMessages limits the number of <roundchange>, <commit> and lock
+	// messages buffered by consensus, <roundchange> messages of the furthest
+	// future rounds will be evicted first, and incoming messages of no higher
+	// priority will be dropped with ErrMessagePoolFull.
+	// (optional). Default to 0, no limit
+	MaxPendingMessages int
+
+	// AdaptiveLatency adapts the latency set by SetLatency to the observed
+	// round trips of <commit> messages answering the <lock> of this participant
+	// as the leader, halved, by the median across participants of each round
+	// and an exponentially weighted moving average bounded by MinLatency &
+	// MaxLatency, so the timeouts and retransmissions of <roundchange> messages
+	// follow the network.
+	// (optional). Default to false, the latency is fixed
+	AdaptiveLatency bool
+
+	// MinLatency & MaxLatency bound the latency adapted by AdaptiveLatency.
+	// (optional). Default to DefaultMinConsensusLatency & MaxConsensusLatency
+	MinLatency time.Duration
+	MaxLatency time.Duration
+
+	// ResyncInterval limits how often this node broadcasts <resync> messages,
+	// and processes <resync> messages from the same participant at a height,
+	// <resync> messages arriving within the interval are dropped with
+	// ErrResyncRateLimited.
+	// (optional). Default to 0, no limit
+	ResyncInterval time.Duration
+
+	// FutureHeights is the number of heights above the height being decided,
+	// whose messages will be buffered and processed once the height is reached,
+	// to save round trips for nodes slightly falling behind.
+	// (optional). Default to DefaultFutureHeights, negative to disable
+	FutureHeights int
+
+	// FutureBufferSize limits the total bytes of buffered messages of future
+	// heights, each participant can take an equal share of it, further messages
+	// will be dropped with ErrMessagePoolFull.
+	// (optional). Default to DefaultFutureBufferSize
+	FutureBufferSize int
+
+	// MaxEvidence limits the number of retained equivocations awaiting to be
+	// taken by TakeEquivocations, the oldest will be evicted first.
+	// (optional). Default to DefaultMaxEvidence
+	MaxEvidence int
+
+	// StaleAcceptWindow accepts the messages of the latest N decided heights,
+	// they're recorded for equivocation detection, and the late <commit>
+	// messages to the decisions are reported by LateCommits for attribution,
+	// without affecting the consensus of current height. Only the messages
+	// of rounds slightly above the decided round are accepted, and the number
+	// of messages from each sender at a height is limited.
+	// (optional). Default to 0, messages of decided heights are rejected
+	StaleAcceptWindow uint64
+
+	// ProofHistory limits the number of latest decided heights whose <decide>
+	// proofs are retained to be exported by ExportProofs.
+	// (optional). Default to DefaultProofHistory, negative to disable
+	ProofHistory int
+
+	// VerifyWorkers limits the number of goroutines verifying signatures in
+	// parallel for a batch of messages passed to ReceiveMessages, state
+	// transitions are still applied sequentially in the order of the batch.
+	// (optional). Default to runtime.NumCPU()
+	VerifyWorkers int
+
+	// Metrics collects statistics of message processing
+	// (optional). Default to no metrics
+	Metrics Metrics
+
+	// Logger logs the progress of consensus, messages are logged with
+	// key/value pairs if it implements FieldLogger.
+	// (optional). Default to no logging
+	Logger Logger
+
+	// Clock is the source of time read by the consensus core
+	// (optional). Default to the wall clock
+	Clock Clock
 }
 
-// VerifyConfig verifies the integrity of this config when creating new consensus object
+// Clone returns a copy of this config which can be modified without affecting
+// the original one, Participants, Weights and DomainSeparator are deep-copied,
+// while PrivateKey, MessageSigner, Signer, Rand, Hasher, Metrics, Logger and all function
+// fields are shared intentionally.
+func (c *Config) Clone() *Config {
+	cloned := *c
+	if c.Participants != nil {
+		cloned.Participants = append([]Identity(nil), c.Participants...)
+	}
+
+	if c.Weights != nil {
+		cloned.Weights = make(map[Identity]uint64, len(c.Weights))
+		for id, weight := range c.Weights {
+			cloned.Weights[id] = weight
+		}
+	}
+
+	if c.DomainSeparator != nil {
+		cloned.DomainSeparator = append([]byte(nil), c.DomainSeparator...)
+	}
+
+	if c.AcceptedVersions != nil {
+		cloned.AcceptedVersions = append([]uint32(nil), c.AcceptedVersions...)
+	}
+	return &cloned
+}
+
+// VerifyConfig verifies the integrity of this config when creating new consensus object,
+// the errors returned are the unwrapped errors of Config.Validate.
 func VerifyConfig(c *Config) error {
+	err := c.Validate()
+	if cause := errors.Unwrap(err); cause != nil {
+		return cause
+	}
+	return err
+}
+
+// Validate checks the invariants of this config, the error returned names
+// the offending field, and wraps one of the ErrConfig errors.
+func (c *Config) Validate() error {
 	if c.Epoch.IsZero() {
 		return ErrConfigEpoch
 	}
 
+	// no height is left to run the round at
+	if c.CurrentRound > 0 && c.CurrentHeight == math.MaxUint64 {
+		return fmt.Errorf("%w, height %v", ErrConfigCurrentRound, c.CurrentHeight)
+	}
+
 	if c.StateCompare == nil {
 		return ErrConfigStateCompare
 	}
 
-	if c.StateValidate == nil {
+	if c.StateValidate == nil && c.StateValidateErr == nil {
 		return ErrConfigStateValidate
 	}
 
-	if c.PrivateKey == nil {
+	if !c.Follower && c.PrivateKey == nil && c.MessageSigner == nil && c.Signer == nil {
 		return ErrConfigPrivateKey
 	}
 
+	if c.Signer != nil {
+		if c.MessageSigner != nil {
+			return fmt.Errorf("%w, Config.MessageSigner is also set", ErrConfigSigner)
+		}
+		if c.EnableCompactMessage {
+			return fmt.Errorf("%w, compact messages are not supported", ErrConfigSigner)
+		}
+		if pub := c.Signer.PublicKey(); pub == nil || pub.Curve == nil || pub.X == nil || pub.Y == nil {
+			return fmt.Errorf("%w, no public key", ErrConfigSigner)
+		}
+	}
+
+	if c.MessageSigner != nil {
+		if c.EnableCompactMessage {
+			return fmt.Errorf("%w, compact messages are not supported", ErrConfigMessageSigner)
+		}
+		if _, _, err := c.MessageSigner.PublicKey(); err != nil {
+			return fmt.Errorf("%w, %v", ErrConfigMessageSigner, err)
+		}
+	}
+
+	// messages of this participant itself must be accepted
+	if c.AcceptedVersions != nil {
+		accepted := false
+		for _, v := range c.AcceptedVersions {
+			accepted = accepted || v == ProtocolVersion
+		}
+		if !accepted {
+			return fmt.Errorf("%w, got %v", ErrConfigAcceptedVersions, c.AcceptedVersions)
+		}
+	}
+
+	// at least 3t+1 participants to tolerate t byzantine participants
 	if len(c.Participants) < ConfigMinimumParticipants {
-		return ErrConfigParticipants
+		return fmt.Errorf("%w, got %v", ErrConfigParticipants, len(c.Participants))
+	}
+
+	seen := make(map[Identity]bool, len(c.Participants))
+	for k, id := range c.Participants {
+		if seen[id] {
+			return fmt.Errorf("%w at index %v", ErrConfigParticipantsDuplicated, k)
+		}
+		seen[id] = true
+	}
+
+	if c.Weights != nil {
+		// identities absent from Participants may join by participant changes,
+		// so that all weights are summed
+		var sum, carry uint64
+		for _, weight := range c.Weights {
+			sum, carry = bits.Add64(sum, weight, 0)
+			if carry != 0 {
+				return ErrConfigWeightsOverflow
+			}
+		}
+
+		var total uint64
+		for _, id := range c.Participants {
+			total += c.Weights[id]
+		}
+		if total == 0 {
+			return ErrConfigWeights
+		}
+	}
+
+	if c.MinLatency > c.MaxLatency && c.MaxLatency > 0 {
+		return fmt.Errorf("%w, got %v > %v", ErrConfigLatency, c.MinLatency, c.MaxLatency)
+	}
+
+	if c.QuorumSize != nil {
+		if c.Weights != nil {
+			return fmt.Errorf("%w, cannot be used along with Config.Weights", ErrConfigQuorumSize)
+		}
+		n := len(c.Participants)
+		if q := c.QuorumSize(n); q < minQuorumSize(n) || q > n {
+			return fmt.Errorf("%w, got %v of %v participants", ErrConfigQuorumSize, q, n)
+		}
 	}
 
 	return nil
 }
+
+// DefaultQuorumSize returns 2*t+1 out of n=3t+1 participants, to tolerate t
+// byzantine participants.
+func DefaultQuorumSize(n int) int { return 2*((n-1)/3) + 1 }
+
+// minQuorumSize returns the minimal safe quorum of n participants, any two
+// quorums of which intersect.
+func minQuorumSize(n int) int { return n/2 + 1 }
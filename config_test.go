@@ -3,6 +3,8 @@ package bdls
 import (
 	"crypto/ecdsa"
 	"crypto/rand"
+	"errors"
+	"math"
 	"testing"
 	"time"
 
@@ -42,4 +44,140 @@ func TestVerifyConfig(t *testing.T) {
 
 	err = VerifyConfig(config)
 	assert.Nil(t, err)
+
+	config.Weights = make(map[Identity]uint64)
+	err = VerifyConfig(config)
+	assert.Equal(t, ErrConfigWeights, err)
+
+	config.Weights[config.Participants[0]] = 1
+	err = VerifyConfig(config)
+	assert.Nil(t, err)
+
+	// weights summing past math.MaxUint64, including non-participants
+	config.Weights[config.Participants[1]] = math.MaxUint64
+	err = VerifyConfig(config)
+	assert.Equal(t, ErrConfigWeightsOverflow, err)
+	config.Weights[config.Participants[1]] = math.MaxUint64 - 1
+	err = VerifyConfig(config)
+	assert.Nil(t, err)
+	config.Weights[Identity{}] = 1
+	err = VerifyConfig(config)
+	assert.Equal(t, ErrConfigWeightsOverflow, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := new(Config)
+	config.Epoch = time.Now()
+	config.StateCompare = func(State, State) int { return 0 }
+	config.StateValidate = func(State) bool { return true }
+
+	// nil private key
+	err := config.Validate()
+	assert.True(t, errors.Is(err, ErrConfigPrivateKey))
+	assert.Contains(t, err.Error(), "Config.PrivateKey")
+
+	randKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	config.PrivateKey = randKey
+
+	// empty participants
+	err = config.Validate()
+	assert.True(t, errors.Is(err, ErrConfigParticipants))
+	assert.Contains(t, err.Error(), "Config.Participants")
+	assert.Contains(t, err.Error(), "got 0")
+
+	// fewer than 3t+1 participants, no byzantine participant can be tolerated
+	for i := 0; i < ConfigMinimumParticipants-1; i++ {
+		randKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		config.Participants = append(config.Participants, DefaultPubKeyToIdentity(&randKey.PublicKey))
+	}
+	err = config.Validate()
+	assert.True(t, errors.Is(err, ErrConfigParticipants))
+	assert.Contains(t, err.Error(), "got 3")
+	_, err = NewConsensus(config)
+	assert.True(t, errors.Is(err, ErrConfigParticipants))
+
+	// duplicated identities
+	config.Participants = append(config.Participants, config.Participants[1])
+	err = config.Validate()
+	assert.True(t, errors.Is(err, ErrConfigParticipantsDuplicated))
+	assert.Contains(t, err.Error(), "at index 3")
+	assert.Equal(t, ErrConfigParticipantsDuplicated, VerifyConfig(config))
+
+	config.Participants[3] = DefaultPubKeyToIdentity(&randKey.PublicKey)
+	assert.Nil(t, config.Validate())
+
+	// messages signed in ProtocolVersion must be accepted
+	config.AcceptedVersions = []uint32{ProtocolVersion + 1}
+	err = config.Validate()
+	assert.True(t, errors.Is(err, ErrConfigAcceptedVersions))
+	config.AcceptedVersions = []uint32{ProtocolVersion, ProtocolVersion + 1}
+	assert.Nil(t, config.Validate())
+	config.AcceptedVersions = nil
+
+	// quorums must intersect
+	config.QuorumSize = func(n int) int { return n / 2 }
+	err = config.Validate()
+	assert.True(t, errors.Is(err, ErrConfigQuorumSize))
+	assert.Contains(t, err.Error(), "got 2 of 4")
+	config.QuorumSize = func(n int) int { return n + 1 }
+	assert.True(t, errors.Is(config.Validate(), ErrConfigQuorumSize))
+	config.QuorumSize = func(n int) int { return n/2 + 1 }
+	assert.Nil(t, config.Validate())
+	config.Weights = map[Identity]uint64{config.Participants[0]: 1}
+	assert.True(t, errors.Is(config.Validate(), ErrConfigQuorumSize))
+	config.Weights = nil
+	config.QuorumSize = nil
+
+	// adaptive latency bounds
+	config.MinLatency = time.Second
+	config.MaxLatency = time.Millisecond
+	assert.True(t, errors.Is(config.Validate(), ErrConfigLatency))
+	config.MaxLatency = 0
+	assert.Nil(t, config.Validate())
+	config.MinLatency = 0
+
+	assert.Equal(t, 3, DefaultQuorumSize(4))
+	assert.Equal(t, 5, DefaultQuorumSize(7))
+	_, err = NewConsensus(config)
+	assert.Nil(t, err)
+}
+
+func TestConfigClone(t *testing.T) {
+	config := new(Config)
+	config.Epoch = time.Now()
+	config.StateCompare = func(State, State) int { return 0 }
+	config.StateValidate = func(State) bool { return true }
+	config.DomainSeparator = []byte("domain")
+	config.Weights = make(map[Identity]uint64)
+	for i := 0; i < ConfigMinimumParticipants; i++ {
+		randKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		id := DefaultPubKeyToIdentity(&randKey.PublicKey)
+		config.Participants = append(config.Participants, id)
+		config.Weights[id] = 1
+		config.PrivateKey = randKey
+	}
+
+	cloned := config.Clone()
+	assert.Equal(t, config.Participants, cloned.Participants)
+	assert.Equal(t, config.Weights, cloned.Weights)
+	assert.Equal(t, config.DomainSeparator, cloned.DomainSeparator)
+	assert.Equal(t, config.PrivateKey, cloned.PrivateKey)
+	assert.Nil(t, cloned.Validate())
+
+	// modifying the clone doesn't affect the original
+	cloned.Participants[0] = Identity{}
+	cloned.Weights[config.Participants[1]] = 10
+	cloned.DomainSeparator[0] = 'D'
+	assert.NotEqual(t, Identity{}, config.Participants[0])
+	assert.Equal(t, uint64(1), config.Weights[config.Participants[1]])
+	assert.Equal(t, []byte("domain"), config.DomainSeparator)
+
+	// nil fields remain nil
+	empty := new(Config).Clone()
+	assert.Nil(t, empty.Participants)
+	assert.Nil(t, empty.Weights)
+	assert.Nil(t, empty.DomainSeparator)
 }
@@ -33,10 +33,15 @@ package bdls
 import (
 	"bytes"
 	"container/list"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"encoding/hex"
+	"math/bits"
 	"net"
+	"runtime"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/Sperax/bdls/crypto/blake2b"
@@ -56,6 +61,18 @@ const (
 	MaxConsensusLatency = 10 * time.Second
 )
 
+// reasons of round changes passed to Config.RoundChangeCallback
+const (
+	// RoundChangeTimeout indicates the round timed out without a decision
+	RoundChangeTimeout = "timeout"
+	// RoundChangeQuorum indicates 2*t+1 <roundchange> of a higher round were received
+	RoundChangeQuorum = "received 2t+1 round-change"
+	// RoundChangeLock indicates a <lock> of a higher round was received
+	RoundChangeLock = "received lock"
+	// RoundChangeSelect indicates a <select> of a higher round was received
+	RoundChangeSelect = "received select"
+)
+
 type (
 	// State is the data to participant in consensus
 	State []byte
@@ -66,6 +83,11 @@ type (
 // defaultHash is the system default hash function
 func defaultHash(s State) StateHash { return blake2b.Sum256(s) }
 
+// StateCompareBytes compares states lexicographically as bytes.Compare,
+// it can be used as Config.StateCompare for applications without ordering
+// preferences.
+func StateCompareBytes(a State, b State) int { return bytes.Compare(a, b) }
+
 type (
 	// consensusStage defines the status of consensus automate
 	consensusStage byte
@@ -86,6 +108,7 @@ type messageTuple struct {
 	StateHash StateHash    // computed while adding
 	Message   *Message     // the decoded message
 	Signed    *SignedProto // the encoded message with signature
+	Weight    uint64       // the weight of the signer
 }
 
 // a sorter for messageTuple slice
@@ -120,8 +143,8 @@ type consensusRound struct {
 
 	// track current max proposed state in <roundchange>,  we don't have to compute this for
 	// a non-leader participant, or if there're no more than 2t+1 messages for leader.
-	MaxProposedState State
-	MaxProposedCount int
+	MaxProposedState  State
+	MaxProposedWeight uint64
 }
 
 // newConsensusRound creates a new round, and sets the round number
@@ -142,7 +165,7 @@ func (r *consensusRound) AddRoundChange(sp *SignedProto, m *Message) bool {
 		}
 	}
 
-	r.roundChanges = append(r.roundChanges, messageTuple{StateHash: r.c.stateHash(m.State), Message: m, Signed: sp})
+	r.roundChanges = append(r.roundChanges, messageTuple{StateHash: r.c.stateHash(m.State), Message: m, Signed: sp, Weight: r.c.signerWeight(sp)})
 	return true
 }
 
@@ -166,9 +189,28 @@ func (r *consensusRound) RemoveRoundChange(idx int) {
 	r.roundChanges = r.roundChanges[:n]
 }
 
+// FindCommit will try to find a <commit> from a given participant,
+// and returns index, -1 if not found
+func (r *consensusRound) FindCommit(X PubKeyAxis, Y PubKeyAxis) int {
+	for k := range r.commits {
+		if r.commits[k].Signed.X == X && r.commits[k].Signed.Y == Y {
+			return k
+		}
+	}
+	return -1
+}
+
 // NumRoundChanges returns count of <roundchange> messages.
 func (r *consensusRound) NumRoundChanges() int { return len(r.roundChanges) }
 
+// RoundChangeWeight returns the total weight of <roundchange> messages.
+func (r *consensusRound) RoundChangeWeight() (weight uint64) {
+	for k := range r.roundChanges {
+		weight += r.roundChanges[k].Weight
+	}
+	return
+}
+
 // SignedRoundChanges converts and returns []*SignedProto(as slice)
 func (r *consensusRound) SignedRoundChanges() []*SignedProto {
 	proof := make([]*SignedProto, 0, len(r.roundChanges))
@@ -178,6 +220,18 @@ func (r *consensusRound) SignedRoundChanges() []*SignedProto {
 	return proof
 }
 
+// SignedRoundChangesTo returns the signed <roundchange> messages to the
+// state of the given hash, as the proofs of a <lock> message
+func (r *consensusRound) SignedRoundChangesTo(hash StateHash) []*SignedProto {
+	proof := make([]*SignedProto, 0, len(r.roundChanges))
+	for k := range r.roundChanges {
+		if r.roundChanges[k].StateHash == hash {
+			proof = append(proof, r.roundChanges[k].Signed)
+		}
+	}
+	return proof
+}
+
 // RoundChangeStates returns all non-nil state in exchanging round change message as slice
 func (r *consensusRound) RoundChangeStates() []State {
 	states := make([]State, 0, len(r.roundChanges))
@@ -197,19 +251,19 @@ func (r *consensusRound) AddCommit(sp *SignedProto, m *Message) bool {
 			return false
 		}
 	}
-	r.commits = append(r.commits, messageTuple{StateHash: r.c.stateHash(m.State), Message: m, Signed: sp})
+	r.commits = append(r.commits, messageTuple{StateHash: r.c.stateHash(m.State), Message: m, Signed: sp, Weight: r.c.signerWeight(sp)})
 	return true
 }
 
-// NumCommitted counts <commit> messages which points to what the leader has locked.
-func (r *consensusRound) NumCommitted() int {
-	var count int
+// CommittedWeight sums the weight of <commit> messages which points to what the leader has locked.
+func (r *consensusRound) CommittedWeight() uint64 {
+	var weight uint64
 	for k := range r.commits {
 		if r.commits[k].StateHash == r.LockedStateHash {
-			count++
+			weight += r.commits[k].Weight
 		}
 	}
-	return count
+	return weight
 }
 
 // SignedCommits converts and returns []*SignedProto
@@ -221,8 +275,20 @@ func (r *consensusRound) SignedCommits() []*SignedProto {
 	return proof
 }
 
-// GetMaxProposed finds the most agreed-on non-nil state, if these is any.
-func (r *consensusRound) GetMaxProposed() (s State, count int) {
+// SignedCommitsTo returns the signed <commit> messages to the state of
+// the given hash, as the proofs of a <decide> message
+func (r *consensusRound) SignedCommitsTo(hash StateHash) []*SignedProto {
+	proof := make([]*SignedProto, 0, len(r.commits))
+	for k := range r.commits {
+		if r.commits[k].StateHash == hash {
+			proof = append(proof, r.commits[k].Signed)
+		}
+	}
+	return proof
+}
+
+// GetMaxProposed finds the most agreed-on non-nil state by weight, if these is any.
+func (r *consensusRound) GetMaxProposed() (s State, weight uint64) {
 	if len(r.roundChanges) == 0 {
 		return nil, 0
 	}
@@ -238,22 +304,22 @@ func (r *consensusRound) GetMaxProposed() (s State, count int) {
 	}
 	sort.Sort(&sorter)
 
-	// find the maximum occurred hash
+	// find the maximum weighted hash
 	// O(n)
-	maxCount := 1
+	maxCount := r.roundChanges[0].Weight
 	maxState := r.roundChanges[0]
-	curCount := 1
+	curCount := r.roundChanges[0].Weight
 
 	n := len(r.roundChanges)
 	for i := 1; i < n; i++ {
 		if r.roundChanges[i].StateHash == r.roundChanges[i-1].StateHash {
-			curCount++
+			curCount += r.roundChanges[i].Weight
 		} else {
 			if curCount > maxCount {
 				maxCount = curCount
 				maxState = r.roundChanges[i-1]
 			}
-			curCount = 1
+			curCount = r.roundChanges[i].Weight
 		}
 	}
 
@@ -278,7 +344,8 @@ type Consensus struct {
 	latestRound  uint64       // latest confirmed round
 	latestProof  *SignedProto // latest <decide> message to prove the state
 
-	unconfirmed []State // data awaiting to be confirmed at next height
+	unconfirmed []State            // data awaiting to be confirmed at next height
+	proposed    map[StateHash]bool // states of unconfirmed proposed by this participant via Propose
 
 	rounds       list.List       // all rounds at next height(consensus round in progress)
 	currentRound *consensusRound // current round which has collected >=2t+1 <roundchange>
@@ -294,20 +361,75 @@ type Consensus struct {
 
 	// the StateCompare function from config
 	stateCompare func(State, State) int
-	// the StateValidate function from config
-	stateValidate func(State) bool
+	// the StateValidateErr function from config, or StateValidate wrapped
+	stateValidateErr func(State) error
+	// the most recent state rejected by stateValidateErr, and the reason
+	lastRejectedState State
+	lastRejectedErr   error
+	// set by PauseProposing
+	proposingPaused bool
 	// message in callback
 	messageValidator func(c *Consensus, m *Message, sp *SignedProto) bool
+	// message filter before verification
+	messageFilter func(sp *SignedProto) bool
+	// protocol versions of incoming messages to accept
+	acceptedVersions []uint32
+	// number of participants required for equal weighting
+	quorumSize func(n int) int
+	// duration of a round to be reported as stuck
+	stuckThreshold time.Duration
+	// duration of a height to be reported as stalled to onStall, 0 to disable
+	livenessTimeout time.Duration
+	onStall         func(height, round uint64, stalledFor time.Duration)
+	// the height being watched for stalls, since when, and the last report
+	stallHeight   uint64
+	stallSince    time.Time
+	stallNotified time.Time
 	// message out callback
 	messageOutCallback func(m *Message, sp *SignedProto)
+	// callback for accepted messages counted toward decisions
+	auditSink func(sp *SignedProto, m *Message)
+
+	// callback when a height is decided
+	decideCallback func(height uint64, round uint64, state State, proof *SignedProto)
+	// the last height notified to decideCallback
+	decidedHeight uint64
+	// callback when the round advances
+	roundChangeCallback func(height, oldRound, newRound uint64, reason string)
+
+	// statistics collector
+	metrics Metrics
+	// logger
+	logger Logger
+	// source of time
+	clock Clock
+	// the height & round being measured, and the time it started
+	measuredHeight uint64
+	measuredRound  uint64
+	roundStarted   time.Time
+	// the time the measured height started, and stats of recent heights
+	heightStarted time.Time
+	heightStats   [heightStatsSize]heightStat
 	// public key to identity function
 	pubKeyToIdentity func(pubkey *ecdsa.PublicKey) Identity
 
 	// the StateHash function to identify a state
 	stateHash func(State) StateHash
 
+	// the hasher to digest messages for signing
+	hasher *Hasher
+
+	// sign & accept messages in compact form
+	enableCompactMessage bool
+
 	// private key
 	privateKey *ecdsa.PrivateKey
+	// the public key of the signer
+	publicKey *ecdsa.PublicKey
+	// signer of non-compact messages
+	signer Signer
+	// signature scheme of the signer, messages in other schemes are rejected
+	scheme SignatureScheme
 	// my publickey coodinate
 	identity Identity
 	// curve retrieved from private key
@@ -315,6 +437,42 @@ type Consensus struct {
 
 	// transmission delay
 	latency time.Duration
+	// adapt latency to observed round trips of <commit>, within the bounds
+	adaptiveLatency bool
+	minLatency      time.Duration
+	maxLatency      time.Duration
+	// the round sampled for latency as the leader, the time its <lock> was
+	// broadcasted, and the samples of participants
+	latencyHeight  uint64
+	latencyRound   uint64
+	lockSent       time.Time
+	latencySampled map[Identity]struct{}
+	latencySamples []time.Duration
+	// user defined <roundchange> timeout
+	roundChangeBackoff func(round uint64) time.Duration
+	// user defined leader election
+	leaderFunc func(height, round uint64, participants []Identity) Identity
+	// min interval between <resync> messages, 0 for no limit
+	resyncInterval time.Duration
+	// the last time this node broadcasted <resync> at current height
+	resyncSent time.Time
+	// the last time <resync> from participants processed at current height
+	resyncReceived map[Identity]time.Time
+	// number of future heights to buffer messages for, 0 to disable
+	futureHeights int
+	// max total bytes of buffered messages of future heights
+	futureBufferSize int
+	// buffered messages of future heights, and their total bytes
+	future      []futureMessage
+	futureBytes int
+	// usage of the buffer by senders
+	futureQuotas map[Identity]futureQuota
+	// max number of buffered messages, 0 for no limit
+	maxPendingMessages int
+	// max number of goroutines verifying a batch of messages
+	verifyWorkers int
+	// messages whose signatures have been verified by ReceiveMessages
+	preverified map[*SignedProto]struct{}
 
 	// all connected peers
 	peers []PeerInterface
@@ -322,6 +480,21 @@ type Consensus struct {
 	// participants is the consensus group, current leader is r % quorum
 	participants []Identity
 
+	// participantIndex maps identities to their index in participants
+	participantIndex map[Identity]int
+
+	// stake weights of participants, nil for equal weighting
+	weights map[Identity]uint64
+	// total weight of individual participants
+	totalWeight uint64
+
+	// pending participant changes to apply once the height is decided
+	participantChanges map[uint64]*participantChange
+
+	// the previous consensus group, still honored for messages at the transition height
+	transitionHeight uint64
+	transitionIndex  map[Identity]int
+
 	// count num of individual identities
 	numIdentities int
 
@@ -333,39 +506,143 @@ type Consensus struct {
 
 	// broadcasting messages being sent to myself
 	loopback [][]byte
+	// broadcasting messages are delivered back to myself by the transport
+	externalLoopback bool
+
+	// max bytes of a state, 0 to disable
+	maxStateSize int
+
+	// events of decided heights
+	decidedCh chan DecideEvent
+
+	// the budget to verify & validate one message, 0 to disable
+	maxMessageProcessTime time.Duration
+	// the deadline of the message being processed, zero if not limited
+	processDeadline time.Time
 
 	// the last message which caused round change
 	lastRoundChangeProof []*SignedProto
+
+	// first signed messages of participants at current height, and decided
+	// heights within staleAcceptWindow, for equivocation detection
+	signedMessages map[equivocationKey]messageTuple
+	// equivocations detected, awaiting to be taken
+	equivocations []Equivocation
+	// offenders reported at current height
+	evidenceKeys map[evidenceKey]struct{}
+	// max number of retained equivocations
+	maxEvidence int
+	// number of decided heights whose messages are still recorded
+	staleAcceptWindow uint64
+	// late <commit> messages of decided heights within staleAcceptWindow
+	lateCommits map[uint64]*lateCommits
+	// number of accepted stale messages of each sender at decided heights
+	staleCounts map[staleKey]int
+	// <decide> proofs of latest decided heights, for ExportProofs
+	proofs       map[uint64][]byte
+	proofHeights []uint64
+	proofHistory int
+	// processed messages not below the decided height, to make replays idempotent
+	seen      map[seenKey]struct{}
+	seenCount map[seenSender]int
+
+	// snapshot of the state machine for concurrent readers
+	observer observer
 }
 
 // NewConsensus creates a BDLS consensus object to participant in consensus procedure,
 // the consensus object returned is data in memory without goroutines or other
 // non-deterministic objects, and errors will be returned if there is problem, with
 // the given config.
-func NewConsensus(config *Config) (*Consensus, error) {
-	err := VerifyConfig(config)
-	if err != nil {
-		return nil, err
-	}
-
-	c := new(Consensus)
-	c.init(config)
-	return c, nil
-}
+func NewConsensus(config *Config) (*Consensus, error) { return New(WithConfig(config)) }
 
 // init consensus with config
 func (c *Consensus) init(config *Config) {
 	// setting current state & height
 	c.latestHeight = config.CurrentHeight
-	c.participants = config.Participants
+	c.observeDecided()
+	c.weights = config.Weights
+	c.setParticipants(config.Participants)
 	c.stateCompare = config.StateCompare
-	c.stateValidate = config.StateValidate
+	c.stateValidateErr = config.StateValidateErr
 	c.messageValidator = config.MessageValidator
+	c.messageFilter = config.MessageFilter
+	c.acceptedVersions = append([]uint32(nil), config.AcceptedVersions...)
+	c.quorumSize = config.QuorumSize
+	c.livenessTimeout = config.LivenessTimeout
+	c.onStall = config.OnStall
+	c.stuckThreshold = config.StuckThreshold
+	if c.stuckThreshold <= 0 {
+		c.stuckThreshold = DefaultStuckThreshold
+	}
 	c.messageOutCallback = config.MessageOutCallback
+	c.auditSink = config.AuditSink
+	c.externalLoopback = config.ExternalLoopback
+	c.maxMessageProcessTime = config.MaxMessageProcessTime
+	c.maxStateSize = config.MaxStateSize
+	if config.DecidedChSize > 0 {
+		c.decidedCh = make(chan DecideEvent, config.DecidedChSize)
+	} else {
+		c.decidedCh = make(chan DecideEvent, DefaultDecidedChSize)
+	}
+	c.roundChangeBackoff = config.RoundChangeBackoff
+	c.leaderFunc = config.LeaderFunc
+	c.maxPendingMessages = config.MaxPendingMessages
+	c.resyncInterval = config.ResyncInterval
+	c.adaptiveLatency = config.AdaptiveLatency
+	c.maxLatency = config.MaxLatency
+	if c.maxLatency <= 0 {
+		c.maxLatency = MaxConsensusLatency
+	}
+	c.minLatency = config.MinLatency
+	if c.minLatency <= 0 {
+		c.minLatency = DefaultMinConsensusLatency
+	}
+	if c.minLatency > c.maxLatency {
+		c.minLatency = c.maxLatency
+	}
+	c.futureHeights = config.FutureHeights
+	if c.futureHeights == 0 {
+		c.futureHeights = DefaultFutureHeights
+	}
+	c.futureBufferSize = config.FutureBufferSize
+	if c.futureBufferSize <= 0 {
+		c.futureBufferSize = DefaultFutureBufferSize
+	}
+	c.staleAcceptWindow = config.StaleAcceptWindow
+	c.maxEvidence = config.MaxEvidence
+	if c.maxEvidence <= 0 {
+		c.maxEvidence = DefaultMaxEvidence
+	}
+	c.proofHistory = config.ProofHistory
+	if c.proofHistory == 0 {
+		c.proofHistory = DefaultProofHistory
+	}
+	c.verifyWorkers = config.VerifyWorkers
+	c.decideCallback = config.DecideCallback
+	c.roundChangeCallback = config.RoundChangeCallback
+	c.decidedHeight = config.CurrentHeight
+	c.metrics = config.Metrics
+	c.logger = config.Logger
+	c.measuredHeight = config.CurrentHeight
+	c.roundStarted = config.Epoch
+	c.heightStarted = config.Epoch
 	c.privateKey = config.PrivateKey
 	c.pubKeyToIdentity = config.PubKeyToIdentity
 	c.enableCommitUnicast = config.EnableCommitUnicast
-
+	c.hasher = config.Hasher
+	c.enableCompactMessage = config.EnableCompactMessage
+
+	// if config has not set validation with reasons, wrap the bool version
+	if c.stateValidateErr == nil {
+		stateValidate := config.StateValidate
+		c.stateValidateErr = func(s State) error {
+			if !stateValidate(s) {
+				return ErrStateRejected
+			}
+			return nil
+		}
+	}
 	// if config has not set hash function, use the default
 	if c.stateHash == nil {
 		c.stateHash = defaultHash
@@ -374,70 +651,299 @@ func (c *Consensus) init(config *Config) {
 	if c.pubKeyToIdentity == nil {
 		c.pubKeyToIdentity = DefaultPubKeyToIdentity
 	}
-	c.identity = c.pubKeyToIdentity(&c.privateKey.PublicKey)
-	c.curve = c.privateKey.Curve
+	// if config has not set message hasher, use the default
+	if c.hasher == nil {
+		c.hasher = DefaultHasher
+	}
+	// if config has not set verify workers, use all CPUs
+	if c.verifyWorkers <= 0 {
+		c.verifyWorkers = runtime.NumCPU()
+	}
+	// if config has not set metrics, use the no-op one
+	if c.metrics == nil {
+		c.metrics = noopMetrics{}
+	}
+	// if config has not set logger, use the no-op one
+	if c.logger == nil {
+		c.logger = noopLogger{}
+	}
+	// if config has not set clock, use the wall clock
+	c.clock = config.Clock
+	if c.clock == nil {
+		c.clock = wallClock{}
+	}
+	if len(config.DomainSeparator) > 0 {
+		c.hasher = c.hasher.WithDomain(config.DomainSeparator)
+	}
+	if config.Follower {
+		// no signer, and no identity among participants
+		c.privateKey = nil
+		c.curve = S256Curve
+		c.scheme = SchemeSecp256k1
+	} else if config.MessageSigner != nil {
+		c.signer = config.MessageSigner
+		c.curve = S256Curve
+		// the public key has been validated in config
+		X, Y, _ := c.signer.PublicKey()
+		c.publicKey = (&SignedProto{X: X, Y: Y}).PublicKey(c.curve)
+	} else if config.Signer != nil {
+		c.privateKey = nil
+		c.signer = NewECDSAKeySigner(config.Signer)
+		c.publicKey = config.Signer.PublicKey()
+		c.curve = c.publicKey.Curve
+	} else {
+		// own a copy of the key, so RotateKey wipes memory of this instance only
+		c.privateKey = clonePrivateKey(c.privateKey)
+		c.signer = NewECDSASignerRand(c.privateKey, config.Rand)
+		c.publicKey = &c.privateKey.PublicKey
+		c.curve = c.privateKey.Curve
+	}
+	if c.signer != nil {
+		c.identity = c.pubKeyToIdentity(c.publicKey)
+		c.scheme = c.signer.Scheme()
+	}
 
 	// initial default parameters settings
 	c.latency = DefaultConsensusLatency
 
-	// and initiated the first <roundchange> proposal
-	c.switchRound(0)
+	// and initiated the first <roundchange> proposal, which is sent by start
+	c.switchRound(config.CurrentRound)
 	c.currentRound.Stage = stageRoundChanging
-	c.broadcastRoundChange()
 	// set rcTimeout to lockTimeout
-	c.rcTimeout = config.Epoch.Add(c.roundchangeDuration(0))
+	c.rcTimeout = config.Epoch.Add(c.roundchangeDuration(config.CurrentRound))
+	c.observe()
+}
+
+// start sends the first <roundchange> of current round, it's called by New
+// once the states have been initialized from config. It's not called by
+// LoadConsensus, as the snapshot records what has been sent, so no message of
+// the initial height & round is sent by a restored consensus.
+func (c *Consensus) start() {
+	c.broadcastRoundChange()
+	c.observe()
+}
+
+// setParticipants sets the consensus group, and rebuilds the participant
+// lookup map along with the number of individual identities.
+func (c *Consensus) setParticipants(participants []Identity) {
+	c.participants = participants
+	c.participantIndex = make(map[Identity]int, len(participants))
+	for k, id := range participants {
+		if _, exists := c.participantIndex[id]; !exists {
+			c.participantIndex[id] = k
+		}
+	}
+	c.numIdentities = len(c.participantIndex)
+
+	c.totalWeight = 0
+	for id := range c.participantIndex {
+		c.totalWeight += c.weightOf(id)
+	}
+}
+
+// participantChange defines the identities to add & remove from the consensus group
+type participantChange struct {
+	add    []Identity
+	remove []Identity
+	set    []Identity // replaces the whole group if not nil
+}
+
+// apply returns a new consensus group with identities removed then added,
+// the order of remaining participants is kept, new ones are appended.
+func (pc *participantChange) apply(participants []Identity) []Identity {
+	if pc.set != nil {
+		return append([]Identity(nil), pc.set...)
+	}
+
+	removed := make(map[Identity]bool)
+	for _, id := range pc.remove {
+		removed[id] = true
+	}
+
+	var ret []Identity
+	exists := make(map[Identity]bool)
+	for _, id := range participants {
+		if !removed[id] && !exists[id] {
+			ret = append(ret, id)
+			exists[id] = true
+		}
+	}
+	for _, id := range pc.add {
+		if !exists[id] {
+			ret = append(ret, id)
+			exists[id] = true
+		}
+	}
+	return ret
+}
+
+// ProposeParticipantChange schedules a change of the consensus group, once a
+// decision has been reached at height atHeight, the consensus switches to the new
+// group for the following heights, and the 2t+1 quorum is recomputed from it.
+//
+// Messages from the previous group are still honored for atHeight itself. As the
+// leader is derived from the group of the height in consensus, a removed validator
+// may still lead rounds at atHeight, but will never lead after the switch. If this
+// node itself is removed, it keeps following but its messages will be rejected by others.
+//
+// The resulting group must contain at least ConfigMinimumParticipants identities.
+func (c *Consensus) ProposeParticipantChange(atHeight uint64, add []Identity, remove []Identity) error {
+	if atHeight <= c.latestHeight {
+		return ErrParticipantChangeHeight
+	}
+
+	change := &participantChange{
+		add:    append([]Identity{}, add...),
+		remove: append([]Identity{}, remove...),
+	}
+
+	// validate the group after all pending changes till atHeight have been applied
+	participants := c.participants
+	for _, h := range c.pendingChangeHeights(atHeight) {
+		if h != atHeight {
+			participants = c.participantChanges[h].apply(participants)
+		}
+	}
+	if len(change.apply(participants)) < ConfigMinimumParticipants {
+		return ErrConfigParticipants
+	}
+
+	if c.participantChanges == nil {
+		c.participantChanges = make(map[uint64]*participantChange)
+	}
+	c.participantChanges[atHeight] = change
+	return nil
+}
+
+// ReloadParticipants replaces the consensus group with ids, eg: reloaded from
+// a configuration file, the new group is switched to atomically once current
+// height has been decided, and the quorum is recomputed from it, as
+// ProposeParticipantChange does. Any change proposed at current height is
+// replaced, and changes at later heights still apply on the new group.
+//
+// The new group must contain at least ConfigMinimumParticipants distinct
+// identities.
+func (c *Consensus) ReloadParticipants(ids []Identity) error {
+	if len(ids) < ConfigMinimumParticipants {
+		return ErrConfigParticipants
+	}
+
+	seen := make(map[Identity]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return ErrConfigParticipantsDuplicated
+		}
+		seen[id] = true
+	}
+
+	if c.participantChanges == nil {
+		c.participantChanges = make(map[uint64]*participantChange)
+	}
+	c.participantChanges[c.latestHeight+1] = &participantChange{set: append([]Identity{}, ids...)}
+	return nil
+}
 
-	// count number of individual identites
-	ids := make(map[Identity]bool)
-	for _, id := range c.participants {
-		ids[id] = true
+// pendingChangeHeights returns the heights of pending participant changes
+// not above the given height, in ascending order.
+func (c *Consensus) pendingChangeHeights(height uint64) []uint64 {
+	var heights []uint64
+	for h := range c.participantChanges {
+		if h <= height {
+			heights = append(heights, h)
+		}
 	}
-	c.numIdentities = len(ids)
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights
+}
+
+// applyParticipantChanges switches to the new consensus group if any
+// participant change is due at or below the decided height.
+func (c *Consensus) applyParticipantChanges(height uint64) {
+	heights := c.pendingChangeHeights(height)
+	if len(heights) == 0 {
+		return
+	}
+
+	c.transitionHeight = height
+	c.transitionIndex = c.participantIndex
+
+	participants := c.participants
+	for _, h := range heights {
+		participants = c.participantChanges[h].apply(participants)
+		delete(c.participantChanges, h)
+	}
+	c.setParticipants(participants)
+}
+
+// IsParticipant checks if the signer of a message is in the consensus group,
+// and returns it's index in Config.Participants. Compact messages must have
+// their public keys recovered first, see SignedProto.RecoverPublicKey.
+func (c *Consensus) IsParticipant(sp *SignedProto) (index int, ok bool) {
+	index, ok = c.participantIndex[c.pubKeyToIdentity(sp.PublicKey(c.curve))]
+	return
+}
+
+// IsParticipantKey checks if the identity of a public key is in the consensus group,
+// and returns it's index in Config.Participants.
+func (c *Consensus) IsParticipantKey(pubkey *ecdsa.PublicKey) (index int, ok bool) {
+	index, ok = c.participantIndex[c.pubKeyToIdentity(pubkey)]
+	return
+}
+
+// HasParticipant checks if an identity is in the consensus group,
+// and returns it's index in Config.Participants.
+func (c *Consensus) HasParticipant(id Identity) (index int, ok bool) {
+	index, ok = c.participantIndex[id]
+	return
+}
+
+// backoffDuration returns base*2^round capped by MaxConsensusLatency,
+// without overflow for large rounds.
+func backoffDuration(base time.Duration, round uint64) time.Duration {
+	if round >= 63 || base > MaxConsensusLatency>>round {
+		return MaxConsensusLatency
+	}
+	return base << round
 }
 
 //  calculates roundchangeDuration
 func (c *Consensus) roundchangeDuration(round uint64) time.Duration {
-	d := 2 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
+	if c.roundChangeBackoff != nil {
+		return c.roundChangeBackoff(round)
 	}
-	return d
+
+	return backoffDuration(2*c.latency, round)
 }
 
 //  calculates collectDuration
 func (c *Consensus) collectDuration(round uint64) time.Duration {
-	d := 2 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
-	}
-	return d
+	return backoffDuration(2*c.latency, round)
 }
 
 //  calculates lockDuration
 func (c *Consensus) lockDuration(round uint64) time.Duration {
-	d := 4 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
-	}
-	return d
+	return backoffDuration(4*c.latency, round)
 }
 
 // calculates commitDuration
 func (c *Consensus) commitDuration(round uint64) time.Duration {
-	d := 2 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
-	}
-	return d
+	return backoffDuration(2*c.latency, round)
 }
 
 // calculates lockReleaseDuration
 func (c *Consensus) lockReleaseDuration(round uint64) time.Duration {
-	d := 2 * c.latency * (1 << round)
-	if d > MaxConsensusLatency {
-		d = MaxConsensusLatency
+	return backoffDuration(2*c.latency, round)
+}
+
+// compareStates compares states with the StateCompare function in config,
+// and breaks ties by state hashes, to select the same state among the tied
+// ones on all participants.
+func (c *Consensus) compareStates(a State, b State) int {
+	if r := c.stateCompare(a, b); r != 0 {
+		return r
 	}
-	return d
+	ha, hb := c.stateHash(a), c.stateHash(b)
+	return bytes.Compare(ha[:], hb[:])
 }
 
 // maximalLocked finds the maximum locked data in this round,
@@ -446,7 +952,7 @@ func (c *Consensus) maximalLocked() State {
 	if len(c.locks) > 0 {
 		maxState := c.locks[0].Message.State
 		for i := 1; i < len(c.locks); i++ {
-			if c.stateCompare(maxState, c.locks[i].Message.State) < 0 {
+			if c.compareStates(maxState, c.locks[i].Message.State) < 0 {
 				maxState = c.locks[i].Message.State
 			}
 		}
@@ -461,7 +967,7 @@ func (c *Consensus) maximalUnconfirmed() State {
 	if len(c.unconfirmed) > 0 {
 		maxState := c.unconfirmed[0]
 		for i := 1; i < len(c.unconfirmed); i++ {
-			if c.stateCompare(maxState, c.unconfirmed[i]) < 0 {
+			if c.compareStates(maxState, c.unconfirmed[i]) < 0 {
 				maxState = c.unconfirmed[i]
 			}
 		}
@@ -470,27 +976,64 @@ func (c *Consensus) maximalUnconfirmed() State {
 	return nil
 }
 
+// messagePool recycles transient Message decode targets, pooled messages
+// are reset on putting back, and must not be retained after that.
+var messagePool = sync.Pool{New: func() interface{} { return new(Message) }}
+
+// putMessage resets the message and puts it back to messagePool
+func putMessage(m *Message) {
+	m.Reset()
+	messagePool.Put(m)
+}
+
 // verifyMessage verifies message signature against it's <r,s> & <x,y>,
 // and also checks if the signer is a valid participant.
 // returns it's decoded 'Message' object if signature has proved authentic.
 // returns nil and error if message has not been correctly signed or from an unknown participant.
 func (c *Consensus) verifyMessage(signed *SignedProto) (*Message, error) {
+	m := new(Message)
+	if err := c.verifyMessageInto(signed, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// verifyMessageInto verifies the message as verifyMessage does, and decodes into m.
+func (c *Consensus) verifyMessageInto(signed *SignedProto, m *Message) error {
 	if signed == nil {
-		return nil, ErrMessageIsEmpty
+		return ErrMessageIsEmpty
 	}
 
-	// check signer's identity, all participants have proven
-	// public key
-	knownParticipants := false
-	coord := c.pubKeyToIdentity(signed.PublicKey(c.curve))
-	for k := range c.participants {
-		if coord == c.participants[k] {
-			knownParticipants = true
+	// all participants sign in the same scheme
+	if signed.Scheme != c.scheme {
+		return ErrMessageScheme
+	}
+
+	// oversize states are rejected before any signature work, including the
+	// states in proofs
+	if c.stateTooLarge(signed.Message) {
+		return ErrStateTooLarge
+	}
+
+	// compact messages carry no public key, recover it first
+	if signed.V != 0 {
+		if !c.enableCompactMessage {
+			return ErrMessageCompactDisabled
+		}
+		if signed.RecoverPublicKey(c.hasher) != nil {
+			return ErrMessageSignature
 		}
 	}
 
-	if !knownParticipants {
-		return nil, ErrMessageUnknownParticipant
+	// check signer's identity, all participants have proven
+	// public key
+	_, known := c.IsParticipant(signed)
+	transitional := false
+	if !known {
+		// previous group is honored for messages at the transition height
+		if _, transitional = c.transitionIndex[c.pubKeyToIdentity(signed.PublicKey(c.curve))]; !transitional {
+			return ErrMessageUnknownParticipant
+		}
 	}
 
 	/*
@@ -499,25 +1042,66 @@ func (c *Consensus) verifyMessage(signed *SignedProto) (*Message, error) {
 		x := new(big.Int).SetBytes(signed.X[:])
 		y := new(big.Int).SetBytes(signed.Y[:])
 		if x.Cmp(p) >= 0 || y.Cmp(p) >= 0 {
-			return nil, ErrMessageSignature
+			return ErrMessageSignature
 		}
 		if !defaultCurve.IsOnCurve(x, y) {
-			return nil, ErrMessageSignature
+			return ErrMessageSignature
 		}
 	*/
 
-	// as public key is proven , we don't have to verify the public key
-	if !signed.Verify(c.curve) {
-		return nil, ErrMessageSignature
+	// as public key is proven , we don't have to verify the public key,
+	// signatures verified by ReceiveMessages are not verified again
+	if _, ok := c.preverified[signed]; !ok {
+		if signed.VerifyWith(c.curve, c.hasher) != nil {
+			return ErrMessageSignature
+		}
 	}
 
 	// decode message
-	m := new(Message)
 	err := proto.Unmarshal(signed.Message, m)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return m, nil
+
+	if transitional && m.Height != c.transitionHeight {
+		return ErrMessageUnknownParticipant
+	}
+	return nil
+}
+
+// maxProofDepth is the deepest nesting of proofs in messages, as a <lock-release>
+// embeds a <lock> with it's <roundchange> proofs.
+const maxProofDepth = 2
+
+// stateTooLarge peeks an encoded message without decoding it, and checks if
+// it or it's proofs carry a state beyond Config.MaxStateSize. Malformed
+// messages are left to the decoder.
+func (c *Consensus) stateTooLarge(bts []byte) bool {
+	if c.maxStateSize <= 0 {
+		return false
+	}
+
+	var peek func(bts []byte, depth int) error
+	peek = func(bts []byte, depth int) error {
+		return walkMessage(bts, func(field uint64, wire uint64, value uint64, b []byte) error {
+			if wire != wireBytes {
+				return nil
+			}
+			switch {
+			case field == messageFieldState && len(b) > c.maxStateSize:
+				return ErrStateTooLarge
+			case (field == messageFieldProof || field == messageFieldLockRelease) && depth < maxProofDepth:
+				return walkMessage(b, func(field uint64, wire uint64, value uint64, b []byte) error {
+					if field == signedFieldMessage && wire == wireBytes {
+						return peek(b, depth+1)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+	return peek(bts, 0) == ErrStateTooLarge
 }
 
 // verify <roundchange> message
@@ -544,7 +1128,7 @@ func (c *Consensus) verifyRoundChangeMessage(m *Message) error {
 
 // verifyLockMessage verifies proofs from <lock> messages,
 // a lock message must contain at least 2t+1 individual <roundchange>
-// messages on B'
+// messages on B', and no <roundchange> messages on other states
 func (c *Consensus) verifyLockMessage(m *Message, signed *SignedProto) error {
 	// check message height
 	if m.Height != c.latestHeight+1 {
@@ -567,16 +1151,23 @@ func (c *Consensus) verifyLockMessage(m *Message, signed *SignedProto) error {
 	}
 
 	// make sure this message has been signed by the leader
-	leaderKey := c.roundLeader(m.Round)
+	leaderKey := c.roundLeader(m.Height, m.Round)
 	if c.pubKeyToIdentity(signed.PublicKey(c.curve)) != leaderKey {
 		return ErrLockNotSignedByLeader
 	}
 
 	// validate proofs enclosed in the message one by one
-	rcs := make(map[Identity]State)
+	rcs := make(map[Identity]struct{})
+	mHash := c.stateHash(m.State)
+	// proofs are decoded into a pooled message, as they are not retained
+	mProof := messagePool.Get().(*Message)
+	defer putMessage(mProof)
 	for _, proof := range m.Proof {
+		if err := c.checkBudget(); err != nil {
+			return err
+		}
 		// first we need to verify the signature,and identity of this proof
-		mProof, err := c.verifyMessage(proof)
+		err := c.verifyMessageInto(proof, mProof)
 		if err != nil {
 			if err == ErrMessageUnknownParticipant {
 				return ErrLockProofUnknownParticipant
@@ -599,29 +1190,25 @@ func (c *Consensus) verifyLockMessage(m *Message, signed *SignedProto) error {
 			return ErrLockProofRoundMismatch
 		}
 
-		// state data validation in proofs
-		if mProof.State != nil {
-			if !c.stateValidate(mProof.State) {
-				return ErrLockProofStateValidation
-			}
+		// every proof must endorse the locked state B', signatures to
+		// other states can't be assembled into a quorum for B'
+		if c.stateHash(mProof.State) != mHash {
+			return ErrLockProofStateMismatch
 		}
 
 		// use map to guarantee we will only accept at most 1 message from one
 		// individual participant
-		rcs[c.pubKeyToIdentity(proof.PublicKey(c.curve))] = mProof.State
+		rcs[c.pubKeyToIdentity(proof.PublicKey(c.curve))] = struct{}{}
 	}
 
-	// count individual proofs to B', which has already guaranteed to be the maximal one.
-	var numValidateProofs int
-	mHash := c.stateHash(m.State)
-	for _, v := range rcs {
-		if c.stateHash(v) == mHash { // B'
-			numValidateProofs++
-		}
+	// weigh individual proofs to B', which has already guaranteed to be the maximal one.
+	var validateWeight uint64
+	for id := range rcs {
+		validateWeight += c.weightOf(id)
 	}
 
-	// check if valid proofs count is less that 2*t+1
-	if numValidateProofs < 2*c.t()+1 {
+	// check if valid proofs weight is less that 2*t+1
+	if !c.hasQuorum(validateWeight) {
 		return ErrLockProofInsufficient
 	}
 	return nil
@@ -649,6 +1236,60 @@ func (c *Consensus) verifyLockReleaseMessage(signed *SignedProto) (*Message, err
 	return lockmsg, nil
 }
 
+// verifyProofScope checks that every proof embedded in m belongs to the
+// height and round of m, before any signature of the proofs is verified.
+// Proofs spliced from another height or round may individually verify,
+// so the whole message will be rejected if any of them is out of scope.
+// A <lock-release> message may embed a <lock> from an earlier round, but
+// never from a later one.
+func (c *Consensus) verifyProofScope(m *Message) error {
+	var errHeight, errRound error
+	switch m.Type {
+	case MessageType_Lock:
+		errHeight, errRound = ErrLockProofHeightMismatch, ErrLockProofRoundMismatch
+	case MessageType_Select:
+		errHeight, errRound = ErrSelectProofHeightMismatch, ErrSelectProofRoundMismatch
+	case MessageType_Decide:
+		errHeight, errRound = ErrDecideProofHeightMismatch, ErrDecideProofRoundMismatch
+	case MessageType_LockRelease:
+		if m.LockRelease == nil {
+			return nil
+		}
+		lockmsg := messagePool.Get().(*Message)
+		defer putMessage(lockmsg)
+		if err := proto.Unmarshal(m.LockRelease.Message, lockmsg); err != nil {
+			return err
+		}
+		if lockmsg.Height != m.Height {
+			return ErrLockReleaseHeightMismatch
+		}
+		if lockmsg.Round > m.Round {
+			return ErrLockReleaseRoundMismatch
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	mProof := messagePool.Get().(*Message)
+	defer putMessage(mProof)
+	for _, proof := range m.Proof {
+		if proof == nil {
+			return ErrMessageIsEmpty
+		}
+		if err := proto.Unmarshal(proof.Message, mProof); err != nil {
+			return err
+		}
+		if mProof.Height != m.Height {
+			return errHeight
+		}
+		if mProof.Round != m.Round {
+			return errRound
+		}
+	}
+	return nil
+}
+
 // verifySelectMessage verifies proofs from <select> message,
 // <select> message MUST contain at least 2t+1 individual messages, but
 // proofs from <select> message MUST NOT contain >= 2t+1 individual
@@ -672,14 +1313,20 @@ func (c *Consensus) verifySelectMessage(m *Message, signed *SignedProto) error {
 	}
 
 	// make sure this message has been signed by the leader
-	leaderKey := c.roundLeader(m.Round)
+	leaderKey := c.roundLeader(m.Height, m.Round)
 	if c.pubKeyToIdentity(signed.PublicKey(c.curve)) != leaderKey {
 		return ErrSelectNotSignedByLeader
 	}
 
 	rcs := make(map[Identity]State)
+	// proofs are decoded into a pooled message, as they are not retained
+	mProof := messagePool.Get().(*Message)
+	defer putMessage(mProof)
 	for _, proof := range m.Proof {
-		mProof, err := c.verifyMessage(proof)
+		if err := c.checkBudget(); err != nil {
+			return err
+		}
+		err := c.verifyMessageInto(proof, mProof)
 		if err != nil {
 			if err == ErrMessageUnknownParticipant {
 				return ErrSelectProofUnknownParticipant
@@ -709,7 +1356,7 @@ func (c *Consensus) verifySelectMessage(m *Message, signed *SignedProto) error {
 		// we also need to check the B'' selected by leader is the maximal one,
 		// if data has been proposed.
 		if mProof.State != nil && m.State != nil {
-			if c.stateCompare(m.State, mProof.State) < 0 {
+			if c.compareStates(m.State, mProof.State) < 0 {
 				return ErrSelectProofNotTheMaximal
 			}
 		}
@@ -719,16 +1366,20 @@ func (c *Consensus) verifySelectMessage(m *Message, signed *SignedProto) error {
 	}
 
 	// check we have at least 2*t+1 proof
-	if len(rcs) < 2*c.t()+1 {
+	var proofWeight uint64
+	for id := range rcs {
+		proofWeight += c.weightOf(id)
+	}
+	if !c.hasQuorum(proofWeight) {
 		return ErrSelectProofInsufficient
 	}
 
-	// count maximum proofs with B' != NULL with identical data hash,
+	// weigh maximum proofs with B' != NULL with identical data hash,
 	// to prevent leader cheating on select.
-	dataProposals := make(map[StateHash]int)
-	for _, data := range rcs {
+	dataProposals := make(map[StateHash]uint64)
+	for id, data := range rcs {
 		if data != nil {
-			dataProposals[c.stateHash(data)]++
+			dataProposals[c.stateHash(data)] += c.weightOf(id)
 		}
 	}
 
@@ -739,16 +1390,16 @@ func (c *Consensus) verifySelectMessage(m *Message, signed *SignedProto) error {
 	}
 
 	// find the highest proposed B'(not NULL)
-	var maxProposed int
-	for _, count := range dataProposals {
-		if count > maxProposed {
-			maxProposed = count
+	var maxProposed uint64
+	for _, weight := range dataProposals {
+		if weight > maxProposed {
+			maxProposed = weight
 		}
 	}
 
 	// if these are more than 2*t+1 valid <roundchange> proofs to B',
 	// this also suggests that the leader may cheat.
-	if maxProposed >= 2*c.t()+1 {
+	if c.hasQuorum(maxProposed) {
 		return ErrSelectProofExceeded
 	}
 
@@ -802,6 +1453,42 @@ func (c *Consensus) ValidateDecideMessage(bts []byte, targetState []byte) error
 	return c.validateDecideMessage(signed, targetState)
 }
 
+// Sync fast-forwards consensus to the height of a verified <decide> proof,
+// for a node falling behind to catch up without replaying every round.
+// Proofs at or below current height will be rejected, the <roundchange>
+// of the new height will be broadcasted on next Update.
+func (c *Consensus) Sync(proof *SignedProto) error {
+	// check message version
+	if !c.acceptVersion(proof.Version) {
+		return ErrProtocolVersion
+	}
+
+	// check message signature & qualifications
+	m, err := c.verifyMessage(proof)
+	if err != nil {
+		return err
+	}
+
+	if m.Type != MessageType_Decide {
+		return ErrMessageUnknownMessageType
+	}
+
+	// verify leader's signature and the <commit> proofs
+	err = c.verifyDecideMessage(m, proof)
+	if err != nil {
+		return err
+	}
+
+	// record this proof for chaining
+	c.latestProof = proof
+	c.heightSync(m.Height, m.Round, m.State, c.clock.Now())
+	// notify the decision
+	c.notifyDecide(m.Height, m.Round, m.State, proof)
+	c.measureRound(c.clock.Now())
+	c.observe()
+	return nil
+}
+
 // DecodeSignedMessage decodes a binary representation of signed consensus message.
 func DecodeSignedMessage(bts []byte) (*SignedProto, error) {
 	signed := new(SignedProto)
@@ -812,6 +1499,15 @@ func DecodeSignedMessage(bts []byte) (*SignedProto, error) {
 	return signed, nil
 }
 
+// DecodeSignedProto decodes a binary representation of signed consensus
+// message, verifies its signature with the DefaultHasher on secp256k1, and
+// decodes the enclosed message, without any consensus state involved. The
+// signer is not checked against any consensus group, see ProofVerifier for
+// other hashers and curves.
+func DecodeSignedProto(bts []byte) (*SignedProto, *Message, error) {
+	return ProofVerifier{}.DecodeSignedProto(bts)
+}
+
 // DecodeMessage decodes a binary representation of consensus message.
 func DecodeMessage(bts []byte) (*Message, error) {
 	msg := new(Message)
@@ -826,8 +1522,8 @@ func DecodeMessage(bts []byte) (*Message, error) {
 // the consensus core must be correctly initialized to validate.
 func (c *Consensus) validateDecideMessage(signed *SignedProto, targetState []byte) error {
 	// check message version
-	if signed.Version != ProtocolVersion {
-		return ErrMessageVersion
+	if !c.acceptVersion(signed.Version) {
+		return ErrProtocolVersion
 	}
 
 	// check message signature & qualifications
@@ -853,7 +1549,8 @@ func (c *Consensus) validateDecideMessage(signed *SignedProto, targetState []byt
 }
 
 // verifyDecideMessage verifies proofs from <decide> message, which MUST
-// contain at least 2t+1 individual <commit> messages to B'.
+// contain at least 2t+1 individual <commit> messages to B', and no
+// <commit> messages to other states.
 func (c *Consensus) verifyDecideMessage(m *Message, signed *SignedProto) error {
 	// a <decide> message from leader MUST include data along with the message
 	if m.State == nil {
@@ -871,14 +1568,21 @@ func (c *Consensus) verifyDecideMessage(m *Message, signed *SignedProto) error {
 	}
 
 	// make sure this message has been signed by the leader
-	leaderKey := c.roundLeader(m.Round)
+	leaderKey := c.roundLeader(m.Height, m.Round)
 	if c.pubKeyToIdentity(signed.PublicKey(c.curve)) != leaderKey {
 		return ErrDecideNotSignedByLeader
 	}
 
-	commits := make(map[Identity]State)
+	commits := make(map[Identity]struct{})
+	mHash := c.stateHash(m.State)
+	// proofs are decoded into a pooled message, as they are not retained
+	mProof := messagePool.Get().(*Message)
+	defer putMessage(mProof)
 	for _, proof := range m.Proof {
-		mProof, err := c.verifyMessage(proof)
+		if err := c.checkBudget(); err != nil {
+			return err
+		}
+		err := c.verifyMessageInto(proof, mProof)
 		if err != nil {
 			if err == ErrMessageUnknownParticipant {
 				return ErrDecideProofUnknownParticipant
@@ -898,32 +1602,24 @@ func (c *Consensus) verifyDecideMessage(m *Message, signed *SignedProto) error {
 			return ErrDecideProofRoundMismatch
 		}
 
-		if !c.stateValidate(mProof.State) {
-			return ErrDecideProofStateValidation
+		// every proof must commit to the decided state, signatures to
+		// other states can't be assembled into a quorum for it
+		if c.stateHash(mProof.State) != mHash {
+			return ErrDecideProofStateMismatch
 		}
 
-		// state data validation in proofs
-		if mProof.State != nil {
-			if !c.stateValidate(mProof.State) {
-				return ErrSelectProofStateValidation
-			}
-		}
-
-		commits[c.pubKeyToIdentity(proof.PublicKey(c.curve))] = mProof.State
+		commits[c.pubKeyToIdentity(proof.PublicKey(c.curve))] = struct{}{}
 	}
 
-	// count proofs to m.State
-	var numValidateProofs int
-	mHash := c.stateHash(m.State)
-	for _, v := range commits {
-		if c.stateHash(v) == mHash {
-			numValidateProofs++
-		}
+	// weigh proofs to m.State
+	var validateWeight uint64
+	for id := range commits {
+		validateWeight += c.weightOf(id)
 	}
 
 	// check to see if the message has at least 2*t+1 <commit> valid proofs,
 	// if not, the leader may cheat.
-	if numValidateProofs < 2*c.t()+1 {
+	if !c.hasQuorum(validateWeight) {
 		return ErrDecideProofInsufficient
 	}
 	return nil
@@ -969,7 +1665,7 @@ func (c *Consensus) broadcastLock() {
 	m.Height = c.latestHeight + 1
 	m.Round = c.currentRound.RoundNumber
 	m.State = c.currentRound.LockedState
-	m.Proof = c.currentRound.SignedRoundChanges()
+	m.Proof = c.currentRound.SignedRoundChangesTo(c.currentRound.LockedStateHash)
 	c.broadcast(&m)
 	//log.Println("broadcast:<lock>")
 }
@@ -1006,18 +1702,24 @@ func (c *Consensus) broadcastDecide() *SignedProto {
 	m.Height = c.latestHeight + 1
 	m.Round = c.currentRound.RoundNumber
 	m.State = c.currentRound.LockedState
-	m.Proof = c.currentRound.SignedCommits()
+	m.Proof = c.currentRound.SignedCommitsTo(c.currentRound.LockedStateHash)
 	return c.broadcast(&m)
 	//log.Println("broadcast:<decide>")
 }
 
 // broadcastResync will broadcast a <resync> message by the leader,
-// from current round with <roundchange> proofs.
-func (c *Consensus) broadcastResync() {
+// from current round with <roundchange> proofs, at most once per
+// resyncInterval.
+func (c *Consensus) broadcastResync(now time.Time) {
 	if c.lastRoundChangeProof == nil {
 		return
 	}
 
+	if c.resyncInterval > 0 && !c.resyncSent.IsZero() && now.Sub(c.resyncSent) < c.resyncInterval {
+		return
+	}
+	c.resyncSent = now
+
 	var m Message
 	m.Type = MessageType_Resync
 	// we only care about <roundchange> messages in resync
@@ -1039,7 +1741,7 @@ func (c *Consensus) sendCommit(msgLock *Message) {
 	m.Round = msgLock.Round   // r
 	m.State = msgLock.State   // B'j
 	if c.enableCommitUnicast {
-		c.sendTo(&m, c.roundLeader(m.Round))
+		c.sendTo(&m, c.roundLeader(m.Height, m.Round))
 	} else {
 		c.broadcast(&m)
 	}
@@ -1047,57 +1749,94 @@ func (c *Consensus) sendCommit(msgLock *Message) {
 	//log.Println("send:<commit>")
 }
 
-// broadcast signs the message with private key before broadcasting to all peers.
+// sign signs the message with private key in compact form if enabled,
+// or with the signer.
+func (c *Consensus) sign(sp *SignedProto, m *Message) error {
+	if c.signer == nil {
+		return ErrNoPrivateKey
+	}
+	if c.enableCompactMessage {
+		return sp.SignCompact(m, c.privateKey, c.hasher)
+	}
+	return sp.SignWithSigner(m, c.signer, c.hasher)
+}
+
+// signFailed logs and counts the message failed to be signed, a signer in an
+// HSM or a remote signer may fail temporarily, the message is not sent.
+func (c *Consensus) signFailed(m *Message, err error) {
+	c.warnw("failed to sign message", "type", m.Type, "height", m.Height, "round", m.Round, "err", err)
+	c.observer.Lock()
+	c.observer.signErrors++
+	c.observer.Unlock()
+}
+
+// broadcast signs the message with private key before broadcasting to all peers,
+// and returns nil if the message cannot be signed.
 func (c *Consensus) broadcast(m *Message) *SignedProto {
+	// followers never send
+	if c.signer == nil {
+		return nil
+	}
+
 	// sign
 	sp := new(SignedProto)
 	sp.Version = ProtocolVersion
-	sp.Sign(m, c.privateKey)
+	if err := c.sign(sp, m); err != nil {
+		c.signFailed(m, err)
+		return nil
+	}
+
+	// protobuf marshalling, the callback shares the same wire form
+	out := sp.Bytes()
 
 	// message callback
 	if c.messageOutCallback != nil {
 		c.messageOutCallback(m, sp)
 	}
-	// protobuf marshalling
-	out, err := proto.Marshal(sp)
-	if err != nil {
-		panic(err)
-	}
 
 	// send to peers one by one
 	for _, peer := range c.peers {
 		_ = peer.Send(out)
 	}
 
-	// we also need to send this message to myself
-	c.loopback = append(c.loopback, out)
+	// we also need to send this message to myself, unless the transport
+	// delivers it back
+	if !c.externalLoopback {
+		c.loopback = append(c.loopback, out)
+	}
 	return sp
 }
 
 // sendTo signs the message with private key before transmitting to the peer.
 func (c *Consensus) sendTo(m *Message, leader Identity) {
+	// followers never send
+	if c.signer == nil {
+		return
+	}
+
 	// sign
 	sp := new(SignedProto)
 	sp.Version = ProtocolVersion
-	sp.Sign(m, c.privateKey)
-
-	// message callback
-	if c.messageOutCallback != nil {
-		c.messageOutCallback(m, sp)
+	if err := c.sign(sp, m); err != nil {
+		c.signFailed(m, err)
+		return
 	}
 
 	// protobuf marshalling
-	out, err := proto.Marshal(sp)
-	if err != nil {
-		panic(err)
-	}
+	out := sp.Bytes()
 
-	// we need to send this message to myself (via loopback) if i'm the leader
+	// we need to send this message to myself (via loopback) if i'm the leader,
+	// it never goes on the wire.
 	if leader == c.identity {
 		c.loopback = append(c.loopback, out)
 		return
 	}
 
+	// message callback
+	if c.messageOutCallback != nil {
+		c.messageOutCallback(m, sp)
+	}
+
 	// otherwise, find and transmit to the leader
 	for _, peer := range c.peers {
 		if pk := peer.GetPublicKey(); pk != nil {
@@ -1110,11 +1849,18 @@ func (c *Consensus) sendTo(m *Message, leader Identity) {
 	}
 }
 
-// propagate broadcasts signed message UNCHANGED to peers.
-func (c *Consensus) propagate(bts []byte) {
+// propagate broadcasts signed message of another participant UNCHANGED to peers.
+func (c *Consensus) propagate(m *Message, signed *SignedProto) {
+	out := signed.Bytes()
+
+	// message callback
+	if c.messageOutCallback != nil {
+		c.messageOutCallback(m, signed)
+	}
+
 	// send to peers one by one
 	for _, peer := range c.peers {
-		_ = peer.Send(bts)
+		_ = peer.Send(out)
 	}
 }
 
@@ -1172,13 +1918,82 @@ func (c *Consensus) lockRelease() {
 // and all lower rounds will be cleared while switching.
 func (c *Consensus) switchRound(round uint64) { c.currentRound = c.getRound(round, true) }
 
-// roundLeader returns leader's identity for a given round
-func (c *Consensus) roundLeader(round uint64) Identity {
+// roundLeader returns leader's identity for a given height and round, the
+// height is of the message being verified, which can be above the height
+// being decided for catch-up <decide> messages.
+func (c *Consensus) roundLeader(height uint64, round uint64) Identity {
 	// NOTE: fixed leader is for testing
 	if c.fixedLeader != nil {
 		return *c.fixedLeader
 	}
-	return c.participants[int(round)%len(c.participants)]
+	if c.leaderFunc != nil {
+		return c.leaderFunc(height, round, c.participants)
+	}
+	return c.participants[round%uint64(len(c.participants))]
+}
+
+// numPendingMessages returns the number of buffered messages
+func (c *Consensus) numPendingMessages() int {
+	n := len(c.locks)
+	for elem := c.rounds.Front(); elem != nil; elem = elem.Next() {
+		cr := elem.Value.(*consensusRound)
+		n += len(cr.roundChanges) + len(cr.commits)
+	}
+	return n
+}
+
+// reservePending makes room for an incoming message of the given round if
+// pending messages have exceeded the limit, by evicting one <roundchange>
+// from the furthest future round which is higher than the given round,
+// ErrMessagePoolFull will be returned if no message can be evicted.
+func (c *Consensus) reservePending(round uint64) error {
+	if c.maxPendingMessages <= 0 || c.numPendingMessages() < c.maxPendingMessages {
+		return nil
+	}
+
+	// rounds are ordered, locate the furthest round with <roundchange>
+	for elem := c.rounds.Back(); elem != nil; elem = elem.Prev() {
+		cr := elem.Value.(*consensusRound)
+		if cr == c.currentRound || cr.RoundNumber <= round {
+			break
+		}
+
+		if n := cr.NumRoundChanges(); n > 0 {
+			// the evicted message will be accepted again if retransmitted
+			c.unmarkSeen(cr.roundChanges[n-1].Message, cr.roundChanges[n-1].Signed)
+			cr.RemoveRoundChange(n - 1)
+			if cr.NumRoundChanges() == 0 && len(cr.commits) == 0 {
+				c.rounds.Remove(elem)
+			}
+			return nil
+		}
+	}
+	return ErrMessagePoolFull
+}
+
+// notifyDecide calls decideCallback at most once for each height
+func (c *Consensus) notifyDecide(height uint64, round uint64, s State, proof *SignedProto) {
+	if height <= c.decidedHeight {
+		return
+	}
+	c.decidedHeight = height
+	c.retainProof(height, proof)
+	c.recordDecision(height, round, s)
+	c.metrics.IncDecided()
+	hash := c.stateHash(s)
+	c.infow("decided", "height", height, "round", round, "state", hex.EncodeToString(hash[:]))
+
+	if c.decideCallback != nil {
+		c.decideCallback(height, round, s, proof)
+	}
+	c.emitDecided(DecideEvent{height, round, s, proof})
+}
+
+// notifyRoundChange calls roundChangeCallback when the round advances
+func (c *Consensus) notifyRoundChange(oldRound uint64, newRound uint64, reason string) {
+	if c.roundChangeCallback != nil && newRound > oldRound {
+		c.roundChangeCallback(c.latestHeight+1, oldRound, newRound, reason)
+	}
 }
 
 // heightSync changes current height to the given height with state
@@ -1187,22 +2002,96 @@ func (c *Consensus) heightSync(height uint64, round uint64, s State, now time.Ti
 	c.latestHeight = height // set height
 	c.latestRound = round   // set round
 	c.latestState = s       // set state
+	c.observeDecided()
+
+	// switch to the new consensus group if scheduled
+	c.applyParticipantChanges(height)
 
 	c.currentRound = nil         // clean current round pointer
 	c.lastRoundChangeProof = nil // clean round change proof
 	c.rounds.Init()              // clean all round
 	c.locks = nil                // clean locks
 	c.unconfirmed = nil          // clean all unconfirmed states from previous heights
+	c.proposed = nil             // clean own proposals from previous heights
+	c.pruneStale(height)         // clean signed messages & offenders of previous heights
+	c.pruneSeen(height)          // clean replay records below the decided height
+	c.resyncSent = time.Time{}   // clean resync rate limits
+	c.resyncReceived = nil       // clean resync rate limits of participants
 	c.switchRound(0)             // start new round at new height
 	c.currentRound.Stage = stageRoundChanging
+	c.replayFuture()             // process buffered messages of the new height
 }
 
 // t calculates (n-1)/3
 func (c *Consensus) t() int { return (c.numIdentities - 1) / 3 }
 
+// weightOf returns the weight of a participant, 1 for equal weighting,
+// identities absent from Config.Weights has zero weight.
+func (c *Consensus) weightOf(id Identity) uint64 {
+	if c.weights == nil {
+		return 1
+	}
+	return c.weights[id]
+}
+
+// signerWeight returns the weight of the signer of a message
+func (c *Consensus) signerWeight(sp *SignedProto) uint64 {
+	return c.weightOf(c.pubKeyToIdentity(sp.PublicKey(c.curve)))
+}
+
+// quorum returns the number of participants required for equal weighting,
+// by Config.QuorumSize if set, and never below the safe floor.
+func (c *Consensus) quorum() int {
+	if c.quorumSize == nil {
+		return 2*c.t() + 1
+	}
+
+	q := c.quorumSize(c.numIdentities)
+	if min := minQuorumSize(c.numIdentities); q < min {
+		q = min
+	}
+	return q
+}
+
+// hasQuorum checks if the given weight reaches the quorum, 2*t+1 for
+// equal weighting or Config.QuorumSize, or more than 2/3 of total weight
+// of participants.
+func (c *Consensus) hasQuorum(weight uint64) bool {
+	if c.weights == nil {
+		return weight >= uint64(c.quorum())
+	}
+
+	// weight*3 > totalWeight*2 in 128-bit
+	hi1, lo1 := bits.Mul64(weight, 3)
+	hi2, lo2 := bits.Mul64(c.totalWeight, 2)
+	return hi1 > hi2 || (hi1 == hi2 && lo1 > lo2)
+}
+
 // Propose adds a new state to unconfirmed queue to particpate in
-// consensus at next height.
-func (c *Consensus) Propose(s State) {
+// consensus at next height, followers return ErrNoPrivateKey, and states
+// beyond Config.MaxStateSize are rejected with ErrStateTooLarge.
+func (c *Consensus) Propose(s State) error {
+	if c.signer == nil {
+		return ErrNoPrivateKey
+	}
+	if c.maxStateSize > 0 && len(s) > c.maxStateSize {
+		return ErrStateTooLarge
+	}
+	if s == nil || c.proposingPaused {
+		return nil
+	}
+	c.propose(s)
+
+	if c.proposed == nil {
+		c.proposed = make(map[StateHash]bool)
+	}
+	c.proposed[c.stateHash(s)] = true
+	return nil
+}
+
+// propose adds a state to unconfirmed queue regardless of PauseProposing,
+// for the states adopted from others' <select> messages.
+func (c *Consensus) propose(s State) {
 	if s == nil {
 		return
 	}
@@ -1219,6 +2108,13 @@ func (c *Consensus) Propose(s State) {
 // ReceiveMessage processes incoming consensus messages, and returns error
 // if message cannot be processed for some reason.
 func (c *Consensus) ReceiveMessage(bts []byte, now time.Time) (err error) {
+	return c.ReceiveMessageContext(context.Background(), bts, now)
+}
+
+// ReceiveMessageContext processes incoming consensus messages as ReceiveMessage,
+// and honors the context between the decode, verify and state-update phases,
+// ctx.Err() will be returned if the context is done before the state-update.
+func (c *Consensus) ReceiveMessageContext(ctx context.Context, bts []byte, now time.Time) (err error) {
 	// messages broadcasted to myself may be queued recursively, and
 	// we only process these messages in defer to avoid side effects
 	// while processing.
@@ -1229,35 +2125,263 @@ func (c *Consensus) ReceiveMessage(bts []byte, now time.Time) (err error) {
 			// NOTE: message directed to myself ignores error.
 			_ = c.receiveMessage(bts, now)
 		}
+		c.measureRound(now)
+		c.observe()
+	}()
+
+	return c.receiveMessageContext(ctx, bts, now, true)
+}
+
+// ReceiveMessages processes a batch of incoming consensus messages, the i-th
+// element of the returned slice is the result of msgs[i] as ReceiveMessage.
+//
+// Signatures of the batch are verified in parallel by at most Config.VerifyWorkers
+// goroutines, then messages are applied sequentially in the order of msgs, so
+// the result is identical to calling ReceiveMessage on each message in turn.
+func (c *Consensus) ReceiveMessages(msgs [][]byte, now time.Time) []error {
+	errs := make([]error, len(msgs))
+	signed := make([]*SignedProto, len(msgs))
+	for k := range msgs {
+		sp := new(SignedProto)
+		if err := proto.Unmarshal(msgs[k], sp); err != nil {
+			errs[k] = err
+			continue
+		}
+		// drop unwanted messages silently before verification
+		if c.messageFilter != nil && !c.messageFilter(sp) {
+			c.countDrop(DropFiltered)
+			continue
+		}
+		signed[k] = sp
+	}
+
+	c.preverified = c.verifyBatch(signed)
+	defer func() { c.preverified = nil }()
+
+	defer func() {
+		for len(c.loopback) > 0 {
+			bts := c.loopback[0]
+			c.loopback = c.loopback[1:]
+			// NOTE: message directed to myself ignores error.
+			_ = c.receiveMessage(bts, now)
+		}
+		c.measureRound(now)
+		c.observe()
 	}()
 
-	return c.receiveMessage(bts, now)
+	for k := range signed {
+		if errs[k] != nil {
+			c.measureMessage(nil, errs[k])
+			continue
+		}
+		if signed[k] == nil { // filtered
+			continue
+		}
+		errs[k] = c.receiveSignedContext(context.Background(), msgs[k], signed[k], now)
+	}
+	return errs
+}
+
+// verifyBatch verifies signatures of messages in parallel, and returns the set
+// of messages with valid signatures. Proofs enclosed in messages are verified
+// too to populate the verify cache, see SetVerifyCacheSize.
+//
+// NOTE: only read-only fields of consensus can be accessed here.
+func (c *Consensus) verifyBatch(signed []*SignedProto) map[*SignedProto]struct{} {
+	valid := make([]bool, len(signed))
+	verify := func(k int) {
+		sp := signed[k]
+		// compact messages will be recovered by verifyMessage
+		if sp == nil || sp.V != 0 {
+			return
+		}
+		// oversize states will be rejected by verifyMessage
+		if c.stateTooLarge(sp.Message) {
+			return
+		}
+		if sp.VerifyWith(c.curve, c.hasher) != nil {
+			return
+		}
+		valid[k] = true
+
+		m := messagePool.Get().(*Message)
+		defer putMessage(m)
+		if proto.Unmarshal(sp.Message, m) != nil {
+			return
+		}
+		for _, proof := range m.Proof {
+			if proof != nil && proof.V == 0 {
+				_ = proof.VerifyWith(c.curve, c.hasher)
+			}
+		}
+	}
+
+	workers := c.verifyWorkers
+	if workers > len(signed) {
+		workers = len(signed)
+	}
+
+	jobs := make(chan int, len(signed))
+	for k := range signed {
+		jobs <- k
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				verify(k)
+			}
+		}()
+	}
+	wg.Wait()
+
+	preverified := make(map[*SignedProto]struct{})
+	for k := range valid {
+		if valid[k] {
+			preverified[signed[k]] = struct{}{}
+		}
+	}
+	return preverified
 }
 
 func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
+	return c.receiveMessageContext(context.Background(), bts, now, false)
+}
+
+// acceptVersion checks if messages of the protocol version are accepted
+func (c *Consensus) acceptVersion(version uint32) bool {
+	return acceptVersion(c.acceptedVersions, version)
+}
+
+// acceptVersion checks if the protocol version is in the accepted versions,
+// or is ProtocolVersion if no version is specified.
+func acceptVersion(accepted []uint32, version uint32) bool {
+	if len(accepted) == 0 {
+		return version == ProtocolVersion
+	}
+	for _, v := range accepted {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// receiveMessageContext processes a message, and checks the context between phases,
+// messages will be passed to the message filter first if filter has set.
+func (c *Consensus) receiveMessageContext(ctx context.Context, bts []byte, now time.Time, filter bool) error {
+	if err := ctx.Err(); err != nil {
+		c.measureMessage(nil, err)
+		return err
+	}
+
 	// unmarshal signed message
 	signed := new(SignedProto)
 	err := proto.Unmarshal(bts, signed)
 	if err != nil {
+		c.measureMessage(nil, err)
+		return err
+	}
+
+	// drop unwanted messages silently before verification
+	if filter && c.messageFilter != nil && !c.messageFilter(signed) {
+		c.countDrop(DropFiltered)
+		return nil
+	}
+
+	return c.receiveSignedContext(ctx, bts, signed, now)
+}
+
+// audit reports an accepted message counted toward decisions to auditSink
+func (c *Consensus) audit(sp *SignedProto, m *Message) {
+	if c.auditSink != nil {
+		c.auditSink(sp, m)
+	}
+}
+
+// checkBudget returns ErrMessageTooExpensive if the message being processed
+// has exceeded Config.MaxMessageProcessTime
+func (c *Consensus) checkBudget() error {
+	if !c.processDeadline.IsZero() && c.clock.Now().After(c.processDeadline) {
+		return ErrMessageTooExpensive
+	}
+	return nil
+}
+
+// receiveSignedContext processes a message decoded from bts, and checks the context between phases.
+func (c *Consensus) receiveSignedContext(ctx context.Context, bts []byte, signed *SignedProto, now time.Time) (err error) {
+	var m *Message
+	c.countReceived(signed)
+	defer func() { c.measureMessage(m, err) }()
+
+	if err = ctx.Err(); err != nil {
 		return err
 	}
 
+	// the budget of verification & validation of this message
+	if c.maxMessageProcessTime > 0 {
+		c.processDeadline = c.clock.Now().Add(c.maxMessageProcessTime)
+		defer func() { c.processDeadline = time.Time{} }()
+	}
+
 	// check message version
-	if signed.Version != ProtocolVersion {
-		return ErrMessageVersion
+	if !c.acceptVersion(signed.Version) {
+		return ErrProtocolVersion
 	}
 
 	// check message signature & qualifications
-	m, err := c.verifyMessage(signed)
+	m, err = c.verifyMessage(signed)
 	if err != nil {
 		return err
 	}
+	if err = c.checkBudget(); err != nil {
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	// messages of future heights are buffered until the height is reached
+	if c.isFuture(m) {
+		return c.bufferFuture(m, signed, bts)
+	}
+
+	// proofs spliced from other heights or rounds reject the whole message
+	if err = c.verifyProofScope(m); err != nil {
+		return err
+	}
+
+	// replayed messages are idempotent and will be dropped silently, a
+	// message is recorded only once it has been stored or counted, so the
+	// retransmissions of messages ignored are processed again.
+	var key seenKey
+	if m.Type != MessageType_Nop {
+		key = c.seenKey(m, signed)
+		if _, replayed := c.seen[key]; replayed {
+			c.debugw("dropping replayed message", "message", m)
+			c.countDrop(DropReplayed)
+			return nil
+		}
+	}
 
 	// callback for incoming message
 	if c.messageValidator != nil {
 		if !c.messageValidator(c, m, signed) {
 			return ErrMessageValidator
 		}
+		if err = c.checkBudget(); err != nil {
+			return err
+		}
+	}
+
+	// messages of recently decided heights are only recorded
+	if c.isStale(m) {
+		return c.receiveStale(m, signed)
 	}
 
 	// message switch
@@ -1279,19 +2403,25 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		// NOTE: the total messages are bounded to max 2*participants
 		// at any time, so the loop has O(n) time complexity
 		var next *list.Element
+		var duplicated bool
 		for elem := c.rounds.Front(); elem != nil; elem = next {
 			next = elem.Next()
 			cr := elem.Value.(*consensusRound)
 			if idx := cr.FindRoundChange(signed.X, signed.Y); idx != -1 { // located!
-				if m.Round == c.currentRound.RoundNumber { // don't remove now!
+				if cr.RoundNumber == m.Round { // will be rejected by AddRoundChange
+					duplicated = true
+					continue
+				} else if m.Round == c.currentRound.RoundNumber { // don't remove now!
 					continue
 				} else if cr.RoundNumber > m.Round {
 					// existing message is higher than incoming message,
 					// just ignore.
+					c.countDrop(DropSuperseded)
 					return nil
 				} else if cr.RoundNumber < m.Round {
 					// existing message is lower than incoming message,
 					// remove the existing message from this round.
+					c.unmarkSeen(cr.roundChanges[idx].Message, cr.roundChanges[idx].Signed)
 					cr.RemoveRoundChange(idx)
 					// if no message remained in this round, release
 					// the round resources too, to prevent OOM attack
@@ -1302,6 +2432,13 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 			}
 		}
 
+		// make room for this message if pending messages have exceeded the limit
+		if !duplicated {
+			if err := c.reservePending(m.Round); err != nil {
+				return err
+			}
+		}
+
 		// locate to round m.Round.
 		// NOTE: getRound must not be called before previous checks done
 		// in order to prevent OOM attack by creating round objects.
@@ -1311,6 +2448,7 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		// round records message along with its signed <roundchange> message
 		// to provide proofs in the future.
 		if round.AddRoundChange(signed, m) {
+			c.markSeen(key)
 			// During any time of the protocol, if a the Pacemaker of Pj (including Pi)
 			// receives at least 2t + 1 round-change message (including round-change
 			// message from himself) for round r (which is larger than its current round
@@ -1325,11 +2463,21 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 			//
 			// Example: P sends r+1 to remove from r, and sends to r again to trigger 2t+1 once
 			// more to reset timeout.
-			if round.NumRoundChanges() == 2*c.t()+1 && round.Stage < stageLock {
+			//
+			// With stake weights, the quorum is triggered when the weight crosses it
+			// with this <roundchange>, which equals to count == 2*t+1 for equal weighting.
+			rcWeight := round.RoundChangeWeight()
+			if c.hasQuorum(rcWeight) && !c.hasQuorum(rcWeight-c.signerWeight(signed)) && round.Stage < stageLock {
 				// switch to this round
+				oldRound := c.currentRound.RoundNumber
 				c.switchRound(m.Round)
+				c.notifyRoundChange(oldRound, m.Round, RoundChangeQuorum)
 				// record this round change proof for resyncing
 				c.lastRoundChangeProof = c.currentRound.SignedRoundChanges()
+				// the quorum is audited once it's formed
+				for k := range c.currentRound.roundChanges {
+					c.audit(c.currentRound.roundChanges[k].Signed, c.currentRound.roundChanges[k].Message)
+				}
 
 				// If Pj has not broadcasted the round-change message yet,
 				// it broadcasts now.
@@ -1337,8 +2485,8 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 
 				// leader of this round MUST wait on collectDuration,
 				// to decide to broadcast <lock> or <select>.
-				leaderKey := c.roundLeader(m.Round)
-				if leaderKey == c.identity {
+				leaderKey := c.roundLeader(m.Height, m.Round)
+				if leaderKey == c.identity && !c.proposingPaused {
 					// leader's <roundchange> collection timeout
 					c.lockTimeout = now.Add(c.collectDuration(m.Round))
 				} else {
@@ -1352,10 +2500,10 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 
 			// for the leader, who's current round has at least 2*t+1 <roundchange>,
 			// we will track max proposed state for each valid added <roundchange>
-			if round == c.currentRound && round.NumRoundChanges() >= 2*c.t()+1 {
-				leaderKey := c.roundLeader(m.Round)
+			if round == c.currentRound && c.hasQuorum(round.RoundChangeWeight()) {
+				leaderKey := c.roundLeader(m.Height, m.Round)
 				if leaderKey == c.identity {
-					round.MaxProposedState, round.MaxProposedCount = round.GetMaxProposed()
+					round.MaxProposedState, round.MaxProposedWeight = round.GetMaxProposed()
 				}
 			}
 		}
@@ -1366,21 +2514,27 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		if err != nil {
 			return err
 		}
+		c.checkEquivocation(m, signed)
+		c.audit(signed, m)
 
 		// round will be increased monotonically
 		if m.Round > c.currentRound.RoundNumber {
+			oldRound := c.currentRound.RoundNumber
 			c.switchRound(m.Round)
+			c.notifyRoundChange(oldRound, m.Round, RoundChangeSelect)
 			c.lastRoundChangeProof = []*SignedProto{signed} // record this proof for resyncing
+			c.markSeen(key)
 		}
 
 		// for rounds r' >= r, we must check c.stage to stageLockRelease
 		// only once to prevent resetting lockReleaseTimeout or shifting c.cstage
 		if c.currentRound.Stage < stageLockRelease {
+			c.markSeen(key)
 			c.currentRound.Stage = stageLockRelease
 			c.lockReleaseTimeout = now.Add(c.commitDuration(m.Round))
 			c.lockRelease()
 			// add to Blockj
-			c.Propose(m.State)
+			c.propose(m.State)
 		}
 
 	case MessageType_Lock:
@@ -1389,16 +2543,22 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		if err != nil {
 			return err
 		}
+		c.checkEquivocation(m, signed)
+		c.audit(signed, m)
 
 		// round will be increased monotonically
 		if m.Round > c.currentRound.RoundNumber {
+			oldRound := c.currentRound.RoundNumber
 			c.switchRound(m.Round)
+			c.notifyRoundChange(oldRound, m.Round, RoundChangeLock)
 			c.lastRoundChangeProof = []*SignedProto{signed} // record this proof for resyncing
+			c.markSeen(key)
 		}
 
 		// for rounds r' >= r, we must check to enter commit status
 		// only once to prevent resetting commitTimeout or shifting c.cstage
 		if c.currentRound.Stage < stageCommit {
+			c.markSeen(key)
 			c.currentRound.Stage = stageCommit
 			c.commitTimeout = now.Add(c.commitDuration(m.Round))
 
@@ -1431,6 +2591,8 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		// length of locks is 0, append and return.
 		if len(c.locks) == 0 {
 			c.locks = append(c.locks, messageTuple{StateHash: c.stateHash(lockmsg.State), Message: lockmsg, Signed: m.LockRelease})
+			c.markSeen(key)
+			c.audit(signed, m)
 			return nil
 		}
 
@@ -1450,12 +2612,14 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		if o < len(c.locks) {
 			c.locks = c.locks[:o]
 			c.locks = append(c.locks, messageTuple{StateHash: c.stateHash(lockmsg.State), Message: lockmsg, Signed: m.LockRelease})
+			c.markSeen(key)
+			c.audit(signed, m)
 		}
 
 	case MessageType_Commit:
 		// leader process commits message from all participants,
 		// check to see if I'm the leader of this round to process this message.
-		leaderKey := c.roundLeader(m.Round)
+		leaderKey := c.roundLeader(m.Height, m.Round)
 		if leaderKey == c.identity {
 			// verify commit message.
 			// NOTE: leader only accept commits for current height & round.
@@ -1463,14 +2627,27 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 			if err != nil {
 				return err
 			}
+			c.checkEquivocation(m, signed)
+
+			// make room for this message if pending messages have exceeded the limit
+			if c.currentRound.FindCommit(signed.X, signed.Y) == -1 {
+				if err := c.reservePending(m.Round); err != nil {
+					return err
+				}
+			}
 
 			// verifyCommitMessage can guarantee that the message is to currentRound,
 			// so we're safe to process in current round.
 			if c.currentRound.AddCommit(signed, m) {
+				c.markSeen(key)
+				c.sampleLatency(m, signed, now)
 				// NOTE: we proceed the following only when AddCommit returns true.
-				// NumCommitted will only return commits with locked B'
+				// CommittedWeight will only weigh commits with locked B'
 				// and ignore non-B' commits.
-				if c.currentRound.NumCommitted() >= 2*c.t()+1 {
+				if c.stateHash(m.State) == c.currentRound.LockedStateHash {
+					c.audit(signed, m)
+				}
+				if c.hasQuorum(c.currentRound.CommittedWeight()) {
 					/*
 						log.Println("======= LEADER'S DECIDE=====")
 						log.Println("Height:", c.currentHeight+1)
@@ -1478,13 +2655,21 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 						log.Println("State:", State(c.currentRound.LockedState).hash())
 					*/
 
-					// broadcast decide will return what it has sent
-					c.latestProof = c.broadcastDecide()
+					// broadcast decide will return what it has sent, the decision
+					// is retried on later <commit> messages if failed to sign
+					proof := c.broadcastDecide()
+					if proof == nil {
+						return ErrSignMessage
+					}
+					c.adaptLatency()
+					c.latestProof = proof
 					c.heightSync(c.latestHeight+1, c.currentRound.RoundNumber, c.currentRound.LockedState, now)
 					// leader should wait for 1 more latency
 					c.rcTimeout = now.Add(c.roundchangeDuration(0) + c.latency)
 					// broadcast <roundchange> at new height
 					c.broadcastRoundChange()
+					// notify the decision
+					c.notifyDecide(c.latestHeight, c.latestRound, c.latestState, c.latestProof)
 				}
 			}
 		}
@@ -1494,20 +2679,35 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		if err != nil {
 			return err
 		}
+		c.audit(signed, m)
 
 		// record this proof for chaining
 		c.latestProof = signed
 
 		// propagate this <decide> message to my neighbour.
 		// NOTE: verifyDecideMessage() can stop broadcast storm.
-		c.propagate(bts)
+		c.propagate(m, signed)
 		// passive confirmation from the leader.
 		c.heightSync(m.Height, m.Round, m.State, now)
 		// non-leader starts waiting for rcTimeout
 		c.rcTimeout = now.Add(c.roundchangeDuration(0))
 		// we sync our height and broadcast new <roundchange>.
 		c.broadcastRoundChange()
+		// notify the decision
+		c.notifyDecide(m.Height, m.Round, m.State, signed)
 	case MessageType_Resync:
+		// answer the same participant at most once per resyncInterval
+		if c.resyncInterval > 0 {
+			sender := c.pubKeyToIdentity(signed.PublicKey(c.curve))
+			if last, ok := c.resyncReceived[sender]; ok && now.Sub(last) < c.resyncInterval {
+				return ErrResyncRateLimited
+			}
+			if c.resyncReceived == nil {
+				c.resyncReceived = make(map[Identity]time.Time)
+			}
+			c.resyncReceived[sender] = now
+		}
+
 		// push the proofs in loopback device
 		for k := range m.Proof {
 			// protobuf marshalling
@@ -1534,6 +2734,9 @@ func (c *Consensus) Update(now time.Time) error {
 			c.loopback = c.loopback[1:]
 			_ = c.receiveMessage(bts, now)
 		}
+		c.measureRound(now)
+		c.checkStall(now)
+		c.observe()
 	}()
 
 	// stage switch
@@ -1544,8 +2747,9 @@ func (c *Consensus) Update(now time.Time) error {
 		}
 
 		if now.After(c.rcTimeout) {
+			c.debugw("roundchange timeout", "height", c.latestHeight+1, "round", c.currentRound.RoundNumber)
 			c.broadcastRoundChange()
-			c.broadcastResync() // we also need to broadcast the round change event message if there is any
+			c.broadcastResync(now) // we also need to broadcast the round change event message if there is any
 			c.rcTimeout = now.Add(c.roundchangeDuration(c.currentRound.RoundNumber))
 		}
 	case stageLock:
@@ -1554,17 +2758,19 @@ func (c *Consensus) Update(now time.Time) error {
 		}
 		// leader's collection, we perform periodically check for <lock> or <select>
 		// check to see if I'm the leader of this round to perform collect timeout
-		leaderKey := c.roundLeader(c.currentRound.RoundNumber)
-		if leaderKey == c.identity {
+		// a leader paused proposing acts as a non-leader
+		leaderKey := c.roundLeader(c.latestHeight+1, c.currentRound.RoundNumber)
+		if leaderKey == c.identity && !c.proposingPaused {
 			// check if we have enough 2t+1 <roundchange> to lock B',
 			// which B' != NULL
-			if c.currentRound.MaxProposedCount >= 2*c.t()+1 {
+			if c.hasQuorum(c.currentRound.MaxProposedWeight) {
 				// lock B' to c.currentRound
 				c.currentRound.LockedState = c.currentRound.MaxProposedState
 				// and computes its hash for comparing B' in <commit> message
 				c.currentRound.LockedStateHash = c.stateHash(c.currentRound.MaxProposedState)
 				// broadcast this <lock>, leader itself will receive this message too.
 				c.broadcastLock()
+				c.startLatencySampling(now)
 				// enter commit stage
 				c.currentRound.Stage = stageCommit
 				c.commitTimeout = now.Add(c.commitDuration(c.currentRound.RoundNumber) + c.latency)
@@ -1576,7 +2782,7 @@ func (c *Consensus) Update(now time.Time) error {
 				// enqueue all received non-NULL data
 				states := c.currentRound.RoundChangeStates()
 				for k := range states {
-					c.Propose(states[k])
+					c.propose(states[k])
 				}
 
 				// broadcast this <select>, leader itself will receive this message too.
@@ -1609,9 +2815,11 @@ func (c *Consensus) Update(now time.Time) error {
 			panic("lockRelease stage entered, but lockReleaseTimout not set")
 		}
 		if now.After(c.lockReleaseTimeout) {
+			c.debugw("lock release timeout", "height", c.latestHeight+1, "round", c.currentRound.RoundNumber)
 			c.currentRound.Stage = stageRoundChanging
 			// move to round +1 when lock release has timeout
 			c.switchRound(c.currentRound.RoundNumber + 1)
+			c.notifyRoundChange(c.currentRound.RoundNumber-1, c.currentRound.RoundNumber, RoundChangeTimeout)
 			c.broadcastRoundChange()
 			c.rcTimeout = now.Add(c.roundchangeDuration(c.currentRound.RoundNumber))
 		}
@@ -1622,16 +2830,172 @@ func (c *Consensus) Update(now time.Time) error {
 // CurrentState returns current state along with current height & round,
 // It's caller's responsibility to check if ReceiveMessage() has
 // created a new height.
+// It's safe to be called concurrently with the state machine.
 func (c *Consensus) CurrentState() (height uint64, round uint64, data State) {
-	return c.latestHeight, c.latestRound, c.latestState
+	c.observer.Lock()
+	defer c.observer.Unlock()
+	return c.observer.height, c.observer.decidedRound, c.observer.decided
+}
+
+// CurrentHeight returns latest decided height, same as the height returned
+// by CurrentState.
+// It's safe to be called concurrently with the state machine.
+func (c *Consensus) CurrentHeight() uint64 {
+	c.observer.Lock()
+	defer c.observer.Unlock()
+	return c.observer.height
+}
+
+// CurrentRound returns current round at the height being decided, i.e. the
+// height next to CurrentHeight, not the round in which latest height was
+// decided as returned by CurrentState.
+// It's safe to be called concurrently with the state machine.
+func (c *Consensus) CurrentRound() uint64 {
+	c.observer.Lock()
+	defer c.observer.Unlock()
+	return c.observer.round
 }
 
 // CurrentProof returns current <decide> message for current height
 func (c *Consensus) CurrentProof() *SignedProto { return c.latestProof }
 
-// SetLatency sets participants expected latency for consensus core
+// CurrentProposer returns the identity of the expected leader to propose
+// at next height, along with the round it applies to. The leader is selected
+// by Config.LeaderFunc, or round-robin from participants by round number, so
+// before the first Propose or any round change, it's the leader of round 0.
+func (c *Consensus) CurrentProposer() (Identity, uint64) {
+	round := c.currentRound.RoundNumber
+	return c.roundLeader(c.latestHeight+1, round), round
+}
+
+// stateValidate validates the state with user's function, and records
+// the state and the reason if rejected.
+func (c *Consensus) stateValidate(s State) bool {
+	err := c.stateValidateErr(s)
+	if err != nil {
+		c.lastRejectedState = s
+		c.lastRejectedErr = err
+		c.debugw("state rejected", "err", err)
+		return false
+	}
+	return true
+}
+
+// LastRejectedState returns the most recent state rejected by Config.StateValidate
+// or Config.StateValidateErr, and the reason of rejection, nil error will be
+// returned if no state has been rejected.
+func (c *Consensus) LastRejectedState() (State, error) {
+	return c.lastRejectedState, c.lastRejectedErr
+}
+
+// RotateKey swaps the private key signing all future messages, and attempts
+// to zero the secret of the previous key. The key is copied on Config and on
+// rotation, only the copy owned by this instance is zeroed, keys held by the
+// caller or shared with other instances are left untouched. The identity of this participant
+// changes with the key, so the rotation should be coordinated with other
+// participants, like scheduling the new identity by ProposeParticipantChange.
+//
+// The previous key SHOULD NOT be kept after rotation. As Go's garbage collector
+// may have copied the secret while moving or growing memory, zeroization can't
+// be guaranteed, it reduces the window the secret stays in memory only.
+func (c *Consensus) RotateKey(newKey *ecdsa.PrivateKey) error {
+	if newKey == nil || newKey.D == nil {
+		return ErrRotateKeyNil
+	}
+	if c.signer == nil {
+		return ErrNoPrivateKey
+	}
+	signer, ok := c.signer.(*ecdsaSigner)
+	if !ok {
+		return ErrRotateKeySigner
+	}
+	software, ok := signer.key.(*softwareSigner)
+	if !ok {
+		return ErrRotateKeySigner
+	}
+	if newKey.Curve != c.curve {
+		return ErrRotateKeyCurve
+	}
+
+	oldKey := software.key
+	c.privateKey = clonePrivateKey(newKey)
+	c.signer = NewECDSASignerRand(c.privateKey, software.rand)
+	c.publicKey = &c.privateKey.PublicKey
+	c.identity = c.pubKeyToIdentity(c.publicKey)
+
+	words := oldKey.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	oldKey.D.SetInt64(0)
+	return nil
+}
+
+// PauseProposing stops this participant from proposing, while paused, Propose
+// is a no-op, and this participant will not broadcast <lock> or <select> as the
+// leader of a round, but it still processes messages from others, and sends
+// <roundchange> and <commit> messages as usual. States proposed before pausing
+// and states adopted from the leader's <select> are kept, and will be carried in
+// <roundchange> messages.
+//
+// When a paused participant is the scheduled leader of a round, the round makes
+// no progress, other participants will time out of the lock, commit and
+// lock-release stages, and move to the next round with a new leader, so each
+// such round costs a full round of timeouts.
+func (c *Consensus) PauseProposing() { c.proposingPaused = true }
+
+// ResumeProposing resumes proposing paused by PauseProposing
+func (c *Consensus) ResumeProposing() { c.proposingPaused = false }
+
+// WithdrawProposal clears the states proposed by Propose at current height,
+// so a fresher state can be proposed for the next round. States adopted from
+// the leader's <select> are kept. It returns false and keeps the proposals if
+// withdrawal is no longer safe.
+//
+// Withdrawal is safe until any of these states has been sent in a <roundchange>
+// that formed a <lock> accepted by this participant at current height,
+// including the one it broadcasts as the leader. From then on, the locked state
+// has to be proposed in all following rounds, and the withdrawal makes no
+// difference.
+//
+// NOTE: a <roundchange> already sent in current round still carries the
+// withdrawn state, which may be selected by the leader of this round, the
+// withdrawal takes effect from the next <roundchange>. States restored by
+// LoadConsensus are not known as own proposals, and won't be withdrawn.
+func (c *Consensus) WithdrawProposal() bool {
+	for k := range c.locks {
+		if c.proposed[c.locks[k].StateHash] {
+			return false
+		}
+	}
+
+	var kept []State
+	for k := range c.unconfirmed {
+		if !c.proposed[c.stateHash(c.unconfirmed[k])] {
+			kept = append(kept, c.unconfirmed[k])
+		}
+	}
+	c.unconfirmed = kept
+	c.proposed = nil
+	return true
+}
+
+// SetLatency sets participants expected latency for consensus core, with
+// Config.AdaptiveLatency it's the initial estimate to adapt from.
 func (c *Consensus) SetLatency(latency time.Duration) { c.latency = latency }
 
+// SetStateCompare replaces the state comparison function of Config.StateCompare,
+// to change the selection policy of proposals, the new function applies to all
+// following comparisons. A nil function will be ignored.
+//
+// NOTE: all participants should switch the policy at the same height, otherwise
+// the leader's selection may be rejected by others.
+func (c *Consensus) SetStateCompare(f func(a State, b State) int) {
+	if f != nil {
+		c.stateCompare = f
+	}
+}
+
 // HasProposed checks whether some state has been proposed via <roundchange>
 // <lock> or left in c.unconfirmed
 func (c *Consensus) HasProposed(state State) bool {
@@ -1670,6 +3034,7 @@ func (c *Consensus) Join(p PeerInterface) bool {
 	}
 
 	c.peers = append(c.peers, p)
+	c.observe()
 	return true
 }
 
@@ -1679,6 +3044,7 @@ func (c *Consensus) Leave(addr net.Addr) bool {
 		if addr.String() == c.peers[k].RemoteAddr().String() {
 			copy(c.peers[k:], c.peers[k+1:])
 			c.peers = c.peers[:len(c.peers)-1]
+			c.observe()
 			return true
 		}
 	}
@@ -2,10 +2,14 @@ package bdls
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	fmt "fmt"
 	"io"
 	"log"
@@ -14,6 +18,7 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -37,24 +42,24 @@ func init() {
 
 // (testing augumented function) SetLeader sets a fixed leader for consensus
 func (c *Consensus) SetLeader(key *ecdsa.PublicKey) {
-	coord := DefaultPubKeyToIdentity(key)
+	coord := c.pubKeyToIdentity(key)
 	c.fixedLeader = &coord
 }
 
 // (testing augumented function) AddParticipant add a new participant in the quorum
 func (c *Consensus) AddParticipant(key *ecdsa.PublicKey) {
-	coord := DefaultPubKeyToIdentity(key)
+	coord := c.pubKeyToIdentity(key)
 	for k := range c.participants {
 		if c.participants[k] == coord {
 			return
 		}
 	}
-	c.participants = append(c.participants, coord)
+	c.setParticipants(append(c.participants, coord))
 }
 
 // createConsensus creates a valid consensus object with given height & round and random state
 // the c.particpants[0] will always be the consensus's publickey
-func createConsensus(t *testing.T, height uint64, round uint64, quorum []*ecdsa.PublicKey) *Consensus {
+func createConsensus(t testing.TB, height uint64, round uint64, quorum []*ecdsa.PublicKey) *Consensus {
 	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
 	assert.Nil(t, err)
 
@@ -219,7 +224,7 @@ func TestLockMessageRoundSwitch(t *testing.T) {
 	assert.Equal(t, 1, len(consensus.locks))
 
 	// round switch to 11 with new B', resetting particpants
-	consensus.participants = nil
+	consensus.setParticipants(nil)
 	m, sp, privateKey, proofKeys := createLockMessage(t, 20, 1, 11, 1, 11)
 	consensus.AddParticipant(&privateKey.PublicKey)
 	consensus.SetLeader(&privateKey.PublicKey)
@@ -236,7 +241,7 @@ func TestLockMessageRoundSwitch(t *testing.T) {
 	assert.Equal(t, 2, len(consensus.locks))
 
 	// round switch to 12 with old B', resetting particpants
-	consensus.participants = nil
+	consensus.setParticipants(nil)
 	_, sp, privateKey, proofKeys = createLockMessageState(t, 20, m.State, 1, 12, 1, 12)
 	consensus.AddParticipant(&privateKey.PublicKey)
 	consensus.SetLeader(&privateKey.PublicKey)
@@ -269,7 +274,7 @@ func TestLockReleaseMessageRoundSwitch(t *testing.T) {
 	assert.Nil(t, err)
 
 	// round switch to 11,  resetting particpants
-	consensus.participants = nil
+	consensus.setParticipants(nil)
 	_, sp, privateKey, proofKeys = createLockReleaseMessage(t, 20, 1, 11, 1, 11)
 	consensus.AddParticipant(&privateKey.PublicKey)
 	consensus.SetLeader(&privateKey.PublicKey)
@@ -372,6 +377,438 @@ func TestCommitTimeout(t *testing.T) {
 	assert.Equal(t, 1, len(consensus.locks))
 }
 
+func TestIsParticipant(t *testing.T) {
+	t.Log("test participant lookup from signed messages")
+	_, sp, privateKey := createRoundChangeMessage(t, 1, 0)
+	consensus := createConsensus(t, 0, 0, nil)
+
+	_, ok := consensus.IsParticipant(sp)
+	assert.False(t, ok)
+	_, err := consensus.verifyMessage(sp)
+	assert.Equal(t, ErrMessageUnknownParticipant, err)
+
+	consensus.AddParticipant(&privateKey.PublicKey)
+	index, ok := consensus.IsParticipant(sp)
+	assert.True(t, ok)
+	assert.Equal(t, 1, index)
+	assert.Equal(t, 2, consensus.numIdentities)
+	_, err = consensus.verifyMessage(sp)
+	assert.Nil(t, err)
+
+	// duplicated identities are counted once
+	consensus.AddParticipant(&privateKey.PublicKey)
+	consensus.setParticipants(append(consensus.participants, consensus.participants[1]))
+	index, ok = consensus.IsParticipant(sp)
+	assert.True(t, ok)
+	assert.Equal(t, 1, index)
+	assert.Equal(t, 2, consensus.numIdentities)
+
+	// rebuilt on participant changes
+	consensus.setParticipants(consensus.participants[:1])
+	_, ok = consensus.IsParticipant(sp)
+	assert.False(t, ok)
+	assert.Equal(t, 1, consensus.numIdentities)
+}
+
+func TestProposeParticipantChange(t *testing.T) {
+	t.Log("test switching the consensus group after the transition height decided")
+	var keys []*ecdsa.PrivateKey
+	var pubkeys []*ecdsa.PublicKey
+	for i := 0; i < 5; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		pubkeys = append(pubkeys, &privateKey.PublicKey)
+	}
+
+	// participants: self, keys[0..3], keys[4] will join
+	consensus := createConsensus(t, 0, 0, pubkeys[:4])
+	assert.Equal(t, 5, consensus.numIdentities)
+	removed := DefaultPubKeyToIdentity(pubkeys[0])
+	added := DefaultPubKeyToIdentity(pubkeys[4])
+
+	assert.Equal(t, ErrParticipantChangeHeight, consensus.ProposeParticipantChange(0, nil, nil))
+	assert.Equal(t, ErrConfigParticipants, consensus.ProposeParticipantChange(1, nil, consensus.participants[:2]))
+	assert.Nil(t, consensus.ProposeParticipantChange(1, []Identity{added}, []Identity{removed}))
+
+	// not switched before decided
+	consensus.heightSync(0, 0, nil, time.Now())
+	assert.Equal(t, 0, consensus.participantIndex[consensus.identity])
+	_, ok := consensus.participantIndex[added]
+	assert.False(t, ok)
+
+	// decided at height 1
+	consensus.heightSync(1, 0, []byte("state"), time.Now())
+	assert.Equal(t, 5, consensus.numIdentities)
+	_, ok = consensus.participantIndex[removed]
+	assert.False(t, ok)
+	assert.Equal(t, added, consensus.participants[len(consensus.participants)-1])
+
+	// the removed validator is honored at the transition height only
+	_, sp, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), keys[0])
+	_, err := consensus.verifyMessage(sp)
+	assert.Nil(t, err)
+	_, sp, _ = createRoundChangeMessageSigner(t, 2, 0, []byte("state"), keys[0])
+	_, err = consensus.verifyMessage(sp)
+	assert.Equal(t, ErrMessageUnknownParticipant, err)
+
+	// the new validator is accepted
+	_, sp, _ = createRoundChangeMessageSigner(t, 2, 0, []byte("state"), keys[4])
+	_, err = consensus.verifyMessage(sp)
+	assert.Nil(t, err)
+
+	// and never be leader again
+	for round := uint64(0); round < 10; round++ {
+		assert.NotEqual(t, removed, consensus.roundLeader(consensus.latestHeight+1, round))
+	}
+}
+
+func TestCurrentProposer(t *testing.T) {
+	t.Log("test the expected proposer follows round-robin leader selection")
+	consensus := createConsensus(t, 0, 0, nil)
+	for i := 0; i < 3; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		consensus.AddParticipant(&privateKey.PublicKey)
+	}
+
+	// before the first round change
+	leader, round := consensus.CurrentProposer()
+	assert.Equal(t, uint64(0), round)
+	assert.Equal(t, consensus.participants[0], leader)
+
+	for r := uint64(1); r < 10; r++ {
+		consensus.switchRound(r)
+		leader, round = consensus.CurrentProposer()
+		assert.Equal(t, r, round)
+		assert.Equal(t, consensus.participants[r%4], leader)
+		assert.Equal(t, consensus.roundLeader(consensus.latestHeight+1, r), leader)
+	}
+}
+
+func TestReloadParticipants(t *testing.T) {
+	t.Log("test reloading the consensus group between heights")
+	net := newMemNetwork(t, 4)
+	others := newMemNetwork(t, 4)
+
+	// the new group replaces a participant with a new one
+	reloaded := append([]Identity{}, net.configs[0].Participants[:3]...)
+	reloaded = append(reloaded, others.configs[0].Participants[0])
+	for _, node := range net.nodes {
+		assert.Equal(t, ErrConfigParticipants, node.ReloadParticipants(reloaded[:3]))
+		assert.Equal(t, ErrConfigParticipantsDuplicated, node.ReloadParticipants(append(reloaded[:3:3], reloaded[0])))
+		assert.Nil(t, node.ReloadParticipants(reloaded))
+		// not switched in the middle of the height
+		assert.Equal(t, net.configs[0].Participants, node.participants)
+		node.Propose([]byte("state"))
+	}
+
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	for _, node := range net.nodes {
+		assert.Equal(t, reloaded, node.participants)
+		assert.Equal(t, 4, node.numIdentities)
+		_, ok := node.HasParticipant(net.configs[0].Participants[3])
+		assert.False(t, ok)
+		_, ok = node.HasParticipant(others.configs[0].Participants[0])
+		assert.True(t, ok)
+		node.Propose([]byte("next"))
+	}
+
+	// the remaining 3 of the new group form a quorum at the next height
+	for i := 0; i < 10000 && !net.decided(2); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(2))
+	proof := net.nodes[0].CurrentProof()
+	_, _, err := VerifyDecideProof(reloaded, proof)
+	assert.Nil(t, err)
+	m, err := DecodeMessage(proof.Message)
+	assert.Nil(t, err)
+	for _, commit := range m.Proof {
+		assert.NotEqual(t, net.configs[0].Participants[3], DefaultPubKeyToIdentity(commit.PublicKey(S256Curve)))
+	}
+}
+
+func TestEquivocation(t *testing.T) {
+	t.Log("test conflicting messages from the same signer are reported as equivocation")
+	m, sp, privateKey, proofKeys := createLockMessage(t, 20, 10, 10, 10, 10)
+	consensus := createConsensus(t, 9, 10, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Nil(t, consensus.TakeEquivocations())
+
+	// the same lock again is not an equivocation
+	consensus.checkEquivocation(m, sp)
+	assert.Nil(t, consensus.TakeEquivocations())
+
+	// a tampered conflicting lock is not reported
+	conflict := *m
+	conflict.State = append([]byte{}, m.State...)
+	conflict.State[0]++
+	tampered := *sp
+	tampered.Message, err = proto.Marshal(&conflict)
+	assert.Nil(t, err)
+	consensus.checkEquivocation(&conflict, &tampered)
+	assert.Nil(t, consensus.TakeEquivocations())
+
+	// a conflicting lock signed by the leader
+	signed := new(SignedProto)
+	signed.Sign(&conflict, privateKey)
+	consensus.checkEquivocation(&conflict, signed)
+	consensus.checkEquivocation(&conflict, signed)
+	equivocations := consensus.TakeEquivocations()
+	assert.Equal(t, 1, len(equivocations))
+	first, err := proto.Marshal(equivocations[0].First)
+	assert.Nil(t, err)
+	assert.Equal(t, bts, first)
+	assert.Equal(t, signed, equivocations[0].Second)
+	assert.True(t, equivocations[0].First.Verify(S256Curve))
+	assert.True(t, equivocations[0].Second.Verify(S256Curve))
+	assert.Nil(t, consensus.TakeEquivocations())
+
+	// evidence is cleared on new height
+	consensus.heightSync(10, 0, m.State, time.Now())
+	consensus.checkEquivocation(&conflict, signed)
+	assert.Nil(t, consensus.TakeEquivocations())
+}
+
+func TestEvidenceBounded(t *testing.T) {
+	t.Log("test equivocations are retained up to the limit with oldest evicted")
+	consensus := createConsensus(t, 0, 0, nil)
+	consensus.maxEvidence = 4
+
+	conflict := func(key *ecdsa.PrivateKey, msgType MessageType, round uint64, b byte) {
+		m := &Message{Type: msgType, Height: 1, Round: round, State: []byte{b}}
+		signed := new(SignedProto)
+		signed.Sign(m, key)
+		consensus.checkEquivocation(m, signed)
+	}
+
+	var offenders []Identity
+	for i := 0; i < 10; i++ {
+		key := mustGenerateKey(t)
+		offenders = append(offenders, consensus.pubKeyToIdentity(&key.PublicKey))
+		for b := byte(0); b < 8; b++ {
+			conflict(key, MessageType_Commit, 0, b)
+			// the same offender at the same height & round is stored once
+			conflict(key, MessageType_RoundChange, 0, b)
+		}
+		assert.True(t, consensus.EvidenceCount() <= 4)
+	}
+	assert.Equal(t, 4, consensus.EvidenceCount())
+
+	equivocations := consensus.TakeEquivocations()
+	assert.Equal(t, 0, consensus.EvidenceCount())
+	for k := range equivocations {
+		assert.Equal(t, offenders[6+k], consensus.pubKeyToIdentity(equivocations[k].Second.PublicKey(S256Curve)))
+	}
+}
+
+func TestDecideCallback(t *testing.T) {
+	t.Log("test decide callback is called exactly once for each height with the proof")
+	net := newMemNetwork(t, 4)
+	decided := make([]map[uint64]int, len(net.nodes))
+	for i := range net.nodes {
+		i := i
+		decided[i] = make(map[uint64]int)
+		net.nodes[i].decideCallback = func(height uint64, round uint64, state State, proof *SignedProto) {
+			decided[i][height]++
+			assert.Equal(t, State("state"), state)
+			assert.True(t, proof.Verify(S256Curve))
+
+			m, err := DecodeMessage(proof.Message)
+			assert.Nil(t, err)
+			assert.Equal(t, MessageType_Decide, m.Type)
+			assert.Equal(t, height, m.Height)
+			assert.Equal(t, round, m.Round)
+		}
+		net.nodes[i].Propose([]byte("state"))
+	}
+
+	for i := 0; i < 1000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	// duplicated <decide> messages
+	bts, err := proto.Marshal(net.nodes[0].CurrentProof())
+	assert.Nil(t, err)
+	for i := range net.nodes {
+		_ = net.nodes[i].ReceiveMessage(bts, net.now)
+		assert.Equal(t, map[uint64]int{1: 1}, decided[i])
+	}
+}
+
+func TestRoundChangeBackoff(t *testing.T) {
+	t.Log("test roundchange timeout follows the configured backoff")
+	consensus := createConsensus(t, 0, 0, nil)
+	assert.Equal(t, 2*consensus.latency, consensus.roundchangeDuration(0))
+
+	consensus.roundChangeBackoff = func(round uint64) time.Duration {
+		d := time.Second << round
+		if d > time.Minute {
+			d = time.Minute
+		}
+		return d
+	}
+
+	now := time.Now()
+	var last time.Duration
+	for r := uint64(0); r < 10; r++ {
+		// let lock release timeout to advance round
+		consensus.currentRound.Stage = stageLockRelease
+		consensus.lockReleaseTimeout = now
+		now = now.Add(time.Millisecond)
+		assert.Nil(t, consensus.Update(now))
+		assert.Equal(t, r+1, consensus.currentRound.RoundNumber)
+
+		timeout := consensus.rcTimeout.Sub(now)
+		assert.Equal(t, consensus.roundChangeBackoff(r+1), timeout)
+		assert.True(t, timeout >= last)
+		assert.True(t, timeout <= time.Minute)
+		last = timeout
+	}
+	assert.Equal(t, time.Minute, last)
+}
+
+func TestMaxPendingMessages(t *testing.T) {
+	t.Log("test buffered messages are bounded by max pending messages")
+	var keys []*ecdsa.PrivateKey
+	var pubkeys []*ecdsa.PublicKey
+	for i := 0; i < 20; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		pubkeys = append(pubkeys, &privateKey.PublicKey)
+	}
+
+	consensus := createConsensus(t, 0, 0, pubkeys)
+	consensus.maxPendingMessages = 5
+
+	receive := func(key *ecdsa.PrivateKey, round uint64) error {
+		_, sp, _ := createRoundChangeMessageSigner(t, 1, round, []byte("state"), key)
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		return consensus.ReceiveMessage(bts, time.Now())
+	}
+
+	// fill the pool with future rounds
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, receive(keys[i], uint64(10+i)))
+	}
+	assert.Equal(t, 5, consensus.numPendingMessages())
+
+	// duplicated message doesn't evict
+	assert.Nil(t, receive(keys[4], 14))
+	assert.Equal(t, 5, consensus.numPendingMessages())
+
+	// lower priority messages are dropped
+	assert.Equal(t, ErrMessagePoolFull, receive(keys[5], 14))
+	assert.Equal(t, ErrMessagePoolFull, receive(keys[5], 100))
+
+	// higher priority messages evict the furthest rounds
+	for i := 5; i < 10; i++ {
+		assert.Nil(t, receive(keys[i], 0))
+		assert.Equal(t, 5, consensus.numPendingMessages())
+	}
+
+	// only the current round remains, no more messages can be evicted
+	assert.Equal(t, 1, consensus.rounds.Len())
+	for i := 10; i < len(keys); i++ {
+		assert.Equal(t, ErrMessagePoolFull, receive(keys[i], 0))
+		assert.Equal(t, ErrMessagePoolFull, receive(keys[i], 1))
+	}
+	assert.Equal(t, 5, consensus.numPendingMessages())
+}
+
+func TestSync(t *testing.T) {
+	t.Log("test fast-forward from height 1 to height 50 via a <decide> proof")
+	m, sp, privateKey, proofKeys := createDecideMessage(t, 20, 50, 3, 50, 3)
+	consensus := createConsensus(t, 1, 0, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+
+	// not a <decide> message
+	_, commit, _ := createCommitMessageSigner(t, 50, 3, m.State, privateKey)
+	assert.Equal(t, ErrMessageUnknownMessageType, consensus.Sync(commit))
+
+	// insufficient proofs
+	insufficient := *m
+	insufficient.Proof = m.Proof[:len(m.Proof)/2]
+	signed := new(SignedProto)
+	signed.Sign(&insufficient, privateKey)
+	assert.Equal(t, ErrDecideProofInsufficient, consensus.Sync(signed))
+
+	var decided int
+	consensus.decideCallback = func(height uint64, round uint64, state State, proof *SignedProto) { decided++ }
+	assert.Nil(t, consensus.Sync(sp))
+	height, round, state := consensus.CurrentState()
+	assert.Equal(t, uint64(50), height)
+	assert.Equal(t, uint64(3), round)
+	assert.Equal(t, State(m.State), state)
+	assert.Equal(t, sp, consensus.CurrentProof())
+	assert.Equal(t, 1, decided)
+
+	// proofs at or below current height
+	assert.Equal(t, ErrDecideHeightLower, consensus.Sync(sp))
+	assert.Equal(t, 1, decided)
+}
+
+func TestPendingRoundChanges(t *testing.T) {
+	t.Log("test reading collected <roundchange> messages concurrently")
+	net := newMemNetwork(t, 4)
+	node := net.nodes[0]
+	have, missing := node.PendingRoundChanges()
+	assert.Equal(t, 0, len(have))
+	assert.Equal(t, node.participants, missing)
+
+	net.nodes[0].Propose([]byte("state"))
+	net.nodes[1].Propose([]byte("state"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			have, missing := node.PendingRoundChanges()
+			assert.Equal(t, 4, len(have)+len(missing))
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		net.step(node.roundchangeDuration(0))
+	}
+	<-done
+
+	// node 0 & 1 have sent <roundchange>
+	have, missing = node.PendingRoundChanges()
+	assert.ElementsMatch(t, node.participants[:2], have)
+	assert.ElementsMatch(t, node.participants[2:], missing)
+}
+
+func TestReceiveMessageContext(t *testing.T) {
+	t.Log("test message ingestion honors context cancellation")
+	_, sp, privateKey := createRoundChangeMessage(t, 1, 0)
+	consensus := createConsensus(t, 0, 0, []*ecdsa.PublicKey{&privateKey.PublicKey})
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, consensus.ReceiveMessageContext(ctx, bts, time.Now()))
+	assert.Equal(t, 0, consensus.currentRound.NumRoundChanges())
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	assert.Nil(t, consensus.ReceiveMessageContext(ctx, bts, time.Now()))
+	assert.Equal(t, 1, consensus.currentRound.NumRoundChanges())
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 //
 // consensus functional tests via IPC
@@ -1110,3 +1547,942 @@ func testConsensus(t *testing.T, param *testParam) []string {
 	}
 
 }
+
+func TestReceiveMessages(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+
+	for i := 0; i < 1000 && !net.decided(1); i++ {
+		var batch [][]byte
+		queue := net.queue
+		net.queue = nil
+		for _, m := range queue {
+			if m.to == 0 {
+				batch = append(batch, m.bts)
+			} else {
+				_ = net.nodes[m.to].ReceiveMessage(m.bts, net.now)
+			}
+		}
+		// a corrupted message and a message with invalid signature
+		if len(batch) > 0 {
+			tampered := new(SignedProto)
+			assert.Nil(t, proto.Unmarshal(batch[0], tampered))
+			tampered.R[0] ^= 0xff
+			bts, err := proto.Marshal(tampered)
+			assert.Nil(t, err)
+			batch = append(batch, []byte{0xff}, bts)
+		}
+
+		// a copy of node 0 receives the batch in parallel
+		snapshot, err := net.nodes[0].Snapshot()
+		assert.Nil(t, err)
+		config := *net.configs[0]
+		config.VerifyWorkers = 3
+		parallel, err := LoadConsensus(&config, snapshot)
+		assert.Nil(t, err)
+
+		serialErrs := make([]error, len(batch))
+		for k := range batch {
+			serialErrs[k] = net.nodes[0].ReceiveMessage(batch[k], net.now)
+		}
+		parallelErrs := parallel.ReceiveMessages(batch, net.now)
+		assert.Equal(t, serialErrs, parallelErrs)
+
+		// NOTE: snapshots differ in signatures of messages signed by node 0
+		expected, actual := net.nodes[0], parallel
+		assert.Equal(t, expected.latestHeight, actual.latestHeight)
+		assert.Equal(t, expected.latestRound, actual.latestRound)
+		assert.Equal(t, expected.latestState, actual.latestState)
+		assert.Equal(t, expected.currentRound.RoundNumber, actual.currentRound.RoundNumber)
+		assert.Equal(t, expected.currentRound.Stage, actual.currentRound.Stage)
+		assert.Equal(t, expected.currentRound.NumRoundChanges(), actual.currentRound.NumRoundChanges())
+		assert.Equal(t, len(expected.currentRound.commits), len(actual.currentRound.commits))
+		assert.Equal(t, len(expected.locks), len(actual.locks))
+		assert.True(t, expected.rcTimeout.Equal(actual.rcTimeout))
+		assert.True(t, expected.lockTimeout.Equal(actual.lockTimeout))
+		assert.True(t, expected.commitTimeout.Equal(actual.commitTimeout))
+
+		net.now = net.now.Add(20 * time.Millisecond)
+		for _, node := range net.nodes {
+			_ = node.Update(net.now)
+		}
+	}
+	assert.True(t, net.decided(1))
+}
+
+func BenchmarkReceiveMessages(b *testing.B) {
+	var msgs [][]byte
+	var quorum []*ecdsa.PublicKey
+	for k := 0; k < 64; k++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(b, err)
+		_, sp, _ := createRoundChangeMessageSigner(b, 1, 0, []byte("state"), privateKey)
+		bts, err := proto.Marshal(sp)
+		assert.Nil(b, err)
+		msgs = append(msgs, bts)
+		quorum = append(quorum, &privateKey.PublicKey)
+	}
+
+	SetVerifyCacheSize(0)
+	defer SetVerifyCacheSize(DefaultVerifyCacheSize)
+	for _, workers := range []int{1, runtime.NumCPU()} {
+		b.Run(fmt.Sprint("workers=", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				consensus := createConsensus(b, 0, 0, quorum)
+				consensus.verifyWorkers = workers
+				b.StartTimer()
+				for _, err := range consensus.ReceiveMessages(msgs, time.Now()) {
+					assert.Nil(b, err)
+				}
+			}
+		})
+	}
+}
+
+func TestStateCompareBytes(t *testing.T) {
+	assert.Equal(t, 0, StateCompareBytes(State("a"), State("a")))
+	assert.Equal(t, 0, StateCompareBytes(nil, State{}))
+	assert.Equal(t, -1, StateCompareBytes(State("a"), State("b")))
+	assert.Equal(t, 1, StateCompareBytes(State("b"), State("a")))
+	assert.Equal(t, -1, StateCompareBytes(State("a"), State("ab")))
+}
+
+func TestSetStateCompare(t *testing.T) {
+	consensus := createConsensus(t, 0, 0, nil)
+	consensus.unconfirmed = []State{State("b"), State("a"), State("c"), State("c")}
+	assert.Equal(t, State("c"), consensus.maximalUnconfirmed())
+
+	// reversed order
+	consensus.SetStateCompare(func(a State, b State) int { return StateCompareBytes(b, a) })
+	assert.Equal(t, State("a"), consensus.maximalUnconfirmed())
+
+	// nil is ignored
+	consensus.SetStateCompare(nil)
+	assert.Equal(t, State("a"), consensus.maximalUnconfirmed())
+
+	// equal states keep the first one
+	first, second := State("x"), State("x")
+	consensus.unconfirmed = []State{first, second}
+	consensus.SetStateCompare(StateCompareBytes)
+	max := consensus.maximalUnconfirmed()
+	assert.Equal(t, &first[0], &max[0])
+}
+
+func TestLastRejectedState(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	errFee := errors.New("insufficient fee")
+	for _, tc := range []struct {
+		validate    func(State) bool
+		validateErr func(State) error
+		expected    error
+	}{
+		{func(s State) bool { return false }, nil, ErrStateRejected},
+		{nil, func(s State) error { return errFee }, errFee},
+		{func(s State) bool { return true }, func(s State) error { return errFee }, errFee},
+	} {
+		consensus := createConsensus(t, 0, 0, []*ecdsa.PublicKey{&privateKey.PublicKey})
+		state, err := consensus.LastRejectedState()
+		assert.Nil(t, state)
+		assert.Nil(t, err)
+
+		config := &Config{
+			Epoch:            time.Now(),
+			PrivateKey:       consensus.privateKey,
+			Participants:     consensus.participants,
+			StateCompare:     StateCompareBytes,
+			StateValidate:    tc.validate,
+			StateValidateErr: tc.validateErr,
+		}
+		consensus = new(Consensus)
+		consensus.init(config)
+
+		_, sp, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		assert.Equal(t, ErrRoundChangeStateValidation, consensus.ReceiveMessage(bts, time.Now()))
+		state, err = consensus.LastRejectedState()
+		assert.Equal(t, State("state"), state)
+		assert.Equal(t, tc.expected, err)
+	}
+
+	// neither is set
+	config := &Config{Epoch: time.Now(), StateCompare: StateCompareBytes}
+	assert.Equal(t, ErrConfigStateValidate, config.Validate())
+}
+
+func TestPauseProposing(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	leader, _ := net.nodes[0].CurrentProposer()
+	paused := net.nodes[net.nodes[0].participantIndex[leader]]
+	paused.PauseProposing()
+
+	// Propose is a no-op while paused
+	paused.Propose([]byte("paused"))
+	assert.Equal(t, 0, len(paused.unconfirmed))
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	for _, node := range net.nodes {
+		height, round, state := node.CurrentState()
+		assert.Equal(t, uint64(1), height)
+		// the paused leader's round has been skipped
+		assert.True(t, round > 0)
+		assert.Equal(t, State("state"), state)
+	}
+
+	paused.ResumeProposing()
+	paused.Propose([]byte("resumed"))
+	assert.Equal(t, 1, len(paused.unconfirmed))
+
+	t.Log("test a paused participant still adopts the state of a <select>")
+	m, sp, privateKey, proofKeys := createSelectMessage(t, 20, 10, 10, 10, 10)
+	consensus := createConsensus(t, 9, 10, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.PauseProposing()
+
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, 1, len(consensus.unconfirmed))
+	assert.Equal(t, State(m.State), consensus.unconfirmed[0])
+}
+
+func TestWithdrawProposal(t *testing.T) {
+	t.Log("test own proposals can be withdrawn until a <lock> on them is accepted")
+	_, sp, privateKey, proofKeys := createLockMessageState(t, 20, []byte("fresh"), 10, 10, 10, 10)
+	consensus := createConsensus(t, 9, 10, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+
+	// a state adopted from the leader's <select> is not withdrawn
+	consensus.propose([]byte("selected"))
+	consensus.Propose([]byte("stale"))
+	assert.True(t, consensus.HasProposed([]byte("stale")))
+	assert.True(t, consensus.WithdrawProposal())
+	assert.False(t, consensus.HasProposed([]byte("stale")))
+	assert.True(t, consensus.HasProposed([]byte("selected")))
+
+	// a fresher state can be proposed again
+	consensus.Propose([]byte("fresh"))
+	assert.True(t, consensus.HasProposed([]byte("fresh")))
+
+	// no longer safe after the <lock> on own proposal is accepted
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.False(t, consensus.WithdrawProposal())
+	assert.True(t, consensus.HasProposed([]byte("fresh")))
+	assert.True(t, consensus.HasProposed([]byte("selected")))
+
+	t.Log("test a <lock> on others' state doesn't prevent withdrawal")
+	_, sp, privateKey, proofKeys = createLockMessage(t, 20, 10, 10, 10, 10)
+	consensus = createConsensus(t, 9, 10, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.Propose([]byte("stale"))
+
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.True(t, consensus.WithdrawProposal())
+	assert.False(t, consensus.HasProposed([]byte("stale")))
+}
+
+func TestMessageOutCallbackTransport(t *testing.T) {
+	t.Log("test deciding with all messages transported by MessageOutCallback only")
+	type outbound struct {
+		from int
+		bts  []byte
+	}
+	var wire []outbound
+	var delivered []map[*SignedProto]int
+
+	now := time.Now()
+	var keys []*ecdsa.PrivateKey
+	var participants []Identity
+	for i := 0; i < 4; i++ {
+		key := mustGenerateKey(t)
+		keys = append(keys, key)
+		participants = append(participants, DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+
+	var nodes []*Consensus
+	for i := range keys {
+		i := i
+		delivered = append(delivered, make(map[*SignedProto]int))
+		config := new(Config)
+		config.Epoch = now
+		config.PrivateKey = keys[i]
+		config.Participants = participants
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		config.MessageOutCallback = func(m *Message, signed *SignedProto) {
+			delivered[i][signed]++
+			wire = append(wire, outbound{from: i, bts: append([]byte{}, signed.Bytes()...)})
+		}
+		consensus, err := NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.Propose([]byte("state"))
+		nodes = append(nodes, consensus)
+	}
+
+	decided := func() bool {
+		for _, node := range nodes {
+			if height, _, _ := node.CurrentState(); height < 1 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; i < 10000 && !decided(); i++ {
+		queue := wire
+		wire = nil
+		for _, out := range queue {
+			for j := range nodes {
+				if j != out.from {
+					_ = nodes[j].ReceiveMessage(out.bts, now)
+				}
+			}
+		}
+		now = now.Add(20 * time.Millisecond)
+		for _, node := range nodes {
+			_ = node.Update(now)
+		}
+	}
+	assert.True(t, decided())
+
+	for i := range nodes {
+		_, _, state := nodes[i].CurrentState()
+		assert.Equal(t, State("state"), state)
+		assert.NotEqual(t, 0, len(delivered[i]))
+		for _, n := range delivered[i] {
+			assert.Equal(t, 1, n)
+		}
+	}
+}
+
+func TestMessageFilter(t *testing.T) {
+	t.Log("test messages dropped by the filter never reach the state machine")
+	var jailed Identity
+	var filtered, processed int
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		jailed = config.Participants[3]
+		if DefaultPubKeyToIdentity(&config.PrivateKey.PublicKey) == jailed {
+			return
+		}
+		config.MessageFilter = func(sp *SignedProto) bool {
+			if DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)) == jailed {
+				filtered++
+				return false
+			}
+			return true
+		}
+		config.MessageValidator = func(c *Consensus, m *Message, sp *SignedProto) bool {
+			if c.pubKeyToIdentity(sp.PublicKey(c.curve)) == jailed {
+				processed++
+			}
+			return true
+		}
+	})
+
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	assert.NotEqual(t, 0, filtered)
+	assert.Equal(t, 0, processed)
+
+	// filtered messages are dropped silently in batch too
+	_, sp, _ := createRoundChangeMessageSigner(t, 2, 0, []byte("state"), net.configs[3].PrivateKey)
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, net.nodes[0].ReceiveMessage(bts, net.now))
+	assert.Equal(t, []error{nil}, net.nodes[0].ReceiveMessages([][]byte{bts}, net.now))
+	assert.Equal(t, 0, processed)
+}
+
+func TestQuorumSize(t *testing.T) {
+	t.Log("test the quorum of the classic fault model and a custom majority")
+	majority := func(n int) int { return n/2 + 1 }
+
+	classic := createConsensus(t, 0, 0, nil)
+	for i := 0; i < 3; i++ {
+		classic.AddParticipant(&mustGenerateKey(t).PublicKey)
+	}
+	assert.Equal(t, 4, classic.numIdentities)
+	assert.False(t, classic.hasQuorum(2))
+	assert.True(t, classic.hasQuorum(3))
+
+	// an unsafe threshold is raised to the floor
+	classic.quorumSize = func(n int) int { return 1 }
+	assert.False(t, classic.hasQuorum(2))
+	assert.True(t, classic.hasQuorum(3))
+
+	// with 3 of 7 participants crashed, only a majority is able to decide
+	decide := func(quorumSize func(n int) int) bool {
+		net := newMemNetworkConfig(t, 7, func(config *Config) { config.QuorumSize = quorumSize })
+		live := net.nodes[:4]
+		for _, node := range live {
+			node.Propose([]byte("state"))
+		}
+		for i := 0; i < 2000; i++ {
+			queue := net.queue
+			net.queue = nil
+			for _, m := range queue {
+				if m.to < len(live) {
+					_ = live[m.to].ReceiveMessage(m.bts, net.now)
+				}
+			}
+			net.now = net.now.Add(20 * time.Millisecond)
+			decided := true
+			for _, node := range live {
+				_ = node.Update(net.now)
+				height, _, _ := node.CurrentState()
+				decided = decided && height == 1
+			}
+			if decided {
+				return true
+			}
+		}
+		return false
+	}
+	assert.False(t, decide(nil))
+	assert.True(t, decide(majority))
+}
+
+func TestLeaderFunc(t *testing.T) {
+	// elects in reverse order, shifted by height
+	elect := func(height, round uint64, participants []Identity) Identity {
+		n := uint64(len(participants))
+		return participants[n-1-(height+round)%n]
+	}
+
+	var mu sync.Mutex
+	var locks int
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		config.LeaderFunc = elect
+		config.MessageValidator = func(c *Consensus, m *Message, signed *SignedProto) bool {
+			if m.Type == MessageType_Lock {
+				assert.Equal(t, elect(m.Height, m.Round, c.participants), c.pubKeyToIdentity(signed.PublicKey(c.curve)))
+				mu.Lock()
+				locks++
+				mu.Unlock()
+			}
+			return true
+		}
+	})
+
+	leader, round := net.nodes[0].CurrentProposer()
+	assert.Equal(t, elect(1, round, net.nodes[0].participants), leader)
+
+	// a <lock> from the round-robin leader is rejected
+	rrLeader := net.configs[0].PrivateKey
+	assert.NotEqual(t, leader, net.nodes[0].participants[0])
+	m := new(Message)
+	m.Type = MessageType_Lock
+	m.Height = 1
+	m.Round = 0
+	m.State = []byte("state")
+	signed := new(SignedProto)
+	signed.Sign(m, rrLeader)
+	assert.Equal(t, ErrLockNotSignedByLeader, net.nodes[1].verifyLockMessage(m, signed))
+
+	for height := uint64(1); height <= 2; height++ {
+		for _, node := range net.nodes {
+			node.Propose([]byte(fmt.Sprint("state", height)))
+		}
+		for i := 0; i < 10000 && !net.decided(height); i++ {
+			net.step(20 * time.Millisecond)
+		}
+		assert.True(t, net.decided(height))
+	}
+	assert.True(t, locks > 0)
+}
+
+func TestLeaderFuncSync(t *testing.T) {
+	// elects by height only, the leaders of height 1 and 3 differ
+	elect := func(height, round uint64, participants []Identity) Identity {
+		return participants[height%uint64(len(participants))]
+	}
+	net := newMemNetworkConfig(t, 4, func(config *Config) { config.LeaderFunc = elect })
+	node := net.nodes[0]
+
+	var keys []*ecdsa.PrivateKey
+	var leader, stale *ecdsa.PrivateKey
+	for _, config := range net.configs {
+		keys = append(keys, config.PrivateKey)
+		switch DefaultPubKeyToIdentity(&config.PrivateKey.PublicKey) {
+		case elect(3, 0, node.participants):
+			leader = config.PrivateKey
+		case elect(1, 0, node.participants):
+			stale = config.PrivateKey
+		}
+	}
+
+	// a catch-up <decide> is verified against the leader of it's own height
+	assert.Equal(t, ErrDecideNotSignedByLeader, node.Sync(createDecideProof(t, 3, 0, []byte("state"), stale, keys)))
+	assert.Nil(t, node.Sync(createDecideProof(t, 3, 0, []byte("state"), leader, keys)))
+	height, _, _ := node.CurrentState()
+	assert.Equal(t, uint64(3), height)
+}
+
+func TestRoundChangeCallback(t *testing.T) {
+	type roundChange struct {
+		height, oldRound, newRound uint64
+		reason                     string
+	}
+	events := make([][]roundChange, 4)
+	var idx int
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		i := idx
+		idx++
+		config.RoundChangeCallback = func(height, oldRound, newRound uint64, reason string) {
+			events[i] = append(events[i], roundChange{height, oldRound, newRound, reason})
+		}
+	})
+
+	// the leader of round 0 never proposes, so round 0 times out
+	leader, _ := net.nodes[0].CurrentProposer()
+	net.nodes[net.nodes[0].participantIndex[leader]].PauseProposing()
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	var timeouts int
+	for i := range events {
+		assert.NotEmpty(t, events[i])
+		for _, e := range events[i] {
+			assert.Equal(t, uint64(1), e.height)
+			assert.True(t, e.newRound > e.oldRound)
+			switch e.reason {
+			case RoundChangeTimeout:
+				assert.Equal(t, e.oldRound+1, e.newRound)
+				timeouts++
+			case RoundChangeQuorum, RoundChangeLock, RoundChangeSelect:
+			default:
+				t.Fatalf("unknown reason %q", e.reason)
+			}
+		}
+	}
+	assert.True(t, timeouts > 0)
+
+	// a <lock> or <select> of a higher round
+	for _, tc := range []struct {
+		create func(t *testing.T, numProofs int, height uint64, round uint64, proofHeight uint64, proofRound uint64) (*Message, *SignedProto, *ecdsa.PrivateKey, []*ecdsa.PublicKey)
+		reason string
+	}{
+		{createLockMessage, RoundChangeLock},
+		{createSelectMessage, RoundChangeSelect},
+	} {
+		_, sp, privateKey, proofKeys := tc.create(t, 20, 10, 10, 10, 10)
+		consensus := createConsensus(t, 9, 0, proofKeys)
+		consensus.SetLeader(&privateKey.PublicKey)
+		var changes []roundChange
+		consensus.roundChangeCallback = func(height, oldRound, newRound uint64, reason string) {
+			changes = append(changes, roundChange{height, oldRound, newRound, reason})
+		}
+
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+		assert.Equal(t, []roundChange{{10, 0, 10, tc.reason}}, changes)
+	}
+}
+
+func TestResyncInterval(t *testing.T) {
+	interval := time.Second
+	net := newMemNetworkConfig(t, 4, func(config *Config) { config.ResyncInterval = interval })
+	node := net.nodes[0]
+	now := net.now
+
+	// resync creates <resync> messages signed by the node at index i, with
+	// distinct proofs to bypass replay detection
+	var round uint64
+	resync := func(i int) []byte {
+		round++
+		_, rc, _ := createRoundChangeMessageSigner(t, 1, round, nil, net.configs[i].PrivateKey)
+		m := new(Message)
+		m.Type = MessageType_Resync
+		m.Proof = []*SignedProto{rc}
+		signed := new(SignedProto)
+		signed.Sign(m, net.configs[i].PrivateKey)
+		bts, err := signed.Marshal()
+		assert.Nil(t, err)
+		return bts
+	}
+
+	// responses to the same peer are throttled
+	assert.Nil(t, node.ReceiveMessage(resync(1), now))
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, ErrResyncRateLimited, node.ReceiveMessage(resync(1), now.Add(time.Duration(i)*interval/10)))
+	}
+	assert.Nil(t, node.ReceiveMessage(resync(2), now))
+	assert.Nil(t, node.ReceiveMessage(resync(1), now.Add(interval)))
+
+	// emissions are throttled
+	net.queue = nil
+	node.lastRoundChangeProof = []*SignedProto{new(SignedProto)}
+	for i := 0; i < 10; i++ {
+		node.broadcastResync(now.Add(time.Duration(i) * interval / 10))
+	}
+	assert.Equal(t, 3, len(net.queue))
+	node.broadcastResync(now.Add(interval))
+	assert.Equal(t, 6, len(net.queue))
+
+	// limits are reset at new height
+	node.heightSync(1, 0, []byte("state"), now)
+	node.lastRoundChangeProof = []*SignedProto{new(SignedProto)}
+	node.broadcastResync(now.Add(interval))
+	assert.Equal(t, 9, len(net.queue))
+	assert.Nil(t, node.ReceiveMessage(resync(1), now.Add(interval)))
+}
+
+func TestRotateKey(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	newKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	oldIdentity := DefaultPubKeyToIdentity(&oldKey.PublicKey)
+	newIdentity := DefaultPubKeyToIdentity(&newKey.PublicKey)
+
+	consensus := createConsensus(t, 0, 0, nil)
+	assert.Nil(t, consensus.RotateKey(oldKey))
+	m := &Message{Type: MessageType_Nop}
+
+	before := new(SignedProto)
+	assert.Nil(t, consensus.sign(before, m))
+	ownedKey := consensus.privateKey
+	assert.True(t, ownedKey != oldKey)
+	assert.Nil(t, consensus.RotateKey(newKey))
+	after := new(SignedProto)
+	assert.Nil(t, consensus.sign(after, m))
+
+	// each message verifies with the matching key
+	assert.Nil(t, before.VerifyWith(S256Curve, nil))
+	assert.Equal(t, oldIdentity, DefaultPubKeyToIdentity(before.PublicKey(S256Curve)))
+	assert.Nil(t, after.VerifyWith(S256Curve, nil))
+	assert.Equal(t, newIdentity, DefaultPubKeyToIdentity(after.PublicKey(S256Curve)))
+	assert.Equal(t, newIdentity, consensus.identity)
+
+	// the previous secret owned by consensus has been zeroed, the caller's
+	// key is left untouched
+	assert.Equal(t, 0, ownedKey.D.Sign())
+	for _, word := range ownedKey.D.Bits()[:cap(ownedKey.D.Bits())] {
+		assert.Zero(t, word)
+	}
+	assert.Equal(t, 1, oldKey.D.Sign())
+	assert.Equal(t, oldIdentity, DefaultPubKeyToIdentity(&oldKey.PublicKey))
+
+	assert.Equal(t, ErrRotateKeyNil, consensus.RotateKey(nil))
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrRotateKeyCurve, consensus.RotateKey(p256Key))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	consensus.signer = NewEd25519Signer(edKey)
+	assert.Equal(t, ErrRotateKeySigner, consensus.RotateKey(newKey))
+}
+
+func TestRotateKeySharedConfig(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	config := net.configs[0]
+	key := config.PrivateKey
+	identity := DefaultPubKeyToIdentity(&key.PublicKey)
+
+	first := net.nodes[0]
+	second, err := NewConsensus(config.Clone())
+	assert.Nil(t, err)
+
+	newKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	assert.Nil(t, first.RotateKey(newKey))
+
+	// the second instance keeps signing with the original key
+	m := &Message{Type: MessageType_Nop}
+	sp := new(SignedProto)
+	assert.Nil(t, second.sign(sp, m))
+	assert.Nil(t, sp.VerifyWith(S256Curve, nil))
+	assert.Equal(t, identity, DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)))
+	assert.Equal(t, identity, second.identity)
+	assert.Equal(t, 1, key.D.Sign())
+	assert.Equal(t, 1, config.PrivateKey.D.Sign())
+}
+
+func TestIsLocked(t *testing.T) {
+	t.Log("test reading the locked state concurrently")
+	net := newMemNetwork(t, 4)
+	leader, _ := net.nodes[0].CurrentProposer()
+	node := net.nodes[(net.nodes[0].participantIndex[leader]+1)%4]
+	_, locked := node.IsLocked()
+	assert.False(t, locked)
+
+	for _, n := range net.nodes {
+		n.Propose([]byte("state"))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if state, locked := node.IsLocked(); locked {
+				assert.Equal(t, State("state"), state)
+			}
+		}
+	}()
+
+	var observed bool
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+		state, locked := node.IsLocked()
+		assert.Equal(t, len(node.locks) > 0, locked)
+		if locked {
+			observed = true
+			assert.Equal(t, State("state"), state)
+		}
+	}
+	<-done
+	assert.True(t, net.decided(1))
+	assert.True(t, observed)
+
+	// locks are cleared at the new height
+	_, locked = node.IsLocked()
+	assert.False(t, locked)
+}
+
+func TestCurrentRound(t *testing.T) {
+	net := newMemNetworkConfig(t, 4, func(config *Config) { config.CurrentRound = 5 })
+	for _, node := range net.nodes {
+		leader, round := node.CurrentProposer()
+		assert.Equal(t, uint64(5), round)
+		assert.Equal(t, node.participants[1], leader)
+		assert.Equal(t, net.now.Add(node.roundchangeDuration(5)), node.rcTimeout)
+		node.Propose([]byte("state"))
+	}
+
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	for _, node := range net.nodes {
+		_, round, state := node.CurrentState()
+		assert.True(t, round >= 5)
+		assert.Equal(t, State("state"), state)
+	}
+
+	// timers and leaders of large rounds
+	node := net.nodes[0]
+	assert.Equal(t, MaxConsensusLatency, node.roundchangeDuration(63))
+	assert.Equal(t, MaxConsensusLatency, node.lockDuration(math.MaxUint64))
+	assert.Equal(t, node.participants[math.MaxUint64%4], node.roundLeader(node.latestHeight+1, math.MaxUint64))
+
+	config := net.configs[0].Clone()
+	config.CurrentHeight = math.MaxUint64
+	assert.True(t, errors.Is(config.Validate(), ErrConfigCurrentRound))
+}
+
+func TestHealth(t *testing.T) {
+	t.Log("test health status reported concurrently")
+	net := newMemNetwork(t, 4)
+	node := net.nodes[0]
+	status := node.Health()
+	assert.Equal(t, uint64(0), status.Height)
+	assert.Equal(t, 3, status.Peers)
+	assert.False(t, status.Stuck)
+	assert.True(t, status.Healthy)
+
+	for _, n := range net.nodes {
+		n.Propose([]byte("state"))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			status := node.Health()
+			assert.True(t, status.Height <= 1)
+		}
+	}()
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	<-done
+	assert.True(t, net.decided(1))
+	assert.Equal(t, uint64(1), node.Health().Height)
+
+	// not connected to enough peers to form a quorum
+	for len(node.peers) > 1 {
+		assert.True(t, node.Leave(node.peers[1].RemoteAddr()))
+	}
+	status = node.Health()
+	assert.Equal(t, 1, status.Peers)
+	assert.False(t, status.Healthy)
+
+	// a round lasted beyond the threshold is stuck
+	stuck := newMemNetworkConfig(t, 4, func(config *Config) {
+		config.Epoch = time.Now().Add(-time.Hour)
+		config.StuckThreshold = time.Minute
+	})
+	status = stuck.nodes[0].Health()
+	assert.True(t, status.Stuck)
+	assert.False(t, status.Healthy)
+	assert.True(t, status.SinceRound >= time.Hour)
+	assert.True(t, status.SinceDecision >= time.Hour)
+}
+
+func TestTieBreak(t *testing.T) {
+	t.Log("test proposals compared equal are selected deterministically")
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		config.StateCompare = func(a State, b State) int { return 0 }
+	})
+
+	a, b := State("a"), State("b")
+	expected := a
+	if ha, hb := net.nodes[0].stateHash(a), net.nodes[0].stateHash(b); bytes.Compare(ha[:], hb[:]) < 0 {
+		expected = b
+	}
+
+	// proposals arrive in different orders
+	for i, node := range net.nodes {
+		if i%2 == 0 {
+			node.Propose(a)
+			node.Propose(b)
+		} else {
+			node.Propose(b)
+			node.Propose(a)
+		}
+		assert.Equal(t, expected, node.maximalUnconfirmed())
+	}
+
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	for _, node := range net.nodes {
+		_, round, state := node.CurrentState()
+		assert.Equal(t, expected, state)
+		assert.Equal(t, uint64(0), round)
+	}
+
+	// the tied state with the lower hash is lower, and will be rejected
+	// if selected by the leader in <select>
+	consensus := net.nodes[0]
+	other := a
+	if bytes.Equal(expected, a) {
+		other = b
+	}
+	assert.Equal(t, -1, consensus.compareStates(other, expected))
+	assert.Equal(t, 0, consensus.compareStates(expected, expected))
+}
+
+// simulatedClock is a Clock advanced manually
+type simulatedClock struct{ now time.Time }
+
+func (c *simulatedClock) Now() time.Time { return c.now }
+
+func TestSimulatedClock(t *testing.T) {
+	t.Log("test round changes driven by a simulated clock without sleeps")
+	clock := &simulatedClock{now: time.Unix(1600000000, 0)}
+	var rounds []uint64
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		config.Epoch = clock.now
+		config.Clock = clock
+		// the leader of each round is isolated, so no round decides
+		participants := config.Participants
+		config.MessageFilter = func(sp *SignedProto) bool {
+			m, err := DecodeMessage(sp.Message)
+			assert.Nil(t, err)
+			return DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)) != participants[m.Round%uint64(len(participants))]
+		}
+	})
+	node := net.nodes[0]
+	node.roundChangeCallback = func(height, oldRound, newRound uint64, reason string) {
+		rounds = append(rounds, newRound)
+	}
+
+	for _, n := range net.nodes {
+		n.Propose([]byte("state"))
+	}
+	started := time.Now()
+	for i := 0; i < 10000 && len(rounds) < 5; i++ {
+		queue := net.queue
+		net.queue = nil
+		for _, m := range queue {
+			_ = net.nodes[m.to].ReceiveMessage(m.bts, clock.Now())
+		}
+		clock.now = clock.now.Add(time.Second)
+		for _, n := range net.nodes {
+			_ = n.Update(clock.Now())
+		}
+	}
+	assert.True(t, time.Since(started) < 10*time.Second)
+	assert.True(t, len(rounds) >= 5)
+	height, _, _ := node.CurrentState()
+	assert.Equal(t, uint64(0), height)
+
+	// health is measured by the simulated clock
+	status := node.Health()
+	assert.Equal(t, rounds[len(rounds)-1], status.Round)
+	since := status.SinceRound
+	clock.now = clock.now.Add(time.Minute)
+	assert.Equal(t, since+time.Minute, node.Health().SinceRound)
+}
+
+func TestDropStats(t *testing.T) {
+	t.Log("test reasons of dropped messages are counted")
+	_, sp, key := createRoundChangeMessageState(t, 1, 0, []byte("state"))
+	consensus := createConsensus(t, 0, 0, []*ecdsa.PublicKey{&key.PublicKey})
+	unknown := mustGenerateKey(t)
+	consensus.messageFilter = func(sp *SignedProto) bool {
+		return DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)) != DefaultPubKeyToIdentity(&unknown.PublicKey)
+	}
+	assert.Equal(t, 0, len(consensus.DropStats()))
+
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, 0, len(consensus.DropStats()))
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+
+	// from a participant unknown
+	_, sp, _ = createRoundChangeMessageState(t, 1, 0, []byte("state"))
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMessageUnknownParticipant, consensus.ReceiveMessage(bts, time.Now()))
+
+	// filtered
+	_, sp, _ = createRoundChangeMessageSigner(t, 1, 0, []byte("state"), unknown)
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+
+	stats := consensus.DropStats()
+	assert.Equal(t, uint64(2), stats[DropReplayed])
+	assert.Equal(t, uint64(1), stats[DropFiltered])
+	assert.Equal(t, uint64(1), stats[ErrMessageUnknownParticipant.Error()])
+
+	// the returned stats are a copy
+	stats[DropReplayed] = 0
+	assert.Equal(t, uint64(2), consensus.DropStats()[DropReplayed])
+
+	// no allocation for messages accepted
+	m := &Message{Type: MessageType_RoundChange}
+	assert.Equal(t, float64(0), testing.AllocsPerRun(100, func() { consensus.measureMessage(m, nil) }))
+}
@@ -59,7 +59,15 @@ func (p *PrivateKey) ToECDSA() *ecdsa.PrivateKey {
 // is deterministic (same message and same key yield the same signature) and canonical
 // in accordance with RFC6979 and BIP0062.
 func (p *PrivateKey) Sign(hash []byte) (*Signature, error) {
-	return signRFC6979(p, hash)
+	return signRFC6979(p, hash, nil)
+}
+
+// SignWithEntropy generates an ECDSA signature as Sign does, with the extra
+// bytes mixed into the nonce as the additional data k' described in section
+// 3.6 of RFC6979, so the nonce stays unique per message even if the extra
+// bytes are reused, and identical inputs yield the same signature.
+func (p *PrivateKey) SignWithEntropy(hash []byte, extra []byte) (*Signature, error) {
+	return signRFC6979(p, hash, extra)
 }
 
 // PrivKeyBytesLen defines the length in bytes of a serialized private key.
@@ -418,13 +418,14 @@ func RecoverCompact(curve *KoblitzCurve, signature,
 	return key, ((signature[0] - 27) & 4) == 4, nil
 }
 
-// signRFC6979 generates a deterministic ECDSA signature according to RFC 6979 and BIP 62.
-func signRFC6979(privateKey *PrivateKey, hash []byte) (*Signature, error) {
+// signRFC6979 generates a deterministic ECDSA signature according to RFC 6979 and BIP 62,
+// with optional additional data mixed into the nonce.
+func signRFC6979(privateKey *PrivateKey, hash []byte, extra []byte) (*Signature, error) {
 
 	privkey := privateKey.ToECDSA()
 	N := S256().N
 	halfOrder := S256().halfOrder
-	k := nonceRFC6979(privkey.D, hash)
+	k := nonceRFC6979(privkey.D, hash, extra)
 	inv := new(big.Int).ModInverse(k, N)
 	r, _ := privkey.Curve.ScalarBaseMult(k.Bytes())
 	r.Mod(r, N)
@@ -449,8 +450,9 @@ func signRFC6979(privateKey *PrivateKey, hash []byte) (*Signature, error) {
 }
 
 // nonceRFC6979 generates an ECDSA nonce (`k`) deterministically according to RFC 6979.
-// It takes a 32-byte hash as an input and returns 32-byte nonce to be used in ECDSA algorithm.
-func nonceRFC6979(privkey *big.Int, hash []byte) *big.Int {
+// It takes a 32-byte hash as an input and returns 32-byte nonce to be used in ECDSA algorithm,
+// the optional extra bytes are appended to the HMAC input as the additional data k' (section 3.6).
+func nonceRFC6979(privkey *big.Int, hash []byte, extra []byte) *big.Int {
 
 	curve := S256()
 	q := curve.Params().N
@@ -461,6 +463,7 @@ func nonceRFC6979(privkey *big.Int, hash []byte) *big.Int {
 	holen := alg().Size()
 	rolen := (qlen + 7) >> 3
 	bx := append(int2octets(x, rolen), bits2octets(hash, curve, rolen)...)
+	bx = append(bx, extra...)
 
 	// Step B
 	v := bytes.Repeat(oneInitializer, holen)
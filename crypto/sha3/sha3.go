@@ -0,0 +1,96 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sha3 implements the legacy Keccak-256 hash function used by
+// Ethereum, adapted from golang.org/x/crypto/sha3 with the generic permutation only.
+package sha3
+
+import "hash"
+
+const (
+	// dsbyteKeccak is the domain separation byte of legacy Keccak
+	dsbyteKeccak = 0x01
+
+	// rateK512 is the rate in bytes for Keccak[512]
+	rateK512 = (1600 - 512) / 8
+)
+
+// state is a Keccak sponge in absorbing direction, as only Sum is supported
+type state struct {
+	a [1600 / 8]byte // main state of the hash
+
+	// a[n:rate] is the remaining space to XOR into before running the permutation.
+	n, rate int
+
+	// dsbyte contains the "domain separation" bits and the first bit of the padding.
+	dsbyte byte
+
+	outputLen int // the default output size in bytes
+}
+
+// NewLegacyKeccak256 creates a new Keccak-256 hash.
+//
+// Only use this function if you require compatibility with an existing cryptosystem
+// that uses non-standard padding, such as Ethereum.
+func NewLegacyKeccak256() hash.Hash {
+	return &state{rate: rateK512, outputLen: 32, dsbyte: dsbyteKeccak}
+}
+
+// BlockSize returns the rate of sponge underlying this hash function.
+func (d *state) BlockSize() int { return d.rate }
+
+// Size returns the output size of the hash function in bytes.
+func (d *state) Size() int { return d.outputLen }
+
+// Reset clears the internal state by zeroing the sponge state.
+func (d *state) Reset() {
+	for i := range d.a {
+		d.a[i] = 0
+	}
+	d.n = 0
+}
+
+// permute applies the KeccakF-1600 permutation.
+func (d *state) permute() {
+	keccakF1600Generic(&d.a)
+	d.n = 0
+}
+
+// Write absorbs more data into the hash's state.
+func (d *state) Write(p []byte) (n int, err error) {
+	n = len(p)
+	for len(p) > 0 {
+		x := d.rate - d.n
+		if x > len(p) {
+			x = len(p)
+		}
+		for i := 0; i < x; i++ {
+			d.a[d.n+i] ^= p[i]
+		}
+		d.n += x
+		p = p[x:]
+
+		// If the sponge is full, apply the permutation.
+		if d.n == d.rate {
+			d.permute()
+		}
+	}
+	return
+}
+
+// Sum appends the current hash to b and returns the resulting slice.
+// It does not change the underlying hash state.
+func (d *state) Sum(b []byte) []byte {
+	// Make a copy of the original hash so that caller can keep writing
+	// and summing.
+	dup := *d
+
+	// Pad with this instance's domain-separator bits, and the final one bit
+	// for the padding, then apply the permutation.
+	dup.a[dup.n] ^= dup.dsbyte
+	dup.a[dup.rate-1] ^= 0x80
+	dup.permute()
+
+	return append(b, dup.a[:dup.outputLen]...)
+}
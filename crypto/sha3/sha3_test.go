@@ -0,0 +1,57 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sha3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestKeccak256(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{"abc", "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		{"The quick brown fox jumps over the lazy dog", "4d741b6f1eb29cb2a9b9911c82f56fa8d73b04959d3d9d222895df6c0b28aa15"},
+	}
+
+	for _, test := range tests {
+		h := NewLegacyKeccak256()
+		h.Write([]byte(test.in))
+		if got := hex.EncodeToString(h.Sum(nil)); got != test.want {
+			t.Errorf("Keccak256(%q) = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+// TestKeccak256Blocks writes data across the block boundaries byte by byte,
+// and compares against a single write.
+func TestKeccak256Blocks(t *testing.T) {
+	data := make([]byte, 3*rateK512+7)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	one := NewLegacyKeccak256()
+	one.Write(data)
+
+	bybyte := NewLegacyKeccak256()
+	for i := range data {
+		bybyte.Write(data[i : i+1])
+	}
+
+	if !bytes.Equal(one.Sum(nil), bybyte.Sum(nil)) {
+		t.Error("Keccak256 mismatch between single write and byte-by-byte writes")
+	}
+
+	one.Reset()
+	empty := NewLegacyKeccak256()
+	if !bytes.Equal(one.Sum(nil), empty.Sum(nil)) {
+		t.Error("Keccak256 mismatch after Reset")
+	}
+}
@@ -0,0 +1,73 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+// DefaultDecidedChSize is the default capacity of the channel returned by
+// DecidedCh.
+const DefaultDecidedChSize = 64
+
+// DecideEvent is a newly decided height emitted to DecidedCh
+type DecideEvent struct {
+	Height uint64       // the decided height
+	Round  uint64       // the round in which the height was decided
+	State  State        // the decided state
+	Proof  *SignedProto // the <decide> message as the proof, MUST NOT be modified
+}
+
+// emitDecided sends the event to DecidedCh without blocking, the event is
+// dropped and counted if the channel is full.
+func (c *Consensus) emitDecided(event DecideEvent) {
+	select {
+	case c.decidedCh <- event:
+	default:
+		c.observer.Lock()
+		c.observer.decidedDrops++
+		c.observer.Unlock()
+	}
+}
+
+// DecidedCh returns a channel emitting one event per newly decided height, in
+// the order of heights, as an alternative of polling CurrentHeight. The channel
+// is buffered with Config.DecidedChSize events, and it's never blocked on, so a
+// slow consumer can't stall the consensus: events arriving while the buffer is
+// full are dropped, and counted by DecidedDrops. Consumers can tell from the gap
+// of heights, and catch up by CurrentState or CurrentProof.
+//
+// The same channel is returned on each call, and it's never closed.
+func (c *Consensus) DecidedCh() <-chan DecideEvent { return c.decidedCh }
+
+// DecidedDrops returns the number of events dropped by DecidedCh.
+// It's safe to be called concurrently with the state machine.
+func (c *Consensus) DecidedDrops() uint64 {
+	c.observer.Lock()
+	defer c.observer.Unlock()
+	return c.observer.decidedDrops
+}
@@ -0,0 +1,61 @@
+package bdls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecidedCh(t *testing.T) {
+	var index int
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		if index == 1 {
+			config.DecidedChSize = 1
+		}
+		index++
+	})
+	decide := func(h uint64) {
+		for _, node := range net.nodes {
+			node.Propose(State{byte(h)})
+		}
+		for i := 0; i < 10000 && !net.decided(h); i++ {
+			net.step(20 * time.Millisecond)
+		}
+		assert.True(t, net.decided(h))
+	}
+
+	// consumed across decisions
+	participants := net.configs[0].Participants
+	ch := net.nodes[0].DecidedCh()
+	assert.Equal(t, DefaultDecidedChSize, cap(ch))
+	for h := uint64(1); h <= 3; h++ {
+		decide(h)
+		select {
+		case event := <-ch:
+			assert.Equal(t, h, event.Height)
+			assert.Equal(t, State{byte(h)}, event.State)
+			height, state, err := VerifyDecideProof(participants, event.Proof)
+			assert.Nil(t, err)
+			assert.Equal(t, h, height)
+			assert.Equal(t, event.State, state)
+			_, round, _ := net.nodes[0].CurrentState()
+			assert.Equal(t, round, event.Round)
+		default:
+			t.Fatal("no event of height", h)
+		}
+	}
+	assert.Equal(t, 0, len(ch))
+	assert.Equal(t, uint64(0), net.nodes[0].DecidedDrops())
+
+	// dropped while full
+	slow := net.nodes[1].DecidedCh()
+	assert.Equal(t, 1, cap(slow))
+	assert.Equal(t, uint64(1), (<-slow).Height)
+	assert.Equal(t, uint64(2), net.nodes[1].DecidedDrops())
+	select {
+	case event := <-slow:
+		t.Fatal("unexpected event of height", event.Height)
+	default:
+	}
+}
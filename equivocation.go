@@ -0,0 +1,121 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+// DefaultMaxEvidence is the default number of retained equivocations
+// awaiting to be taken.
+const DefaultMaxEvidence = 1024
+
+// Equivocation is the evidence of a participant signing two conflicting
+// messages of the same type at the same height & round, both messages
+// have been verified against the signer's public key.
+type Equivocation struct {
+	First  *SignedProto
+	Second *SignedProto
+}
+
+// equivocationKey identifies a message slot of a participant
+type equivocationKey struct {
+	identity Identity
+	height   uint64
+	round    uint64
+	msgType  MessageType
+}
+
+// evidenceKey identifies an offender at a height & round, at most one
+// equivocation is retained for each.
+type evidenceKey struct {
+	identity Identity
+	height   uint64
+	round    uint64
+}
+
+// checkEquivocation records the first verified message for each (signer,
+// height, round, type), and reports an equivocation if another message
+// with a different state is signed for the same slot.
+func (c *Consensus) checkEquivocation(m *Message, signed *SignedProto) {
+	key := equivocationKey{
+		identity: c.pubKeyToIdentity(signed.PublicKey(c.curve)),
+		height:   m.Height,
+		round:    m.Round,
+		msgType:  m.Type,
+	}
+
+	if c.signedMessages == nil {
+		c.signedMessages = make(map[equivocationKey]messageTuple)
+	}
+
+	first, ok := c.signedMessages[key]
+	if !ok {
+		c.signedMessages[key] = messageTuple{StateHash: c.stateHash(m.State), Message: m, Signed: signed}
+		return
+	}
+
+	if first.StateHash == c.stateHash(m.State) {
+		return
+	}
+
+	// make sure both messages verify before reporting
+	if first.Signed.VerifyWith(c.curve, c.hasher) != nil || signed.VerifyWith(c.curve, c.hasher) != nil {
+		return
+	}
+
+	// report only once for each offender at this height & round
+	ek := evidenceKey{identity: key.identity, height: key.height, round: key.round}
+	if _, reported := c.evidenceKeys[ek]; reported {
+		return
+	}
+	if c.evidenceKeys == nil {
+		c.evidenceKeys = make(map[evidenceKey]struct{})
+	}
+	c.evidenceKeys[ek] = struct{}{}
+
+	// evict the oldest evidence if the store is full
+	if len(c.equivocations) >= c.maxEvidence {
+		copy(c.equivocations, c.equivocations[1:])
+		c.equivocations[len(c.equivocations)-1] = Equivocation{}
+		c.equivocations = c.equivocations[:len(c.equivocations)-1]
+	}
+	c.equivocations = append(c.equivocations, Equivocation{First: first.Signed, Second: signed})
+	c.warnw("equivocation detected", "type", m.Type, "height", m.Height, "round", m.Round, "signer", key.identity.Short())
+}
+
+// TakeEquivocations returns all equivocations detected since last call, and
+// clears them. Each equivocation can be used as the evidence for slashing.
+func (c *Consensus) TakeEquivocations() []Equivocation {
+	equivocations := c.equivocations
+	c.equivocations = nil
+	return equivocations
+}
+
+// EvidenceCount returns the number of retained equivocations awaiting to be
+// taken, which is bounded by Config.MaxEvidence.
+func (c *Consensus) EvidenceCount() int { return len(c.equivocations) }
@@ -34,21 +34,50 @@ import "errors"
 
 var (
 	// Config Related
-	ErrConfigEpoch              = errors.New("Config.Epoch is nil")
-	ErrConfigStateNil           = errors.New("Config.CurrentState is nil")
-	ErrConfigStateCompare       = errors.New("Config.StateCompare function has not set")
-	ErrConfigStateValidate      = errors.New("Config.StateValidate function has not set")
-	ErrConfigPrivateKey         = errors.New("Config.PrivateKey has not set")
-	ErrConfigParticipants       = errors.New("Config.Participants must contain at least 4 participants")
-	ErrConfigPubKeyToCoordinate = errors.New("Config.must contain at least 4 participants")
+	ErrConfigEpoch                  = errors.New("Config.Epoch is nil")
+	ErrConfigStateNil               = errors.New("Config.CurrentState is nil")
+	ErrConfigCurrentRound           = errors.New("Config.CurrentRound has no height to start with")
+	ErrConfigStateCompare           = errors.New("Config.StateCompare function has not set")
+	ErrConfigStateValidate          = errors.New("Config.StateValidate or Config.StateValidateErr function has not set")
+	ErrConfigPrivateKey             = errors.New("Config.PrivateKey, Config.Signer or Config.MessageSigner has not set")
+	ErrConfigParticipants           = errors.New("Config.Participants must contain at least 4 participants")
+	ErrConfigPubKeyToCoordinate     = errors.New("Config.must contain at least 4 participants")
+	ErrConfigWeights                = errors.New("Config.Weights must have positive total weight of participants")
+	ErrConfigWeightsOverflow        = errors.New("Config.Weights must sum to at most math.MaxUint64")
+	ErrConfigParticipantsDuplicated = errors.New("Config.Participants has duplicated identity")
+	ErrConfigMessageSigner          = errors.New("Config.MessageSigner is invalid")
+	ErrConfigSigner                 = errors.New("Config.Signer is invalid")
+	ErrConfigAcceptedVersions       = errors.New("Config.AcceptedVersions must contain ProtocolVersion")
+	ErrConfigQuorumSize             = errors.New("Config.QuorumSize must be more than half of participants")
+	ErrConfigLatency                = errors.New("Config.MinLatency must not exceed Config.MaxLatency")
 
 	// common errors related to every message
-	ErrMessageVersion            = errors.New("the message has different version")
+	ErrProtocolVersion           = errors.New("the message has a protocol version not accepted")
+	ErrMessageVersion            = ErrProtocolVersion // former name of ErrProtocolVersion
 	ErrMessageValidator          = errors.New("the message has been rejected by external validator")
 	ErrMessageIsEmpty            = errors.New("the message being verified is empty")
 	ErrMessageUnknownMessageType = errors.New("unrecognized message type")
 	ErrMessageSignature          = errors.New("cannot verify the signature of this message")
 	ErrMessageUnknownParticipant = errors.New("the message is from unknown partcipants")
+	ErrMessageCompactDisabled    = errors.New("the message is compact while compact messages are disabled")
+	ErrNoPrivateKey              = errors.New("the consensus is a follower without a key to sign")
+	ErrSignMessage               = errors.New("the message to send cannot be signed, see SignErrors")
+	ErrMessageTooExpensive       = errors.New("the message has exceeded the budget of processing time")
+	ErrMessageScheme             = errors.New("the message is signed in another signature scheme than configured")
+	ErrMessagePoolFull           = errors.New("the message has been dropped as pending messages exceeded the limit")
+	ErrResyncRateLimited         = errors.New("the <resync> message has been dropped as the sender exceeded the resync rate")
+	ErrStateRejected             = errors.New("the state has been rejected by Config.StateValidate")
+	ErrStateTooLarge             = errors.New("the state exceeds Config.MaxStateSize")
+	ErrStaleRound                = errors.New("the message of a decided height has a round beyond the decided round")
+
+	// signature verification related
+	ErrBadPubKey    = errors.New("the public key of the message is malformed")
+	ErrZeroRS       = errors.New("the signature of the message has zero r or s")
+	ErrRSOutOfRange = errors.New("the signature of the message has r or s not less than curve order")
+	ErrHighS        = errors.New("the signature of the message is not in canonical low-S form")
+	ErrSigMismatch  = errors.New("the signature does not match the message and public key")
+	ErrRecoveryID   = errors.New("the compact message has an invalid recovery id")
+	ErrScheme       = errors.New("the message is signed in an unknown signature scheme")
 
 	// <roundchange> related
 	ErrRoundChangeHeightMismatch  = errors.New("the <roundchange> message has another height than expected")
@@ -67,6 +96,7 @@ var (
 	ErrLockProofRoundMismatch      = errors.New("the proofs in <lock> message has mismatched round")
 	ErrLockProofStateValidation    = errors.New("the proofs in <lock> message has invalid state data")
 	ErrLockProofInsufficient       = errors.New("the <lock> message has insufficient <roundchange> proofs to the proposed state")
+	ErrLockProofStateMismatch      = errors.New("the proofs in <lock> message are not to the proposed state")
 
 	// <select> related
 	ErrSelectStateValidation         = errors.New("the state data validation failed <select> message")
@@ -94,9 +124,13 @@ var (
 	ErrDecideProofRoundMismatch      = errors.New("the proofs in <decide> message has mismatched round")
 	ErrDecideProofStateValidation    = errors.New("the proofs in <decide> message has invalid state data")
 	ErrDecideProofInsufficient       = errors.New("the <decide> message has insufficient <commit> proofs to the proposed state")
+	ErrDecideProofDuplicateSigner    = errors.New("the proofs in <decide> message has duplicated signers")
+	ErrDecideProofStateMismatch      = errors.New("the proofs in <decide> message are not to the decided state")
 
 	// <lock-release> related
-	ErrLockReleaseStatus = errors.New("received <lock-release> message in non LOCK-RELEASE state")
+	ErrLockReleaseStatus         = errors.New("received <lock-release> message in non LOCK-RELEASE state")
+	ErrLockReleaseHeightMismatch = errors.New("the <lock> in <lock-release> message has mismatched height")
+	ErrLockReleaseRoundMismatch  = errors.New("the <lock> in <lock-release> message has higher round")
 
 	// <commit> related
 	ErrCommitEmptyState      = errors.New("the state is empty in <commit> message")
@@ -108,4 +142,31 @@ var (
 
 	// <decide> verification
 	ErrMismatchedTargetState = errors.New("the state in <decide> message does not match the provided target state")
+
+	// participant change related
+	ErrParticipantChangeHeight = errors.New("the participant change must be at a height above the latest height")
+
+	// key rotation related
+	ErrRotateKeyNil    = errors.New("the private key to rotate to is nil")
+	ErrRotateKeyCurve  = errors.New("the private key to rotate to is on another curve")
+	ErrRotateKeySigner = errors.New("the private key of Config.MessageSigner or Config.Signer cannot be rotated")
+
+	// snapshot related
+	ErrSnapshotVersion   = errors.New("the snapshot has unsupported version")
+	ErrSnapshotCorrupted = errors.New("the snapshot is corrupted")
+
+	// decide proof export related
+	ErrExportHeight        = errors.New("the <decide> proof at the height is not available")
+	ErrExportHasher        = errors.New("the <decide> proof can only be exported with keccak256 hasher")
+	ErrExportNotCompact    = errors.New("the <decide> proof can only be exported from compact <commit> messages")
+	ErrExportRange         = errors.New("the range of heights to export is empty")
+	ErrExportTooManyProofs = errors.New("the <decide> proof has too many signatures to export")
+
+	// proof chain verification related
+	ErrProofChainEmpty  = errors.New("the chain of <decide> proofs is empty")
+	ErrProofChainHeight = errors.New("the chain of <decide> proofs is not of consecutive heights")
+	ErrProofMalformed   = errors.New("the encoded <decide> proof is malformed")
+
+	// test vector fixtures related
+	ErrFixtureMismatch = errors.New("the fixture is not reproduced from its private key and message")
 )
@@ -0,0 +1,129 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	proto "github.com/gogo/protobuf/proto"
+)
+
+const (
+	// DecideProofHeaderSize is the size of the fixed header of an exported
+	// <decide> proof before the <commit> message
+	DecideProofHeaderSize = 4 + 4
+	// DecideProofSignatureSize is the size of each signature in an exported <decide> proof
+	DecideProofSignatureSize = 32 + 32 + 1
+	// MaxDecideProofSignatures is the maximum number of signatures in an exported <decide> proof
+	MaxDecideProofSignatures = math.MaxUint16
+)
+
+// ExportDecideProof exports the <decide> proof at the given height in a compact
+// layout to be verified by smart contracts on EVM, all integers are big-endian:
+//
+//	offset  size  field
+//	0       4     version of the <commit> messages
+//	4       4     l, length of msg
+//	8       l     msg, the protobuf encoded <commit> message signed by every signer
+//	8+l     2     n, number of signatures
+//	10+l    65*n  signatures, each as r(32) | s(32) | v(1)
+//
+// No height or state is exported apart from msg, contracts MUST derive the
+// digest signed from msg, which is identical for all signers as compact
+// messages exclude the public key:
+//
+//	keccak256(prefix | "/compact" | uint32le(version) | uint32le(l) | msg)
+//
+// where prefix is SignaturePrefix(or Config.DomainSeparator) followed by "/keccak256",
+// and read the height, round and state from msg, which is exported only in the
+// canonical encoding, with the fields of zero height, round or empty state omitted:
+//
+//	0x08 0x04 | 0x10 uvarint(height) | 0x18 uvarint(round) | 0x22 uvarint(len(state)) | state
+//
+// v is 27 + recovery id as expected by ecrecover, contracts MUST check the recovered
+// addresses are distinct participants forming a quorum.
+//
+// Only the latest decided height is available, and the consensus must be
+// configured with Keccak256Hasher and EnableCompactMessage. Proofs of more than
+// MaxDecideProofSignatures signatures are rejected with ErrExportTooManyProofs.
+func (c *Consensus) ExportDecideProof(height uint64) ([]byte, error) {
+	if c.latestProof == nil || height != c.latestHeight {
+		return nil, ErrExportHeight
+	}
+	if c.hasher.Name != Keccak256Hasher.Name {
+		return nil, ErrExportHasher
+	}
+
+	m := new(Message)
+	if err := proto.Unmarshal(c.latestProof.Message, m); err != nil {
+		return nil, err
+	}
+	if len(m.Proof) > MaxDecideProofSignatures {
+		return nil, ErrExportTooManyProofs
+	}
+
+	// the <commit> message signed must be the canonical encoding of the decision
+	msg, err := proto.Marshal(&Message{Type: MessageType_Commit, Height: m.Height, Round: m.Round, State: m.State})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, DecideProofHeaderSize, DecideProofHeaderSize+len(msg)+2+len(m.Proof)*DecideProofSignatureSize)
+	binary.BigEndian.PutUint32(out[4:], uint32(len(msg)))
+	out = append(out, msg...)
+	out = append(out, 0, 0)
+	binary.BigEndian.PutUint16(out[len(out)-2:], uint16(len(m.Proof)))
+
+	for i, proof := range m.Proof {
+		if proof.V == 0 || len(proof.R) > SizeAxis || len(proof.S) > SizeAxis {
+			return nil, ErrExportNotCompact
+		}
+
+		// all signers must sign the same message of the same version
+		if !bytes.Equal(proof.Message, msg) {
+			return nil, ErrExportNotCompact
+		}
+		if i == 0 {
+			binary.BigEndian.PutUint32(out[0:], proof.Version)
+		} else if proof.Version != m.Proof[0].Version {
+			return nil, ErrExportNotCompact
+		}
+
+		var sig [DecideProofSignatureSize]byte
+		copy(sig[SizeAxis-len(proof.R):], proof.R)
+		copy(sig[2*SizeAxis-len(proof.S):], proof.S)
+		sig[2*SizeAxis] = byte(27 + proof.V - 1)
+		out = append(out, sig[:]...)
+	}
+	return out, nil
+}
@@ -0,0 +1,119 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/Sperax/bdls/crypto/btcec"
+	"github.com/Sperax/bdls/crypto/sha3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportDecideProof(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var quorum []*ecdsa.PublicKey
+	var proofs []*SignedProto
+	for i := 0; i < 3; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		quorum = append(quorum, &privateKey.PublicKey)
+
+		commit := &Message{Type: MessageType_Commit, Height: 10, Round: 2, State: []byte("state")}
+		sp := new(SignedProto)
+		assert.Nil(t, sp.SignCompact(commit, privateKey, Keccak256Hasher))
+		proofs = append(proofs, sp)
+	}
+
+	consensus := createConsensus(t, 9, 0, quorum)
+	decide := &Message{Type: MessageType_Decide, Height: 10, Round: 2, State: []byte("state"), Proof: proofs}
+	consensus.latestProof = new(SignedProto)
+	consensus.latestProof.Sign(decide, consensus.privateKey)
+	consensus.latestHeight = 10
+
+	// hasher mismatch
+	_, err := consensus.ExportDecideProof(10)
+	assert.Equal(t, ErrExportHasher, err)
+
+	consensus.hasher = Keccak256Hasher
+	_, err = consensus.ExportDecideProof(9)
+	assert.Equal(t, ErrExportHeight, err)
+
+	out, err := consensus.ExportDecideProof(10)
+	assert.Nil(t, err)
+
+	// decode as a contract does
+	version := binary.BigEndian.Uint32(out[0:])
+	l := int(binary.BigEndian.Uint32(out[4:]))
+	msg := out[DecideProofHeaderSize:][:l]
+	n := int(binary.BigEndian.Uint16(out[DecideProofHeaderSize+l:]))
+	assert.Equal(t, len(proofs), n)
+	assert.Equal(t, DecideProofHeaderSize+l+2+n*DecideProofSignatureSize, len(out))
+
+	// the height, round and state are read from the canonical <commit> message
+	assert.Equal(t, []byte{0x08, byte(MessageType_Commit)}, msg[:2])
+	assert.Equal(t, byte(0x10), msg[2])
+	height, k := binary.Uvarint(msg[3:])
+	assert.Equal(t, uint64(10), height)
+	rest := msg[3+k:]
+	assert.Equal(t, byte(0x18), rest[0])
+	round, k := binary.Uvarint(rest[1:])
+	assert.Equal(t, uint64(2), round)
+	rest = rest[1+k:]
+	assert.Equal(t, byte(0x22), rest[0])
+	size, k := binary.Uvarint(rest[1:])
+	assert.Equal(t, []byte("state"), rest[1+k:][:size])
+	assert.Equal(t, 1+k+int(size), len(rest))
+
+	// the digest is derived from the message
+	digest := sha3.NewLegacyKeccak256()
+	digest.Write([]byte(SignaturePrefix + "/keccak256/compact"))
+	var scratch [4]byte
+	binary.LittleEndian.PutUint32(scratch[:], version)
+	digest.Write(scratch[:])
+	binary.LittleEndian.PutUint32(scratch[:], uint32(l))
+	digest.Write(scratch[:])
+	digest.Write(msg)
+	assert.Equal(t, proofs[0].HashWith(Keccak256Hasher), digest.Sum(nil))
+
+	for i := 0; i < n; i++ {
+		sig := out[DecideProofHeaderSize+l+2+i*DecideProofSignatureSize:][:DecideProofSignatureSize]
+		v := sig[64]
+		assert.True(t, v == 27 || v == 28)
+
+		// ecrecover(digest, v, r, s)
+		compact := append([]byte{v}, sig[:64]...)
+		pubkey, _, err := btcec.RecoverCompact(btcec.S256(), compact, proofs[0].HashWith(Keccak256Hasher))
+		assert.Nil(t, err)
+		assert.Equal(t, keys[i].X, pubkey.X)
+		assert.Equal(t, keys[i].Y, pubkey.Y)
+	}
+
+	// <commit> messages not of the decision
+	valid := decide.Proof
+	other := new(SignedProto)
+	assert.Nil(t, other.SignCompact(&Message{Type: MessageType_Commit, Height: 9, Round: 2, State: []byte("state")}, keys[0], Keccak256Hasher))
+	decide.Proof = append(append([]*SignedProto{}, valid...), other)
+	consensus.latestProof.Sign(decide, consensus.privateKey)
+	_, err = consensus.ExportDecideProof(10)
+	assert.Equal(t, ErrExportNotCompact, err)
+
+	// too many signatures
+	decide.Proof = nil
+	for len(decide.Proof) <= MaxDecideProofSignatures {
+		decide.Proof = append(decide.Proof, valid[0])
+	}
+	consensus.latestProof.Sign(decide, consensus.privateKey)
+	_, err = consensus.ExportDecideProof(10)
+	assert.Equal(t, ErrExportTooManyProofs, err)
+	decide.Proof = valid
+
+	// non-compact <commit>
+	_, sp, _ := createCommitMessage(t, 10, 2, []byte("state"))
+	decide.Proof = append(decide.Proof, sp)
+	consensus.latestProof.Sign(decide, consensus.privateKey)
+	_, err = consensus.ExportDecideProof(10)
+	assert.Equal(t, ErrExportNotCompact, err)
+}
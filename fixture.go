@@ -0,0 +1,127 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io"
+	"math/big"
+)
+
+// Fixture is a test vector of a message signed deterministically, for the
+// conformance of other implementations. Wire is the protobuf encoding of
+// Signed, which MUST be reproduced byte by byte from PrivateKey & Signed.Message.
+type Fixture struct {
+	Name       string       `json:"name"`
+	PrivateKey hexBytes     `json:"privateKey"`
+	Signed     *SignedProto `json:"signed"`
+	Wire       hexBytes     `json:"wire"`
+}
+
+// NewFixture signs the message with SignDeterministic in ProtocolVersion,
+// and creates a fixture of it.
+func NewFixture(name string, m *Message, privateKey *ecdsa.PrivateKey) Fixture {
+	sp := new(SignedProto)
+	sp.Version = ProtocolVersion
+	sp.SignDeterministic(m, privateKey)
+	return Fixture{Name: name, PrivateKey: privateKey.D.Bytes(), Signed: sp, Wire: sp.Bytes()}
+}
+
+// GenerateFixtures creates fixtures of every message type at a fixed height
+// & round signed by the private key, including the proofs enclosed.
+func GenerateFixtures(privateKey *ecdsa.PrivateKey) []Fixture {
+	const height, round = 10, 2
+	state := State("state")
+	sign := func(m *Message) *SignedProto { return NewFixture("", m, privateKey).Signed }
+
+	roundChange := &Message{Type: MessageType_RoundChange, Height: height, Round: round, State: state}
+	lock := &Message{Type: MessageType_Lock, Height: height, Round: round, State: state, Proof: []*SignedProto{sign(roundChange)}}
+	commit := &Message{Type: MessageType_Commit, Height: height, Round: round, State: state}
+
+	return []Fixture{
+		NewFixture("nop", &Message{Type: MessageType_Nop, Height: height, Round: round}, privateKey),
+		NewFixture("roundchange", roundChange, privateKey),
+		NewFixture("roundchange-nil", &Message{Type: MessageType_RoundChange, Height: height, Round: round}, privateKey),
+		NewFixture("select", &Message{Type: MessageType_Select, Height: height, Round: round, State: state, Proof: []*SignedProto{sign(roundChange)}}, privateKey),
+		NewFixture("lock", lock, privateKey),
+		NewFixture("lockrelease", &Message{Type: MessageType_LockRelease, Height: height, Round: round + 1, LockRelease: sign(lock)}, privateKey),
+		NewFixture("commit", commit, privateKey),
+		NewFixture("decide", &Message{Type: MessageType_Decide, Height: height, Round: round, State: state, Proof: []*SignedProto{sign(commit)}}, privateKey),
+		NewFixture("resync", &Message{Type: MessageType_Resync, Height: height, Round: round, Proof: []*SignedProto{sign(roundChange)}}, privateKey),
+	}
+}
+
+// WriteFixtures encodes the fixtures as indented JSON
+func WriteFixtures(w io.Writer, fixtures []Fixture) error {
+	bts, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(bts, '\n'))
+	return err
+}
+
+// LoadFixtures decodes the fixtures written by WriteFixtures, and verifies
+// each of them: the signature is valid, Wire decodes to the same message,
+// and Signed is reproduced by signing the message with the private key.
+func LoadFixtures(r io.Reader) ([]Fixture, error) {
+	var fixtures []Fixture
+	if err := json.NewDecoder(r).Decode(&fixtures); err != nil {
+		return nil, err
+	}
+
+	for _, f := range fixtures {
+		if f.Signed == nil {
+			return nil, ErrFixtureMismatch
+		}
+		if !f.Signed.Verify(S256Curve) {
+			return nil, ErrMessageSignature
+		}
+		if !bytes.Equal(f.Signed.Bytes(), f.Wire) {
+			return nil, ErrFixtureMismatch
+		}
+
+		m, err := DecodeMessage(f.Signed.Message)
+		if err != nil {
+			return nil, err
+		}
+		privateKey := new(ecdsa.PrivateKey)
+		privateKey.Curve = S256Curve
+		privateKey.D = new(big.Int).SetBytes(f.PrivateKey)
+		privateKey.X, privateKey.Y = S256Curve.ScalarBaseMult(f.PrivateKey)
+		if !bytes.Equal(NewFixture(f.Name, m, privateKey).Wire, f.Wire) {
+			return nil, ErrFixtureMismatch
+		}
+	}
+	return fixtures, nil
+}
@@ -0,0 +1,54 @@
+package bdls
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixtures(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, WriteFixtures(&buf, GenerateFixtures(deterministicKey(1))))
+
+	path := filepath.Join("testdata", "fixtures.json")
+	if *updateGolden {
+		assert.Nil(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+	}
+
+	// the committed fixtures are verified, and reproduced byte by byte
+	expected, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	fixtures, err := LoadFixtures(bytes.NewReader(expected))
+	assert.Nil(t, err)
+	assert.Equal(t, 9, len(fixtures))
+	assert.Equal(t, string(expected), buf.String())
+
+	// tampered wire
+	fixtures[1].Wire[len(fixtures[1].Wire)-1] ^= 1
+	var tampered bytes.Buffer
+	assert.Nil(t, WriteFixtures(&tampered, fixtures))
+	_, err = LoadFixtures(&tampered)
+	assert.Equal(t, ErrFixtureMismatch, err)
+
+	// tampered signature
+	fixtures, err = LoadFixtures(bytes.NewReader(expected))
+	assert.Nil(t, err)
+	fixtures[1].Signed.S[0] ^= 1
+	tampered.Reset()
+	assert.Nil(t, WriteFixtures(&tampered, fixtures))
+	_, err = LoadFixtures(&tampered)
+	assert.Equal(t, ErrMessageSignature, err)
+
+	// another private key
+	fixtures, err = LoadFixtures(bytes.NewReader(expected))
+	assert.Nil(t, err)
+	fixtures[1].PrivateKey = deterministicKey(2).D.Bytes()
+	bts, err := json.Marshal(fixtures)
+	assert.Nil(t, err)
+	_, err = LoadFixtures(bytes.NewReader(bts))
+	assert.Equal(t, ErrFixtureMismatch, err)
+}
@@ -0,0 +1,56 @@
+package bdls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollower(t *testing.T) {
+	net := newMemNetwork(t, 4)
+
+	// a keyless follower of the validators
+	config := net.configs[0].Clone()
+	config.PrivateKey = nil
+	assert.Equal(t, ErrConfigPrivateKey, config.Validate())
+	config.Follower = true
+	// the follower signs nothing, only the <decide> messages of the leaders
+	// it propagates pass the callback, which reach nobody as it has no peers
+	var signed, propagated int
+	config.MessageOutCallback = func(m *Message, sp *SignedProto) {
+		if m.Type != MessageType_Decide {
+			signed++
+		} else {
+			propagated++
+		}
+	}
+	follower, err := NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrNoPrivateKey, follower.Propose([]byte("state")))
+	assert.Equal(t, ErrNoPrivateKey, follower.RotateKey(mustGenerateKey(t)))
+
+	index := len(net.nodes)
+	net.configs = append(net.configs, config)
+	net.nodes = append(net.nodes, follower)
+	for i := 0; i < index; i++ {
+		net.nodes[i].Join(&memPeer{to: index, queue: &net.queue})
+	}
+
+	for _, node := range net.nodes[:index] {
+		assert.Nil(t, node.Propose([]byte("state")))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	assert.Equal(t, 0, signed)
+	assert.Equal(t, 1, propagated)
+
+	height, _, state := follower.CurrentState()
+	assert.Equal(t, uint64(1), height)
+	assert.Equal(t, State("state"), state)
+	_, decided, err := VerifyDecideProof(net.configs[0].Participants, follower.CurrentProof())
+	assert.Nil(t, err)
+	assert.Equal(t, State("state"), decided)
+}
@@ -0,0 +1,140 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+const (
+	// DefaultFutureHeights is the default number of heights above the height
+	// being decided, whose messages will be buffered until the height is reached.
+	DefaultFutureHeights = 2
+	// DefaultFutureBufferSize is the default limit of total bytes of buffered
+	// messages of future heights.
+	DefaultFutureBufferSize = 1 << 20
+	// maxFuturePerSender limits the number of buffered messages of future
+	// heights from each sender.
+	maxFuturePerSender = 64
+)
+
+// futureMessage is a verified message of a future height, to be processed
+// once the height is reached
+type futureMessage struct {
+	height uint64
+	sender Identity
+	bts    []byte
+}
+
+// futureQuota is the usage of future buffer by a sender
+type futureQuota struct {
+	bytes int
+	count int
+}
+
+// isFuture checks if a message belongs to a height within the window above
+// the height being decided, which can only be processed after the height is
+// reached, messages beyond the window will be rejected by height checks.
+func (c *Consensus) isFuture(m *Message) bool {
+	if c.futureHeights <= 0 || m.Height <= c.latestHeight+1 || m.Height-(c.latestHeight+1) > uint64(c.futureHeights) {
+		return false
+	}
+
+	switch m.Type {
+	case MessageType_RoundChange, MessageType_Lock, MessageType_Select, MessageType_Commit, MessageType_LockRelease:
+		return true
+	}
+	// <decide> of future heights are processed immediately to catch up
+	return false
+}
+
+// bufferFuture buffers the encoded message of a future height, ErrMessagePoolFull
+// will be returned if the buffer has exceeded the limit, or the sender has
+// exceeded it's quota, which is an equal share of the limit among participants
+// and at most maxFuturePerSender messages.
+func (c *Consensus) bufferFuture(m *Message, signed *SignedProto, bts []byte) error {
+	if c.futureBytes+len(bts) > c.futureBufferSize {
+		return ErrMessagePoolFull
+	}
+
+	sender := c.pubKeyToIdentity(signed.PublicKey(c.curve))
+	quota := c.futureQuotas[sender]
+	share := c.futureBufferSize
+	if len(c.participants) > 0 {
+		share /= len(c.participants)
+	}
+	if quota.bytes+len(bts) > share || quota.count >= maxFuturePerSender {
+		return ErrMessagePoolFull
+	}
+
+	if c.futureQuotas == nil {
+		c.futureQuotas = make(map[Identity]futureQuota)
+	}
+	c.futureQuotas[sender] = futureQuota{bytes: quota.bytes + len(bts), count: quota.count + 1}
+
+	// the buffer of incoming message may be reused by callers
+	c.future = append(c.future, futureMessage{height: m.Height, sender: sender, bts: append([]byte(nil), bts...)})
+	c.futureBytes += len(bts)
+	return nil
+}
+
+// releaseFuture releases the usage of a buffered message from the quota of it's sender
+func (c *Consensus) releaseFuture(fm futureMessage) {
+	c.futureBytes -= len(fm.bts)
+	quota := c.futureQuotas[fm.sender]
+	quota.bytes -= len(fm.bts)
+	quota.count--
+	if quota.count <= 0 {
+		delete(c.futureQuotas, fm.sender)
+	} else {
+		c.futureQuotas[fm.sender] = quota
+	}
+}
+
+// replayFuture moves the buffered messages of the height being decided to
+// loopback, and drops the messages of decided heights.
+func (c *Consensus) replayFuture() {
+	o := 0
+	for _, fm := range c.future {
+		switch {
+		case fm.height == c.latestHeight+1:
+			c.loopback = append(c.loopback, fm.bts)
+			c.releaseFuture(fm)
+		case fm.height <= c.latestHeight:
+			c.releaseFuture(fm)
+		default:
+			c.future[o] = fm
+			o++
+		}
+	}
+
+	// clear references for garbage collection
+	for i := o; i < len(c.future); i++ {
+		c.future[i] = futureMessage{}
+	}
+	c.future = c.future[:o]
+}
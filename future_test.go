@@ -0,0 +1,144 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFutureMessages(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+
+	// node 0 is partitioned while others decide height 1, and enter height 2
+	var held [][]byte
+	decided := func() bool {
+		for _, node := range net.nodes[1:] {
+			if h, _, _ := node.CurrentState(); h < 1 {
+				return false
+			}
+		}
+		return true
+	}
+	for i := 0; i < 10000 && !decided(); i++ {
+		queue := net.queue
+		net.queue = nil
+		for _, m := range queue {
+			if m.to == 0 {
+				held = append(held, m.bts)
+				continue
+			}
+			_ = net.nodes[m.to].ReceiveMessage(m.bts, net.now)
+		}
+		net.now = net.now.Add(20 * time.Millisecond)
+		for _, node := range net.nodes[1:] {
+			_ = node.Update(net.now)
+		}
+	}
+	assert.True(t, decided())
+	for _, node := range net.nodes[1:] {
+		node.Propose([]byte("state2"))
+		_ = node.Update(net.now.Add(time.Minute))
+	}
+
+	// <roundchange> messages of height 2 arrive early
+	node := net.nodes[0]
+	var future int
+	for _, m := range net.queue {
+		if m.to == 0 {
+			held = append(held, m.bts)
+		}
+	}
+	for _, bts := range held {
+		msg, err := DecodeSignedMessage(bts)
+		assert.Nil(t, err)
+		decoded, err := DecodeMessage(msg.Message)
+		assert.Nil(t, err)
+		if decoded.Type == MessageType_RoundChange && decoded.Height == 2 {
+			assert.Nil(t, node.ReceiveMessage(bts, net.now))
+			future++
+		}
+	}
+	assert.Equal(t, 3, future)
+	assert.Equal(t, future, len(node.future))
+	assert.Equal(t, uint64(0), node.latestHeight)
+
+	// messages beyond the window are dropped
+	_, rc, _ := createRoundChangeMessageSigner(t, 2+DefaultFutureHeights, 0, nil, net.configs[1].PrivateKey)
+	bts, err := rc.Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrRoundChangeHeightMismatch, node.ReceiveMessage(bts, net.now))
+	assert.Equal(t, future, len(node.future))
+
+	// buffered messages are applied after the node advances to height 2
+	assert.Nil(t, node.Sync(net.nodes[1].CurrentProof()))
+	assert.Nil(t, node.Update(net.now))
+	assert.Equal(t, uint64(1), node.latestHeight)
+	assert.Equal(t, 0, len(node.future))
+	assert.Equal(t, 0, node.futureBytes)
+	assert.Equal(t, future, node.currentRound.NumRoundChanges())
+}
+
+func TestFutureBufferSize(t *testing.T) {
+	net := newMemNetworkConfig(t, 4, func(config *Config) { config.FutureBufferSize = 1024 })
+	node := net.nodes[0]
+
+	var err error
+	var buffered int
+	for round := uint64(0); err == nil; round++ {
+		_, rc, _ := createRoundChangeMessageSigner(t, 2, round, make([]byte, 100), net.configs[1].PrivateKey)
+		bts, _ := rc.Marshal()
+		if err = node.ReceiveMessage(bts, net.now); err == nil {
+			buffered += len(bts)
+		}
+	}
+	assert.Equal(t, ErrMessagePoolFull, err)
+	assert.Equal(t, buffered, node.futureBytes)
+	// a sender takes at most an equal share of the buffer
+	assert.True(t, node.futureBytes <= 1024/4)
+
+	// others have their own shares
+	_, rc, _ := createRoundChangeMessageSigner(t, 2, 0, make([]byte, 100), net.configs[2].PrivateKey)
+	bts, _ := rc.Marshal()
+	assert.Nil(t, node.ReceiveMessage(bts, net.now))
+	assert.Equal(t, 2, len(node.futureQuotas))
+
+	// a sender buffers at most maxFuturePerSender messages
+	net = newMemNetwork(t, 4)
+	node = net.nodes[0]
+	err = nil
+	var count int
+	for round := uint64(0); err == nil; round++ {
+		_, rc, _ := createRoundChangeMessageSigner(t, 2, round, nil, net.configs[1].PrivateKey)
+		bts, _ := rc.Marshal()
+		if err = node.ReceiveMessage(bts, net.now); err == nil {
+			count++
+		}
+	}
+	assert.Equal(t, ErrMessagePoolFull, err)
+	assert.Equal(t, maxFuturePerSender, count)
+
+	// quotas are released on replay
+	var keys []*ecdsa.PrivateKey
+	var leader *ecdsa.PrivateKey
+	for _, config := range net.configs {
+		keys = append(keys, config.PrivateKey)
+		if DefaultPubKeyToIdentity(&config.PrivateKey.PublicKey) == node.roundLeader(1, 0) {
+			leader = config.PrivateKey
+		}
+	}
+	assert.Nil(t, node.Sync(createDecideProof(t, 1, 0, []byte("state"), leader, keys)))
+	assert.Nil(t, node.Update(net.now))
+	assert.Equal(t, 0, len(node.future))
+	assert.Equal(t, 0, len(node.futureQuotas))
+
+	// disabled
+	net = newMemNetworkConfig(t, 4, func(config *Config) { config.FutureHeights = -1 })
+	_, rc, _ = createRoundChangeMessageSigner(t, 2, 0, nil, net.configs[1].PrivateKey)
+	bts, _ = rc.Marshal()
+	assert.Equal(t, ErrRoundChangeHeightMismatch, net.nodes[0].ReceiveMessage(bts, net.now))
+}
@@ -0,0 +1,86 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls/crypto/sha3"
+	"github.com/stretchr/testify/assert"
+)
+
+// addressOf converts the coordinate X || Y of a public key to its Ethereum
+// address, which is the last 20 bytes of keccak256(X || Y)
+func addressOf(coord Identity) (ret Identity) {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(coord[:])
+	copy(ret[:], hash.Sum(nil)[12:])
+	return
+}
+
+// addressIdentity identifies a public key by its Ethereum address
+func addressIdentity(pubkey *ecdsa.PublicKey) Identity {
+	return addressOf(DefaultPubKeyToIdentity(pubkey))
+}
+
+func TestPubKeyToIdentityAddress(t *testing.T) {
+	var addresses []Identity
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		config.PubKeyToIdentity = addressIdentity
+		if addresses == nil {
+			// the coordinates of the default participants are converted
+			for _, coord := range config.Participants {
+				addresses = append(addresses, addressOf(coord))
+			}
+		}
+		config.Participants = addresses
+	})
+
+	for i, node := range net.nodes {
+		key := &net.configs[i].PrivateKey.PublicKey
+		assert.Equal(t, addresses[i], node.identity)
+		index, ok := node.IsParticipantKey(key)
+		assert.True(t, ok)
+		assert.Equal(t, i, index)
+		_, ok = node.HasParticipant(DefaultPubKeyToIdentity(key))
+		assert.False(t, ok)
+	}
+
+	for h := uint64(1); h <= 3; h++ {
+		for _, node := range net.nodes {
+			node.Propose([]byte{byte(h)})
+		}
+		for i := 0; i < 10000 && !net.decided(h); i++ {
+			net.step(20 * time.Millisecond)
+		}
+		assert.True(t, net.decided(h))
+	}
+
+	node := net.nodes[0]
+	signers, ok := node.DecideSigners(3)
+	assert.True(t, ok)
+	assert.True(t, len(signers) >= 3)
+	for _, signer := range signers {
+		_, ok := node.HasParticipant(signer)
+		assert.True(t, ok)
+	}
+
+	// standalone proofs are verified with the same identities
+	proof := node.CurrentProof()
+	verifier := ProofVerifier{PubKeyToIdentity: addressIdentity}
+	height, state, err := verifier.VerifyDecideProof(addresses, proof)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), height)
+	assert.Equal(t, State{3}, state)
+	height, _, err = verifier.VerifyDecideProofBytes(addresses, proof.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), height)
+	proofs, err := node.ExportProofs(1, 3)
+	assert.Nil(t, err)
+	height, _, err = verifier.VerifyProofChain(addresses, proofs)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), height)
+
+	_, _, err = VerifyDecideProof(addresses, proof)
+	assert.Equal(t, ErrMessageUnknownParticipant, err)
+}
@@ -78,7 +78,7 @@ func NewIPCPeer(c *Consensus, latency time.Duration) *IPCPeer {
 }
 
 // GetPublicKey returns peer's public key as identity
-func (p *IPCPeer) GetPublicKey() *ecdsa.PublicKey { return &p.c.privateKey.PublicKey }
+func (p *IPCPeer) GetPublicKey() *ecdsa.PublicKey { return p.c.publicKey }
 
 // RemoteAddr implements Peer.RemoteAddr, the address is p's memory address
 func (p *IPCPeer) RemoteAddr() net.Addr { return fakeAddress(fmt.Sprint(unsafe.Pointer(p))) }
@@ -97,11 +97,12 @@ func (p *IPCPeer) GetBytesCount() int64 {
 	return p.bytesCount
 }
 
-// Propose a state, awaiting to be finalized at next height.
-func (p *IPCPeer) Propose(s State) {
+// Propose a state, awaiting to be finalized at next height, errors of
+// Consensus.Propose are returned.
+func (p *IPCPeer) Propose(s State) error {
 	p.Lock()
 	defer p.Unlock()
-	p.c.Propose(s)
+	return p.c.Propose(s)
 }
 
 // GetLatestState returns latest state
@@ -136,7 +137,7 @@ func (p *IPCPeer) Send(msg []byte) error {
 		p.msgCount++
 		p.bytesCount += int64(len(msg))
 
-		err := p.c.ReceiveMessage(msg, time.Now())
+		err := p.c.ReceiveMessage(msg, p.c.clock.Now())
 		if err != nil {
 			//		log.Println(err)
 		}
@@ -160,7 +161,7 @@ func (p *IPCPeer) Update() {
 	case <-p.die:
 	default:
 		// call consensus update
-		_ = p.c.Update(time.Now())
+		_ = p.c.Update(p.c.clock.Now())
 		timer.SystemTimedSched.Put(p.Update, time.Now().Add(20*time.Millisecond))
 	}
 }
@@ -0,0 +1,102 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultMinConsensusLatency is the default floor of the latency adapted by
+// Config.AdaptiveLatency
+const DefaultMinConsensusLatency = 20 * time.Millisecond
+
+// latencyGain is the weight of a new sample in the moving average of the
+// adaptive latency, as 1/latencyGain
+const latencyGain = 8
+
+// startLatencySampling starts sampling the round trips of <commit> messages
+// answering the <lock> broadcasted by this participant as the leader.
+func (c *Consensus) startLatencySampling(now time.Time) {
+	if !c.adaptiveLatency {
+		return
+	}
+	c.latencyHeight, c.latencyRound = c.latestHeight+1, c.currentRound.RoundNumber
+	c.latencySampled = make(map[Identity]struct{})
+	c.latencySamples = c.latencySamples[:0]
+	c.lockSent = now
+}
+
+// sampleLatency samples an accepted <commit> message, as half of the round trip
+// since the <lock> of the round was broadcasted, one sample per participant.
+func (c *Consensus) sampleLatency(m *Message, signed *SignedProto, now time.Time) {
+	if !c.adaptiveLatency || c.lockSent.IsZero() || m.Height != c.latencyHeight || m.Round != c.latencyRound {
+		return
+	}
+
+	sender := c.pubKeyToIdentity(signed.PublicKey(c.curve))
+	if sender == c.identity {
+		return
+	}
+	if _, sampled := c.latencySampled[sender]; sampled {
+		return
+	}
+	c.latencySampled[sender] = struct{}{}
+
+	if sample := now.Sub(c.lockSent) / 2; sample >= 0 {
+		c.latencySamples = append(c.latencySamples, sample)
+	}
+}
+
+// adaptLatency adapts the latency to the median of samples of the round, by an
+// exponentially weighted moving average bounded by the configured min & max
+// latency, the median is robust to a minority of slow or early participants.
+func (c *Consensus) adaptLatency() {
+	if !c.adaptiveLatency || len(c.latencySamples) == 0 {
+		return
+	}
+	sort.Slice(c.latencySamples, func(i, j int) bool { return c.latencySamples[i] < c.latencySamples[j] })
+	sample := c.latencySamples[len(c.latencySamples)/2]
+	c.latencySamples = c.latencySamples[:0]
+	c.lockSent = time.Time{}
+
+	latency := c.latency + (sample-c.latency)/latencyGain
+	if latency < c.minLatency {
+		latency = c.minLatency
+	} else if latency > c.maxLatency {
+		latency = c.maxLatency
+	}
+	c.latency = latency
+}
+
+// Latency returns the latency the timeouts of consensus core are based on,
+// set by SetLatency or adapted by Config.AdaptiveLatency.
+func (c *Consensus) Latency() time.Duration { return c.latency }
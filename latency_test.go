@@ -0,0 +1,104 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveLatency(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var pubkeys []*ecdsa.PublicKey
+	for i := 0; i < 20; i++ {
+		key := mustGenerateKey(t)
+		keys = append(keys, key)
+		pubkeys = append(pubkeys, &key.PublicKey)
+	}
+
+	// sample the <commit> of each key arriving after the round trip
+	sample := func(consensus *Consensus, epoch time.Time, key *ecdsa.PrivateKey, rtt time.Duration) {
+		m, commit, _ := createCommitMessageSigner(t, 1, 0, []byte("state"), key)
+		consensus.sampleLatency(m, commit, epoch.Add(rtt))
+	}
+
+	// fixed by default
+	consensus := createConsensus(t, 0, 0, pubkeys)
+	epoch := time.Now()
+	consensus.startLatencySampling(epoch)
+	for _, key := range keys[:5] {
+		sample(consensus, epoch, key, 4*time.Second)
+	}
+	consensus.adaptLatency()
+	assert.Equal(t, DefaultConsensusLatency, consensus.Latency())
+
+	consensus = createConsensus(t, 0, 0, pubkeys)
+	consensus.adaptiveLatency = true
+	consensus.maxLatency = 1500 * time.Millisecond
+	interval := consensus.roundchangeDuration(0)
+
+	// nothing sampled before the leader broadcasts <lock>
+	sample(consensus, epoch, keys[0], 4*time.Second)
+	consensus.adaptLatency()
+	assert.Equal(t, DefaultConsensusLatency, consensus.Latency())
+
+	// round trips of 2s raise the latency towards 1s, the median is robust
+	// to a minority of outliers
+	consensus.startLatencySampling(epoch)
+	for _, key := range keys[:5] {
+		sample(consensus, epoch, key, 2*time.Second)
+		// sampled once per participant
+		sample(consensus, epoch, key, time.Hour)
+	}
+	for _, key := range keys[5:7] {
+		sample(consensus, epoch, key, time.Hour)
+	}
+	// samples of other rounds are ignored
+	m, commit, _ := createCommitMessageSigner(t, 1, 1, []byte("state"), keys[8])
+	consensus.sampleLatency(m, commit, epoch.Add(time.Hour))
+	assert.Equal(t, 7, len(consensus.latencySamples))
+
+	consensus.adaptLatency()
+	expected := DefaultConsensusLatency + (time.Second-DefaultConsensusLatency)/latencyGain
+	assert.Equal(t, expected, consensus.Latency())
+	assert.True(t, consensus.roundchangeDuration(0) > interval)
+
+	// adapted once per round
+	consensus.adaptLatency()
+	assert.Equal(t, expected, consensus.Latency())
+
+	// capped at max latency
+	for i := 0; i < 100; i++ {
+		consensus.startLatencySampling(epoch)
+		for _, key := range keys {
+			sample(consensus, epoch, key, time.Hour)
+		}
+		consensus.adaptLatency()
+	}
+	assert.Equal(t, 1500*time.Millisecond, consensus.Latency())
+}
+
+func TestAdaptiveLatencyNetwork(t *testing.T) {
+	t.Log("test leaders adapt the latency to the round trips of <commit> messages")
+	net := newMemNetworkConfig(t, 4, func(config *Config) { config.AdaptiveLatency = true })
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	// <commit> messages arrive a step after the <lock>, only the leader of the
+	// decided round has sampled them
+	expected := DefaultConsensusLatency + (10*time.Millisecond-DefaultConsensusLatency)/latencyGain
+	var adapted int
+	for _, node := range net.nodes {
+		if node.Latency() != DefaultConsensusLatency {
+			assert.Equal(t, expected, node.Latency())
+			adapted++
+		}
+	}
+	assert.Equal(t, 1, adapted)
+}
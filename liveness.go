@@ -0,0 +1,62 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import "time"
+
+// checkStall calls onStall once the height being decided has lasted beyond
+// livenessTimeout since it's first observed by Update, and again every
+// livenessTimeout until the height is decided.
+func (c *Consensus) checkStall(now time.Time) {
+	if c.livenessTimeout <= 0 || c.onStall == nil {
+		return
+	}
+
+	// a new height resets the alarm
+	height := c.latestHeight + 1
+	if height != c.stallHeight || c.stallSince.IsZero() {
+		c.stallHeight = height
+		c.stallSince = now
+		c.stallNotified = time.Time{}
+		return
+	}
+
+	stalledFor := now.Sub(c.stallSince)
+	if stalledFor <= c.livenessTimeout {
+		return
+	}
+	if !c.stallNotified.IsZero() && now.Sub(c.stallNotified) < c.livenessTimeout {
+		return
+	}
+	c.stallNotified = now
+	c.warnw("consensus stalled", "height", height, "round", c.currentRound.RoundNumber, "for", stalledFor)
+	c.onStall(height, c.currentRound.RoundNumber, stalledFor)
+}
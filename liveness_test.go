@@ -0,0 +1,71 @@
+package bdls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLivenessTimeout(t *testing.T) {
+	type stall struct {
+		height, round uint64
+		stalledFor    time.Duration
+	}
+	var stalls []stall
+	withheld := true
+	var participants []Identity
+	var index int
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		config.LivenessTimeout = time.Second
+		if index == 0 {
+			config.OnStall = func(height, round uint64, stalledFor time.Duration) {
+				stalls = append(stalls, stall{height, round, stalledFor})
+			}
+		}
+		index++
+		participants = config.Participants
+		// 2 of 4 participants are isolated to withhold the quorum
+		config.MessageFilter = func(sp *SignedProto) bool {
+			id := DefaultPubKeyToIdentity(sp.PublicKey(S256Curve))
+			return !withheld || (id != participants[2] && id != participants[3])
+		}
+	})
+
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 150; i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.False(t, net.decided(1))
+
+	// reported once beyond the timeout, and again periodically
+	assert.Equal(t, 2, len(stalls))
+	for k := range stalls {
+		assert.Equal(t, uint64(1), stalls[k].height)
+		assert.True(t, stalls[k].stalledFor > time.Duration(k+1)*time.Second)
+	}
+	assert.True(t, stalls[1].stalledFor-stalls[0].stalledFor >= time.Second)
+
+	// the alarm resets once decided
+	withheld = false
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	reported := len(stalls)
+	for i := 0; i < 40; i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.Equal(t, reported, len(stalls))
+
+	// the next height without proposals stalls too
+	for i := 0; i < 40; i++ {
+		net.step(20 * time.Millisecond)
+	}
+	if assert.Equal(t, reported+1, len(stalls)) {
+		assert.Equal(t, uint64(2), stalls[reported].height)
+		assert.True(t, stalls[reported].stalledFor > time.Second)
+	}
+}
@@ -0,0 +1,124 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logger is the logging interface of consensus, it can be adapted to
+// structured loggers like slog or zap without the package importing them.
+type Logger interface {
+	// Debugf logs verbose messages, such as messages being dropped
+	Debugf(format string, args ...interface{})
+	// Infof logs protocol progress, such as entering rounds and decisions
+	Infof(format string, args ...interface{})
+	// Warnf logs suspicious behaviours, such as equivocations
+	Warnf(format string, args ...interface{})
+}
+
+// noopLogger is the default Logger which discards all messages
+type noopLogger struct{}
+
+func (noopLogger) Debugf(format string, args ...interface{}) {}
+func (noopLogger) Infof(format string, args ...interface{})  {}
+func (noopLogger) Warnf(format string, args ...interface{})  {}
+
+// FieldLogger is an optional interface of Logger to log messages with
+// key/value pairs, a Logger implementing it receives the fields of messages
+// logged by the consensus core unformatted, otherwise the fields are
+// formatted as "msg key=value ..." to the printf methods.
+type FieldLogger interface {
+	Logger
+	// Debugw logs verbose messages with key/value pairs
+	Debugw(msg string, keysAndValues ...interface{})
+	// Infow logs protocol progress with key/value pairs
+	Infow(msg string, keysAndValues ...interface{})
+	// Warnw logs suspicious behaviours with key/value pairs
+	Warnw(msg string, keysAndValues ...interface{})
+}
+
+// fieldsFormat returns the printf format of a message with key/value pairs,
+// and the values to be formatted, a dangling key is formatted as a value.
+func fieldsFormat(msg string, keysAndValues []interface{}) (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString(strings.ReplaceAll(msg, "%", "%%"))
+	values := make([]interface{}, 0, (len(keysAndValues)+1)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 == len(keysAndValues) {
+			sb.WriteString(" %v")
+			values = append(values, keysAndValues[i])
+			break
+		}
+		sb.WriteString(" ")
+		sb.WriteString(strings.ReplaceAll(fmt.Sprint(keysAndValues[i]), "%", "%%"))
+		sb.WriteString("=%v")
+		values = append(values, keysAndValues[i+1])
+	}
+	return sb.String(), values
+}
+
+// debugw logs a verbose message with key/value pairs
+func (c *Consensus) debugw(msg string, keysAndValues ...interface{}) {
+	switch l := c.logger.(type) {
+	case noopLogger:
+	case FieldLogger:
+		l.Debugw(msg, keysAndValues...)
+	default:
+		format, values := fieldsFormat(msg, keysAndValues)
+		l.Debugf(format, values...)
+	}
+}
+
+// infow logs protocol progress with key/value pairs
+func (c *Consensus) infow(msg string, keysAndValues ...interface{}) {
+	switch l := c.logger.(type) {
+	case noopLogger:
+	case FieldLogger:
+		l.Infow(msg, keysAndValues...)
+	default:
+		format, values := fieldsFormat(msg, keysAndValues)
+		l.Infof(format, values...)
+	}
+}
+
+// warnw logs a suspicious behaviour with key/value pairs
+func (c *Consensus) warnw(msg string, keysAndValues ...interface{}) {
+	switch l := c.logger.(type) {
+	case noopLogger:
+	case FieldLogger:
+		l.Warnw(msg, keysAndValues...)
+	default:
+		format, values := fieldsFormat(msg, keysAndValues)
+		l.Warnf(format, values...)
+	}
+}
@@ -0,0 +1,103 @@
+package bdls
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bufLogger records all logged lines
+type bufLogger struct {
+	sync.Mutex
+	lines []string
+}
+
+func (l *bufLogger) log(level string, format string, args ...interface{}) {
+	l.Lock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+	l.Unlock()
+}
+
+func (l *bufLogger) Debugf(format string, args ...interface{}) { l.log("DEBUG", format, args...) }
+func (l *bufLogger) Infof(format string, args ...interface{})  { l.log("INFO", format, args...) }
+func (l *bufLogger) Warnf(format string, args ...interface{})  { l.log("WARN", format, args...) }
+
+func (l *bufLogger) contains(s string) bool {
+	l.Lock()
+	defer l.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogger(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	logger := new(bufLogger)
+	net.nodes[0].logger = logger
+	for i := range net.nodes {
+		net.nodes[i].Propose([]byte("state"))
+	}
+
+	for i := 0; i < 1000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	assert.True(t, logger.contains("INFO entering round height=2 round=0"))
+	assert.True(t, logger.contains("INFO decided height=1"))
+
+	_, sp, _ := createRoundChangeMessage(t, 1, 0)
+	bts, err := sp.Marshal()
+	assert.Nil(t, err)
+	assert.NotNil(t, net.nodes[0].ReceiveMessage(bts, net.now))
+	assert.True(t, logger.contains("DEBUG dropping message err="+ErrMessageUnknownParticipant.Error()))
+}
+
+// fieldLogger records the key/value pairs of all logged messages
+type fieldLogger struct {
+	bufLogger
+	fields map[string][]interface{}
+}
+
+func (l *fieldLogger) logw(msg string, keysAndValues []interface{}) {
+	l.Lock()
+	l.fields[msg] = keysAndValues
+	l.Unlock()
+}
+
+func (l *fieldLogger) Debugw(msg string, keysAndValues ...interface{}) { l.logw(msg, keysAndValues) }
+func (l *fieldLogger) Infow(msg string, keysAndValues ...interface{})  { l.logw(msg, keysAndValues) }
+func (l *fieldLogger) Warnw(msg string, keysAndValues ...interface{})  { l.logw(msg, keysAndValues) }
+
+func TestFieldLogger(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	logger := &fieldLogger{fields: make(map[string][]interface{})}
+	net.nodes[0].logger = logger
+	for i := range net.nodes {
+		net.nodes[i].Propose([]byte("state"))
+	}
+
+	for i := 0; i < 1000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	assert.Equal(t, []interface{}{"height", uint64(2), "round", uint64(0)}, logger.fields["entering round"])
+	assert.Equal(t, "height", logger.fields["decided"][0])
+	assert.Equal(t, uint64(1), logger.fields["decided"][1])
+
+	// key/value pairs are not formatted to printf methods
+	assert.Equal(t, 0, len(logger.lines))
+}
+
+func TestFieldsFormat(t *testing.T) {
+	format, values := fieldsFormat("100% done", []interface{}{"height", 1, "a%b", "x", "dangling"})
+	assert.Equal(t, "100%% done height=%v a%%b=%v %v", format)
+	assert.Equal(t, []interface{}{1, "x", "dangling"}, values)
+	assert.Equal(t, "100% done height=1 a%b=x dangling", fmt.Sprintf(format, values...))
+}
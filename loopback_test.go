@@ -0,0 +1,61 @@
+package bdls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExternalLoopback(t *testing.T) {
+	run := func(external bool) *memNetwork {
+		net := newMemNetworkConfig(t, 4, func(config *Config) { config.ExternalLoopback = external })
+		if external {
+			// the transport delivers own messages back
+			for i, node := range net.nodes {
+				node.Join(&memPeer{to: i, key: &net.configs[i].PrivateKey.PublicKey, queue: &net.queue})
+			}
+		}
+		for h := uint64(1); h <= 3; h++ {
+			for _, node := range net.nodes {
+				node.Propose([]byte{byte(h)})
+			}
+			for i := 0; i < 10000 && !net.decided(h); i++ {
+				net.step(20 * time.Millisecond)
+			}
+			assert.True(t, net.decided(h))
+		}
+		return net
+	}
+
+	internal := run(false)
+	external := run(true)
+	for i := range external.nodes {
+		height, _, state := external.nodes[i].CurrentState()
+		expectedHeight, _, expectedState := internal.nodes[i].CurrentState()
+		assert.Equal(t, expectedHeight, height)
+		assert.Equal(t, expectedState, state)
+		proof := external.nodes[i].CurrentProof()
+		_, decided, err := VerifyDecideProof(external.configs[i].Participants, proof)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedState, decided)
+	}
+
+	// own messages are not looped back internally, so they pass the filter
+	var filtered int
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		config.ExternalLoopback = true
+		config.MessageFilter = func(sp *SignedProto) bool {
+			if DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)) == DefaultPubKeyToIdentity(&config.PrivateKey.PublicKey) {
+				filtered++
+			}
+			return true
+		}
+	})
+	net.nodes[0].Join(&memPeer{to: 0, key: &net.configs[0].PrivateKey.PublicKey, queue: &net.queue})
+	net.nodes[0].Propose([]byte("state"))
+	for i := 0; i < 100; i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, filtered > 0)
+}
@@ -31,48 +31,191 @@
 package bdls
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
+	"crypto/subtle"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"hash"
 	"math/big"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/Sperax/bdls/crypto/blake2b"
 	"github.com/Sperax/bdls/crypto/btcec"
+	"github.com/Sperax/bdls/crypto/sha3"
 	proto "github.com/gogo/protobuf/proto"
 )
 
 // ErrPubKey will be returned if error found while decoding message's public key
 var ErrPubKey = errors.New("incorrect pubkey format")
 
+// ErrIdentityLength will be returned if a hex string doesn't decode to an Identity
+var ErrIdentityLength = errors.New("incorrect identity length")
+
 // secp256k1 elliptic curve
 var S256Curve elliptic.Curve = btcec.S256()
 
 const (
 	// SizeAxis defines byte size of X-axis or Y-axis in a public key
 	SizeAxis = 32
+	// SizeCompressedPubKey defines byte size of a compressed public key
+	SizeCompressedPubKey = 1 + SizeAxis
 	// SignaturePrefix is the prefix for signing a consensus message
 	SignaturePrefix = "BDLS_CONSENSUS_SIGNATURE"
+	// compactSuffix is appended to the signature prefix for compact messages,
+	// as their digests exclude the public key.
+	compactSuffix = "/compact"
+	// minParallelBatch is the minimal batch size to verify signatures in parallel,
+	// smaller batches are verified sequentially to avoid goroutine overhead.
+	minParallelBatch = 8
 )
 
+// Hasher defines the hash function to digest a signed message for signing & verification
+type Hasher struct {
+	// Name identifies the hash function, for any hash function other than
+	// the default blake2b-256, the name will be appended to the signature
+	// prefix, so signatures produced under one hash never verify under another.
+	Name string
+	// New returns a new hash.Hash to compute the digest
+	New func() hash.Hash
+	// Domain replaces SignaturePrefix if set, to separate signatures of
+	// independent networks using the same keys.
+	Domain []byte
+
+	// pool recycles hash.Hash created by New, shared by copies of the hasher,
+	// hashers without a pool create a new hash.Hash on every digest.
+	pool *hashPool
+}
+
+// hashPool recycles hash.Hash created by a hash function, it's only used
+// while Hasher.New is still the function it's built from, so a hasher or a
+// copy of it with New replaced never digests with the former hash function.
+type hashPool struct {
+	fn uintptr
+	sync.Pool
+}
+
+// newHashPool creates a hashPool of a top-level hash function, as closures
+// of the same code with different captured variables are indistinguishable.
+func newHashPool(fn func() hash.Hash) *hashPool {
+	p := &hashPool{fn: funcPointer(fn)}
+	p.New = func() interface{} { return fn() }
+	return p
+}
+
+// funcPointer returns the code pointer of a hash function
+func funcPointer(fn func() hash.Hash) uintptr {
+	return reflect.ValueOf(fn).Pointer()
+}
+
+// newBlake2b256 returns a new blake2b-256 hash.Hash
+func newBlake2b256() hash.Hash {
+	h, err := blake2b.New256(nil)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// DefaultHasher is the default blake2b-256 hasher for signed messages
+var DefaultHasher = &Hasher{
+	Name: "blake2b-256",
+	New:  newBlake2b256,
+	pool: newHashPool(newBlake2b256),
+}
+
+// Keccak256Hasher is the legacy keccak256 hasher as in Ethereum, signatures
+// produced with it can be exported by EthSignature for ecrecover.
+var Keccak256Hasher = &Hasher{
+	Name: "keccak256",
+	New:  sha3.NewLegacyKeccak256,
+	pool: newHashPool(sha3.NewLegacyKeccak256),
+}
+
+// pooled checks if the hasher has a pool built from the current New
+func (h *Hasher) pooled() bool {
+	return h.pool != nil && funcPointer(h.New) == h.pool.fn
+}
+
+// get returns a hash.Hash from the pool if the hasher has one
+func (h *Hasher) get() hash.Hash {
+	if h.pooled() {
+		return h.pool.Get().(hash.Hash)
+	}
+	return h.New()
+}
+
+// put resets the hash.Hash and puts it back to the pool
+func (h *Hasher) put(hash hash.Hash) {
+	if h.pooled() {
+		hash.Reset()
+		h.pool.Put(hash)
+	}
+}
+
+// WithDomain returns a copy of this hasher with the given domain separator
+func (h *Hasher) WithDomain(domain []byte) *Hasher {
+	copied := *h
+	copied.Domain = append([]byte{}, domain...)
+	return &copied
+}
+
+// prefix returns the signature prefix(or domain) with the hash identifier
+func (h *Hasher) prefix() []byte {
+	prefix := []byte(SignaturePrefix)
+	if len(h.Domain) > 0 {
+		prefix = h.Domain
+	}
+
+	if h.Name == DefaultHasher.Name {
+		return prefix
+	}
+	return append(append(append([]byte{}, prefix...), '/'), h.Name...)
+}
+
 // PubKeyAxis defines X-axis or Y-axis in a public key
 type PubKeyAxis [SizeAxis]byte
 
 // Marshal implements protobuf MarshalTo
 func (t PubKeyAxis) Marshal() ([]byte, error) {
+	if t == (PubKeyAxis{}) {
+		return nil, nil
+	}
 	return t[:], nil
 }
 
 // MarshalTo implements protobuf MarshalTo
 func (t *PubKeyAxis) MarshalTo(data []byte) (n int, err error) {
+	if *t == (PubKeyAxis{}) {
+		return 0, nil
+	}
 	copy(data, (*t)[:])
 	return SizeAxis, nil
 }
 
+// ConstantTimeEqual reports whether the two axes are equal in constant time
+func (t PubKeyAxis) ConstantTimeEqual(o PubKeyAxis) bool {
+	return subtle.ConstantTimeCompare(t[:], o[:]) == 1
+}
+
 // Unmarshal implements protobuf Unmarshal
+//
+// Inputs of at most 32 bytes are left-padded with zeros, a 33-byte input with
+// a single leading zero byte(as from sign-padded big integer encodings) is
+// accepted with the zero stripped, any other input longer than 32 bytes is
+// rejected with ErrPubKey.
 func (t *PubKeyAxis) Unmarshal(data []byte) error {
+	// strip a single sign-padding zero byte
+	if len(data) == SizeAxis+1 && data[0] == 0 {
+		data = data[1:]
+	}
+
 	// more than 32 bytes, illegal axis
 	if len(data) > SizeAxis {
 		return ErrPubKey
@@ -84,22 +227,91 @@ func (t *PubKeyAxis) Unmarshal(data []byte) error {
 	return nil
 }
 
-// Size implements protobuf Size
-func (t *PubKeyAxis) Size() int { return SizeAxis }
+// Size implements protobuf Size, an all-zero axis(as in compact messages)
+// will be encoded as empty bytes.
+func (t *PubKeyAxis) Size() int {
+	if *t == (PubKeyAxis{}) {
+		return 0
+	}
+	return SizeAxis
+}
 
 // String representation of Axis
 func (t *PubKeyAxis) String() string {
 	return hex.EncodeToString((*t)[:])
 }
 
-// String representation of Axis
+// MarshalText implements encoding.TextMarshaler, the axis is encoded as hex string
 func (t *PubKeyAxis) MarshalText() (text []byte, err error) {
 	return []byte(hex.EncodeToString((*t)[:])), nil
 }
 
+// UnmarshalText implements encoding.TextUnmarshaler, to decode a hex string
+// from MarshalText
+func (t *PubKeyAxis) UnmarshalText(text []byte) error {
+	bts, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	return t.Unmarshal(bts)
+}
+
 // Identity is a user-defined struct to encode X-axis and Y-axis for a publickey in an array
 type Identity [2 * SizeAxis]byte
 
+// identityShortBytes is the number of leading and trailing bytes in Short
+const identityShortBytes = 4
+
+// Hex returns the full hex form of this identity, X-axis followed by Y-axis
+func (id Identity) Hex() string { return hex.EncodeToString(id[:]) }
+
+// Short returns a short hex fingerprint of this identity for display, as the
+// first 4 bytes and the last 4 bytes, like "1a2b3c4d..5e6f7a8b". It's not
+// unique and MUST NOT be used to identify participants.
+func (id Identity) Short() string {
+	var buf [4*identityShortBytes + 2]byte
+	hex.Encode(buf[:], id[:identityShortBytes])
+	buf[2*identityShortBytes] = '.'
+	buf[2*identityShortBytes+1] = '.'
+	hex.Encode(buf[2*identityShortBytes+2:], id[len(id)-identityShortBytes:])
+	return string(buf[:])
+}
+
+// ParseIdentityHex decodes an identity from its full hex form returned by Hex
+func ParseIdentityHex(s string) (id Identity, err error) {
+	bts, err := hex.DecodeString(s)
+	if err != nil {
+		return id, err
+	}
+	if len(bts) != len(id) {
+		return id, ErrIdentityLength
+	}
+	copy(id[:], bts)
+	return id, nil
+}
+
+// Compressed returns the 33-byte compressed form of this identity as a public
+// key on secp256k1, the first byte is 0x02 if Y is even, 0x03 if Y is odd,
+// followed by X. Only the identities derived by DefaultPubKeyToIdentity can be
+// restored by IdentityFromCompressed.
+func (id Identity) Compressed() (ret [SizeCompressedPubKey]byte) {
+	ret[0] = 0x02 | (id[len(id)-1] & 1)
+	copy(ret[1:], id[:SizeAxis])
+	return
+}
+
+// IdentityFromCompressed restores an identity from the compressed form returned
+// by Compressed, ErrPubKey will be returned if it's not a point on secp256k1.
+func IdentityFromCompressed(compressed [SizeCompressedPubKey]byte) (id Identity, err error) {
+	X, Y, err := ParseCompressedPubKey(compressed[:])
+	if err != nil {
+		return id, err
+	}
+	copy(id[:SizeAxis], X[:])
+	copy(id[SizeAxis:], Y[:])
+	return id, nil
+}
+
 // default method to derive coordinate from public key
 func DefaultPubKeyToIdentity(pubkey *ecdsa.PublicKey) (ret Identity) {
 	var X PubKeyAxis
@@ -120,38 +332,249 @@ func DefaultPubKeyToIdentity(pubkey *ecdsa.PublicKey) (ret Identity) {
 	return
 }
 
+// String renders the type, height, round and the short hex of the state hash
+// of this message, as "Commit height=10 round=2 state=1a2b3c4d".
+func (m *Message) String() string {
+	if m == nil {
+		return "<nil>"
+	}
+
+	var buf [64]byte
+	out := append(buf[:0], m.Type.String()...)
+	out = append(out, " height="...)
+	out = strconv.AppendUint(out, m.Height, 10)
+	out = append(out, " round="...)
+	out = strconv.AppendUint(out, m.Round, 10)
+	out = append(out, " state="...)
+	if m.State == nil {
+		out = append(out, "nil"...)
+	} else {
+		var short [8]byte
+		hash := blake2b.Sum256(m.State)
+		hex.Encode(short[:], hash[:4])
+		out = append(out, short[:]...)
+	}
+	return string(out)
+}
+
+// SignedProto defines a message with signature and it's publickey
+type SignedProto struct {
+	Version uint32 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	// the Message encoded raw protobuf in bytes
+	Message []byte `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	// signer's public key
+	X PubKeyAxis `protobuf:"bytes,3,opt,name=x,proto3,customtype=PubKeyAxis" json:"x"`
+	Y PubKeyAxis `protobuf:"bytes,4,opt,name=y,proto3,customtype=PubKeyAxis" json:"y"`
+	// signature r,s for prefix+messages+version+x+y above
+	R []byte `protobuf:"bytes,5,opt,name=r,proto3" json:"r,omitempty"`
+	S []byte `protobuf:"bytes,6,opt,name=s,proto3" json:"s,omitempty"`
+	// recovery id + 1 of the signature for compact messages, the signer's
+	// public key is recovered from r,s and X & Y are omitted, 0 if not compact.
+	V uint32 `protobuf:"varint,7,opt,name=v,proto3" json:"v,omitempty"`
+	// signature scheme of r,s and the public key, 0 for secp256k1 ECDSA
+	Scheme               SignatureScheme `protobuf:"varint,8,opt,name=scheme,proto3,casttype=SignatureScheme" json:"scheme,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+	// XXX_wire caches the wire form returned by Bytes(), it's declared
+	// with XXX_ prefix to be ignored by proto.Equal and text marshalling.
+	XXX_wire *wireCache `json:"-"`
+	// XXX_digest memoizes the *digestMemo of the latest digest by HashWith,
+	// it's XXX_ prefixed as XXX_wire, as text marshalling can't skip
+	// unexported fields.
+	XXX_digest atomic.Value `json:"-"`
+}
+
+// Bytes returns the protobuf encoded wire form of the message, the result is
+// cached to avoid re-encoding for repeated sends, and will be re-encoded if any
+// field has been assigned since the last call, the bytes of slice fields are
+// not expected to be modified in place.
+//
+// NOTE: the returned slice is shared and MUST NOT be modified.
+func (sp *SignedProto) Bytes() []byte {
+	if sp.XXX_wire != nil && sp.XXX_wire.matches(sp) {
+		return sp.XXX_wire.bts
+	}
+
+	// encoding of SignedProto never fails
+	bts, _ := sp.Marshal()
+	sp.XXX_wire = &wireCache{
+		bts:          bts,
+		version:      sp.Version,
+		v:            sp.V,
+		scheme:       sp.Scheme,
+		x:            sp.X,
+		y:            sp.Y,
+		message:      sp.Message,
+		r:            sp.R,
+		s:            sp.S,
+		unrecognized: sp.XXX_unrecognized,
+	}
+	return bts
+}
+
+// wireCache is the wire form of a SignedProto, with a snapshot of the fields
+// it's encoded from.
+type wireCache struct {
+	bts          []byte
+	version      uint32
+	v            uint32
+	scheme       SignatureScheme
+	x            PubKeyAxis
+	y            PubKeyAxis
+	message      []byte
+	r            []byte
+	s            []byte
+	unrecognized []byte
+}
+
+// matches checks if the fields of sp are still the snapshot, slices are
+// compared by their headers.
+func (wc *wireCache) matches(sp *SignedProto) bool {
+	return wc.version == sp.Version && wc.v == sp.V && wc.scheme == sp.Scheme &&
+		wc.x == sp.X && wc.y == sp.Y &&
+		sameSlice(wc.message, sp.Message) && sameSlice(wc.r, sp.R) && sameSlice(wc.s, sp.S) &&
+		sameSlice(wc.unrecognized, sp.XXX_unrecognized)
+}
+
+// sameSlice checks if two slices share the same header, as the same backing
+// array, length and capacity.
+func sameSlice(a, b []byte) bool {
+	if len(a) != len(b) || cap(a) != cap(b) || (a == nil) != (b == nil) {
+		return false
+	}
+	return cap(a) == 0 || &a[:cap(a)][0] == &b[:cap(b)][0]
+}
+
+// scratchPool recycles scratch buffers for encoding integers while hashing
+var scratchPool = sync.Pool{New: func() interface{} { return new([4]byte) }}
+
 // Hash concats and hash as follows:
 // blake2b(signPrefix + version + pubkey.X + pubkey.Y+len_32bit(msg) + message)
-func (sp *SignedProto) Hash() []byte {
-	hash, err := blake2b.New256(nil)
-	if err != nil {
-		panic(err)
+func (sp *SignedProto) Hash() []byte { return sp.HashWith(DefaultHasher) }
+
+// HashWith concats and hash as Hash() does, with the given hasher,
+// a nil hasher is the DefaultHasher.
+//
+// For compact messages(V != 0), the public key is excluded from the digest
+// to make recovery possible, and the prefix is suffixed with "/compact":
+// hash(signPrefix + "/compact" + version + len_32bit(msg) + message)
+//
+// The digest is memoized on the message object for repeated verifications,
+// and will be recomputed if the hasher, version, public key or the Message
+// slice has been replaced since, the bytes of Message are not expected to be
+// modified in place. It's safe for concurrent use.
+func (sp *SignedProto) HashWith(h *Hasher) []byte {
+	if h == nil {
+		h = DefaultHasher
+	}
+
+	if memo, ok := sp.XXX_digest.Load().(*digestMemo); ok && memo.matches(sp, h) {
+		return append([]byte{}, memo.sum...)
+	}
+
+	memo := newDigestMemo(sp, h)
+	memo.sum = sp.digest(h)
+	sp.XXX_digest.Store(memo)
+	return append([]byte{}, memo.sum...)
+}
+
+// digestMemo is a digest of a SignedProto, with the inputs it's computed from
+type digestMemo struct {
+	hasher  *Hasher
+	newHash uintptr
+	name    string
+	domain  []byte
+	version uint32
+	v       uint32
+	x       PubKeyAxis
+	y       PubKeyAxis
+	message []byte
+	sum     []byte
+}
+
+// newDigestMemo records the inputs of the digest of sp computed by h
+func newDigestMemo(sp *SignedProto, h *Hasher) *digestMemo {
+	memo := &digestMemo{
+		hasher:  h,
+		newHash: funcPointer(h.New),
+		name:    h.Name,
+		domain:  append([]byte{}, h.Domain...),
+		version: sp.Version,
+		v:       sp.V,
+		message: sp.Message,
+	}
+	// the public key is not digested for compact messages
+	if sp.V == 0 {
+		memo.x, memo.y = sp.X, sp.Y
 	}
+	return memo
+}
+
+// matches checks if the inputs of the digest of sp computed by h are still what
+// the memo has been computed from, the message is compared by it's slice header.
+func (memo *digestMemo) matches(sp *SignedProto, h *Hasher) bool {
+	if memo.hasher != h || memo.newHash != funcPointer(h.New) || memo.name != h.Name || !bytes.Equal(memo.domain, h.Domain) {
+		return false
+	}
+	if memo.version != sp.Version || memo.v != sp.V {
+		return false
+	}
+	if sp.V == 0 && (memo.x != sp.X || memo.y != sp.Y) {
+		return false
+	}
+	return sameSlice(memo.message, sp.Message)
+}
+
+// digest computes the digest of HashWith without caching, for signing, as
+// messages being signed are rarely verified by the same object.
+func (sp *SignedProto) digest(h *Hasher) []byte {
+	if h == nil {
+		h = DefaultHasher
+	}
+	hash := h.get()
+	defer h.put(hash)
+
 	// write prefix
-	_, err = hash.Write([]byte(SignaturePrefix))
+	_, err := hash.Write(h.prefix())
 	if err != nil {
 		panic(err)
 	}
 
-	// write version
-	err = binary.Write(hash, binary.LittleEndian, sp.Version)
-	if err != nil {
-		panic(err)
+	if sp.V != 0 {
+		_, err = hash.Write([]byte(compactSuffix))
+		if err != nil {
+			panic(err)
+		}
 	}
 
-	// write X & Y
-	_, err = hash.Write(sp.X[:])
+	// scratch buffer for little-endian integers
+	scratch := scratchPool.Get().(*[4]byte)
+	defer scratchPool.Put(scratch)
+
+	// write version
+	binary.LittleEndian.PutUint32(scratch[:], sp.Version)
+	_, err = hash.Write(scratch[:])
 	if err != nil {
 		panic(err)
 	}
 
-	_, err = hash.Write(sp.Y[:])
-	if err != nil {
-		panic(err)
+	// write X & Y
+	if sp.V == 0 {
+		_, err = hash.Write(sp.X[:])
+		if err != nil {
+			panic(err)
+		}
+
+		_, err = hash.Write(sp.Y[:])
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	// write message length
-	err = binary.Write(hash, binary.LittleEndian, uint32(len(sp.Message)))
+	binary.LittleEndian.PutUint32(scratch[:], uint32(len(sp.Message)))
+	_, err = hash.Write(scratch[:])
 	if err != nil {
 		panic(err)
 	}
@@ -165,39 +588,192 @@ func (sp *SignedProto) Hash() []byte {
 	return hash.Sum(nil)
 }
 
-// Sign the message with a private key
-func (sp *SignedProto) Sign(m *Message, privateKey *ecdsa.PrivateKey) {
+// setMessage marshals the message into this signed message, along with
+// the version and the public key of the signer.
+func (sp *SignedProto) setMessage(m *Message, publicKey *ecdsa.PublicKey) error {
 	bts, err := proto.Marshal(m)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	// hash message
 	sp.Version = ProtocolVersion
 	sp.Message = bts
+	sp.Scheme = SchemeSecp256k1
+
+	err = sp.X.Unmarshal(publicKey.X.Bytes())
+	if err != nil {
+		return err
+	}
+	err = sp.Y.Unmarshal(publicKey.Y.Bytes())
+	if err != nil {
+		return err
+	}
+	return nil
+}
 
-	err = sp.X.Unmarshal(privateKey.PublicKey.X.Bytes())
+// Sign the message with a private key, it panics on error, see SignSafe.
+func (sp *SignedProto) Sign(m *Message, privateKey *ecdsa.PrivateKey) {
+	err := sp.SignSafe(m, privateKey)
 	if err != nil {
 		panic(err)
 	}
-	err = sp.Y.Unmarshal(privateKey.PublicKey.Y.Bytes())
+}
+
+// SignSafe signs the message with a private key, and returns error instead of
+// panicking if the message cannot be marshalled or signed.
+func (sp *SignedProto) SignSafe(m *Message, privateKey *ecdsa.PrivateKey) error {
+	return sp.SignWith(m, privateKey, DefaultHasher)
+}
+
+// SignWith signs the message with a private key, the message is digested with
+// the given hasher, a nil hasher is the DefaultHasher.
+func (sp *SignedProto) SignWith(m *Message, privateKey *ecdsa.PrivateKey, h *Hasher) error {
+	return sp.SignWithSigner(m, NewECDSASigner(privateKey), h)
+}
+
+// SignDeterministic signs the message with a private key on secp256k1, the nonce
+// is derived from the private key and the message hash as described in RFC6979,
+// so identical inputs always produce identical signatures.
+func (sp *SignedProto) SignDeterministic(m *Message, privateKey *ecdsa.PrivateKey) {
+	err := sp.setMessage(m, &privateKey.PublicKey)
 	if err != nil {
 		panic(err)
 	}
-	hash := sp.Hash()
+	hash := sp.digest(DefaultHasher)
 
-	// sign the message
-	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hash)
+	// sign the message, the signature is already in low-S form
+	sig, err := (*btcec.PrivateKey)(privateKey).Sign(hash)
 	if err != nil {
 		panic(err)
 	}
-	sp.R = r.Bytes()
-	sp.S = s.Bytes()
+	sp.R = sig.R.Bytes()
+	sp.S = sig.S.Bytes()
+}
+
+// SignCompact signs the message with a private key on secp256k1 in compact form,
+// the recovery id is stored in V instead of the public key in X & Y, the public
+// key will be recovered from the signature while verifying. The message is
+// digested with the given hasher, a nil hasher is the DefaultHasher.
+func (sp *SignedProto) SignCompact(m *Message, privateKey *ecdsa.PrivateKey, h *Hasher) error {
+	bts, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	sp.Version = ProtocolVersion
+	sp.Message = bts
+	sp.X = PubKeyAxis{}
+	sp.Y = PubKeyAxis{}
+	sp.Scheme = SchemeSecp256k1
+	// V must be set before hashing to select the compact digest
+	sp.V = 1
+	hash := sp.digest(h)
+
+	// sig = [27 + recid] | R | S, the signature is already in low-S form
+	sig, err := btcec.SignCompact(btcec.S256(), (*btcec.PrivateKey)(privateKey), hash, false)
+	if err != nil {
+		return err
+	}
+	sp.V = uint32(sig[0]-27) + 1
+	sp.R = new(big.Int).SetBytes(sig[1 : 1+SizeAxis]).Bytes()
+	sp.S = new(big.Int).SetBytes(sig[1+SizeAxis:]).Bytes()
+	return nil
+}
+
+// RecoverPublicKey recovers the signer's public key of a compact message into
+// X & Y, if X & Y have already been set, they must match the recovered key.
+// It does nothing for non-compact messages.
+func (sp *SignedProto) RecoverPublicKey(h *Hasher) error {
+	if sp.V == 0 {
+		return nil
+	}
+
+	// only secp256k1 signatures are recoverable
+	if sp.V > 4 || sp.Scheme != SchemeSecp256k1 {
+		return ErrRecoveryID
+	}
+
+	if len(sp.R) > SizeAxis || len(sp.S) > SizeAxis {
+		return ErrRSOutOfRange
+	}
+
+	// rebuild the compact signature
+	sig := make([]byte, 1+2*SizeAxis)
+	sig[0] = byte(27 + sp.V - 1)
+	copy(sig[1+SizeAxis-len(sp.R):], sp.R)
+	copy(sig[1+2*SizeAxis-len(sp.S):], sp.S)
+
+	pubkey, _, err := btcec.RecoverCompact(btcec.S256(), sig, sp.HashWith(h))
+	if err != nil {
+		return ErrSigMismatch
+	}
+
+	var X, Y PubKeyAxis
+	err = X.Unmarshal(pubkey.X.Bytes())
+	if err != nil {
+		return err
+	}
+	err = Y.Unmarshal(pubkey.Y.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if sp.X != (PubKeyAxis{}) || sp.Y != (PubKeyAxis{}) {
+		if !sp.X.ConstantTimeEqual(X) || !sp.Y.ConstantTimeEqual(Y) {
+			return ErrSigMismatch
+		}
+	}
+	sp.X = X
+	sp.Y = Y
+	return nil
 }
 
 // Verify the signature of this signed message
-func (sp *SignedProto) Verify(curve elliptic.Curve) bool {
+func (sp *SignedProto) Verify(curve elliptic.Curve) bool { return sp.VerifyError(curve) == nil }
+
+// VerifyError verifies the signature of this signed message, and returns the
+// reason if verification failed. Results on secp256k1 are cached, see SetVerifyCacheSize.
+func (sp *SignedProto) VerifyError(curve elliptic.Curve) error {
+	return sp.VerifyWith(curve, DefaultHasher)
+}
+
+// VerifyWith verifies the signature of this signed message as VerifyError does,
+// the message is digested with the given hasher, a nil hasher is the DefaultHasher.
+// For compact messages, the public key will be recovered into X & Y first.
+// The curve applies to SchemeSecp256k1 only, messages of other schemes are
+// verified by the Verifier of their scheme.
+func (sp *SignedProto) VerifyWith(curve elliptic.Curve, h *Hasher) error {
+	switch sp.Scheme {
+	case SchemeSecp256k1:
+	case SchemeEd25519:
+		if sp.V != 0 {
+			return ErrRecoveryID
+		}
+		return NewEd25519Verifier().Verify(sp.X, sp.Y, sp.HashWith(h), sp.R, sp.S)
+	default:
+		return ErrScheme
+	}
+
+	if err := sp.RecoverPublicKey(h); err != nil {
+		return err
+	}
+
+	hash := sp.HashWith(h)
+	if curve != S256Curve {
+		return sp.verifyHash(curve, hash)
+	}
+
+	key := newVerifyCacheKey(hash, sp.R, sp.S)
+	if found, err := defaultVerifyCache.Get(key); found {
+		return err
+	}
+	err := sp.verifyHash(curve, hash)
+	defaultVerifyCache.Put(key, err)
+	return err
+}
+
+// verifyHash verifies the signature of this signed message against a precomputed hash
+func (sp *SignedProto) verifyHash(curve elliptic.Curve, hash []byte) error {
 	var X, Y, R, S big.Int
-	hash := sp.Hash()
 	// verify against public key and r, s
 	pubkey := ecdsa.PublicKey{}
 	pubkey.Curve = curve
@@ -208,7 +784,35 @@ func (sp *SignedProto) Verify(curve elliptic.Curve) bool {
 	R.SetBytes(sp.R[:])
 	S.SetBytes(sp.S[:])
 
-	return ecdsa.Verify(&pubkey, hash, &R, &S)
+	// public key validation, the point must be on the curve, as the
+	// arithmetic on an off-curve point is undefined
+	P := curve.Params().P
+	if (X.Sign() == 0 && Y.Sign() == 0) || X.Cmp(P) >= 0 || Y.Cmp(P) >= 0 {
+		return ErrBadPubKey
+	}
+	if !curve.IsOnCurve(&X, &Y) {
+		return ErrBadPubKey
+	}
+
+	// r, s must be in range [1, N-1]
+	N := curve.Params().N
+	if R.Sign() == 0 || S.Sign() == 0 {
+		return ErrZeroRS
+	}
+
+	if R.Cmp(N) >= 0 || S.Cmp(N) >= 0 {
+		return ErrRSOutOfRange
+	}
+
+	// reject non-canonical high-S signatures
+	if S.Cmp(new(big.Int).Rsh(N, 1)) > 0 {
+		return ErrHighS
+	}
+
+	if !ecdsa.Verify(&pubkey, hash, &R, &S) {
+		return ErrSigMismatch
+	}
+	return nil
 }
 
 // PublicKey returns the public key of this signed message
@@ -219,3 +823,143 @@ func (sp *SignedProto) PublicKey(curve elliptic.Curve) *ecdsa.PublicKey {
 	pubkey.Y = big.NewInt(0).SetBytes(sp.Y[:])
 	return pubkey
 }
+
+// EthSignature exports the signature in the 65-byte r||s||v layout expected by
+// ecrecover in EVM, r & s are 32-byte big-endian, and v is 27 + recovery id.
+//
+// The recovery id is searched against the keccak256 digest from HashWith(Keccak256Hasher),
+// so the exported signature only recovers the signer if the message was signed
+// with Keccak256Hasher, otherwise ErrSigMismatch will be returned.
+func (sp *SignedProto) EthSignature() (ret [65]byte, err error) {
+	if len(sp.R) > SizeAxis || len(sp.S) > SizeAxis {
+		return ret, ErrRSOutOfRange
+	}
+
+	if sp.V != 0 {
+		if err := sp.RecoverPublicKey(Keccak256Hasher); err != nil {
+			return ret, err
+		}
+	}
+
+	hash := sp.HashWith(Keccak256Hasher)
+	sig := make([]byte, 1+2*SizeAxis)
+	copy(sig[1+SizeAxis-len(sp.R):], sp.R)
+	copy(sig[1+2*SizeAxis-len(sp.S):], sp.S)
+	for recid := byte(0); recid < 4; recid++ {
+		sig[0] = 27 + recid
+		pubkey, _, err := btcec.RecoverCompact(btcec.S256(), sig, hash)
+		if err != nil {
+			continue
+		}
+
+		var X, Y PubKeyAxis
+		if X.Unmarshal(pubkey.X.Bytes()) != nil || Y.Unmarshal(pubkey.Y.Bytes()) != nil {
+			continue
+		}
+
+		if X.ConstantTimeEqual(sp.X) && Y.ConstantTimeEqual(sp.Y) {
+			copy(ret[:], sig[1:])
+			ret[2*SizeAxis] = 27 + recid
+			return ret, nil
+		}
+	}
+	return ret, ErrSigMismatch
+}
+
+// CompressedPubKey returns the 33-byte compressed public key of this signed message,
+// the first byte is 0x02 if Y is even, 0x03 if Y is odd, followed by X.
+func (sp *SignedProto) CompressedPubKey() (ret [SizeCompressedPubKey]byte) {
+	ret[0] = 0x02 | (sp.Y[SizeAxis-1] & 1)
+	copy(ret[1:], sp.X[:])
+	return
+}
+
+// ParseCompressedPubKey parses a 33-byte compressed public key on secp256k1
+// back into X & Y axes.
+func ParseCompressedPubKey(compressed []byte) (X PubKeyAxis, Y PubKeyAxis, err error) {
+	if len(compressed) != SizeCompressedPubKey || (compressed[0] != 0x02 && compressed[0] != 0x03) {
+		return X, Y, ErrPubKey
+	}
+
+	pubkey, err := btcec.ParsePubKey(compressed, btcec.S256())
+	if err != nil {
+		return X, Y, ErrPubKey
+	}
+
+	err = X.Unmarshal(pubkey.X.Bytes())
+	if err != nil {
+		return X, Y, err
+	}
+	err = Y.Unmarshal(pubkey.Y.Bytes())
+	if err != nil {
+		return X, Y, err
+	}
+	return X, Y, nil
+}
+
+// VerifyBatch verifies the signatures of a batch of signed messages on secp256k1,
+// the i-th element in valid reports the result of msgs[i], so callers can drop
+// only the bad messages instead of the whole batch. err will be ErrMessageSignature
+// if any message in the batch failed verification.
+//
+// Each message is verified as VerifyWith(S256Curve, DefaultHasher) does, in
+// parallel with runtime.NumCPU() workers, batches smaller than minParallelBatch
+// are verified sequentially. A message appearing more than once in the batch
+// is verified once, as verification may recover it's public key in place.
+func VerifyBatch(msgs []*SignedProto) (valid []bool, err error) {
+	valid = make([]bool, len(msgs))
+	first := make(map[*SignedProto]int, len(msgs))
+	for k := range msgs {
+		if _, ok := first[msgs[k]]; !ok && msgs[k] != nil {
+			first[msgs[k]] = k
+		}
+	}
+
+	verify := func(k int) {
+		if msgs[k] != nil && first[msgs[k]] == k {
+			valid[k] = msgs[k].VerifyWith(S256Curve, DefaultHasher) == nil
+		}
+	}
+
+	if len(msgs) < minParallelBatch {
+		for k := range msgs {
+			verify(k)
+		}
+	} else {
+		workers := runtime.NumCPU()
+		if workers > len(msgs) {
+			workers = len(msgs)
+		}
+
+		jobs := make(chan int, len(msgs))
+		for k := range msgs {
+			jobs <- k
+		}
+		close(jobs)
+
+		var wg sync.WaitGroup
+		wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wg.Done()
+				for k := range jobs {
+					verify(k)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	for k := range msgs {
+		if msgs[k] != nil {
+			valid[k] = valid[first[msgs[k]]]
+		}
+	}
+
+	for k := range valid {
+		if !valid[k] {
+			return valid, ErrMessageSignature
+		}
+	}
+	return valid, nil
+}
@@ -75,22 +75,6 @@ func (MessageType) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_33c57e4bae7b9afd, []int{0}
 }
 
-// SignedProto defines a message with signature and it's publickey
-type SignedProto struct {
-	Version uint32 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
-	// the Message encoded raw protobuf in bytes
-	Message []byte `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
-	// signer's public key
-	X PubKeyAxis `protobuf:"bytes,3,opt,name=x,proto3,customtype=PubKeyAxis" json:"x"`
-	Y PubKeyAxis `protobuf:"bytes,4,opt,name=y,proto3,customtype=PubKeyAxis" json:"y"`
-	// signature r,s for prefix+messages+version+x+y above
-	R                    []byte   `protobuf:"bytes,5,opt,name=r,proto3" json:"r,omitempty"`
-	S                    []byte   `protobuf:"bytes,6,opt,name=s,proto3" json:"s,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
-}
-
 func (m *SignedProto) Reset()         { *m = SignedProto{} }
 func (m *SignedProto) String() string { return proto.CompactTextString(m) }
 func (*SignedProto) ProtoMessage()    {}
@@ -152,6 +136,20 @@ func (m *SignedProto) GetS() []byte {
 	return nil
 }
 
+func (m *SignedProto) GetV() uint32 {
+	if m != nil {
+		return m.V
+	}
+	return 0
+}
+
+func (m *SignedProto) GetScheme() SignatureScheme {
+	if m != nil {
+		return m.Scheme
+	}
+	return 0
+}
+
 // Message defines a consensus message
 type Message struct {
 	// Type of this message
@@ -171,9 +169,8 @@ type Message struct {
 	XXX_sizecache        int32        `json:"-"`
 }
 
-func (m *Message) Reset()         { *m = Message{} }
-func (m *Message) String() string { return proto.CompactTextString(m) }
-func (*Message) ProtoMessage()    {}
+func (m *Message) Reset()      { *m = Message{} }
+func (*Message) ProtoMessage() {}
 func (*Message) Descriptor() ([]byte, []int) {
 	return fileDescriptor_33c57e4bae7b9afd, []int{1}
 }
@@ -255,31 +252,34 @@ func init() {
 func init() { proto.RegisterFile("message.proto", fileDescriptor_33c57e4bae7b9afd) }
 
 var fileDescriptor_33c57e4bae7b9afd = []byte{
-	// 381 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0xcd, 0xaa, 0xda, 0x40,
-	0x14, 0xc7, 0x1d, 0xf3, 0x61, 0x39, 0xd1, 0x76, 0x3a, 0x94, 0x32, 0x74, 0xa1, 0x41, 0x28, 0x95,
-	0x42, 0x23, 0xd4, 0x27, 0xa8, 0x76, 0x51, 0xe8, 0x07, 0x32, 0xf6, 0x05, 0xf2, 0x71, 0x8c, 0xa1,
-	0x26, 0x23, 0x99, 0xa4, 0x98, 0xc7, 0xe9, 0xdb, 0xb8, 0x2c, 0x5d, 0x76, 0x21, 0x17, 0x9f, 0xe4,
-	0x32, 0x13, 0xbd, 0x64, 0x71, 0xef, 0xee, 0xfc, 0xce, 0xff, 0x7f, 0xce, 0xf9, 0x27, 0x0c, 0x8c,
-	0x72, 0x54, 0x2a, 0x4c, 0x31, 0x38, 0x94, 0xb2, 0x92, 0xcc, 0x8e, 0x92, 0xbd, 0x7a, 0xf3, 0x21,
-	0xcd, 0xaa, 0x5d, 0x1d, 0x05, 0xb1, 0xcc, 0xe7, 0xa9, 0x4c, 0xe5, 0xdc, 0x88, 0x51, 0xbd, 0x35,
-	0x64, 0xc0, 0x54, 0xed, 0xd0, 0xf4, 0x0f, 0x01, 0x6f, 0x93, 0xa5, 0x05, 0x26, 0x6b, 0xb3, 0x84,
-	0xc3, 0xe0, 0x37, 0x96, 0x2a, 0x93, 0x05, 0x27, 0x3e, 0x99, 0x8d, 0xc4, 0x0d, 0xb5, 0xf2, 0xbd,
-	0xbd, 0xc7, 0xfb, 0x3e, 0x99, 0x0d, 0xc5, 0x0d, 0x99, 0x0f, 0xe4, 0xc8, 0x2d, 0xdd, 0x5b, 0xb2,
-	0xd3, 0x79, 0xd2, 0xfb, 0x7f, 0x9e, 0xc0, 0xba, 0x8e, 0xbe, 0x62, 0xf3, 0xe9, 0x98, 0x29, 0x41,
-	0x8e, 0xda, 0xd1, 0x70, 0xfb, 0x69, 0x47, 0xc3, 0x86, 0x40, 0x4a, 0xee, 0x98, 0xbd, 0xa4, 0xd4,
-	0xa4, 0xb8, 0xdb, 0x92, 0x9a, 0xfe, 0x23, 0x0f, 0xa7, 0xd9, 0x5b, 0xb0, 0x7f, 0x36, 0x07, 0x34,
-	0xe1, 0x9e, 0x7f, 0x7c, 0x19, 0xe8, 0x6f, 0x0e, 0xae, 0xa2, 0x16, 0x84, 0x91, 0xd9, 0x6b, 0x70,
-	0xbf, 0x60, 0x96, 0xee, 0x2a, 0x93, 0xd5, 0x16, 0x57, 0x62, 0xaf, 0xc0, 0x11, 0xb2, 0x2e, 0x12,
-	0x13, 0xd7, 0x16, 0x2d, 0xe8, 0xee, 0xa6, 0x0a, 0x2b, 0x6c, 0x23, 0x8a, 0x16, 0xd8, 0x3b, 0x70,
-	0xd6, 0xa5, 0x94, 0x5b, 0xee, 0xf8, 0xd6, 0xcc, 0xbb, 0xdd, 0xea, 0xfc, 0x2c, 0xd1, 0xea, 0x6c,
-	0x01, 0xde, 0x37, 0x19, 0xff, 0x12, 0xb8, 0xc7, 0x50, 0xa1, 0xc9, 0xfd, 0xa8, 0xbd, 0xeb, 0x7a,
-	0x5f, 0x82, 0xd7, 0x89, 0xcd, 0x06, 0x60, 0xfd, 0x90, 0x07, 0xda, 0x63, 0x2f, 0xc0, 0x33, 0xa1,
-	0x56, 0xbb, 0xb0, 0x48, 0x91, 0x12, 0xf6, 0x0c, 0x6c, 0x3d, 0x47, 0xfb, 0x0c, 0xc0, 0xdd, 0xe0,
-	0x1e, 0xe3, 0x8a, 0x5a, 0xba, 0x5e, 0xc9, 0x3c, 0xcf, 0x2a, 0x6a, 0xeb, 0x91, 0xce, 0x66, 0xea,
-	0x68, 0xf1, 0x33, 0xc6, 0x59, 0x82, 0xd4, 0xd5, 0xb5, 0x40, 0xd5, 0x14, 0x31, 0x1d, 0x2c, 0x87,
-	0xa7, 0xcb, 0x98, 0xfc, 0xbd, 0x8c, 0xc9, 0xdd, 0x65, 0x4c, 0x22, 0xd7, 0xbc, 0x80, 0xc5, 0x7d,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x43, 0xc3, 0x64, 0x6c, 0x47, 0x02, 0x00, 0x00,
+	// 429 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0xbf, 0x8e, 0xd3, 0x40,
+	0x10, 0xc6, 0xb3, 0x97, 0xb5, 0x73, 0x1a, 0xe7, 0xb8, 0x65, 0x41, 0x68, 0x45, 0x11, 0x47, 0x27,
+	0x21, 0x22, 0x10, 0x39, 0x89, 0xeb, 0xae, 0x23, 0x47, 0x81, 0xc4, 0x1f, 0x45, 0x1b, 0x5e, 0xc0,
+	0x76, 0xe6, 0x1c, 0x8b, 0xd8, 0x1b, 0x79, 0xd7, 0x51, 0xfc, 0x26, 0x94, 0xf0, 0x36, 0x57, 0x52,
+	0x22, 0x8a, 0x08, 0xf9, 0x09, 0xa8, 0xa9, 0xd0, 0xae, 0x13, 0xe4, 0x02, 0xba, 0xf9, 0xcd, 0xf7,
+	0xcd, 0x78, 0xbe, 0x95, 0xe1, 0x2c, 0x47, 0xad, 0xa3, 0x14, 0xa7, 0x9b, 0x52, 0x19, 0xc5, 0x69,
+	0xbc, 0x5c, 0xeb, 0xc7, 0x2f, 0xd2, 0xcc, 0xac, 0xaa, 0x78, 0x9a, 0xa8, 0xfc, 0x32, 0x55, 0xa9,
+	0xba, 0x74, 0x62, 0x5c, 0xdd, 0x3a, 0x72, 0xe0, 0xaa, 0x76, 0xe8, 0xa2, 0x21, 0x10, 0x2c, 0xb2,
+	0xb4, 0xc0, 0xe5, 0xdc, 0x2d, 0x11, 0x30, 0xd8, 0x62, 0xa9, 0x33, 0x55, 0x08, 0x32, 0x26, 0x93,
+	0x33, 0x79, 0x44, 0xab, 0xbc, 0x6f, 0xbf, 0x27, 0x4e, 0xc6, 0x64, 0x32, 0x94, 0x47, 0xe4, 0x63,
+	0x20, 0x3b, 0xd1, 0xb7, 0xbd, 0x19, 0xbf, 0xdb, 0x87, 0xbd, 0x1f, 0xfb, 0x10, 0xe6, 0x55, 0xfc,
+	0x16, 0xeb, 0x57, 0xbb, 0x4c, 0x4b, 0xb2, 0xb3, 0x8e, 0x5a, 0xd0, 0xff, 0x3b, 0x6a, 0x3e, 0x04,
+	0x52, 0x0a, 0xcf, 0xed, 0x25, 0xa5, 0x25, 0x2d, 0xfc, 0x96, 0xb4, 0xa5, 0xad, 0x18, 0xb8, 0x6b,
+	0xc8, 0x96, 0x3f, 0x07, 0x5f, 0x27, 0x2b, 0xcc, 0x51, 0x9c, 0xda, 0xd6, 0xec, 0xc1, 0xef, 0x7d,
+	0x78, 0x6e, 0x23, 0x44, 0xa6, 0x2a, 0x71, 0xe1, 0x24, 0x79, 0xb0, 0x5c, 0xd3, 0x5f, 0x5f, 0xc3,
+	0xde, 0xc5, 0x77, 0xf2, 0xf7, 0x76, 0xfe, 0x04, 0xe8, 0xc7, 0x7a, 0x83, 0x2e, 0xdd, 0xbd, 0x97,
+	0xf7, 0xa7, 0xf6, 0xd1, 0xa6, 0x07, 0xd1, 0x0a, 0xd2, 0xc9, 0xfc, 0x11, 0xf8, 0x6f, 0x30, 0x4b,
+	0x57, 0xc6, 0x85, 0xa5, 0xf2, 0x40, 0xfc, 0x21, 0x78, 0x52, 0x55, 0xc5, 0xd2, 0xe5, 0xa5, 0xb2,
+	0x05, 0xdb, 0x5d, 0x98, 0xc8, 0x60, 0x9b, 0x51, 0xb6, 0xc0, 0x9f, 0x82, 0x37, 0x2f, 0x95, 0xba,
+	0x15, 0xde, 0xb8, 0x3f, 0x09, 0x8e, 0xdf, 0xea, 0xbc, 0xb6, 0x6c, 0x75, 0x7e, 0x05, 0xc1, 0x3b,
+	0x95, 0x7c, 0x92, 0xb8, 0xc6, 0x48, 0xa3, 0x0b, 0xfe, 0x4f, 0x7b, 0xd7, 0x75, 0x4d, 0x3f, 0x7f,
+	0x09, 0x7b, 0xcf, 0x4a, 0x08, 0x3a, 0xc7, 0xf3, 0x01, 0xf4, 0x3f, 0xa8, 0x0d, 0xeb, 0xf1, 0x73,
+	0x08, 0xdc, 0x69, 0x37, 0xab, 0xa8, 0x48, 0x91, 0x11, 0x7e, 0x0a, 0xd4, 0x4e, 0xb3, 0x13, 0x0e,
+	0xe0, 0x2f, 0x70, 0x8d, 0x89, 0x61, 0x7d, 0x5b, 0xdf, 0xa8, 0x3c, 0xcf, 0x0c, 0xa3, 0x76, 0xa4,
+	0xb3, 0x9f, 0x79, 0x56, 0x7c, 0x8d, 0x49, 0xb6, 0x44, 0xe6, 0xdb, 0x5a, 0xa2, 0xae, 0x8b, 0x84,
+	0x0d, 0x66, 0xc3, 0xbb, 0x66, 0x44, 0xbe, 0x35, 0x23, 0xf2, 0xb3, 0x19, 0x91, 0xd8, 0x77, 0x3f,
+	0xd2, 0xd5, 0x9f, 0x01, 0x00, 0xf1, 0x64, 0xba, 0x57, 0x8e, 0x02, 0x00, 0x00,
 }
 
 func (m *SignedProto) Marshal() (dAtA []byte, err error) {
@@ -306,6 +306,16 @@ func (m *SignedProto) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i -= len(m.XXX_unrecognized)
 		copy(dAtA[i:], m.XXX_unrecognized)
 	}
+	if m.Scheme != 0 {
+		i = encodeVarintMessage(dAtA, i, uint64(m.Scheme))
+		i--
+		dAtA[i] = 0x40
+	}
+	if m.V != 0 {
+		i = encodeVarintMessage(dAtA, i, uint64(m.V))
+		i--
+		dAtA[i] = 0x38
+	}
 	if len(m.S) > 0 {
 		i -= len(m.S)
 		copy(dAtA[i:], m.S)
@@ -466,6 +476,12 @@ func (m *SignedProto) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovMessage(uint64(l))
 	}
+	if m.V != 0 {
+		n += 1 + sovMessage(uint64(m.V))
+	}
+	if m.Scheme != 0 {
+		n += 1 + sovMessage(uint64(m.Scheme))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -729,6 +745,44 @@ func (m *SignedProto) Unmarshal(dAtA []byte) error {
 				m.S = []byte{}
 			}
 			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field V", wireType)
+			}
+			m.V = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.V |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Scheme", wireType)
+			}
+			m.Scheme = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Scheme |= SignatureScheme(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMessage(dAtA[iNdEx:])
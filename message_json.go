@@ -0,0 +1,155 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/Sperax/bdls/crypto/blake2b"
+	proto "github.com/gogo/protobuf/proto"
+)
+
+// hexBytes is a byte slice encoded as hex string in JSON
+type hexBytes []byte
+
+// MarshalText implements encoding.TextMarshaler
+func (b hexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (b *hexBytes) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*b = nil
+		return nil
+	}
+	bts, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*b = bts
+	return nil
+}
+
+// jsonMessage is the JSON representation of Message
+type jsonMessage struct {
+	Type   string   `json:"type"`
+	Height uint64   `json:"height"`
+	Round  uint64   `json:"round"`
+	State  hexBytes `json:"state,omitempty"`
+	// StateHash is informative, and ignored while decoding
+	StateHash   hexBytes       `json:"stateHash,omitempty"`
+	Proof       []*SignedProto `json:"proof,omitempty"`
+	LockRelease *SignedProto   `json:"lockRelease,omitempty"`
+}
+
+// jsonSignedProto is the JSON representation of SignedProto
+type jsonSignedProto struct {
+	Version uint32       `json:"version"`
+	Message *jsonMessage `json:"message"`
+	X       hexBytes     `json:"x,omitempty"`
+	Y       hexBytes     `json:"y,omitempty"`
+	R       hexBytes     `json:"r,omitempty"`
+	S       hexBytes     `json:"s,omitempty"`
+	V       uint32       `json:"v,omitempty"`
+	Scheme  uint32       `json:"scheme,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, the public key and signature are
+// encoded as hex strings, and the enclosed Message is decoded and rendered
+// with its type name, height, round, state and the blake2b-256 hash of state.
+func (sp *SignedProto) MarshalJSON() ([]byte, error) {
+	m := new(Message)
+	if err := proto.Unmarshal(sp.Message, m); err != nil {
+		return nil, err
+	}
+
+	jm := &jsonMessage{
+		Type:        m.Type.String(),
+		Height:      m.Height,
+		Round:       m.Round,
+		State:       m.State,
+		Proof:       m.Proof,
+		LockRelease: m.LockRelease,
+	}
+	if len(m.State) > 0 {
+		hash := blake2b.Sum256(m.State)
+		jm.StateHash = hash[:]
+	}
+
+	js := &jsonSignedProto{Version: sp.Version, Message: jm, R: sp.R, S: sp.S, V: sp.V, Scheme: uint32(sp.Scheme)}
+	if sp.X != (PubKeyAxis{}) || sp.Y != (PubKeyAxis{}) {
+		js.X = sp.X[:]
+		js.Y = sp.Y[:]
+	}
+	return json.Marshal(js)
+}
+
+// UnmarshalJSON implements json.Unmarshaler to decode the output of MarshalJSON,
+// the enclosed Message is re-encoded, so the signature remains valid for messages
+// encoded by this library.
+func (sp *SignedProto) UnmarshalJSON(data []byte) error {
+	js := new(jsonSignedProto)
+	if err := json.Unmarshal(data, js); err != nil {
+		return err
+	}
+
+	*sp = SignedProto{Version: js.Version, R: js.R, S: js.S, V: js.V, Scheme: SignatureScheme(js.Scheme)}
+	if err := sp.X.Unmarshal(js.X); err != nil {
+		return err
+	}
+	if err := sp.Y.Unmarshal(js.Y); err != nil {
+		return err
+	}
+
+	if js.Message != nil {
+		typ, ok := MessageType_value[js.Message.Type]
+		if !ok {
+			return ErrMessageUnknownMessageType
+		}
+
+		m := &Message{
+			Type:        MessageType(typ),
+			Height:      js.Message.Height,
+			Round:       js.Message.Round,
+			State:       js.Message.State,
+			Proof:       js.Message.Proof,
+			LockRelease: js.Message.LockRelease,
+		}
+		bts, err := proto.Marshal(m)
+		if err != nil {
+			return err
+		}
+		sp.Message = bts
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// deterministicKey derives a private key from a fixed scalar
+func deterministicKey(d int64) *ecdsa.PrivateKey {
+	privateKey := new(ecdsa.PrivateKey)
+	privateKey.Curve = S256Curve
+	privateKey.D = big.NewInt(d)
+	privateKey.X, privateKey.Y = S256Curve.ScalarBaseMult(privateKey.D.Bytes())
+	return privateKey
+}
+
+func TestSignedProtoJSONGolden(t *testing.T) {
+	// a <decide> message with 2 <commit> proofs, signed deterministically
+	var proofs []*SignedProto
+	for i := int64(1); i <= 2; i++ {
+		commit := &Message{Type: MessageType_Commit, Height: 10, Round: 2, State: []byte("state")}
+		sp := new(SignedProto)
+		sp.Version = ProtocolVersion
+		sp.SignDeterministic(commit, deterministicKey(i))
+		proofs = append(proofs, sp)
+	}
+	decide := &Message{Type: MessageType_Decide, Height: 10, Round: 2, State: []byte("state"), Proof: proofs}
+	sp := new(SignedProto)
+	sp.Version = ProtocolVersion
+	sp.SignDeterministic(decide, deterministicKey(3))
+
+	bts, err := json.MarshalIndent(sp, "", "  ")
+	assert.Nil(t, err)
+
+	golden := filepath.Join("testdata", "decide.golden.json")
+	if *updateGolden {
+		assert.Nil(t, ioutil.WriteFile(golden, bts, 0644))
+	}
+	expected, err := ioutil.ReadFile(golden)
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), string(bts))
+
+	// round trip
+	decoded := new(SignedProto)
+	assert.Nil(t, json.Unmarshal(expected, decoded))
+	assert.Equal(t, sp.Bytes(), decoded.Bytes())
+	assert.True(t, decoded.Verify(S256Curve))
+
+	// unknown message type
+	assert.Equal(t, ErrMessageUnknownMessageType, json.Unmarshal([]byte(`{"message":{"type":"Unknown"}}`), decoded))
+}
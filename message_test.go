@@ -3,13 +3,22 @@ package bdls
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"math/big"
 	mrand "math/rand"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Sperax/bdls/crypto/blake2b"
+	"github.com/Sperax/bdls/crypto/btcec"
 	proto "github.com/gogo/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 )
@@ -48,7 +57,7 @@ func createRoundChangeMessageSigner(t testing.TB, height uint64, round uint64, s
 }
 
 // createCommitMessage generates a random valid <commit> message
-func createCommitMessageSigner(t *testing.T, height uint64, round uint64, state State, signer *ecdsa.PrivateKey) (*Message, *SignedProto, *ecdsa.PrivateKey) {
+func createCommitMessageSigner(t testing.TB, height uint64, round uint64, state State, signer *ecdsa.PrivateKey) (*Message, *SignedProto, *ecdsa.PrivateKey) {
 	// <roundchange>
 	rc := new(Message)
 	rc.Type = MessageType_Commit
@@ -63,7 +72,7 @@ func createCommitMessageSigner(t *testing.T, height uint64, round uint64, state
 }
 
 // createCommitMessage generates a random valid <commit> message
-func createCommitMessage(t *testing.T, height uint64, round uint64, state State) (*Message, *SignedProto, *ecdsa.PrivateKey) {
+func createCommitMessage(t testing.TB, height uint64, round uint64, state State) (*Message, *SignedProto, *ecdsa.PrivateKey) {
 	// key generation
 	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
 	assert.Nil(t, err)
@@ -75,6 +84,8 @@ func createLockReleaseMessage(t *testing.T, numProofs int, height uint64, round
 	// <lock-release> message
 	lockrelease := new(Message)
 	lockrelease.Type = MessageType_LockRelease
+	lockrelease.Height = height
+	lockrelease.Round = round
 	lockrelease.LockRelease = signed
 
 	signedlockrelease := new(SignedProto)
@@ -101,11 +112,10 @@ func createLockMessageState(t *testing.T, numProofs int, state []byte, height ui
 		// <roundchange>
 		var signedRc *SignedProto
 		var proofKey *ecdsa.PrivateKey
-		if i >= valid { // only provide valid proofs
-			randstate := make([]byte, 1024)
-			_, err := io.ReadFull(rand.Reader, randstate)
-			assert.Nil(t, err)
-			_, signedRc, proofKey = createRoundChangeMessageState(t, proofHeight, proofRound, randstate)
+		if i >= valid { // participants without proofs
+			proofKey = mustGenerateKey(t)
+			publicKeys = append(publicKeys, &proofKey.PublicKey)
+			continue
 		} else {
 			if i == 0 { // signed the first proof with message's key
 				_, signedRc, proofKey = createRoundChangeMessageSigner(t, proofHeight, proofRound, state, privateKey)
@@ -124,8 +134,8 @@ func createLockMessageState(t *testing.T, numProofs int, state []byte, height ui
 
 }
 
-// createLockMessage generates a valid lock message, proofs are generated based on quorum,
-// the first 2t+1 roundchange proposals are the same
+// createLockMessage generates a valid lock message, with 2t+1 roundchange proofs to the
+// proposed state from the first 2t+1 of numProofs participants
 func createLockMessage(t *testing.T, numProofs int, height uint64, round uint64, proofHeight uint64, proofRound uint64) (*Message, *SignedProto, *ecdsa.PrivateKey, []*ecdsa.PublicKey) {
 	state := make([]byte, 1024)
 	_, err := io.ReadFull(rand.Reader, state)
@@ -180,9 +190,9 @@ func createSelectMessage(t *testing.T, numProofs int, height uint64, round uint6
 	return m, signed, privateKey, publicKeys
 }
 
-// createDecideMessage creates a valid <decide> message, and generate <commit> proofs based on quorum,
-// the first 2t+1 roundchange proposals are the same
-func createDecideMessage(t *testing.T, numProofs int, height uint64, round uint64, proofHeight uint64, proofRound uint64) (*Message, *SignedProto, *ecdsa.PrivateKey, []*ecdsa.PublicKey) {
+// createDecideMessage creates a valid <decide> message, with 2t+1 <commit> proofs to the
+// decided state from the first 2t+1 of numProofs participants
+func createDecideMessage(t testing.TB, numProofs int, height uint64, round uint64, proofHeight uint64, proofRound uint64) (*Message, *SignedProto, *ecdsa.PrivateKey, []*ecdsa.PublicKey) {
 	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
 	assert.Nil(t, err)
 	valid := 2*((numProofs-1)/3) + 1
@@ -202,11 +212,11 @@ func createDecideMessage(t *testing.T, numProofs int, height uint64, round uint6
 		// <roundchange>
 		var signedRc *SignedProto
 		var proofKey *ecdsa.PrivateKey
-		if i >= valid { // only provide valid proofs
-			randstate := make([]byte, 1024)
-			_, err := io.ReadFull(rand.Reader, randstate)
+		if i >= valid { // participants without proofs
+			proofKey, err = ecdsa.GenerateKey(S256Curve, rand.Reader)
 			assert.Nil(t, err)
-			_, signedRc, proofKey = createCommitMessage(t, proofHeight, proofRound, randstate)
+			publicKeys = append(publicKeys, &proofKey.PublicKey)
+			continue
 		} else {
 			if i == 0 {
 				_, signedRc, proofKey = createCommitMessageSigner(t, proofHeight, proofRound, state, privateKey)
@@ -312,6 +322,32 @@ func TestVerifyMessageUnknownVersion(t *testing.T) {
 	assert.Equal(t, ErrMessageVersion, err)
 }
 
+func TestAcceptedVersions(t *testing.T) {
+	_, sp, key := createRoundChangeMessageState(t, 1, 0, []byte("state"))
+	consensus := createConsensus(t, 0, 0, []*ecdsa.PublicKey{&key.PublicKey})
+
+	// signed under version N, only N+1 is accepted
+	consensus.acceptedVersions = []uint32{ProtocolVersion + 1}
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrProtocolVersion, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, ErrProtocolVersion, consensus.Sync(sp))
+
+	// signed under version N+1
+	sp.Version = ProtocolVersion + 1
+	sp.R, sp.S, err = NewECDSASigner(key).Sign(sp.HashWith(DefaultHasher))
+	assert.Nil(t, err)
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+
+	// both are accepted while upgrading
+	consensus.acceptedVersions = []uint32{ProtocolVersion, ProtocolVersion + 1}
+	assert.True(t, consensus.acceptVersion(ProtocolVersion))
+	assert.True(t, consensus.acceptVersion(ProtocolVersion+1))
+	assert.False(t, consensus.acceptVersion(ProtocolVersion+2))
+}
+
 func TestVerifyMessageUnknownType(t *testing.T) {
 	// signer
 	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
@@ -530,7 +566,7 @@ func TestVerifyLockMessageProofInsufficient(t *testing.T) {
 	consensus.SetLeader(&privateKey.PublicKey)
 
 	// only keep 20 participants,by removing the consensus's own public key
-	consensus.participants = consensus.participants[1:]
+	consensus.setParticipants(consensus.participants[1:])
 	assert.Equal(t, quorum, len(consensus.participants))
 
 	// random remove a valid proof from the first 2t+1(B)
@@ -547,6 +583,92 @@ func TestVerifyLockMessageProofInsufficient(t *testing.T) {
 	assert.Equal(t, ErrLockProofInsufficient, err)
 }
 
+func TestVerifyLockMessageProofStateMismatch(t *testing.T) {
+	quorum := 20
+	m, sp, privateKey, proofKeys := createLockMessage(t, quorum, 1, 0, 1, 0)
+
+	// splice a <roundchange> endorsing another state into a quorum
+	_, rc, key := createRoundChangeMessageState(t, 1, 0, State("other"))
+	m.Proof = append(m.Proof, rc)
+	sp.Sign(m, privateKey)
+	consensus := createConsensus(t, 0, 0, append(proofKeys, &key.PublicKey))
+	consensus.SetLeader(&privateKey.PublicKey)
+	// remove the consensus's own public key to keep the quorum of 2t+1
+	consensus.setParticipants(consensus.participants[1:])
+	assert.Equal(t, ErrLockProofStateMismatch, consensus.verifyLockMessage(m, sp))
+
+	// <roundchange> without state
+	_, m.Proof[len(m.Proof)-1], _ = createRoundChangeMessageSigner(t, 1, 0, nil, key)
+	sp.Sign(m, privateKey)
+	assert.Equal(t, ErrLockProofStateMismatch, consensus.verifyLockMessage(m, sp))
+
+	m.Proof = m.Proof[:len(m.Proof)-1]
+	sp.Sign(m, privateKey)
+	assert.Nil(t, consensus.verifyLockMessage(m, sp))
+}
+
+func TestVerifyLockMessageWeights(t *testing.T) {
+	quorum := 20
+	m, sp, privateKey, proofKeys := createLockMessage(t, quorum, 1, 0, 1, 0)
+	consensus := createConsensus(t, 0, 0, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.setParticipants(consensus.participants[1:])
+
+	// the first 2t+1 proofs are to B'
+	valid := 2*((quorum-1)/3) + 1
+	setWeights := func(validWeight uint64, otherWeight uint64) {
+		consensus.weights = make(map[Identity]uint64)
+		for k := range proofKeys {
+			if k < valid {
+				consensus.weights[DefaultPubKeyToIdentity(proofKeys[k])] = validWeight
+			} else {
+				consensus.weights[DefaultPubKeyToIdentity(proofKeys[k])] = otherWeight
+			}
+		}
+		consensus.setParticipants(consensus.participants)
+	}
+
+	// 2t+1 participants, but not more than 2/3 stake
+	setWeights(1, 10)
+	assert.Equal(t, ErrLockProofInsufficient, consensus.verifyLockMessage(m, sp))
+
+	// 2t+1 participants with more than 2/3 stake
+	setWeights(10, 1)
+	assert.Nil(t, consensus.verifyLockMessage(m, sp))
+
+	// fall back to equal weighting
+	consensus.weights = nil
+	consensus.setParticipants(consensus.participants)
+	assert.Nil(t, consensus.verifyLockMessage(m, sp))
+}
+
+func TestHasQuorum(t *testing.T) {
+	consensus := createConsensus(t, 0, 0, nil)
+	ids := make([]Identity, 4)
+	for k := range ids {
+		ids[k][0] = byte(k)
+	}
+
+	// equal weighting, 2*t+1
+	consensus.setParticipants(ids)
+	assert.False(t, consensus.hasQuorum(2))
+	assert.True(t, consensus.hasQuorum(3))
+
+	// more than 2/3 of total weight
+	consensus.weights = map[Identity]uint64{ids[0]: 1, ids[1]: 1, ids[2]: 1, ids[3]: 3}
+	consensus.setParticipants(ids)
+	assert.Equal(t, uint64(6), consensus.totalWeight)
+	assert.False(t, consensus.hasQuorum(4))
+	assert.True(t, consensus.hasQuorum(5))
+
+	// no overflow on large weights
+	max := ^uint64(0) / 4
+	consensus.weights = map[Identity]uint64{ids[0]: max, ids[1]: max, ids[2]: max, ids[3]: max}
+	consensus.setParticipants(ids)
+	assert.False(t, consensus.hasQuorum(2*max))
+	assert.True(t, consensus.hasQuorum(3*max))
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 //
 // <select> message related tests
@@ -698,7 +820,7 @@ func TestVerifySelectMessageProofInsufficient(t *testing.T) {
 	consensus.SetLeader(&privateKey.PublicKey)
 
 	// only keep 20 participants,by removing the consensus's own public key
-	consensus.participants = consensus.participants[1:]
+	consensus.setParticipants(consensus.participants[1:])
 	assert.Equal(t, quorum, len(consensus.participants))
 
 	// only keep 2t messages which is less than 2t+1
@@ -750,7 +872,7 @@ func TestVerifySelectMessageProofExceed(t *testing.T) {
 
 	valid := 2*((quorum-1)/3) + 1
 	// clear first 2t+1 participants and messages
-	consensus.participants = consensus.participants[valid:]
+	consensus.setParticipants(consensus.participants[valid:])
 	m.Proof = m.Proof[valid:]
 
 	// append new 2t+1 proof to B' and set new participants
@@ -779,7 +901,7 @@ func TestVerifyLockReleaseMessageValid(t *testing.T) {
 	consensus := createConsensus(t, 0, 0, proofKeys)
 
 	// remove consensus' publickey to keep quorum participants
-	consensus.participants = consensus.participants[1:]
+	consensus.setParticipants(consensus.participants[1:])
 	assert.Equal(t, quorum, len(consensus.participants))
 
 	// set status
@@ -795,7 +917,7 @@ func TestVerifyLockReleaseMessageStatusInValid(t *testing.T) {
 	consensus := createConsensus(t, 0, 0, proofKeys)
 
 	// remove consensus' public key to keep quorum participants
-	consensus.participants = consensus.participants[1:]
+	consensus.setParticipants(consensus.participants[1:])
 	assert.Equal(t, quorum, len(consensus.participants))
 
 	msg, err := consensus.verifyLockReleaseMessage(sp)
@@ -1042,6 +1164,82 @@ func TestVerifyDecideMessageProofRound(t *testing.T) {
 	assert.Equal(t, ErrDecideProofRoundMismatch, err)
 }
 
+func TestReceiveDecideSplicedProof(t *testing.T) {
+	m, sp, privateKey, proofKeys := createDecideMessage(t, 20, 1, 0, 1, 0)
+	consensus := createConsensus(t, 0, 0, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.AddParticipant(&privateKey.PublicKey)
+
+	// a proof from another round verifies individually, but must not be
+	// spliced into the <decide> message
+	_, signedProof, proofKey := createCommitMessage(t, 1, 1, m.State)
+	consensus.AddParticipant(&proofKey.PublicKey)
+	assert.Nil(t, consensus.verifyMessageInto(signedProof, new(Message)))
+
+	i := mrand.Int() % len(m.Proof)
+	original := m.Proof[i]
+	m.Proof[i] = signedProof
+	sp.Sign(m, privateKey)
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrDecideProofRoundMismatch, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, uint64(0), consensus.latestHeight)
+
+	// the same with a proof from another height
+	_, signedProof, proofKey = createCommitMessage(t, 2, 0, m.State)
+	consensus.AddParticipant(&proofKey.PublicKey)
+	m.Proof[i] = signedProof
+	sp.Sign(m, privateKey)
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrDecideProofHeightMismatch, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, uint64(0), consensus.latestHeight)
+
+	// the untouched message decides
+	consensus = createConsensus(t, 0, 0, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.AddParticipant(&privateKey.PublicKey)
+	m.Proof[i] = original
+	sp.Sign(m, privateKey)
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, uint64(1), consensus.latestHeight)
+}
+
+func TestReceiveLockReleaseSplicedLock(t *testing.T) {
+	m, sp, privateKey, proofKeys := createLockReleaseMessage(t, 20, 1, 10, 1, 10)
+	consensus := createConsensus(t, 0, 1, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.AddParticipant(&privateKey.PublicKey)
+	consensus.currentRound.Stage = stageLockRelease
+
+	// the embedded <lock> is from a later round
+	m.Round = 9
+	sp.Sign(m, privateKey)
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrLockReleaseRoundMismatch, consensus.ReceiveMessage(bts, time.Now()))
+
+	// the embedded <lock> is from another height
+	m.Round = 10
+	m.Height = 0
+	sp.Sign(m, privateKey)
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrLockReleaseHeightMismatch, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, 0, len(consensus.locks))
+
+	// a <lock> from an earlier round is accepted
+	m.Round = 11
+	m.Height = 1
+	sp.Sign(m, privateKey)
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, 1, len(consensus.locks))
+}
+
 func TestVerifyDecideMessageProofUnknownParticipant(t *testing.T) {
 	m, sp, privateKey, proofKeys := createDecideMessage(t, 20, 1, 0, 1, 0)
 	consensus := createConsensus(t, 0, 0, proofKeys)
@@ -1076,6 +1274,25 @@ func TestVerifyDecideMessageProofSignature(t *testing.T) {
 	assert.Equal(t, ErrMessageSignature, err)
 }
 
+func TestVerifyDecideMessageProofStateMismatch(t *testing.T) {
+	quorum := 20
+	m, sp, privateKey, proofKeys := createDecideMessage(t, quorum, 1, 0, 1, 0)
+
+	// splice a <commit> to another state into a quorum
+	_, commit, key := createCommitMessage(t, 1, 0, State("other"))
+	m.Proof = append(m.Proof, commit)
+	sp.Sign(m, privateKey)
+	consensus := createConsensus(t, 0, 0, append(proofKeys, &key.PublicKey))
+	consensus.SetLeader(&privateKey.PublicKey)
+	// remove the consensus's own public key to keep the quorum of 2t+1
+	consensus.setParticipants(consensus.participants[1:])
+	assert.Equal(t, ErrDecideProofStateMismatch, consensus.verifyDecideMessage(m, sp))
+
+	m.Proof = m.Proof[:len(m.Proof)-1]
+	sp.Sign(m, privateKey)
+	assert.Nil(t, consensus.verifyDecideMessage(m, sp))
+}
+
 func TestVerifyDecideMessageProofInsufficient(t *testing.T) {
 	quorum := 20
 	m, sp, privateKey, proofKeys := createDecideMessage(t, quorum, 1, 0, 1, 0)
@@ -1103,6 +1320,55 @@ func BenchmarkSecp256k1Verify(b *testing.B) {
 	}
 }
 
+func BenchmarkSign(b *testing.B) {
+	privateKey, _ := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	m := &Message{Type: MessageType_RoundChange, Height: 1, State: make([]byte, 1024)}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sp := new(SignedProto)
+		sp.Sign(m, privateKey)
+	}
+}
+
+func BenchmarkVerifyDecideMessage(b *testing.B) {
+	m, sp, privateKey, proofKeys := createDecideMessage(b, 20, 50, 3, 50, 3)
+	consensus := createConsensus(b, 1, 0, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	assert.Nil(b, consensus.verifyDecideMessage(m, sp))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		consensus.verifyDecideMessage(m, sp)
+	}
+}
+
+func TestMessageString(t *testing.T) {
+	assert.Equal(t, "RoundChange", MessageType_RoundChange.String())
+	assert.Equal(t, "Lock", MessageType_Lock.String())
+	assert.Equal(t, "Select", MessageType_Select.String())
+	assert.Equal(t, "Commit", MessageType_Commit.String())
+	assert.Equal(t, "Decide", MessageType_Decide.String())
+	assert.Equal(t, "Nop", MessageType_Nop.String())
+
+	m := &Message{Type: MessageType_Commit, Height: 10, Round: 2, State: []byte("state")}
+	hash := blake2b.Sum256(m.State)
+	assert.Equal(t, fmt.Sprintf("Commit height=10 round=2 state=%x", hash[:4]), m.String())
+	assert.Equal(t, m.String(), fmt.Sprint(m))
+
+	m.State = nil
+	assert.Equal(t, "Commit height=10 round=2 state=nil", m.String())
+
+	var nilMessage *Message
+	assert.Equal(t, "<nil>", nilMessage.String())
+
+	// only the returned string is allocated
+	m.State = []byte("state")
+	assert.Equal(t, float64(1), testing.AllocsPerRun(100, func() { _ = m.String() }))
+}
+
 func TestMessageMarshalJson(t *testing.T) {
 	_, sp, _, _ := createDecideMessage(t, 10, 1, 0, 1, 0)
 	bts, err := json.Marshal(sp)
@@ -1113,3 +1379,873 @@ func TestMessageMarshalJson(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, sp, sp2)
 }
+
+func TestVerifyBatch(t *testing.T) {
+	for _, n := range []int{minParallelBatch - 1, 100} {
+		var msgs []*SignedProto
+		for i := 0; i < n; i++ {
+			_, sp, _ := createRoundChangeMessage(t, 1, 0)
+			msgs = append(msgs, sp)
+		}
+
+		valid, err := VerifyBatch(msgs)
+		assert.Nil(t, err)
+		assert.Equal(t, n, len(valid))
+		for k := range valid {
+			assert.True(t, valid[k])
+		}
+
+		// corrupt one signature and nil another
+		msgs[1].Message = append([]byte{}, msgs[1].Message...)
+		msgs[1].Message[0]++
+		msgs[n-1] = nil
+		valid, err = VerifyBatch(msgs)
+		assert.Equal(t, ErrMessageSignature, err)
+		for k := range valid {
+			if k == 1 || k == n-1 {
+				assert.False(t, valid[k])
+			} else {
+				assert.True(t, valid[k])
+			}
+		}
+	}
+}
+
+func TestVerifyBatchSchemes(t *testing.T) {
+	privateKey := mustGenerateKey(t)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	var msgs []*SignedProto
+	for i := 0; i < 2*minParallelBatch; i++ {
+		m := &Message{Type: MessageType_RoundChange, Height: uint64(i), State: []byte("state")}
+		sp := new(SignedProto)
+		switch i % 3 {
+		case 0:
+			// compact, with the public key to be recovered
+			assert.Nil(t, sp.SignCompact(m, privateKey, nil))
+			bts, err := sp.Marshal()
+			assert.Nil(t, err)
+			sp = new(SignedProto)
+			assert.Nil(t, sp.Unmarshal(bts))
+			assert.Equal(t, PubKeyAxis{}, sp.X)
+		case 1:
+			assert.Nil(t, sp.SignWithSigner(m, NewEd25519Signer(edKey), nil))
+		default:
+			sp.Sign(m, privateKey)
+		}
+		msgs = append(msgs, sp)
+	}
+	// the same message twice
+	msgs = append(msgs, msgs[0])
+
+	for _, batch := range [][]*SignedProto{msgs[:3], msgs} {
+		valid, err := VerifyBatch(batch)
+		assert.Nil(t, err)
+		for k := range valid {
+			assert.True(t, valid[k])
+		}
+	}
+
+	// a corrupted compact and ed25519 message
+	msgs[3].R[0] ^= 0xff
+	msgs[4].S[0] ^= 0xff
+	valid, err := VerifyBatch(msgs)
+	assert.Equal(t, ErrMessageSignature, err)
+	for k := range valid {
+		assert.Equal(t, k != 3 && k != 4, valid[k])
+	}
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	privateKey, _ := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	var msgs []*SignedProto
+	for i := 0; i < 256; i++ {
+		_, sp, _ := createRoundChangeMessageSigner(b, 0, 0, nil, privateKey)
+		msgs = append(msgs, sp)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		VerifyBatch(msgs)
+	}
+}
+
+func TestVerifyHighS(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		_, sp, _ := createRoundChangeMessage(t, 1, 0)
+		assert.True(t, sp.Verify(S256Curve))
+
+		// signature must be in canonical low-S form
+		S := new(big.Int).SetBytes(sp.S)
+		halfN := new(big.Int).Rsh(S256Curve.Params().N, 1)
+		assert.True(t, S.Cmp(halfN) <= 0)
+
+		// the complement (r, N-s) is also a valid ecdsa signature, but must be rejected
+		sp.S = new(big.Int).Sub(S256Curve.Params().N, S).Bytes()
+		assert.False(t, sp.Verify(S256Curve))
+	}
+}
+
+func TestSignDeterministic(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	m, _, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+
+	sp1 := new(SignedProto)
+	sp1.SignDeterministic(m, privateKey)
+	sp2 := new(SignedProto)
+	sp2.SignDeterministic(m, privateKey)
+	assert.True(t, sp1.Verify(S256Curve))
+	assert.Equal(t, sp1.R, sp2.R)
+	assert.Equal(t, sp1.S, sp2.S)
+
+	// different message must have a different signature
+	m.Round++
+	sp3 := new(SignedProto)
+	sp3.SignDeterministic(m, privateKey)
+	assert.True(t, sp3.Verify(S256Curve))
+	assert.NotEqual(t, sp1.R, sp3.R)
+}
+
+func TestPubKeyAxisMarshalJson(t *testing.T) {
+	_, sp, _ := createRoundChangeMessage(t, 1, 0)
+	bts, err := json.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Contains(t, string(bts), hex.EncodeToString(sp.X[:]))
+
+	sp2 := new(SignedProto)
+	err = json.Unmarshal(bts, sp2)
+	assert.Nil(t, err)
+	assert.Equal(t, sp.X, sp2.X)
+	assert.Equal(t, sp.Y, sp2.Y)
+	assert.True(t, sp2.Verify(S256Curve))
+
+	// malformed axis
+	var axis PubKeyAxis
+	assert.NotNil(t, axis.UnmarshalText([]byte("zz")))
+	assert.Equal(t, ErrPubKey, axis.UnmarshalText([]byte(hex.EncodeToString(make([]byte, SizeAxis+2)))))
+}
+
+func TestVerifyError(t *testing.T) {
+	_, sp, _ := createRoundChangeMessage(t, 1, 0)
+	assert.Nil(t, sp.VerifyError(S256Curve))
+
+	// signature mismatch
+	bad := *sp
+	bad.Message = append([]byte{}, sp.Message...)
+	bad.Message[0]++
+	assert.Equal(t, ErrSigMismatch, bad.VerifyError(S256Curve))
+	assert.False(t, bad.Verify(S256Curve))
+
+	// zero r or s
+	bad = *sp
+	bad.R = nil
+	assert.Equal(t, ErrZeroRS, bad.VerifyError(S256Curve))
+
+	// high-S
+	bad = *sp
+	bad.S = new(big.Int).Sub(S256Curve.Params().N, new(big.Int).SetBytes(sp.S)).Bytes()
+	assert.Equal(t, ErrHighS, bad.VerifyError(S256Curve))
+
+	// malformed public key
+	bad = *sp
+	bad.X = PubKeyAxis{}
+	bad.Y = PubKeyAxis{}
+	assert.Equal(t, ErrBadPubKey, bad.VerifyError(S256Curve))
+	for k := range bad.X {
+		bad.X[k] = 0xff
+	}
+	assert.Equal(t, ErrBadPubKey, bad.VerifyError(S256Curve))
+}
+
+func TestVerifyOffCurve(t *testing.T) {
+	_, sp, _ := createRoundChangeMessage(t, 1, 0)
+	assert.True(t, sp.Verify(S256Curve))
+
+	// (X, Y+1) is within the field, but not on the curve
+	pub := sp.PublicKey(S256Curve)
+	Y := new(big.Int).Add(pub.Y, big.NewInt(1))
+	Y.Mod(Y, S256Curve.Params().P)
+	assert.False(t, S256Curve.IsOnCurve(pub.X, Y))
+
+	bad := *sp
+	assert.Nil(t, bad.Y.Unmarshal(Y.Bytes()))
+	assert.False(t, bad.Verify(S256Curve))
+	assert.Equal(t, ErrBadPubKey, bad.VerifyError(S256Curve))
+	assert.Equal(t, ErrBadPubKey, NewECDSAVerifier(S256Curve).Verify(bad.X, bad.Y, bad.Hash(), bad.R, bad.S))
+
+	// (X, 0) has no point on secp256k1
+	bad = *sp
+	bad.Y = PubKeyAxis{}
+	assert.False(t, bad.Verify(S256Curve))
+	assert.Equal(t, ErrBadPubKey, bad.VerifyError(S256Curve))
+}
+
+func TestVerifyRSRange(t *testing.T) {
+	_, sp, _ := createRoundChangeMessage(t, 1, 0)
+	N := S256Curve.Params().N
+	overN := new(big.Int).Add(N, big.NewInt(1)).Bytes()
+
+	cases := []struct {
+		R   []byte
+		S   []byte
+		err error
+	}{
+		{nil, sp.S, ErrZeroRS},
+		{sp.R, nil, ErrZeroRS},
+		{[]byte{0, 0, 0}, sp.S, ErrZeroRS},
+		{sp.R, make([]byte, 32), ErrZeroRS},
+		{N.Bytes(), sp.S, ErrRSOutOfRange},
+		{sp.R, N.Bytes(), ErrRSOutOfRange},
+		{overN, sp.S, ErrRSOutOfRange},
+		{sp.R, overN, ErrRSOutOfRange},
+	}
+
+	for _, c := range cases {
+		bad := *sp
+		bad.R = c.R
+		bad.S = c.S
+		assert.Equal(t, c.err, bad.VerifyError(S256Curve))
+		assert.False(t, bad.Verify(S256Curve))
+	}
+}
+
+func TestSignSafe(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	m, _, _ := createRoundChangeMessageSigner(t, 1, 0, nil, privateKey)
+
+	sp := new(SignedProto)
+	assert.Nil(t, sp.SignSafe(m, privateKey))
+	assert.True(t, sp.Verify(S256Curve))
+
+	// oversized public key axis
+	badKey := *privateKey
+	badKey.PublicKey.X = new(big.Int).Lsh(big.NewInt(1), 8*SizeAxis)
+	assert.Equal(t, ErrPubKey, new(SignedProto).SignSafe(m, &badKey))
+	badKey = *privateKey
+	badKey.PublicKey.Y = new(big.Int).Lsh(big.NewInt(1), 8*SizeAxis)
+	assert.Equal(t, ErrPubKey, new(SignedProto).SignSafe(m, &badKey))
+
+	// Sign keeps panicking for backward compatibility
+	assert.Panics(t, func() { new(SignedProto).Sign(m, &badKey) })
+}
+
+func TestHasher(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	m, sp, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+
+	// the default hasher keeps the digest
+	assert.Equal(t, sp.Hash(), sp.HashWith(nil))
+	assert.Equal(t, sp.Hash(), sp.HashWith(DefaultHasher))
+
+	sha := &Hasher{Name: "sha256", New: sha256.New}
+	assert.NotEqual(t, sp.Hash(), sp.HashWith(sha))
+
+	// signatures from one hasher never verify under another
+	spSha := new(SignedProto)
+	assert.Nil(t, spSha.SignWith(m, privateKey, sha))
+	assert.Nil(t, spSha.VerifyWith(S256Curve, sha))
+	assert.Equal(t, ErrSigMismatch, spSha.VerifyWith(S256Curve, DefaultHasher))
+	assert.Equal(t, ErrSigMismatch, sp.VerifyWith(S256Curve, sha))
+
+	// consensus with customized hasher
+	consensus := createConsensus(t, 0, 0, []*ecdsa.PublicKey{&privateKey.PublicKey})
+	consensus.hasher = sha
+	_, err = consensus.verifyMessage(spSha)
+	assert.Nil(t, err)
+	_, err = consensus.verifyMessage(sp)
+	assert.Equal(t, ErrMessageSignature, err)
+}
+
+func TestDomainSeparator(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	newConsensus := func(domain []byte) *Consensus {
+		config := new(Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = privateKey
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		config.DomainSeparator = domain
+		config.Participants = append(config.Participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+		for i := 1; i < ConfigMinimumParticipants; i++ {
+			randKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+			assert.Nil(t, err)
+			config.Participants = append(config.Participants, DefaultPubKeyToIdentity(&randKey.PublicKey))
+		}
+		consensus, err := NewConsensus(config)
+		assert.Nil(t, err)
+		return consensus
+	}
+
+	consensusA := newConsensus([]byte("A"))
+	consensusB := newConsensus([]byte("B"))
+	consensusDefault := newConsensus(nil)
+	assert.Equal(t, DefaultHasher, consensusDefault.hasher)
+
+	m, spDefault, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+	spA := new(SignedProto)
+	assert.Nil(t, spA.SignWith(m, privateKey, DefaultHasher.WithDomain([]byte("A"))))
+
+	_, err = consensusA.verifyMessage(spA)
+	assert.Nil(t, err)
+	_, err = consensusB.verifyMessage(spA)
+	assert.Equal(t, ErrMessageSignature, err)
+	_, err = consensusDefault.verifyMessage(spA)
+	assert.Equal(t, ErrMessageSignature, err)
+
+	// unset domain falls back to SignaturePrefix
+	_, err = consensusDefault.verifyMessage(spDefault)
+	assert.Nil(t, err)
+	_, err = consensusA.verifyMessage(spDefault)
+	assert.Equal(t, ErrMessageSignature, err)
+}
+
+func TestSignCompact(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	m, full, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+	compact := new(SignedProto)
+	assert.Nil(t, compact.SignCompact(m, privateKey, nil))
+	assert.NotEqual(t, uint32(0), compact.V)
+
+	// public key is omitted on the wire
+	bts, err := proto.Marshal(compact)
+	assert.Nil(t, err)
+	fullBts, err := proto.Marshal(full)
+	assert.Nil(t, err)
+	assert.True(t, len(bts) < len(fullBts)-SizeAxis)
+
+	decoded := new(SignedProto)
+	assert.Nil(t, proto.Unmarshal(bts, decoded))
+	assert.Equal(t, PubKeyAxis{}, decoded.X)
+	assert.Nil(t, decoded.VerifyError(S256Curve))
+	assert.Equal(t, DefaultPubKeyToIdentity(&privateKey.PublicKey), DefaultPubKeyToIdentity(decoded.PublicKey(S256Curve)))
+
+	// non-compact messages are not affected
+	assert.Nil(t, full.RecoverPublicKey(nil))
+	assert.Nil(t, full.VerifyError(S256Curve))
+
+	// mismatched public key
+	wrong := *compact
+	wrong.X = full.Y
+	assert.Equal(t, ErrSigMismatch, wrong.VerifyError(S256Curve))
+
+	// invalid recovery id
+	wrong = *compact
+	wrong.X, wrong.Y = PubKeyAxis{}, PubKeyAxis{}
+	wrong.V = 5
+	assert.Equal(t, ErrRecoveryID, wrong.VerifyError(S256Curve))
+
+	// tampered message recovers another key
+	wrong = *compact
+	wrong.X, wrong.Y = PubKeyAxis{}, PubKeyAxis{}
+	wrong.Message = append([]byte{}, compact.Message...)
+	wrong.Message[0] ^= 1
+	err = wrong.RecoverPublicKey(nil)
+	if err == nil {
+		assert.NotEqual(t, compact.X, wrong.X)
+	}
+
+	// consensus accepts compact messages only if enabled
+	newConsensus := func(enable bool) *Consensus {
+		config := new(Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = privateKey
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		config.EnableCompactMessage = enable
+		config.Participants = append(config.Participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+		for i := 1; i < ConfigMinimumParticipants; i++ {
+			randKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+			assert.Nil(t, err)
+			config.Participants = append(config.Participants, DefaultPubKeyToIdentity(&randKey.PublicKey))
+		}
+		consensus, err := NewConsensus(config)
+		assert.Nil(t, err)
+		return consensus
+	}
+
+	decoded = new(SignedProto)
+	assert.Nil(t, proto.Unmarshal(bts, decoded))
+	_, err = newConsensus(false).verifyMessage(decoded)
+	assert.Equal(t, ErrMessageCompactDisabled, err)
+	_, err = newConsensus(true).verifyMessage(decoded)
+	assert.Nil(t, err)
+	_, err = newConsensus(true).verifyMessage(full)
+	assert.Nil(t, err)
+}
+
+func TestCompressedPubKey(t *testing.T) {
+	m := new(Message)
+	m.Type = MessageType_Nop
+
+	testKey := func(privateKey *ecdsa.PrivateKey) {
+		sp := new(SignedProto)
+		sp.Sign(m, privateKey)
+
+		compressed := sp.CompressedPubKey()
+		assert.Equal(t, (*btcec.PublicKey)(&privateKey.PublicKey).SerializeCompressed(), compressed[:])
+
+		X, Y, err := ParseCompressedPubKey(compressed[:])
+		assert.Nil(t, err)
+		assert.Equal(t, sp.X, X)
+		assert.Equal(t, sp.Y, Y)
+	}
+
+	for i := 0; i < 100; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		testKey(privateKey)
+	}
+
+	// keys whose X has leading zero bytes
+	found := 0
+	for found < 2 {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		if len(privateKey.PublicKey.X.Bytes()) < SizeAxis {
+			testKey(privateKey)
+			found++
+		}
+	}
+
+	// malformed inputs
+	_, _, err := ParseCompressedPubKey(make([]byte, SizeCompressedPubKey))
+	assert.Equal(t, ErrPubKey, err)
+	_, _, err = ParseCompressedPubKey(make([]byte, SizeAxis))
+	assert.Equal(t, ErrPubKey, err)
+}
+
+func TestIdentityCompressed(t *testing.T) {
+	parities := make(map[byte]int)
+	testKey := func(privateKey *ecdsa.PrivateKey) {
+		id := DefaultPubKeyToIdentity(&privateKey.PublicKey)
+		compressed := id.Compressed()
+		assert.Equal(t, (*btcec.PublicKey)(&privateKey.PublicKey).SerializeCompressed(), compressed[:])
+		parities[compressed[0]]++
+
+		restored, err := IdentityFromCompressed(compressed)
+		assert.Nil(t, err)
+		assert.Equal(t, id, restored)
+
+		// the other parity is the negated point
+		compressed[0] ^= 1
+		negated, err := IdentityFromCompressed(compressed)
+		assert.Nil(t, err)
+		assert.Equal(t, id[:SizeAxis], negated[:SizeAxis])
+		Y := new(big.Int).SetBytes(id[SizeAxis:])
+		negY := new(big.Int).Sub(S256Curve.Params().P, Y)
+		assert.Equal(t, negY, new(big.Int).SetBytes(negated[SizeAxis:]))
+	}
+
+	for i := 0; i < 100; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		testKey(privateKey)
+	}
+	assert.True(t, parities[0x02] > 0)
+	assert.True(t, parities[0x03] > 0)
+
+	// keys whose X or Y has leading zero bytes
+	foundX, foundY := 0, 0
+	for foundX < 2 || foundY < 2 {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		if len(privateKey.PublicKey.X.Bytes()) < SizeAxis {
+			testKey(privateKey)
+			foundX++
+		}
+		if len(privateKey.PublicKey.Y.Bytes()) < SizeAxis {
+			testKey(privateKey)
+			foundY++
+		}
+	}
+
+	// X of no point on the curve
+	var compressed [SizeCompressedPubKey]byte
+	compressed[0] = 0x02
+	for x := int64(1); ; x++ {
+		// y^2 = x^3 + 7 has no root
+		X := big.NewInt(x)
+		rhs := new(big.Int).Add(new(big.Int).Exp(X, big.NewInt(3), nil), big.NewInt(7))
+		if new(big.Int).ModSqrt(rhs, S256Curve.Params().P) == nil {
+			X.FillBytes(compressed[1:])
+			break
+		}
+	}
+	_, err := IdentityFromCompressed(compressed)
+	assert.Equal(t, ErrPubKey, err)
+
+	// X beyond the field, and invalid prefix
+	S256Curve.Params().P.FillBytes(compressed[1:])
+	_, err = IdentityFromCompressed(compressed)
+	assert.Equal(t, ErrPubKey, err)
+	_, err = IdentityFromCompressed([SizeCompressedPubKey]byte{0x04})
+	assert.Equal(t, ErrPubKey, err)
+}
+
+func TestEthSignature(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	m := new(Message)
+	m.Type = MessageType_Decide
+	m.Height = 1
+	m.State = []byte("state")
+
+	sp := new(SignedProto)
+	assert.Nil(t, sp.SignWith(m, privateKey, Keccak256Hasher))
+	sig, err := sp.EthSignature()
+	assert.Nil(t, err)
+	assert.True(t, sig[64] == 27 || sig[64] == 28)
+
+	// ecrecover(digest, v, r, s)
+	compact := append([]byte{sig[64]}, sig[:64]...)
+	pubkey, _, err := btcec.RecoverCompact(btcec.S256(), compact, sp.HashWith(Keccak256Hasher))
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultPubKeyToIdentity(&privateKey.PublicKey), DefaultPubKeyToIdentity(pubkey.ToECDSA()))
+
+	// compact messages
+	spCompact := new(SignedProto)
+	assert.Nil(t, spCompact.SignCompact(m, privateKey, Keccak256Hasher))
+	sigCompact, err := spCompact.EthSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, byte(27+spCompact.V-1), sigCompact[64])
+
+	// signed with the default blake2b hasher
+	_, spDefault, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+	_, err = spDefault.EthSignature()
+	assert.Equal(t, ErrSigMismatch, err)
+}
+
+func TestPubKeyAxisConstantTimeEqual(t *testing.T) {
+	var a, b PubKeyAxis
+	assert.True(t, a.ConstantTimeEqual(b))
+	_, err := io.ReadFull(rand.Reader, a[:])
+	assert.Nil(t, err)
+	assert.False(t, a.ConstantTimeEqual(b))
+	b = a
+	assert.True(t, a.ConstantTimeEqual(b))
+	b[SizeAxis-1] ^= 1
+	assert.False(t, a.ConstantTimeEqual(b))
+}
+
+func TestPubKeyAxisUnmarshalLength(t *testing.T) {
+	value := make([]byte, SizeAxis)
+	_, err := io.ReadFull(rand.Reader, value)
+	assert.Nil(t, err)
+	value[0] = 0xff
+
+	// 32 bytes
+	var axis PubKeyAxis
+	assert.Nil(t, axis.Unmarshal(value))
+	assert.Equal(t, value, axis[:])
+
+	// 31 bytes are left-padded with zero
+	axis = PubKeyAxis{}
+	assert.Nil(t, axis.Unmarshal(value[1:]))
+	assert.Equal(t, byte(0), axis[0])
+	assert.Equal(t, value[1:], axis[1:])
+
+	// 33 bytes with a leading zero
+	axis = PubKeyAxis{}
+	assert.Nil(t, axis.Unmarshal(append([]byte{0}, value...)))
+	assert.Equal(t, value, axis[:])
+
+	// 33 bytes without a leading zero
+	assert.Equal(t, ErrPubKey, axis.Unmarshal(append([]byte{1}, value...)))
+
+	// 34 bytes with leading zeros
+	assert.Equal(t, ErrPubKey, axis.Unmarshal(append([]byte{0, 0}, value...)))
+}
+
+// referenceHash digests the signed message with a fresh hash.Hash as HashWith did before pooling
+func referenceHash(sp *SignedProto, h *Hasher) []byte {
+	hash := h.New()
+	hash.Write(h.prefix())
+	if sp.V != 0 {
+		hash.Write([]byte(compactSuffix))
+	}
+	binary.Write(hash, binary.LittleEndian, sp.Version)
+	if sp.V == 0 {
+		hash.Write(sp.X[:])
+		hash.Write(sp.Y[:])
+	}
+	binary.Write(hash, binary.LittleEndian, uint32(len(sp.Message)))
+	hash.Write(sp.Message)
+	return hash.Sum(nil)
+}
+
+func TestHashPooled(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	hashers := []*Hasher{
+		DefaultHasher,
+		Keccak256Hasher,
+		DefaultHasher.WithDomain([]byte("domain")),
+		{Name: "unpooled", New: newBlake2b256},
+	}
+
+	for i := 0; i < 100; i++ {
+		state := make([]byte, i*10)
+		_, err := io.ReadFull(rand.Reader, state)
+		assert.Nil(t, err)
+		m := &Message{Type: MessageType_RoundChange, Height: uint64(i), State: state}
+
+		for _, h := range hashers {
+			sp := new(SignedProto)
+			assert.Nil(t, sp.SignWith(m, privateKey, h))
+			assert.Equal(t, referenceHash(sp, h), sp.HashWith(h))
+			// interleaved digests must not interfere with each other
+			assert.Equal(t, sp.HashWith(h), sp.HashWith(h))
+
+			compact := new(SignedProto)
+			assert.Nil(t, compact.SignCompact(m, privateKey, h))
+			assert.Equal(t, referenceHash(compact, h), compact.HashWith(h))
+		}
+	}
+}
+
+func TestHashPoolReplacedNew(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	_, sp, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+
+	// a copy of a pooled hasher with New replaced
+	h := *DefaultHasher
+	assert.True(t, h.pooled())
+	assert.Equal(t, referenceHash(sp, &h), sp.HashWith(&h))
+	h.New = sha256.New
+	assert.False(t, h.pooled())
+	assert.Equal(t, referenceHash(sp, &h), sp.HashWith(&h))
+	assert.Equal(t, sha256.Size, len(sp.HashWith(&h)))
+
+	// the pool of the original hasher is intact
+	assert.True(t, DefaultHasher.pooled())
+	assert.Equal(t, referenceHash(sp, DefaultHasher), sp.HashWith(DefaultHasher))
+}
+
+func TestHashCached(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	other, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	_, sp, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+
+	check := func() {
+		for _, h := range []*Hasher{DefaultHasher, Keccak256Hasher} {
+			assert.Equal(t, referenceHash(sp, h), sp.HashWith(h))
+			// cached
+			assert.Equal(t, referenceHash(sp, h), sp.HashWith(h))
+		}
+		assert.Equal(t, referenceHash(sp, DefaultHasher), sp.Hash())
+	}
+	check()
+
+	// the returned digest is a copy
+	hash := sp.Hash()
+	hash[0]++
+	check()
+
+	// invalidated by changes of version, public key & message
+	sp.Version++
+	check()
+	sp.X, sp.Y = PubKeyAxis{}, PubKeyAxis{}
+	copy(sp.X[:], other.PublicKey.X.Bytes())
+	check()
+	copy(sp.Y[:], other.PublicKey.Y.Bytes())
+	check()
+	sp.Message = append(sp.Message, 0)
+	check()
+	sp.Message = append([]byte{}, sp.Message...)
+	sp.Message[0]++
+	check()
+	sp.Message = sp.Message[:len(sp.Message)-1]
+	check()
+	sp.V = 1
+	check()
+
+	// memoized on each object
+	copied := *sp
+	copied.Message = append([]byte{}, sp.Message...)
+	copied.Message[0]++
+	assert.Equal(t, referenceHash(&copied, DefaultHasher), copied.Hash())
+	check()
+
+	// invalidated by changes of the hasher
+	h := DefaultHasher.WithDomain([]byte("domain"))
+	assert.Equal(t, referenceHash(sp, h), sp.HashWith(h))
+	h.Domain[0]++
+	assert.Equal(t, referenceHash(sp, h), sp.HashWith(h))
+
+	// verification with the cached digest
+	_, sp, _ = createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+	assert.True(t, sp.Verify(S256Curve))
+	assert.True(t, sp.Verify(S256Curve))
+	sp.Message = append([]byte{}, sp.Message...)
+	sp.Message[len(sp.Message)-1]++
+	assert.False(t, sp.Verify(S256Curve))
+
+	// verification doesn't modify the message, and is safe for concurrent use
+	_, sp, _ = createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+	before, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.True(t, sp.Verify(S256Curve))
+			assert.Equal(t, referenceHash(sp, DefaultHasher), sp.Hash())
+		}()
+	}
+	wg.Wait()
+	after, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, before, after)
+}
+
+func BenchmarkHash(b *testing.B) {
+	privateKey, _ := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	_, sp, _ := createRoundChangeMessageSigner(b, 1, 0, make([]byte, 1024), privateKey)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sp.Hash()
+	}
+}
+
+func TestSignedProtoBytes(t *testing.T) {
+	_, sp, _ := createCommitMessage(t, 1, 0, []byte("state"))
+	expected, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+
+	bts := sp.Bytes()
+	assert.Equal(t, expected, bts)
+	// cached
+	again := sp.Bytes()
+	assert.Equal(t, &bts[0], &again[0])
+
+	mutations := []func(sp *SignedProto){
+		func(sp *SignedProto) { sp.Version++ },
+		func(sp *SignedProto) { sp.Message = append([]byte{0xff}, sp.Message[1:]...) },
+		func(sp *SignedProto) { sp.Message = append(sp.Message, 0) },
+		func(sp *SignedProto) { sp.Message = sp.Message[:len(sp.Message)-1] },
+		func(sp *SignedProto) { sp.X[0] ^= 0xff },
+		func(sp *SignedProto) { sp.Y = PubKeyAxis{} },
+		func(sp *SignedProto) { sp.R = append([]byte{sp.R[0] ^ 0xff}, sp.R[1:]...) },
+		func(sp *SignedProto) { sp.S = nil },
+		func(sp *SignedProto) { sp.V = 1 },
+		func(sp *SignedProto) { sp.Scheme = SchemeEd25519 },
+		func(sp *SignedProto) { sp.XXX_unrecognized = []byte{0x48, 0x01} },
+	}
+	for k := range mutations {
+		mutations[k](sp)
+		expected, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, sp.Bytes(), "mutation %v", k)
+	}
+
+	// cached with unrecognized fields, without re-encoding or decoding
+	bts = sp.Bytes()
+	again = sp.Bytes()
+	assert.Equal(t, &bts[0], &again[0])
+	assert.Equal(t, float64(0), testing.AllocsPerRun(100, func() { sp.Bytes() }))
+
+	// unmarshal resets the cache
+	decoded := new(SignedProto)
+	_, another, _ := createCommitMessage(t, 1, 0, []byte("another"))
+	assert.Nil(t, proto.Unmarshal(another.Bytes(), decoded))
+	decoded.Bytes()
+	assert.Nil(t, proto.Unmarshal(sp.Bytes(), decoded))
+	assert.Equal(t, sp.Bytes(), decoded.Bytes())
+}
+
+func BenchmarkBroadcast100(b *testing.B) {
+	m, _, signer := createCommitMessage(b, 1, 0, make([]byte, 1024))
+	sp := new(SignedProto)
+	sp.Sign(m, signer)
+	peers := make([][]byte, 100)
+
+	b.Run("Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for k := range peers {
+				peers[k], _ = proto.Marshal(sp)
+			}
+		}
+	})
+	b.Run("Bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for k := range peers {
+				peers[k] = sp.Bytes()
+			}
+		}
+	})
+}
+
+func TestIdentityHex(t *testing.T) {
+	var id Identity
+	for i := range id {
+		id[i] = byte(i)
+	}
+	assert.Equal(t, 2*len(id), len(id.Hex()))
+	assert.Equal(t, "00010203..3c3d3e3f", id.Short())
+
+	parsed, err := ParseIdentityHex(id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, id, parsed)
+
+	_, err = ParseIdentityHex(id.Hex()[:len(id.Hex())-2])
+	assert.Equal(t, ErrIdentityLength, err)
+	_, err = ParseIdentityHex("zz")
+	assert.NotNil(t, err)
+}
+
+func TestDecodeSignedProto(t *testing.T) {
+	m, sp, key := createRoundChangeMessageState(t, 10, 2, []byte("state"))
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+
+	// valid frame
+	signed, decoded, err := DecodeSignedProto(bts)
+	assert.Nil(t, err)
+	assert.Equal(t, sp.X, signed.X)
+	assert.Equal(t, m.Type, decoded.Type)
+	assert.Equal(t, m.Height, decoded.Height)
+	assert.Equal(t, m.Round, decoded.Round)
+	assert.Equal(t, m.State, decoded.State)
+
+	// truncated frame
+	_, _, err = DecodeSignedProto(bts[:len(bts)/2])
+	assert.NotNil(t, err)
+
+	// corrupt signature
+	corrupt := append([]byte{}, bts...)
+	corrupt[len(corrupt)-1]++
+	signed, decoded, err = DecodeSignedProto(corrupt)
+	assert.Equal(t, ErrMessageSignature, err)
+	assert.Nil(t, signed)
+	assert.Nil(t, decoded)
+
+	// corrupt message enclosed in a valid signature
+	sp.Message = []byte{0xff, 0xff, 0xff}
+	sp.R, sp.S, err = NewECDSASigner(key).Sign(sp.HashWith(DefaultHasher))
+	assert.Nil(t, err)
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	signed, decoded, err = DecodeSignedProto(bts)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrMessageSignature, err)
+	assert.Nil(t, signed)
+	assert.Nil(t, decoded)
+}
@@ -0,0 +1,251 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"sync"
+	"time"
+)
+
+// Metrics collects statistics of message processing, methods are called
+// synchronously by the state machine, and should return quickly.
+type Metrics interface {
+	// IncMessageReceived is called for each decoded message before
+	// verification, rejected messages are counted by IncRejected as well.
+	IncMessageReceived(MessageType)
+	// IncMessageVerified is called for each message accepted by the state machine
+	IncMessageVerified(MessageType)
+	// IncRejected is called for each message rejected, with the reason
+	IncRejected(reason string)
+	// IncRoundEntered is called when consensus enters a new round
+	IncRoundEntered()
+	// IncDecided is called when a height has been decided
+	IncDecided()
+	// ObserveRoundDuration is called with the time spent on a round when
+	// consensus leaves it
+	ObserveRoundDuration(time.Duration)
+}
+
+// noopMetrics is the default Metrics which does nothing
+type noopMetrics struct{}
+
+func (noopMetrics) IncMessageReceived(MessageType)     {}
+func (noopMetrics) IncMessageVerified(MessageType)     {}
+func (noopMetrics) IncRejected(reason string)          {}
+func (noopMetrics) IncRoundEntered()                   {}
+func (noopMetrics) IncDecided()                        {}
+func (noopMetrics) ObserveRoundDuration(time.Duration) {}
+
+// MemoryMetrics is a Metrics implementation which keeps statistics in
+// memory, it's safe to be read concurrently.
+type MemoryMetrics struct {
+	mu             sync.Mutex
+	received       map[MessageType]uint64
+	verified       map[MessageType]uint64
+	rejected       map[string]uint64
+	roundsEntered  uint64
+	decided        uint64
+	roundDurations []time.Duration
+}
+
+// NewMemoryMetrics creates an empty MemoryMetrics
+func NewMemoryMetrics() *MemoryMetrics {
+	m := new(MemoryMetrics)
+	m.received = make(map[MessageType]uint64)
+	m.verified = make(map[MessageType]uint64)
+	m.rejected = make(map[string]uint64)
+	return m
+}
+
+// IncMessageReceived implements Metrics
+func (m *MemoryMetrics) IncMessageReceived(t MessageType) {
+	m.mu.Lock()
+	m.received[t]++
+	m.mu.Unlock()
+}
+
+// IncMessageVerified implements Metrics
+func (m *MemoryMetrics) IncMessageVerified(t MessageType) {
+	m.mu.Lock()
+	m.verified[t]++
+	m.mu.Unlock()
+}
+
+// IncRejected implements Metrics
+func (m *MemoryMetrics) IncRejected(reason string) {
+	m.mu.Lock()
+	m.rejected[reason]++
+	m.mu.Unlock()
+}
+
+// IncRoundEntered implements Metrics
+func (m *MemoryMetrics) IncRoundEntered() {
+	m.mu.Lock()
+	m.roundsEntered++
+	m.mu.Unlock()
+}
+
+// IncDecided implements Metrics
+func (m *MemoryMetrics) IncDecided() {
+	m.mu.Lock()
+	m.decided++
+	m.mu.Unlock()
+}
+
+// ObserveRoundDuration implements Metrics
+func (m *MemoryMetrics) ObserveRoundDuration(d time.Duration) {
+	m.mu.Lock()
+	m.roundDurations = append(m.roundDurations, d)
+	m.mu.Unlock()
+}
+
+// Received returns the number of received messages of the given type
+func (m *MemoryMetrics) Received(t MessageType) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.received[t]
+}
+
+// Verified returns the number of accepted messages of the given type
+func (m *MemoryMetrics) Verified(t MessageType) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.verified[t]
+}
+
+// Rejected returns the number of rejected messages of the given reason
+func (m *MemoryMetrics) Rejected(reason string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rejected[reason]
+}
+
+// RoundsEntered returns the number of rounds entered
+func (m *MemoryMetrics) RoundsEntered() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.roundsEntered
+}
+
+// Decided returns the number of heights decided
+func (m *MemoryMetrics) Decided() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.decided
+}
+
+// RoundDurations returns the durations of rounds left
+func (m *MemoryMetrics) RoundDurations() []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]time.Duration(nil), m.roundDurations...)
+}
+
+// countReceived reports a decoded message to metrics before verification,
+// the type is read from the encoded message without decoding it, an omitted
+// type is <nop>.
+func (c *Consensus) countReceived(signed *SignedProto) {
+	t := MessageType_Nop
+	err := walkMessage(signed.Message, func(field uint64, wire uint64, value uint64, b []byte) error {
+		if field == messageFieldType && wire == wireVarint {
+			t = MessageType(value)
+		}
+		return nil
+	})
+	if err == nil {
+		c.metrics.IncMessageReceived(t)
+	}
+}
+
+// measureMessage reports a processed message to metrics and logger, m is
+// nil if the message cannot be decoded or verified.
+func (c *Consensus) measureMessage(m *Message, err error) {
+	if err != nil {
+		c.countDrop(err.Error())
+		c.metrics.IncRejected(err.Error())
+		if m != nil {
+			c.debugw("dropping message", "err", err, "message", m)
+		} else {
+			c.debugw("dropping message", "err", err)
+		}
+	} else if m != nil {
+		c.metrics.IncMessageVerified(m.Type)
+	}
+}
+
+// measureRound reports round transitions to metrics and logger
+func (c *Consensus) measureRound(now time.Time) {
+	height, round := c.latestHeight, c.currentRound.RoundNumber
+	if height == c.measuredHeight && round == c.measuredRound {
+		return
+	}
+
+	if !c.roundStarted.IsZero() {
+		c.metrics.ObserveRoundDuration(now.Sub(c.roundStarted))
+	}
+	if height != c.measuredHeight {
+		if height == c.measuredHeight+1 && !c.heightStarted.IsZero() {
+			c.heightStats[height%heightStatsSize] = heightStat{
+				height:   height,
+				rounds:   c.latestRound + 1,
+				duration: now.Sub(c.heightStarted),
+			}
+		}
+		c.heightStarted = now
+	}
+	c.metrics.IncRoundEntered()
+	c.infow("entering round", "height", height+1, "round", round)
+	c.measuredHeight = height
+	c.measuredRound = round
+	c.roundStarted = now
+}
+
+// heightStatsSize is the number of recent heights kept for HeightStats
+const heightStatsSize = 256
+
+// heightStat records the rounds and duration of a decided height
+type heightStat struct {
+	height   uint64
+	rounds   uint64
+	duration time.Duration
+}
+
+// HeightStats returns the number of rounds and the duration taken to decide the
+// given height, measured from entering the height to the decision observed by
+// this node. Only the most recent heights are kept, ok will be false if the height
+// is unknown or has been synced without being measured.
+func (c *Consensus) HeightStats(height uint64) (rounds uint64, duration time.Duration, ok bool) {
+	stat := c.heightStats[height%heightStatsSize]
+	if stat.rounds == 0 || stat.height != height {
+		return 0, 0, false
+	}
+	return stat.rounds, stat.duration, true
+}
@@ -0,0 +1,83 @@
+package bdls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMetrics(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	metrics := make([]*MemoryMetrics, len(net.nodes))
+	for i := range net.nodes {
+		metrics[i] = NewMemoryMetrics()
+		net.nodes[i].metrics = metrics[i]
+		net.nodes[i].Propose([]byte("state"))
+	}
+
+	for i := 0; i < 1000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	for i := range metrics {
+		assert.Equal(t, uint64(1), metrics[i].Decided())
+		assert.True(t, metrics[i].Received(MessageType_RoundChange) > 0)
+		assert.True(t, metrics[i].Verified(MessageType_RoundChange) > 0)
+		assert.True(t, metrics[i].Verified(MessageType_RoundChange) <= metrics[i].Received(MessageType_RoundChange))
+		assert.True(t, metrics[i].RoundsEntered() > 0)
+		assert.Equal(t, int(metrics[i].RoundsEntered()), len(metrics[i].RoundDurations()))
+	}
+
+	// rejected messages
+	assert.NotNil(t, net.nodes[0].ReceiveMessage([]byte{0xff}, net.now))
+	_, sp, _ := createRoundChangeMessage(t, 1, 0)
+	bts, err := sp.Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMessageUnknownParticipant, net.nodes[0].ReceiveMessage(bts, net.now))
+	assert.Equal(t, uint64(1), metrics[0].Rejected(ErrMessageUnknownParticipant.Error()))
+
+	// messages are counted on decode, before verification
+	received := metrics[0].Received(MessageType_RoundChange)
+	verified := metrics[0].Verified(MessageType_RoundChange)
+	_, sp, _ = createRoundChangeMessage(t, 1, 0)
+	sp.R[0] ^= 0xff
+	assert.NotNil(t, net.nodes[0].ReceiveMessage(sp.Bytes(), net.now))
+	assert.Equal(t, received+1, metrics[0].Received(MessageType_RoundChange))
+	assert.Equal(t, verified, metrics[0].Verified(MessageType_RoundChange))
+}
+
+func TestHeightStats(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	start := net.now
+	for height := uint64(1); height <= 2; height++ {
+		for _, node := range net.nodes {
+			node.Propose([]byte{byte(height)})
+		}
+		for i := 0; i < 1000 && !net.decided(height); i++ {
+			net.step(20 * time.Millisecond)
+		}
+		assert.True(t, net.decided(height))
+	}
+
+	for _, node := range net.nodes {
+		var total time.Duration
+		for height := uint64(1); height <= 2; height++ {
+			rounds, duration, ok := node.HeightStats(height)
+			assert.True(t, ok)
+			assert.True(t, rounds >= 1)
+			assert.True(t, duration > 0)
+			total += duration
+		}
+		assert.True(t, total <= net.now.Sub(start))
+
+		// unknown heights
+		_, _, ok := node.HeightStats(0)
+		assert.False(t, ok)
+		_, _, ok = node.HeightStats(3)
+		assert.False(t, ok)
+		_, _, ok = node.HeightStats(1 + heightStatsSize)
+		assert.False(t, ok)
+	}
+}
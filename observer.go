@@ -0,0 +1,205 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultStuckThreshold is the default duration of a round to be reported
+// as stuck by Health.
+const DefaultStuckThreshold = time.Minute
+
+// Reasons of messages dropped silently by ReceiveMessage, messages rejected
+// with errors are reported by DropStats with the error messages as reasons.
+const (
+	DropFiltered   = "filtered by Config.MessageFilter"
+	DropReplayed   = "replayed"
+	DropSuperseded = "superseded by <roundchange> of a higher round"
+)
+
+// HealthStatus is the health of a participant reported by Health
+type HealthStatus struct {
+	Height        uint64        // latest decided height
+	Round         uint64        // current round at the height being decided
+	SinceDecision time.Duration // time since latest decision observed
+	SinceRound    time.Duration // time since current round started
+	Peers         int           // number of peers joined
+	Stuck         bool          // current round has lasted beyond Config.StuckThreshold
+	// Healthy is true if current round is not stuck, and the number of peers
+	// along with this participant itself is enough to form a quorum of
+	// equally weighted participants.
+	Healthy bool
+}
+
+// observer keeps a snapshot of the state machine for diagnostics, the
+// snapshot is refreshed after each call into the state machine, and is
+// safe to be read concurrently.
+type observer struct {
+	sync.Mutex
+	roundChanges []Identity // participants who have sent <roundchange> in current round
+	missing      []Identity // participants who have not sent <roundchange> in current round
+	locked       State      // the maximal locked state at current height, nil if not locked
+
+	height        uint64    // latest decided height
+	decidedRound  uint64    // round of latest decided height
+	decided       State     // state of latest decided height
+	round         uint64    // current round
+	heightStarted time.Time // time of latest decision observed
+	roundStarted  time.Time // time of current round started
+	peers         int       // number of peers joined
+	quorum        int       // number of participants to form a quorum
+
+	drops        map[string]uint64 // number of messages dropped by reasons
+	decidedDrops uint64            // number of events dropped by DecidedCh
+	signErrors   uint64            // number of messages failed to be signed
+}
+
+// observe refreshes the observer's snapshot from the state machine
+func (c *Consensus) observe() {
+	var have []Identity
+	var missing []Identity
+	sent := make(map[Identity]bool)
+	if c.currentRound != nil {
+		for k := range c.currentRound.roundChanges {
+			id := c.pubKeyToIdentity(c.currentRound.roundChanges[k].Signed.PublicKey(c.curve))
+			sent[id] = true
+			have = append(have, id)
+		}
+	}
+
+	for _, id := range c.participants {
+		if !sent[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	c.observer.Lock()
+	c.observer.roundChanges = have
+	c.observer.missing = missing
+	c.observer.locked = c.maximalLocked()
+	c.observer.height = c.latestHeight
+	if c.currentRound != nil {
+		c.observer.round = c.currentRound.RoundNumber
+	}
+	c.observer.heightStarted = c.heightStarted
+	c.observer.roundStarted = c.roundStarted
+	c.observer.peers = len(c.peers)
+	c.observer.quorum = c.quorum()
+	c.observer.Unlock()
+}
+
+// observeDecided refreshes the observer's snapshot of latest decided height,
+// round and state, it's called whenever they're changed, so that the
+// snapshot is in sync for the callbacks fired in between.
+func (c *Consensus) observeDecided() {
+	c.observer.Lock()
+	c.observer.height = c.latestHeight
+	c.observer.decidedRound = c.latestRound
+	c.observer.decided = c.latestState
+	c.observer.Unlock()
+}
+
+// PendingRoundChanges returns the participants who have sent <roundchange>
+// and the participants we're still waiting on, at current height & round.
+// It's safe to be called concurrently with the state machine.
+func (c *Consensus) PendingRoundChanges() (have []Identity, missing []Identity) {
+	c.observer.Lock()
+	defer c.observer.Unlock()
+	have = append(have, c.observer.roundChanges...)
+	missing = append(missing, c.observer.missing...)
+	return
+}
+
+// IsLocked returns the maximal locked state at current height if any, the
+// state is locked by a <lock> or <lock-release> message, and it will be
+// proposed in <roundchange> messages of later rounds until decided, or
+// released by a lock of a higher round, which will be reported by later calls.
+// It's safe to be called concurrently with the state machine.
+func (c *Consensus) IsLocked() (State, bool) {
+	c.observer.Lock()
+	defer c.observer.Unlock()
+	return c.observer.locked, c.observer.locked != nil
+}
+
+// Health returns the health of this participant for monitoring, the durations
+// are measured from the time passed to Update and ReceiveMessage till now by
+// Config.Clock.
+// It's safe to be called concurrently with the state machine.
+func (c *Consensus) Health() HealthStatus {
+	now := c.clock.Now()
+	c.observer.Lock()
+	defer c.observer.Unlock()
+	status := HealthStatus{
+		Height:        c.observer.height,
+		Round:         c.observer.round,
+		SinceDecision: now.Sub(c.observer.heightStarted),
+		SinceRound:    now.Sub(c.observer.roundStarted),
+		Peers:         c.observer.peers,
+	}
+	status.Stuck = status.SinceRound > c.stuckThreshold
+	status.Healthy = !status.Stuck && status.Peers+1 >= c.observer.quorum
+	return status
+}
+
+// countDrop increases the counter of messages dropped by the reason
+func (c *Consensus) countDrop(reason string) {
+	c.observer.Lock()
+	if c.observer.drops == nil {
+		c.observer.drops = make(map[string]uint64)
+	}
+	c.observer.drops[reason]++
+	c.observer.Unlock()
+}
+
+// DropStats returns the number of incoming messages dropped or rejected by
+// reasons, the reasons are DropFiltered, DropReplayed, DropSuperseded, or the
+// error messages returned by ReceiveMessage.
+// It's safe to be called concurrently with the state machine.
+func (c *Consensus) DropStats() map[string]uint64 {
+	c.observer.Lock()
+	defer c.observer.Unlock()
+	stats := make(map[string]uint64, len(c.observer.drops))
+	for reason, n := range c.observer.drops {
+		stats[reason] = n
+	}
+	return stats
+}
+
+// SignErrors returns the number of outgoing messages which have failed to be
+// signed by the signer, the messages are not sent, see Config.Signer.
+// It's safe to be called concurrently with the state machine.
+func (c *Consensus) SignErrors() uint64 {
+	c.observer.Lock()
+	defer c.observer.Unlock()
+	return c.observer.signErrors
+}
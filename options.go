@@ -0,0 +1,113 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"time"
+)
+
+// Option sets a parameter of the consensus object created by New
+type Option func(*Config)
+
+// WithConfig sets all parameters from an existing config, options after it
+// override the corresponding fields.
+func WithConfig(config *Config) Option {
+	return func(c *Config) {
+		if config != nil {
+			*c = *config
+		}
+	}
+}
+
+// WithEpoch sets the starting time point for consensus
+func WithEpoch(epoch time.Time) Option { return func(c *Config) { c.Epoch = epoch } }
+
+// WithCurrentHeight sets the height to start consensus with
+func WithCurrentHeight(height uint64) Option { return func(c *Config) { c.CurrentHeight = height } }
+
+// WithCurrentRound sets the round to start consensus with
+func WithCurrentRound(round uint64) Option { return func(c *Config) { c.CurrentRound = round } }
+
+// WithPrivateKey sets the private key to sign messages
+func WithPrivateKey(key *ecdsa.PrivateKey) Option { return func(c *Config) { c.PrivateKey = key } }
+
+// WithParticipants sets the consensus group
+func WithParticipants(participants []Identity) Option {
+	return func(c *Config) { c.Participants = participants }
+}
+
+// WithStateCompare sets the function to compare states
+func WithStateCompare(f func(a State, b State) int) Option {
+	return func(c *Config) { c.StateCompare = f }
+}
+
+// WithStateValidate sets the function to validate states
+func WithStateValidate(f func(State) bool) Option { return func(c *Config) { c.StateValidate = f } }
+
+// WithStateValidateErr sets the function to validate states with rejection reasons
+func WithStateValidateErr(f func(State) error) Option {
+	return func(c *Config) { c.StateValidateErr = f }
+}
+
+// WithDecideCallback sets the callback when a height is decided
+func WithDecideCallback(f func(height uint64, round uint64, state State, proof *SignedProto)) Option {
+	return func(c *Config) { c.DecideCallback = f }
+}
+
+// WithMetrics sets the statistics collector
+func WithMetrics(metrics Metrics) Option { return func(c *Config) { c.Metrics = metrics } }
+
+// WithClock sets the source of time read by the consensus core
+func WithClock(clock Clock) Option { return func(c *Config) { c.Clock = clock } }
+
+// WithLogger sets the logger
+func WithLogger(logger Logger) Option { return func(c *Config) { c.Logger = logger } }
+
+// New creates a BDLS consensus object from options, required parameters are
+// Epoch, PrivateKey, Participants, StateCompare and StateValidate(or StateValidateErr), an error
+// naming the missing parameter will be returned if they're not set.
+func New(opts ...Option) (*Consensus, error) {
+	config := new(Config)
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Consensus)
+	c.init(config)
+	c.start()
+	return c, nil
+}
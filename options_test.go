@@ -0,0 +1,57 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	var participants []Identity
+	participants = append(participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	for i := 0; i < 3; i++ {
+		key, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+
+	var decided bool
+	opts := []Option{
+		WithEpoch(time.Now()),
+		WithCurrentHeight(10),
+		WithParticipants(participants),
+		WithStateCompare(func(a State, b State) int { return bytes.Compare(a, b) }),
+		WithStateValidate(func(State) bool { return true }),
+		WithDecideCallback(func(uint64, uint64, State, *SignedProto) { decided = true }),
+	}
+
+	// missing private key
+	_, err = New(opts...)
+	assert.Equal(t, ErrConfigPrivateKey, err)
+
+	consensus, err := New(append(opts, WithPrivateKey(privateKey))...)
+	assert.Nil(t, err)
+	height, _, _ := consensus.CurrentState()
+	assert.Equal(t, uint64(10), height)
+	assert.Equal(t, participants, consensus.participants)
+	assert.Equal(t, participants[0], consensus.identity)
+	consensus.decideCallback(11, 0, nil, nil)
+	assert.True(t, decided)
+
+	// options override config
+	config := new(Config)
+	config.Epoch = time.Now()
+	_, err = New(WithConfig(config))
+	assert.Equal(t, ErrConfigStateCompare, err)
+	consensus, err = New(append([]Option{WithConfig(config)}, append(opts, WithPrivateKey(privateKey), WithCurrentHeight(20))...)...)
+	assert.Nil(t, err)
+	height, _, _ = consensus.CurrentState()
+	assert.Equal(t, uint64(20), height)
+}
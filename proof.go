@@ -0,0 +1,648 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/binary"
+	"math/bits"
+	"sort"
+
+	proto "github.com/gogo/protobuf/proto"
+)
+
+// VerifyDecideProof verifies a standalone <decide> proof against the consensus
+// group without a Consensus object, for light clients and explorers to check
+// finality, and returns the decided height & state.
+//
+// The proof must be signed by a participant, and carry at least 2*t+1 <commit>
+// proofs to the decided state of the same height & round from distinct
+// participants, with participants weighted equally.
+//
+// Messages are verified with the DefaultHasher on secp256k1, or by their
+// SignatureScheme, and signers are identified by DefaultPubKeyToIdentity,
+// compact messages are accepted, see ProofVerifier for other identities,
+// hashers, curves and quorums.
+// As the election of leaders is not known here, the signer of the <decide>
+// message is not checked to be the leader of the round.
+func VerifyDecideProof(participants []Identity, proof *SignedProto) (height uint64, state State, err error) {
+	return ProofVerifier{}.VerifyDecideProof(participants, proof)
+}
+
+// ProofVerifier verifies standalone proofs as the package level functions do,
+// with the identities, hasher, curve and quorum of the consensus group, for the
+// groups configured with the counterparts in Config.
+type ProofVerifier struct {
+	// PubKeyToIdentity derives the identities of signers from their public
+	// keys, it must be the Config.PubKeyToIdentity of the consensus group.
+	// (optional). Default to DefaultPubKeyToIdentity
+	PubKeyToIdentity func(pubkey *ecdsa.PublicKey) Identity
+
+	// Hasher digests messages for verification, it must be the Config.Hasher
+	// of the consensus group.
+	// (optional). Default to DefaultHasher
+	Hasher *Hasher
+
+	// DomainSeparator replaces SignaturePrefix in message digests, it must be
+	// the Config.DomainSeparator of the consensus group.
+	// (optional). Default to SignaturePrefix
+	DomainSeparator []byte
+
+	// Curve of the public keys of signers, it must be the curve of the
+	// private keys of the consensus group.
+	// (optional). Default to S256Curve
+	Curve elliptic.Curve
+
+	// Weights defines stake weights of participants as Config.Weights does, a
+	// decision requires more than 2/3 of total weight of participants, no
+	// decision is verified if the total weight exceeds math.MaxUint64.
+	// (optional). Default to equal weighting
+	Weights map[Identity]uint64
+
+	// QuorumSize returns the number of participants required out of n to
+	// decide as Config.QuorumSize does, and cannot be used along with Weights.
+	// (optional). Default to DefaultQuorumSize
+	QuorumSize func(n int) int
+
+	// AcceptedVersions is the set of protocol versions of the messages in proofs
+	// to accept as Config.AcceptedVersions does, proofs exported during a rolling
+	// upgrade may contain messages of the previous version.
+	// (optional). Default to ProtocolVersion only
+	AcceptedVersions []uint32
+}
+
+// group indexes the participants to verify the proofs against
+func (v ProofVerifier) group(participants []Identity) *proofGroup {
+	g := &proofGroup{
+		index:            make(map[Identity]struct{}, len(participants)),
+		toIdentity:       v.PubKeyToIdentity,
+		hasher:           v.hasher(),
+		curve:            v.curve(),
+		weights:          v.Weights,
+		quorumSize:       v.QuorumSize,
+		acceptedVersions: v.AcceptedVersions,
+	}
+	if g.toIdentity == nil {
+		g.toIdentity = DefaultPubKeyToIdentity
+	}
+	for _, id := range participants {
+		if _, duplicated := g.index[id]; !duplicated {
+			g.index[id] = struct{}{}
+			var carry uint64
+			g.totalWeight, carry = bits.Add64(g.totalWeight, g.weights[id], 0)
+			g.overflowed = g.overflowed || carry != 0
+		}
+	}
+	return g
+}
+
+// hasher returns the hasher with the domain separator applied
+func (v ProofVerifier) hasher() *Hasher {
+	h := v.Hasher
+	if h == nil {
+		h = DefaultHasher
+	}
+	if len(v.DomainSeparator) > 0 {
+		h = h.WithDomain(v.DomainSeparator)
+	}
+	return h
+}
+
+// curve returns the curve of the signers
+func (v ProofVerifier) curve() elliptic.Curve {
+	if v.Curve == nil {
+		return S256Curve
+	}
+	return v.Curve
+}
+
+// DecodeSignedProto decodes and verifies a signed message as the package level
+// DecodeSignedProto does, with the hasher and curve of the verifier.
+func (v ProofVerifier) DecodeSignedProto(bts []byte) (*SignedProto, *Message, error) {
+	signed, err := DecodeSignedMessage(bts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// compact messages have their public key recovered while verifying
+	if signed.VerifyWith(v.curve(), v.hasher()) != nil {
+		return nil, nil, ErrMessageSignature
+	}
+
+	m, err := DecodeMessage(signed.Message)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signed, m, nil
+}
+
+// VerifyDecideProof verifies a standalone <decide> proof as the package level
+// VerifyDecideProof does.
+func (v ProofVerifier) VerifyDecideProof(participants []Identity, proof *SignedProto) (height uint64, state State, err error) {
+	group := v.group(participants)
+	m, err := group.verify(proof)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tally, err := newDecideTally(group, m)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	mCommit := new(Message)
+	for _, commit := range m.Proof {
+		if err := tally.add(commit, mCommit); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err := tally.done(); err != nil {
+		return 0, nil, err
+	}
+	return m.Height, m.State, nil
+}
+
+// VerifyDecideProofBytes verifies an encoded standalone <decide> proof as
+// VerifyDecideProof does, while the <commit> proofs are decoded and verified
+// one at a time directly from the encoded message and discarded, only the
+// signers are retained, to limit the peak memory for large consensus groups.
+// The verification stops at the first invalid <commit> proof.
+func VerifyDecideProofBytes(participants []Identity, proof []byte) (height uint64, state State, err error) {
+	return ProofVerifier{}.VerifyDecideProofBytes(participants, proof)
+}
+
+// VerifyDecideProofBytes verifies an encoded standalone <decide> proof as the
+// package level VerifyDecideProofBytes does.
+func (v ProofVerifier) VerifyDecideProofBytes(participants []Identity, proof []byte) (height uint64, state State, err error) {
+	signed, err := DecodeSignedMessage(proof)
+	if err != nil {
+		return 0, nil, err
+	}
+	return verifyDecideStream(v.group(participants), signed)
+}
+
+// verifyDecideStream verifies a decoded <decide> proof whose enclosed message
+// is kept encoded, with <commit> proofs streamed from it.
+func verifyDecideStream(group *proofGroup, signed *SignedProto) (height uint64, state State, err error) {
+	if err := group.verifySignature(signed); err != nil {
+		return 0, nil, err
+	}
+
+	m, err := decodeMessageHeader(signed.Message)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tally, err := newDecideTally(group, m)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// the <commit> proof & its message are reused for every proof
+	commit := new(SignedProto)
+	mCommit := new(Message)
+	err = walkMessage(signed.Message, func(field uint64, wire uint64, value uint64, b []byte) error {
+		if field != messageFieldProof {
+			return nil
+		}
+		if wire != wireBytes {
+			return ErrProofMalformed
+		}
+		if err := proto.Unmarshal(b, commit); err != nil {
+			return err
+		}
+		return tally.add(commit, mCommit)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := tally.done(); err != nil {
+		return 0, nil, err
+	}
+	return m.Height, m.State, nil
+}
+
+// decideTally accumulates the <commit> proofs of a standalone <decide> proof
+type decideTally struct {
+	group   *proofGroup
+	m       *Message
+	signers map[Identity]struct{}
+	weight  uint64
+}
+
+// newDecideTally validates the decoded <decide> message m, and creates a tally
+// for its <commit> proofs
+func newDecideTally(group *proofGroup, m *Message) (*decideTally, error) {
+	if m.Type != MessageType_Decide {
+		return nil, ErrMessageUnknownMessageType
+	}
+
+	if m.State == nil {
+		return nil, ErrDecideEmptyState
+	}
+
+	return &decideTally{group: group, m: m, signers: make(map[Identity]struct{}, len(group.index))}, nil
+}
+
+// add verifies a <commit> proof and counts its signer, the proof is decoded
+// into mCommit.
+func (t *decideTally) add(commit *SignedProto, mCommit *Message) error {
+	err := t.group.verifyInto(commit, mCommit)
+	if err == ErrMessageUnknownParticipant {
+		return ErrDecideProofUnknownParticipant
+	} else if err != nil {
+		return err
+	}
+
+	if mCommit.Type != MessageType_Commit {
+		return ErrDecideProofTypeMismatch
+	}
+
+	if mCommit.Height != t.m.Height {
+		return ErrDecideProofHeightMismatch
+	}
+
+	if mCommit.Round != t.m.Round {
+		return ErrDecideProofRoundMismatch
+	}
+
+	// every <commit> must be to the decided state
+	if !bytes.Equal(mCommit.State, t.m.State) {
+		return ErrDecideProofStateMismatch
+	}
+
+	signer := t.group.toIdentity(commit.PublicKey(t.group.curve))
+	if _, duplicated := t.signers[signer]; duplicated {
+		return ErrDecideProofDuplicateSigner
+	}
+	t.signers[signer] = struct{}{}
+	if t.group.weights != nil {
+		t.weight += t.group.weights[signer]
+	} else {
+		t.weight++
+	}
+	return nil
+}
+
+// done checks the tally has reached the quorum of the group
+func (t *decideTally) done() error {
+	if !t.group.hasQuorum(t.weight) {
+		return ErrDecideProofInsufficient
+	}
+	return nil
+}
+
+// proofGroup is the consensus group to verify standalone proofs against
+type proofGroup struct {
+	index       map[Identity]struct{}
+	toIdentity  func(pubkey *ecdsa.PublicKey) Identity
+	hasher      *Hasher
+	curve       elliptic.Curve
+	weights     map[Identity]uint64
+	totalWeight uint64
+	quorumSize  func(n int) int
+	// the total weight has overflowed, no quorum can be reached
+	overflowed bool
+	// protocol versions of messages to accept
+	acceptedVersions []uint32
+}
+
+// hasQuorum checks if the weight of signers reaches the quorum of the group,
+// as Consensus does.
+func (g *proofGroup) hasQuorum(weight uint64) bool {
+	if g.weights == nil {
+		n := len(g.index)
+		q := DefaultQuorumSize(n)
+		if g.quorumSize != nil {
+			q = g.quorumSize(n)
+			if min := minQuorumSize(n); q < min {
+				q = min
+			}
+		}
+		return weight >= uint64(q)
+	}
+
+	if g.overflowed {
+		return false
+	}
+
+	// weight*3 > totalWeight*2 in 128-bit
+	hi1, lo1 := bits.Mul64(weight, 3)
+	hi2, lo2 := bits.Mul64(g.totalWeight, 2)
+	return hi1 > hi2 || (hi1 == hi2 && lo1 > lo2)
+}
+
+// verify verifies the version, signature & signer of a message against the
+// participants, and decodes the message.
+func (g *proofGroup) verify(signed *SignedProto) (*Message, error) {
+	m := new(Message)
+	if err := g.verifyInto(signed, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// verifyInto verifies a message as verify does, and decodes the message into m.
+func (g *proofGroup) verifyInto(signed *SignedProto, m *Message) error {
+	if err := g.verifySignature(signed); err != nil {
+		return err
+	}
+	return proto.Unmarshal(signed.Message, m)
+}
+
+// verifySignature verifies the version, signature & signer of a message
+// against the participants.
+func (g *proofGroup) verifySignature(signed *SignedProto) error {
+	if signed == nil {
+		return ErrMessageIsEmpty
+	}
+
+	if !acceptVersion(g.acceptedVersions, signed.Version) {
+		return ErrProtocolVersion
+	}
+
+	// compact messages have their public key recovered while verifying
+	if signed.VerifyWith(g.curve, g.hasher) != nil {
+		return ErrMessageSignature
+	}
+
+	if _, ok := g.index[g.toIdentity(signed.PublicKey(g.curve))]; !ok {
+		return ErrMessageUnknownParticipant
+	}
+	return nil
+}
+
+// field numbers & wire types of the encoded Message, see message.proto
+const (
+	messageFieldType        = 1
+	messageFieldHeight      = 2
+	messageFieldRound       = 3
+	messageFieldState       = 4
+	messageFieldProof       = 5
+	messageFieldLockRelease = 6
+
+	// field number of the message in the encoded SignedProto, see message.proto
+	signedFieldMessage = 2
+
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// walkMessage iterates the fields of an encoded message without decoding
+// them, fn is called with the field number, the wire type, and the value of a
+// varint field or the bytes of a length-delimited field sliced from bts.
+// Fixed-size fields are skipped.
+func walkMessage(bts []byte, fn func(field uint64, wire uint64, value uint64, b []byte) error) error {
+	for len(bts) > 0 {
+		key, n := binary.Uvarint(bts)
+		if n <= 0 || key>>3 == 0 {
+			return ErrProofMalformed
+		}
+		bts = bts[n:]
+
+		var value uint64
+		var b []byte
+		switch key & 7 {
+		case wireVarint:
+			value, n = binary.Uvarint(bts)
+			if n <= 0 {
+				return ErrProofMalformed
+			}
+			bts = bts[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(bts)
+			if n <= 0 || length > uint64(len(bts)-n) {
+				return ErrProofMalformed
+			}
+			b = bts[n : n+int(length)]
+			bts = bts[n+int(length):]
+		case 1: // 64-bit
+			if len(bts) < 8 {
+				return ErrProofMalformed
+			}
+			bts = bts[8:]
+			continue
+		case 5: // 32-bit
+			if len(bts) < 4 {
+				return ErrProofMalformed
+			}
+			bts = bts[4:]
+			continue
+		default:
+			return ErrProofMalformed
+		}
+
+		if err := fn(key>>3, key&7, value, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeMessageHeader decodes an encoded message without its proofs, the
+// state is sliced from bts.
+func decodeMessageHeader(bts []byte) (*Message, error) {
+	m := new(Message)
+	err := walkMessage(bts, func(field uint64, wire uint64, value uint64, b []byte) error {
+		switch field {
+		case messageFieldType, messageFieldHeight, messageFieldRound:
+			if wire != wireVarint {
+				return ErrProofMalformed
+			}
+		case messageFieldState:
+			if wire != wireBytes {
+				return ErrProofMalformed
+			}
+		}
+
+		switch field {
+		case messageFieldType:
+			m.Type = MessageType(value)
+		case messageFieldHeight:
+			m.Height = value
+		case messageFieldRound:
+			m.Round = value
+		case messageFieldState:
+			m.State = b
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DefaultProofHistory is the default number of latest decided heights whose
+// <decide> proofs are retained for ExportProofs.
+const DefaultProofHistory = 128
+
+// retainProof records the <decide> proof of a decided height, and evicts the
+// proofs of the oldest heights beyond the history limit.
+func (c *Consensus) retainProof(height uint64, proof *SignedProto) {
+	if c.proofHistory < 0 || proof == nil {
+		return
+	}
+
+	if c.proofs == nil {
+		c.proofs = make(map[uint64][]byte)
+	}
+	c.proofs[height] = append([]byte{}, proof.Bytes()...)
+	c.proofHeights = append(c.proofHeights, height)
+
+	for len(c.proofHeights) > c.proofHistory {
+		delete(c.proofs, c.proofHeights[0])
+		c.proofHeights = c.proofHeights[1:]
+	}
+}
+
+// ExportProofs returns the encoded <decide> proofs of the decided heights in
+// [from, to], to be verified by VerifyProofChain. Only the proofs of latest
+// Config.ProofHistory heights decided by this participant are retained,
+// ErrExportHeight will be returned if any height in the range is missing,
+// eg: skipped by Sync.
+func (c *Consensus) ExportProofs(from, to uint64) ([][]byte, error) {
+	if from > to {
+		return nil, ErrExportRange
+	}
+
+	var proofs [][]byte
+	for h := from; ; h++ {
+		proof, ok := c.proofs[h]
+		if !ok {
+			return nil, ErrExportHeight
+		}
+		proofs = append(proofs, proof)
+		if h == to {
+			break
+		}
+	}
+	return proofs, nil
+}
+
+// DecideSigners returns the identities of the participants whose <commit>
+// messages are aggregated in the <decide> proof of a decided height, sorted
+// by identity, for attribution of the finalized decisions. The signers are
+// read from the proof recorded at decision, so <commit> messages arriving
+// afterwards don't change them. Returns false if the proof of the height is
+// not retained, see Config.ProofHistory.
+func (c *Consensus) DecideSigners(height uint64) ([]Identity, bool) {
+	bts, ok := c.proofs[height]
+	if !ok {
+		if height != c.latestHeight || c.latestProof == nil {
+			return nil, false
+		}
+		bts = c.latestProof.Bytes()
+	}
+
+	var proof SignedProto
+	if err := proto.Unmarshal(bts, &proof); err != nil {
+		return nil, false
+	}
+	m := new(Message)
+	if err := proto.Unmarshal(proof.Message, m); err != nil {
+		return nil, false
+	}
+
+	var signers []Identity
+	seen := make(map[Identity]struct{}, len(m.Proof))
+	for _, commit := range m.Proof {
+		// compact messages have their public key recovered first
+		if commit.RecoverPublicKey(c.hasher) != nil {
+			continue
+		}
+		signer := c.pubKeyToIdentity(commit.PublicKey(c.curve))
+		if _, duplicated := seen[signer]; !duplicated {
+			seen[signer] = struct{}{}
+			signers = append(signers, signer)
+		}
+	}
+
+	sort.Slice(signers, func(i, j int) bool { return bytes.Compare(signers[i][:], signers[j][:]) < 0 })
+	return signers, true
+}
+
+// VerifyProofChain verifies the encoded <decide> proofs of consecutive heights
+// exported by ExportProofs, each proof is verified independently by
+// VerifyDecideProof against the same participants, and returns the last
+// decided height & state.
+func VerifyProofChain(participants []Identity, proofs [][]byte) (lastHeight uint64, lastState State, err error) {
+	return ProofVerifier{}.VerifyProofChain(participants, proofs)
+}
+
+// VerifyProofChain verifies the encoded <decide> proofs as the package level
+// VerifyProofChain does.
+func (v ProofVerifier) VerifyProofChain(participants []Identity, proofs [][]byte) (lastHeight uint64, lastState State, err error) {
+	return v.VerifyProofChainWith(func(uint64) []Identity { return participants }, proofs)
+}
+
+// VerifyProofChainWith verifies the proofs as VerifyProofChain does, with the
+// participants of each height resolved by the callback, for the consensus
+// groups changed in the range.
+func VerifyProofChainWith(resolve func(height uint64) []Identity, proofs [][]byte) (lastHeight uint64, lastState State, err error) {
+	return ProofVerifier{}.VerifyProofChainWith(resolve, proofs)
+}
+
+// VerifyProofChainWith verifies the encoded <decide> proofs as the package
+// level VerifyProofChainWith does.
+func (v ProofVerifier) VerifyProofChainWith(resolve func(height uint64) []Identity, proofs [][]byte) (lastHeight uint64, lastState State, err error) {
+	if len(proofs) == 0 {
+		return 0, nil, ErrProofChainEmpty
+	}
+
+	for k := range proofs {
+		signed, err := DecodeSignedMessage(proofs[k])
+		if err != nil {
+			return 0, nil, err
+		}
+
+		// the height is read before verification to resolve the participants,
+		// and will be verified along with the proof.
+		m, err := decodeMessageHeader(signed.Message)
+		if err != nil {
+			return 0, nil, err
+		}
+		if k > 0 && m.Height != lastHeight+1 {
+			return 0, nil, ErrProofChainHeight
+		}
+
+		height, state, err := verifyDecideStream(v.group(resolve(m.Height)), signed)
+		if err != nil {
+			return 0, nil, err
+		}
+		lastHeight, lastState = height, state
+	}
+	return lastHeight, lastState, nil
+}
@@ -0,0 +1,410 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createDecideProof creates a <decide> proof signed by leader with <commit>
+// proofs from the signers
+func createDecideProof(t testing.TB, height uint64, round uint64, state State, leader *ecdsa.PrivateKey, signers []*ecdsa.PrivateKey) *SignedProto {
+	m := new(Message)
+	m.Type = MessageType_Decide
+	m.Height = height
+	m.Round = round
+	m.State = state
+	for _, key := range signers {
+		_, commit, _ := createCommitMessageSigner(t, height, round, state, key)
+		m.Proof = append(m.Proof, commit)
+	}
+
+	signed := new(SignedProto)
+	signed.Sign(m, leader)
+	return signed
+}
+
+func TestVerifyDecideProof(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []Identity
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+	forged, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	state := State("state")
+
+	// quorum
+	height, decided, err := VerifyDecideProof(participants, createDecideProof(t, 10, 2, state, keys[0], keys[:3]))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), height)
+	assert.Equal(t, state, decided)
+
+	// sub-quorum
+	_, _, err = VerifyDecideProof(participants, createDecideProof(t, 10, 2, state, keys[0], keys[:2]))
+	assert.Equal(t, ErrDecideProofInsufficient, err)
+
+	// duplicated signers
+	_, _, err = VerifyDecideProof(participants, createDecideProof(t, 10, 2, state, keys[0], []*ecdsa.PrivateKey{keys[0], keys[1], keys[1]}))
+	assert.Equal(t, ErrDecideProofDuplicateSigner, err)
+
+	// forged signers
+	_, _, err = VerifyDecideProof(participants, createDecideProof(t, 10, 2, state, keys[0], []*ecdsa.PrivateKey{keys[0], keys[1], forged}))
+	assert.Equal(t, ErrDecideProofUnknownParticipant, err)
+	_, _, err = VerifyDecideProof(participants, createDecideProof(t, 10, 2, state, forged, keys[:3]))
+	assert.Equal(t, ErrMessageUnknownParticipant, err)
+
+	// tampered signature
+	proof := createDecideProof(t, 10, 2, state, keys[0], keys[:3])
+	proof.Message = append(proof.Message, 0)
+	_, _, err = VerifyDecideProof(participants, proof)
+	assert.Equal(t, ErrMessageSignature, err)
+
+	// commits to another state are rejected, even along with a quorum
+	proof = createDecideProof(t, 10, 2, state, keys[0], keys[:3])
+	m, err := DecodeMessage(proof.Message)
+	assert.Nil(t, err)
+	_, commit, _ := createCommitMessageSigner(t, 10, 2, State("other"), keys[3])
+	m.Proof = append(m.Proof, commit)
+	proof.Sign(m, keys[0])
+	_, _, err = VerifyDecideProof(participants, proof)
+	assert.Equal(t, ErrDecideProofStateMismatch, err)
+}
+
+func TestProofVerifierConfig(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []Identity
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+	state := State("state")
+
+	// weights
+	weights := map[Identity]uint64{participants[0]: 10, participants[1]: 1, participants[2]: 1, participants[3]: 1}
+	proof := createDecideProof(t, 10, 2, state, keys[0], keys[:1])
+	_, _, err := VerifyDecideProof(participants, proof)
+	assert.Equal(t, ErrDecideProofInsufficient, err)
+	_, decided, err := ProofVerifier{Weights: weights}.VerifyDecideProof(participants, proof)
+	assert.Nil(t, err)
+	assert.Equal(t, state, decided)
+	proof = createDecideProof(t, 10, 2, state, keys[1], keys[1:])
+	_, _, err = ProofVerifier{Weights: weights}.VerifyDecideProof(participants, proof)
+	assert.Equal(t, ErrDecideProofInsufficient, err)
+	overflowed := map[Identity]uint64{participants[0]: math.MaxUint64, participants[1]: 1}
+	proof = createDecideProof(t, 10, 2, state, keys[0], keys)
+	_, _, err = ProofVerifier{Weights: overflowed}.VerifyDecideProof(participants, proof)
+	assert.Equal(t, ErrDecideProofInsufficient, err)
+
+	// quorum size
+	proof = createDecideProof(t, 10, 2, state, keys[0], keys[:3])
+	all := func(n int) int { return n }
+	_, _, err = ProofVerifier{QuorumSize: all}.VerifyDecideProof(participants, proof)
+	assert.Equal(t, ErrDecideProofInsufficient, err)
+	bts, err := proof.Marshal()
+	assert.Nil(t, err)
+	_, _, err = ProofVerifier{QuorumSize: all}.VerifyDecideProofBytes(participants, bts)
+	assert.Equal(t, ErrDecideProofInsufficient, err)
+
+	// accepted versions, with a <commit> in the proof signed under version N+1
+	proof = createDecideProof(t, 10, 2, state, keys[0], keys[:3])
+	dm := new(Message)
+	assert.Nil(t, dm.Unmarshal(proof.Message))
+	dm.Proof[0] = &SignedProto{Version: ProtocolVersion + 1, Message: dm.Proof[0].Message}
+	dm.Proof[0].X, dm.Proof[0].Y = proof.X, proof.Y
+	dm.Proof[0].R, dm.Proof[0].S, err = NewECDSASigner(keys[0]).Sign(dm.Proof[0].Hash())
+	assert.Nil(t, err)
+	proof = new(SignedProto)
+	proof.Sign(dm, keys[0])
+	_, _, err = VerifyDecideProof(participants, proof)
+	assert.Equal(t, ErrProtocolVersion, err)
+	upgrading := ProofVerifier{AcceptedVersions: []uint32{ProtocolVersion, ProtocolVersion + 1}}
+	_, decided, err = upgrading.VerifyDecideProof(participants, proof)
+	assert.Nil(t, err)
+	assert.Equal(t, state, decided)
+	_, _, err = ProofVerifier{AcceptedVersions: []uint32{ProtocolVersion + 1}}.VerifyDecideProof(participants, proof)
+	assert.Equal(t, ErrProtocolVersion, err)
+
+	// hasher & domain separator of a network
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		config.Hasher = Keccak256Hasher
+		config.DomainSeparator = []byte("network")
+	})
+	for _, node := range net.nodes {
+		node.Propose(state)
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	verifier := ProofVerifier{Hasher: Keccak256Hasher, DomainSeparator: []byte("network")}
+	_, _, err = VerifyDecideProof(net.configs[0].Participants, net.nodes[0].CurrentProof())
+	assert.Equal(t, ErrMessageSignature, err)
+	_, decided, err = verifier.VerifyDecideProof(net.configs[0].Participants, net.nodes[0].CurrentProof())
+	assert.Nil(t, err)
+	assert.Equal(t, state, decided)
+
+	_, _, err = DecodeSignedProto(net.nodes[0].CurrentProof().Bytes())
+	assert.Equal(t, ErrMessageSignature, err)
+	_, m, err := verifier.DecodeSignedProto(net.nodes[0].CurrentProof().Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, MessageType_Decide, m.Type)
+}
+
+func TestVerifyDecideProofNetwork(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	height, state, err := VerifyDecideProof(net.configs[0].Participants, net.nodes[0].CurrentProof())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), height)
+	assert.Equal(t, State("state"), state)
+}
+
+func TestExportProofs(t *testing.T) {
+	net := newMemNetworkConfig(t, 4, func(config *Config) { config.ProofHistory = 3 })
+	for h := uint64(1); h <= 5; h++ {
+		for _, node := range net.nodes {
+			node.Propose([]byte{byte(h)})
+		}
+		for i := 0; i < 10000 && !net.decided(h); i++ {
+			net.step(20 * time.Millisecond)
+		}
+		assert.True(t, net.decided(h))
+	}
+
+	node := net.nodes[0]
+	_, err := node.ExportProofs(3, 2)
+	assert.Equal(t, ErrExportRange, err)
+	// heights beyond the history are evicted
+	_, err = node.ExportProofs(2, 5)
+	assert.Equal(t, ErrExportHeight, err)
+	_, err = node.ExportProofs(3, 6)
+	assert.Equal(t, ErrExportHeight, err)
+
+	proofs, err := node.ExportProofs(3, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(proofs))
+
+	participants := net.configs[0].Participants
+	height, state, err := VerifyProofChain(participants, proofs)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), height)
+	assert.Equal(t, State{5}, state)
+
+	single, err := node.ExportProofs(4, 4)
+	assert.Nil(t, err)
+	height, state, err = VerifyProofChain(participants, single)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), height)
+	assert.Equal(t, State{4}, state)
+
+	_, _, err = VerifyProofChain(participants, nil)
+	assert.Equal(t, ErrProofChainEmpty, err)
+	_, _, err = VerifyProofChain(participants, [][]byte{proofs[0], proofs[2]})
+	assert.Equal(t, ErrProofChainHeight, err)
+	_, _, err = VerifyProofChain(participants, [][]byte{proofs[0], proofs[1][:len(proofs[1])/2]})
+	assert.NotNil(t, err)
+
+	// the participants are resolved for each height
+	others := newMemNetwork(t, 4).configs[0].Participants
+	resolve := func(height uint64) []Identity {
+		if height == 5 {
+			return others
+		}
+		return participants
+	}
+	_, _, err = VerifyProofChainWith(resolve, proofs)
+	assert.Equal(t, ErrMessageUnknownParticipant, err)
+	height, _, err = VerifyProofChainWith(resolve, proofs[:2])
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), height)
+}
+
+func TestDecideSigners(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	_, ok := net.nodes[0].DecideSigners(1)
+	assert.False(t, ok)
+
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	signers, ok := net.nodes[0].DecideSigners(1)
+	assert.True(t, ok)
+	assert.True(t, len(signers) >= 3)
+	for k, signer := range signers {
+		assert.Contains(t, net.configs[0].Participants, signer)
+		if k > 0 {
+			assert.True(t, bytes.Compare(signers[k-1][:], signer[:]) < 0)
+		}
+	}
+
+	// late <commit> messages don't change the signers
+	for i := 0; i < 100; i++ {
+		net.step(20 * time.Millisecond)
+	}
+	again, ok := net.nodes[0].DecideSigners(1)
+	assert.True(t, ok)
+	assert.Equal(t, signers, again)
+
+	_, ok = net.nodes[0].DecideSigners(2)
+	assert.False(t, ok)
+}
+
+func TestVerifyDecideProofBytes(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []Identity
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+	forged, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	state := State("state")
+
+	// the same results as VerifyDecideProof
+	for _, proof := range []*SignedProto{
+		createDecideProof(t, 10, 2, state, keys[0], keys[:3]),
+		createDecideProof(t, 10, 2, state, keys[0], keys[:2]),
+		createDecideProof(t, 10, 2, state, keys[0], []*ecdsa.PrivateKey{keys[0], keys[1], keys[1]}),
+		createDecideProof(t, 10, 2, state, keys[0], []*ecdsa.PrivateKey{keys[0], keys[1], forged}),
+		createDecideProof(t, 10, 2, state, forged, keys[:3]),
+		createDecideProof(t, 10, 2, nil, keys[0], keys[:3]),
+	} {
+		height, decided, err := VerifyDecideProof(participants, proof)
+		streamHeight, streamDecided, streamErr := VerifyDecideProofBytes(participants, proof.Bytes())
+		assert.Equal(t, err, streamErr)
+		assert.Equal(t, height, streamHeight)
+		assert.Equal(t, decided, streamDecided)
+	}
+
+	height, decided, err := VerifyDecideProofBytes(participants, createDecideProof(t, 10, 2, state, keys[0], keys[:3]).Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), height)
+	assert.Equal(t, state, decided)
+
+	// stops at the first forged <commit>, before reaching a malformed one
+	m := new(Message)
+	m.Type = MessageType_Decide
+	m.Height = 10
+	m.Round = 2
+	m.State = state
+	_, commit, _ := createCommitMessageSigner(t, 10, 2, state, keys[1])
+	commit.S[0] ^= 1
+	m.Proof = append(m.Proof, commit, &SignedProto{Message: []byte{0xff}})
+	proof := new(SignedProto)
+	proof.Sign(m, keys[0])
+	_, _, err = VerifyDecideProofBytes(participants, proof.Bytes())
+	assert.Equal(t, ErrMessageSignature, err)
+
+	// malformed encoding
+	_, _, err = VerifyDecideProofBytes(participants, []byte{0xff})
+	assert.NotNil(t, err)
+	// a proof truncated in the enclosed message
+	_, err = decodeMessageHeader(append(proof.Message, byte(messageFieldProof<<3|wireBytes), 0x10))
+	assert.Equal(t, ErrProofMalformed, err)
+	// a varint field of the header in another wire type
+	_, err = decodeMessageHeader([]byte{byte(messageFieldHeight<<3 | wireBytes), 0})
+	assert.Equal(t, ErrProofMalformed, err)
+}
+
+// BenchmarkVerifyDecideProof500 compares the memory of verifying a <decide>
+// proof of 500 signers decoded at once, and streamed from its encoding.
+func BenchmarkVerifyDecideProof500(b *testing.B) {
+	var keys []*ecdsa.PrivateKey
+	var participants []Identity
+	for i := 0; i < 500; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(b, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+	bts := createDecideProof(b, 10, 2, State("state"), keys[0], keys).Bytes()
+
+	run := func(b *testing.B, verify func() error) {
+		// collect frequently to keep the heap close to the live objects, and
+		// verify every signature for the sampling to catch the peak
+		defer debug.SetGCPercent(debug.SetGCPercent(1))
+		SetVerifyCacheSize(0)
+		defer SetVerifyCacheSize(DefaultVerifyCacheSize)
+		var peak uint64
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var stats runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			base := stats.HeapAlloc
+
+			done := make(chan struct{})
+			sampled := make(chan uint64)
+			go func() {
+				var max uint64
+				for {
+					select {
+					case <-done:
+						sampled <- max
+						return
+					default:
+					}
+					var stats runtime.MemStats
+					runtime.ReadMemStats(&stats)
+					if stats.HeapAlloc > base && stats.HeapAlloc-base > max {
+						max = stats.HeapAlloc - base
+					}
+					time.Sleep(100 * time.Microsecond)
+				}
+			}()
+			if err := verify(); err != nil {
+				b.Fatal(err)
+			}
+			close(done)
+			if max := <-sampled; max > peak {
+				peak = max
+			}
+		}
+		b.ReportMetric(float64(peak), "peak-B")
+	}
+
+	b.Run("decoded", func(b *testing.B) {
+		run(b, func() error {
+			signed, err := DecodeSignedMessage(bts)
+			if err != nil {
+				return err
+			}
+			_, _, err = VerifyDecideProof(participants, signed)
+			return err
+		})
+	})
+	b.Run("streaming", func(b *testing.B) {
+		run(b, func() error {
+			_, _, err := VerifyDecideProofBytes(participants, bts)
+			return err
+		})
+	})
+}
@@ -0,0 +1,111 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import "github.com/Sperax/bdls/crypto/blake2b"
+
+// seenKey identifies a processed message to make replays idempotent
+type seenKey struct {
+	identity Identity
+	height   uint64
+	round    uint64
+	msgType  MessageType
+	hash     [blake2b.Size256]byte
+}
+
+// seenKey derives the replay record of a verified message
+func (c *Consensus) seenKey(m *Message, signed *SignedProto) seenKey {
+	return seenKey{
+		identity: c.pubKeyToIdentity(signed.PublicKey(c.curve)),
+		height:   m.Height,
+		round:    m.Round,
+		msgType:  m.Type,
+		hash:     blake2b.Sum256(signed.Message),
+	}
+}
+
+// maxSeenPerSender caps the replay records of a sender at a height, messages
+// beyond the cap are still processed, but their replays are not dropped.
+const maxSeenPerSender = 64
+
+// seenSender identifies the replay records of a sender at a height
+type seenSender struct {
+	identity Identity
+	height   uint64
+}
+
+// markSeen records a message which has been stored or counted
+func (c *Consensus) markSeen(key seenKey) {
+	if c.seen == nil {
+		c.seen = make(map[seenKey]struct{})
+		c.seenCount = make(map[seenSender]int)
+	}
+	if _, ok := c.seen[key]; ok {
+		return
+	}
+
+	sender := seenSender{key.identity, key.height}
+	if c.seenCount[sender] >= maxSeenPerSender {
+		return
+	}
+	c.seen[key] = struct{}{}
+	c.seenCount[sender]++
+}
+
+// unmarkSeen removes the replay record of a message no longer kept, so the
+// message will be accepted again if retransmitted.
+func (c *Consensus) unmarkSeen(m *Message, signed *SignedProto) {
+	key := c.seenKey(m, signed)
+	if _, ok := c.seen[key]; !ok {
+		return
+	}
+	delete(c.seen, key)
+
+	sender := seenSender{key.identity, key.height}
+	if c.seenCount[sender]--; c.seenCount[sender] <= 0 {
+		delete(c.seenCount, sender)
+	}
+}
+
+// pruneSeen removes replay records below the given height, messages below
+// the decided height will be rejected by height checks.
+func (c *Consensus) pruneSeen(height uint64) {
+	for key := range c.seen {
+		if key.height < height {
+			delete(c.seen, key)
+		}
+	}
+	for sender := range c.seenCount {
+		if sender.height < height {
+			delete(c.seenCount, sender)
+		}
+	}
+}
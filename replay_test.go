@@ -0,0 +1,125 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayLockMessage(t *testing.T) {
+	_, sp, privateKey, proofKeys := createLockMessage(t, 20, 1, 10, 1, 10)
+	consensus := createConsensus(t, 0, 1, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.AddParticipant(&privateKey.PublicKey)
+	// count the <lock> messages passed into processing
+	var locks int
+	validator := func(c *Consensus, m *Message, sp *SignedProto) bool {
+		if m.Type == MessageType_Lock {
+			locks++
+		}
+		return true
+	}
+	consensus.messageValidator = validator
+
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, 1, len(consensus.locks))
+	assert.Equal(t, 1, locks)
+	// the <lock> only, my <commit> via loopback isn't counted by a non-leader
+	assert.Equal(t, 1, len(consensus.seen))
+
+	// replay
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, 1, len(consensus.locks))
+	assert.Equal(t, 1, locks)
+	assert.Equal(t, 1, len(consensus.seen))
+
+	// replay after restart
+	snapshot, err := consensus.Snapshot()
+	assert.Nil(t, err)
+	config := &Config{
+		Epoch:            time.Now(),
+		PrivateKey:       consensus.privateKey,
+		Participants:     consensus.participants,
+		StateCompare:     StateCompareBytes,
+		StateValidate:    func(State) bool { return true },
+		MessageValidator: validator,
+	}
+	restored, err := LoadConsensus(config, snapshot)
+	assert.Nil(t, err)
+	restored.SetLeader(&privateKey.PublicKey)
+	assert.Equal(t, consensus.seen, restored.seen)
+	assert.Nil(t, restored.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, 1, len(restored.locks))
+	assert.Equal(t, 1, locks)
+
+	// pruned below the decided height
+	consensus.heightSync(1, 0, State("state"), time.Now())
+	assert.Equal(t, 1, len(consensus.seen))
+	consensus.heightSync(2, 0, State("state"), time.Now())
+	assert.Equal(t, 0, len(consensus.seen))
+}
+
+func TestReplayIgnored(t *testing.T) {
+	_, _, key := createRoundChangeMessage(t, 1, 0)
+	_, _, other := createRoundChangeMessage(t, 1, 0)
+	quorum := []*ecdsa.PublicKey{&key.PublicKey, &other.PublicKey}
+	for i := 0; i < 4; i++ {
+		quorum = append(quorum, &mustGenerateKey(t).PublicKey)
+	}
+	consensus := createConsensus(t, 0, 0, quorum)
+	roundChange := func(signer *ecdsa.PrivateKey, round uint64) []byte {
+		_, sp, _ := createRoundChangeMessageSigner(t, 1, round, nil, signer)
+		return sp.Bytes()
+	}
+
+	// a stored message is recorded
+	assert.Nil(t, consensus.ReceiveMessage(roundChange(key, 5), time.Now()))
+	assert.Equal(t, 1, len(consensus.seen))
+	assert.Nil(t, consensus.ReceiveMessage(roundChange(key, 5), time.Now()))
+	assert.Equal(t, uint64(1), consensus.DropStats()[DropReplayed])
+
+	// an ignored message is not recorded, and processed again if retransmitted
+	superseded := roundChange(key, 3)
+	assert.Nil(t, consensus.ReceiveMessage(superseded, time.Now()))
+	assert.Nil(t, consensus.ReceiveMessage(superseded, time.Now()))
+	assert.Equal(t, uint64(2), consensus.DropStats()[DropSuperseded])
+	assert.Equal(t, 1, len(consensus.seen))
+
+	// a message removed by a higher round is no longer recorded
+	assert.Nil(t, consensus.ReceiveMessage(roundChange(key, 7), time.Now()))
+	assert.Equal(t, 1, len(consensus.seen))
+	assert.Nil(t, consensus.ReceiveMessage(roundChange(key, 5), time.Now()))
+	assert.Equal(t, uint64(3), consensus.DropStats()[DropSuperseded])
+
+	// a message evicted by Config.MaxPendingMessages will be accepted again
+	consensus.maxPendingMessages = 1
+	assert.Nil(t, consensus.ReceiveMessage(roundChange(other, 2), time.Now()))
+	assert.Equal(t, 1, len(consensus.seen))
+	assert.Equal(t, ErrMessagePoolFull, consensus.ReceiveMessage(roundChange(key, 7), time.Now()))
+	assert.Equal(t, uint64(1), consensus.DropStats()[DropReplayed])
+}
+
+func TestReplayCap(t *testing.T) {
+	consensus := createConsensus(t, 0, 0, nil)
+	var key seenKey
+	for i := 0; i < 2*maxSeenPerSender; i++ {
+		key.round = uint64(i)
+		consensus.markSeen(key)
+	}
+	assert.Equal(t, maxSeenPerSender, len(consensus.seen))
+
+	// other senders are not affected
+	key.identity[0]++
+	consensus.markSeen(key)
+	assert.Equal(t, maxSeenPerSender+1, len(consensus.seen))
+
+	// and room is made by removing
+	consensus.pruneSeen(1)
+	assert.Equal(t, 0, len(consensus.seen))
+	assert.Equal(t, 0, len(consensus.seenCount))
+}
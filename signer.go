@@ -0,0 +1,283 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"math/big"
+
+	"github.com/Sperax/bdls/crypto/btcec"
+	proto "github.com/gogo/protobuf/proto"
+)
+
+// SignatureScheme identifies the algorithm signing a message, all participants
+// in a consensus group MUST use the same scheme.
+type SignatureScheme uint32
+
+const (
+	// SchemeSecp256k1 signs messages with ECDSA, the public key is carried in X & Y
+	SchemeSecp256k1 SignatureScheme = 0
+	// SchemeEd25519 signs messages with ed25519, the 32-byte public key is carried
+	// in X with Y left zero, and the 64-byte signature is split into R & S.
+	SchemeEd25519 SignatureScheme = 1
+)
+
+// String returns the name of the signature scheme
+func (s SignatureScheme) String() string {
+	switch s {
+	case SchemeSecp256k1:
+		return "secp256k1"
+	case SchemeEd25519:
+		return "ed25519"
+	}
+	return "unknown"
+}
+
+// Signer signs the digests of messages, as returned by SignedProto.HashWith
+type Signer interface {
+	// Scheme returns the signature scheme of this signer
+	Scheme() SignatureScheme
+	// PublicKey returns the public key to be carried in X & Y of messages
+	PublicKey() (X PubKeyAxis, Y PubKeyAxis, err error)
+	// Sign signs the digest, and returns the signature in r & s
+	Sign(digest []byte) (r []byte, s []byte, err error)
+}
+
+// Verifier verifies the signatures produced by a Signer of the same scheme
+type Verifier interface {
+	// Scheme returns the signature scheme of this verifier
+	Scheme() SignatureScheme
+	// Verify verifies the signature r & s of the digest against the public key X & Y
+	Verify(X PubKeyAxis, Y PubKeyAxis, digest []byte, r []byte, s []byte) error
+}
+
+// KeySigner signs digests with an ECDSA key which is never exposed to the
+// consensus core, like a key kept in an HSM or by a remote signer.
+//
+// Signer is the abstraction the core signs messages with, in any scheme and
+// in the wire form of r & s. KeySigner is the narrower shape exposed by ECDSA
+// key stores, it's adapted to a Signer by NewECDSAKeySigner, which enforces
+// the canonical low-S form, so implementations don't have to care about the
+// wire format.
+type KeySigner interface {
+	// PublicKey returns the public key of the signing key
+	PublicKey() *ecdsa.PublicKey
+	// Sign signs the digest, and returns the signature in r & s
+	Sign(digest []byte) (r *big.Int, s *big.Int, err error)
+}
+
+// softwareSigner is a KeySigner with an in-memory private key
+type softwareSigner struct {
+	key  *ecdsa.PrivateKey
+	rand io.Reader
+}
+
+// NewSoftwareSigner creates a KeySigner with an in-memory private key, the
+// entropy of nonces is read from the given reader, a nil reader is rand.Reader.
+// With other readers on secp256k1, the nonces are derived from the key and the
+// digest as described in RFC6979, with 32 bytes read from the reader as the
+// additional data, so the signatures are reproducible if the reader yields the
+// same bytes, while nonces are never reused across digests.
+func NewSoftwareSigner(key *ecdsa.PrivateKey, r io.Reader) KeySigner {
+	if r == nil {
+		r = rand.Reader
+	}
+	return &softwareSigner{key, r}
+}
+
+func (s *softwareSigner) PublicKey() *ecdsa.PublicKey { return &s.key.PublicKey }
+
+func (s *softwareSigner) Sign(digest []byte) (r *big.Int, ss *big.Int, err error) {
+	if s.rand == rand.Reader || s.key.Curve != S256Curve {
+		return ecdsa.Sign(s.rand, s.key, digest)
+	}
+
+	var extra [32]byte
+	if _, err = io.ReadFull(s.rand, extra[:]); err != nil {
+		return nil, nil, err
+	}
+	sig, err := (*btcec.PrivateKey)(s.key).SignWithEntropy(digest, extra[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return sig.R, sig.S, nil
+}
+
+// ecdsaSigner signs digests with a KeySigner in low-S form, the public key
+// is read once on creation, as it may be a round-trip to a remote signer.
+type ecdsaSigner struct {
+	key KeySigner
+	pub *ecdsa.PublicKey
+}
+
+// NewECDSASigner creates a Signer of SchemeSecp256k1 from an ECDSA private key
+func NewECDSASigner(key *ecdsa.PrivateKey) Signer { return NewECDSASignerRand(key, nil) }
+
+// clonePrivateKey returns a deep copy of key, sharing no big.Int memory.
+func clonePrivateKey(key *ecdsa.PrivateKey) *ecdsa.PrivateKey {
+	clone := &ecdsa.PrivateKey{D: new(big.Int).Set(key.D)}
+	clone.Curve = key.Curve
+	clone.X = new(big.Int).Set(key.X)
+	clone.Y = new(big.Int).Set(key.Y)
+	return clone
+}
+
+// NewECDSASignerRand creates a Signer of SchemeSecp256k1 from an ECDSA private
+// key, the nonces are read from the given reader, see NewSoftwareSigner.
+func NewECDSASignerRand(key *ecdsa.PrivateKey, r io.Reader) Signer {
+	return NewECDSAKeySigner(NewSoftwareSigner(key, r))
+}
+
+// NewECDSAKeySigner creates a Signer of SchemeSecp256k1 signing with a KeySigner
+func NewECDSAKeySigner(key KeySigner) Signer { return &ecdsaSigner{key, key.PublicKey()} }
+
+func (e *ecdsaSigner) Scheme() SignatureScheme { return SchemeSecp256k1 }
+
+func (e *ecdsaSigner) PublicKey() (X PubKeyAxis, Y PubKeyAxis, err error) {
+	if e.pub == nil || e.pub.Curve == nil || e.pub.X == nil || e.pub.Y == nil {
+		err = ErrPubKey
+		return
+	}
+	if err = X.Unmarshal(e.pub.X.Bytes()); err != nil {
+		return
+	}
+	err = Y.Unmarshal(e.pub.Y.Bytes())
+	return
+}
+
+func (e *ecdsaSigner) Sign(digest []byte) (r []byte, s []byte, err error) {
+	if e.pub == nil || e.pub.Curve == nil {
+		return nil, nil, ErrPubKey
+	}
+	R, S, err := e.key.Sign(digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if R == nil || S == nil {
+		return nil, nil, ErrRSOutOfRange
+	}
+
+	// enforce canonical low-S form to prevent signature malleability,
+	// as (r, N-s) is also a valid signature for the same message.
+	N := e.pub.Curve.Params().N
+	if S.Cmp(new(big.Int).Rsh(N, 1)) > 0 {
+		S = new(big.Int).Sub(N, S)
+	}
+	return R.Bytes(), S.Bytes(), nil
+}
+
+// ecdsaVerifier verifies ECDSA signatures on a curve
+type ecdsaVerifier struct{ curve elliptic.Curve }
+
+// NewECDSAVerifier creates a Verifier of SchemeSecp256k1 on the given curve
+func NewECDSAVerifier(curve elliptic.Curve) Verifier { return &ecdsaVerifier{curve} }
+
+func (e *ecdsaVerifier) Scheme() SignatureScheme { return SchemeSecp256k1 }
+
+func (e *ecdsaVerifier) Verify(X PubKeyAxis, Y PubKeyAxis, digest []byte, r []byte, s []byte) error {
+	sp := &SignedProto{X: X, Y: Y, R: r, S: s}
+	return sp.verifyHash(e.curve, digest)
+}
+
+// ed25519Signer signs digests with an ed25519 private key
+type ed25519Signer struct{ key ed25519.PrivateKey }
+
+// NewEd25519Signer creates a Signer of SchemeEd25519 from an ed25519 private key
+func NewEd25519Signer(key ed25519.PrivateKey) Signer { return &ed25519Signer{key} }
+
+func (e *ed25519Signer) Scheme() SignatureScheme { return SchemeEd25519 }
+
+func (e *ed25519Signer) PublicKey() (X PubKeyAxis, Y PubKeyAxis, err error) {
+	copy(X[:], e.key.Public().(ed25519.PublicKey))
+	return
+}
+
+func (e *ed25519Signer) Sign(digest []byte) (r []byte, s []byte, err error) {
+	sig := ed25519.Sign(e.key, digest)
+	return sig[:ed25519.SignatureSize/2], sig[ed25519.SignatureSize/2:], nil
+}
+
+// ed25519Verifier verifies ed25519 signatures
+type ed25519Verifier struct{}
+
+// NewEd25519Verifier creates a Verifier of SchemeEd25519
+func NewEd25519Verifier() Verifier { return ed25519Verifier{} }
+
+func (ed25519Verifier) Scheme() SignatureScheme { return SchemeEd25519 }
+
+func (ed25519Verifier) Verify(X PubKeyAxis, Y PubKeyAxis, digest []byte, r []byte, s []byte) error {
+	if X == (PubKeyAxis{}) || Y != (PubKeyAxis{}) {
+		return ErrBadPubKey
+	}
+
+	if len(r) != ed25519.SignatureSize/2 || len(s) != ed25519.SignatureSize/2 {
+		return ErrRSOutOfRange
+	}
+
+	sig := make([]byte, 0, ed25519.SignatureSize)
+	sig = append(append(sig, r...), s...)
+	if !ed25519.Verify(ed25519.PublicKey(X[:]), digest, sig) {
+		return ErrSigMismatch
+	}
+	return nil
+}
+
+// Ed25519Identity returns the identity of an ed25519 public key, as the key
+// carried in X followed by zero Y, which equals to the identity derived by
+// DefaultPubKeyToIdentity from SignedProto.PublicKey.
+func Ed25519Identity(pubkey ed25519.PublicKey) (ret Identity) {
+	copy(ret[:SizeAxis], pubkey)
+	return
+}
+
+// SignWithSigner signs the message with a Signer of any scheme, the message is
+// digested with the given hasher, a nil hasher is the DefaultHasher.
+func (sp *SignedProto) SignWithSigner(m *Message, signer Signer, h *Hasher) error {
+	bts, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	sp.Version = ProtocolVersion
+	sp.Message = bts
+	sp.X, sp.Y, err = signer.PublicKey()
+	if err != nil {
+		return err
+	}
+	sp.V = 0
+	sp.Scheme = signer.Scheme()
+
+	sp.R, sp.S, err = signer.Sign(sp.digest(h))
+	return err
+}
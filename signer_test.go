@@ -0,0 +1,255 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	mrand "math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWithSigner(t *testing.T) {
+	m, _, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), mustGenerateKey(t))
+
+	// secp256k1
+	privateKey := mustGenerateKey(t)
+	sp := new(SignedProto)
+	assert.Nil(t, sp.SignWithSigner(m, NewECDSASigner(privateKey), nil))
+	assert.Equal(t, SchemeSecp256k1, sp.Scheme)
+	assert.Nil(t, sp.VerifyWith(S256Curve, nil))
+	assert.Equal(t, DefaultPubKeyToIdentity(&privateKey.PublicKey), DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)))
+
+	// ed25519
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	sp = new(SignedProto)
+	assert.Nil(t, sp.SignWithSigner(m, NewEd25519Signer(key), nil))
+	assert.Equal(t, SchemeEd25519, sp.Scheme)
+	assert.Nil(t, sp.VerifyWith(S256Curve, nil))
+	assert.True(t, sp.Verify(S256Curve))
+	assert.Equal(t, Ed25519Identity(pub), DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)))
+	assert.Nil(t, NewEd25519Verifier().Verify(sp.X, sp.Y, sp.Hash(), sp.R, sp.S))
+
+	// the scheme survives encoding
+	bts, err := sp.Marshal()
+	assert.Nil(t, err)
+	decoded, err := DecodeSignedMessage(bts)
+	assert.Nil(t, err)
+	assert.Equal(t, SchemeEd25519, decoded.Scheme)
+	assert.Nil(t, decoded.VerifyWith(S256Curve, nil))
+	assert.Equal(t, bts, sp.Bytes())
+
+	// signatures don't verify under other schemes
+	decoded.Scheme = SchemeSecp256k1
+	assert.NotNil(t, decoded.VerifyWith(S256Curve, nil))
+	decoded.Scheme = 2
+	assert.Equal(t, ErrScheme, decoded.VerifyWith(S256Curve, nil))
+
+	// tampered
+	sp.Message = append(sp.Message, 0)
+	assert.Equal(t, ErrSigMismatch, sp.VerifyWith(S256Curve, nil))
+	sp.Message = sp.Message[:len(sp.Message)-1]
+	sp.V = 1
+	assert.Equal(t, ErrRecoveryID, sp.VerifyWith(S256Curve, nil))
+}
+
+func TestSignerRand(t *testing.T) {
+	privateKey := mustGenerateKey(t)
+	m, _, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("state"), privateKey)
+	participants := []Identity{DefaultPubKeyToIdentity(&privateKey.PublicKey)}
+	for i := 0; i < 3; i++ {
+		participants = append(participants, DefaultPubKeyToIdentity(&mustGenerateKey(t).PublicKey))
+	}
+
+	// sign with the consensus seeded by Config.Rand
+	sign := func(seed int64) []byte {
+		config := new(Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = privateKey
+		config.Participants = participants
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(State) bool { return true }
+		config.Rand = mrand.New(mrand.NewSource(seed))
+		consensus, err := NewConsensus(config)
+		assert.Nil(t, err)
+
+		sp := new(SignedProto)
+		assert.Nil(t, consensus.sign(sp, m))
+		assert.Nil(t, sp.VerifyWith(S256Curve, nil))
+		return sp.Bytes()
+	}
+
+	// repeated runs produce identical signatures
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, sign(7), sign(7))
+	}
+	assert.NotEqual(t, sign(7), sign(8))
+
+	// the same entropy never reuses a nonce across digests
+	other, _, _ := createRoundChangeMessageSigner(t, 1, 0, []byte("other"), privateKey)
+	first, second := new(SignedProto), new(SignedProto)
+	assert.Nil(t, first.SignWithSigner(m, NewECDSASignerRand(privateKey, bytes.NewReader(make([]byte, 32))), nil))
+	assert.Nil(t, second.SignWithSigner(other, NewECDSASignerRand(privateKey, bytes.NewReader(make([]byte, 32))), nil))
+	assert.NotEqual(t, first.R, second.R)
+	assert.Nil(t, first.VerifyWith(S256Curve, nil))
+	assert.Nil(t, second.VerifyWith(S256Curve, nil))
+
+	// the entropy is read from the reader
+	reader := mrand.New(mrand.NewSource(7))
+	sp := new(SignedProto)
+	assert.Nil(t, sp.SignWithSigner(m, NewECDSASignerRand(privateKey, reader), nil))
+	assert.Equal(t, sign(7), sp.Bytes())
+
+	// reader errors are returned
+	assert.NotNil(t, sp.SignWithSigner(m, NewECDSASignerRand(privateKey, bytes.NewReader(nil)), nil))
+
+	// a nil reader is rand.Reader
+	assert.Nil(t, sp.SignWithSigner(m, NewECDSASignerRand(privateKey, nil), nil))
+	assert.Nil(t, sp.VerifyWith(S256Curve, nil))
+}
+
+// recordingSigner is a KeySigner recording every digest it's asked to sign
+type recordingSigner struct {
+	KeySigner
+	digests [][]byte
+	fail    bool // fails as an unreachable remote signer
+}
+
+func (r *recordingSigner) Sign(digest []byte) (*big.Int, *big.Int, error) {
+	if r.fail {
+		return nil, nil, errors.New("signer unreachable")
+	}
+	r.digests = append(r.digests, append([]byte(nil), digest...))
+	return r.KeySigner.Sign(digest)
+}
+
+func TestConfigSigner(t *testing.T) {
+	var index int
+	var signer *recordingSigner
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		if index == 0 {
+			signer = &recordingSigner{KeySigner: NewSoftwareSigner(config.PrivateKey, nil)}
+			config.Signer = signer
+		}
+		index++
+	})
+	node := net.nodes[0]
+	assert.Nil(t, node.privateKey)
+	identity := DefaultPubKeyToIdentity(&net.configs[0].PrivateKey.PublicKey)
+
+	// every message sent by the node is signed by the signer
+	var sent int
+	for _, node := range net.nodes {
+		node.Propose(State("state"))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		for _, m := range net.queue {
+			sp, err := DecodeSignedMessage(m.bts)
+			assert.Nil(t, err)
+			if DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)) == identity {
+				assert.Contains(t, signer.digests, sp.Hash())
+				sent++
+			}
+		}
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	assert.True(t, sent > 0)
+	assert.NotEmpty(t, signer.digests)
+
+	// failures of the signer are counted, and the messages are not sent
+	signer.fail = true
+	for _, node := range net.nodes {
+		node.Propose(State("next"))
+	}
+	for i := 0; i < 100; i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, node.SignErrors() > 0)
+
+	// and the consensus recovers with the signer
+	signer.fail = false
+	for i := 0; i < 10000 && !net.decided(2); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(2))
+
+	// the key in the signer cannot be rotated
+	assert.Equal(t, ErrRotateKeySigner, node.RotateKey(mustGenerateKey(t)))
+
+	// invalid signers
+	config := net.configs[0].Clone()
+	config.EnableCompactMessage = true
+	assert.True(t, errors.Is(config.Validate(), ErrConfigSigner))
+	config.EnableCompactMessage = false
+	config.MessageSigner = NewECDSASigner(config.PrivateKey)
+	assert.True(t, errors.Is(config.Validate(), ErrConfigSigner))
+	config.MessageSigner = nil
+	config.Signer = &recordingSigner{KeySigner: NewSoftwareSigner(&ecdsa.PrivateKey{}, nil)}
+	assert.True(t, errors.Is(config.Validate(), ErrConfigSigner))
+	config.Signer = signer
+	config.PrivateKey = nil
+	assert.Nil(t, config.Validate())
+}
+
+// mustGenerateKey generates a secp256k1 key
+func mustGenerateKey(t *testing.T) *ecdsa.PrivateKey {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	return privateKey
+}
+
+func TestEd25519Network(t *testing.T) {
+	var keys []ed25519.PrivateKey
+	var participants []Identity
+	for i := 0; i < 4; i++ {
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, key)
+		participants = append(participants, Ed25519Identity(pub))
+	}
+
+	var idx int
+	net := newMemNetworkConfig(t, 4, func(config *Config) {
+		config.Participants = participants
+		config.MessageSigner = NewEd25519Signer(keys[idx])
+		idx++
+	})
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	height, _, err := VerifyDecideProof(participants, net.nodes[0].CurrentProof())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), height)
+
+	// secp256k1 messages are rejected by an ed25519 network
+	_, rc, _ := createRoundChangeMessageSigner(t, 2, 0, nil, mustGenerateKey(t))
+	bts, err := rc.Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMessageScheme, net.nodes[0].ReceiveMessage(bts, net.now))
+
+	// and vice versa
+	secp := newMemNetwork(t, 4)
+	m, _, _ := createRoundChangeMessageSigner(t, 1, 0, nil, mustGenerateKey(t))
+	sp := new(SignedProto)
+	assert.Nil(t, sp.SignWithSigner(m, NewEd25519Signer(keys[0]), nil))
+	bts, err = sp.Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMessageScheme, secp.nodes[0].ReceiveMessage(bts, secp.now))
+
+	// compact messages are not supported
+	config := net.configs[0].Clone()
+	config.EnableCompactMessage = true
+	assert.True(t, errors.Is(config.Validate(), ErrConfigMessageSigner))
+}
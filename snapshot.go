@@ -0,0 +1,330 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+)
+
+// SnapshotVersion is the current version of snapshot format
+const SnapshotVersion = 1
+
+// Snapshot serializes the internal state of consensus into bytes, including
+// the current height, round, collected proofs and locked states, the consensus
+// can be restored from it via LoadConsensus.
+func (c *Consensus) Snapshot() ([]byte, error) {
+	snapshot := new(Snapshot)
+	snapshot.Version = SnapshotVersion
+	snapshot.LatestHeight = c.latestHeight
+	snapshot.LatestRound = c.latestRound
+	snapshot.LatestState = c.latestState
+	snapshot.LatestProof = c.latestProof
+	snapshot.Unconfirmed = toBytesSlice(c.unconfirmed)
+
+	for elem := c.rounds.Front(); elem != nil; elem = elem.Next() {
+		r := elem.Value.(*consensusRound)
+		sr := new(SnapshotRound)
+		sr.RoundNumber = r.RoundNumber
+		sr.Stage = uint32(r.Stage)
+		sr.LockedState = r.LockedState
+		sr.RoundChangeSent = r.RoundChangeSent
+		sr.CommitSent = r.CommitSent
+		sr.RoundChanges = r.SignedRoundChanges()
+		sr.Commits = r.SignedCommits()
+		sr.MaxProposedState = r.MaxProposedState
+		sr.MaxProposedWeight = r.MaxProposedWeight
+		snapshot.Rounds = append(snapshot.Rounds, sr)
+	}
+	snapshot.CurrentRound = c.currentRound.RoundNumber
+
+	snapshot.RcTimeout = toUnixNano(c.rcTimeout)
+	snapshot.LockTimeout = toUnixNano(c.lockTimeout)
+	snapshot.CommitTimeout = toUnixNano(c.commitTimeout)
+	snapshot.LockReleaseTimeout = toUnixNano(c.lockReleaseTimeout)
+
+	for k := range c.locks {
+		snapshot.Locks = append(snapshot.Locks, c.locks[k].Signed)
+	}
+	snapshot.LastRoundChangeProof = c.lastRoundChangeProof
+
+	snapshot.Participants = identitiesToBytes(c.participants)
+	for _, h := range c.pendingChangeHeights(math.MaxUint64) {
+		change := c.participantChanges[h]
+		snapshot.ParticipantChanges = append(snapshot.ParticipantChanges, &SnapshotParticipantChange{
+			Height: h,
+			Add:    identitiesToBytes(change.add),
+			Remove: identitiesToBytes(change.remove),
+		})
+	}
+	snapshot.TransitionHeight = c.transitionHeight
+	transition := make([]Identity, 0, len(c.transitionIndex))
+	for id := range c.transitionIndex {
+		transition = append(transition, id)
+	}
+	sort.Slice(transition, func(i, j int) bool { return c.transitionIndex[transition[i]] < c.transitionIndex[transition[j]] })
+	snapshot.TransitionParticipants = identitiesToBytes(transition)
+	snapshot.Latency = int64(c.latency)
+	snapshot.Loopback = c.loopback
+
+	for key := range c.seen {
+		snapshot.Seen = append(snapshot.Seen, &SnapshotSeen{
+			Identity: append([]byte{}, key.identity[:]...),
+			Height:   key.height,
+			Round:    key.round,
+			Type:     key.msgType,
+			Hash:     append([]byte{}, key.hash[:]...),
+		})
+	}
+	// deterministic order
+	sort.Slice(snapshot.Seen, func(i, j int) bool {
+		a, b := snapshot.Seen[i], snapshot.Seen[j]
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		if a.Round != b.Round {
+			return a.Round < b.Round
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if cmp := bytes.Compare(a.Identity, b.Identity); cmp != 0 {
+			return cmp < 0
+		}
+		return bytes.Compare(a.Hash, b.Hash) < 0
+	})
+
+	return proto.Marshal(snapshot)
+}
+
+// LoadConsensus creates a consensus object with the given config, and restores
+// its internal state from a snapshot created by Consensus.Snapshot, the restored
+// consensus continues from where the snapshot was taken.
+func LoadConsensus(config *Config, snapshot []byte) (*Consensus, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(Snapshot)
+	err = proto.Unmarshal(snapshot, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Version != SnapshotVersion {
+		return nil, ErrSnapshotVersion
+	}
+
+	c := new(Consensus)
+	c.init(config)
+
+	// overwrite states initialized from config
+	c.latestHeight = s.LatestHeight
+	c.decidedHeight = s.LatestHeight
+	c.latestRound = s.LatestRound
+	c.latestState = s.LatestState
+	c.observeDecided()
+	c.latestProof = s.LatestProof
+	c.unconfirmed = fromBytesSlice(s.Unconfirmed)
+
+	participants, err := bytesToIdentities(s.Participants)
+	if err != nil {
+		return nil, err
+	}
+	c.setParticipants(participants)
+
+	c.participantChanges = nil
+	for _, change := range s.ParticipantChanges {
+		add, err := bytesToIdentities(change.Add)
+		if err != nil {
+			return nil, err
+		}
+		remove, err := bytesToIdentities(change.Remove)
+		if err != nil {
+			return nil, err
+		}
+		if c.participantChanges == nil {
+			c.participantChanges = make(map[uint64]*participantChange)
+		}
+		c.participantChanges[change.Height] = &participantChange{add: add, remove: remove}
+	}
+
+	c.transitionHeight = s.TransitionHeight
+	c.transitionIndex = nil
+	if len(s.TransitionParticipants) > 0 {
+		transition, err := bytesToIdentities(s.TransitionParticipants)
+		if err != nil {
+			return nil, err
+		}
+		c.transitionIndex = make(map[Identity]int)
+		for k, id := range transition {
+			c.transitionIndex[id] = k
+		}
+	}
+
+	// rounds
+	c.rounds.Init()
+	for _, sr := range s.Rounds {
+		if consensusStage(sr.Stage) > stageLockRelease {
+			return nil, ErrSnapshotCorrupted
+		}
+
+		r := c.getRound(sr.RoundNumber, false)
+		r.Stage = consensusStage(sr.Stage)
+		r.LockedState = sr.LockedState
+		if sr.LockedState != nil {
+			r.LockedStateHash = c.stateHash(sr.LockedState)
+		}
+		r.RoundChangeSent = sr.RoundChangeSent
+		r.CommitSent = sr.CommitSent
+		r.MaxProposedState = sr.MaxProposedState
+		r.MaxProposedWeight = sr.MaxProposedWeight
+
+		if r.roundChanges, err = c.restoreTuples(sr.RoundChanges); err != nil {
+			return nil, err
+		}
+		if r.commits, err = c.restoreTuples(sr.Commits); err != nil {
+			return nil, err
+		}
+	}
+	c.currentRound = c.getRound(s.CurrentRound, false)
+
+	c.rcTimeout = fromUnixNano(s.RcTimeout)
+	c.lockTimeout = fromUnixNano(s.LockTimeout)
+	c.commitTimeout = fromUnixNano(s.CommitTimeout)
+	c.lockReleaseTimeout = fromUnixNano(s.LockReleaseTimeout)
+
+	if c.locks, err = c.restoreTuples(s.Locks); err != nil {
+		return nil, err
+	}
+	c.lastRoundChangeProof = s.LastRoundChangeProof
+	c.latency = time.Duration(s.Latency)
+
+	c.seen = nil
+	c.seenCount = nil
+	for _, seen := range s.Seen {
+		var key seenKey
+		if len(seen.Identity) != len(key.identity) || len(seen.Hash) != len(key.hash) {
+			return nil, ErrSnapshotCorrupted
+		}
+		copy(key.identity[:], seen.Identity)
+		copy(key.hash[:], seen.Hash)
+		key.height = seen.Height
+		key.round = seen.Round
+		key.msgType = seen.Type
+		c.markSeen(key)
+	}
+
+	// restore the messages queued, the restored consensus resumes sending
+	// on the next Update
+	c.loopback = s.Loopback
+	c.measuredHeight = c.latestHeight
+	c.measuredRound = c.currentRound.RoundNumber
+	c.roundStarted = time.Time{}
+	c.heightStarted = time.Time{}
+	c.observe()
+	return c, nil
+}
+
+// restoreTuples decodes signed messages into message tuples
+func (c *Consensus) restoreTuples(signed []*SignedProto) ([]messageTuple, error) {
+	var tuples []messageTuple
+	for _, sp := range signed {
+		m := new(Message)
+		if err := proto.Unmarshal(sp.Message, m); err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, messageTuple{StateHash: c.stateHash(m.State), Message: m, Signed: sp, Weight: c.signerWeight(sp)})
+	}
+	return tuples, nil
+}
+
+// toUnixNano converts time to unix nano, or 0 if the time is zero
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano converts unix nano to time, or zero time if 0
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// toBytesSlice converts states to bytes slices
+func toBytesSlice(states []State) [][]byte {
+	ret := make([][]byte, 0, len(states))
+	for _, s := range states {
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// fromBytesSlice converts bytes slices to states
+func fromBytesSlice(bts [][]byte) []State {
+	var ret []State
+	for _, b := range bts {
+		ret = append(ret, b)
+	}
+	return ret
+}
+
+// identitiesToBytes converts identities to bytes slices
+func identitiesToBytes(ids []Identity) [][]byte {
+	ret := make([][]byte, 0, len(ids))
+	for k := range ids {
+		ret = append(ret, append([]byte{}, ids[k][:]...))
+	}
+	return ret
+}
+
+// bytesToIdentities converts bytes slices to identities
+func bytesToIdentities(bts [][]byte) ([]Identity, error) {
+	var ret []Identity
+	for _, b := range bts {
+		var id Identity
+		if len(b) != len(id) {
+			return nil, ErrSnapshotCorrupted
+		}
+		copy(id[:], b)
+		ret = append(ret, id)
+	}
+	return ret, nil
+}
@@ -0,0 +1,2499 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: snapshot.proto
+
+package bdls
+
+import (
+	fmt "fmt"
+	proto "github.com/gogo/protobuf/proto"
+	io "io"
+	math "math"
+	math_bits "math/bits"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
+
+// SnapshotRound defines a consensus round in a snapshot
+type SnapshotRound struct {
+	RoundNumber     uint64 `protobuf:"varint,1,opt,name=RoundNumber,proto3" json:"RoundNumber,omitempty"`
+	Stage           uint32 `protobuf:"varint,2,opt,name=Stage,proto3" json:"Stage,omitempty"`
+	LockedState     []byte `protobuf:"bytes,3,opt,name=LockedState,proto3" json:"LockedState,omitempty"`
+	RoundChangeSent bool   `protobuf:"varint,4,opt,name=RoundChangeSent,proto3" json:"RoundChangeSent,omitempty"`
+	CommitSent      bool   `protobuf:"varint,5,opt,name=CommitSent,proto3" json:"CommitSent,omitempty"`
+	// collected <roundchange> messages
+	RoundChanges []*SignedProto `protobuf:"bytes,6,rep,name=RoundChanges,proto3" json:"RoundChanges,omitempty"`
+	// collected <commit> messages
+	Commits              []*SignedProto `protobuf:"bytes,7,rep,name=Commits,proto3" json:"Commits,omitempty"`
+	MaxProposedState     []byte         `protobuf:"bytes,8,opt,name=MaxProposedState,proto3" json:"MaxProposedState,omitempty"`
+	MaxProposedWeight    uint64         `protobuf:"varint,9,opt,name=MaxProposedWeight,proto3" json:"MaxProposedWeight,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *SnapshotRound) Reset()         { *m = SnapshotRound{} }
+func (m *SnapshotRound) String() string { return proto.CompactTextString(m) }
+func (*SnapshotRound) ProtoMessage()    {}
+func (*SnapshotRound) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c8aab8e59648e0b, []int{0}
+}
+func (m *SnapshotRound) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *SnapshotRound) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_SnapshotRound.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *SnapshotRound) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SnapshotRound.Merge(m, src)
+}
+func (m *SnapshotRound) XXX_Size() int {
+	return m.Size()
+}
+func (m *SnapshotRound) XXX_DiscardUnknown() {
+	xxx_messageInfo_SnapshotRound.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SnapshotRound proto.InternalMessageInfo
+
+func (m *SnapshotRound) GetRoundNumber() uint64 {
+	if m != nil {
+		return m.RoundNumber
+	}
+	return 0
+}
+
+func (m *SnapshotRound) GetStage() uint32 {
+	if m != nil {
+		return m.Stage
+	}
+	return 0
+}
+
+func (m *SnapshotRound) GetLockedState() []byte {
+	if m != nil {
+		return m.LockedState
+	}
+	return nil
+}
+
+func (m *SnapshotRound) GetRoundChangeSent() bool {
+	if m != nil {
+		return m.RoundChangeSent
+	}
+	return false
+}
+
+func (m *SnapshotRound) GetCommitSent() bool {
+	if m != nil {
+		return m.CommitSent
+	}
+	return false
+}
+
+func (m *SnapshotRound) GetRoundChanges() []*SignedProto {
+	if m != nil {
+		return m.RoundChanges
+	}
+	return nil
+}
+
+func (m *SnapshotRound) GetCommits() []*SignedProto {
+	if m != nil {
+		return m.Commits
+	}
+	return nil
+}
+
+func (m *SnapshotRound) GetMaxProposedState() []byte {
+	if m != nil {
+		return m.MaxProposedState
+	}
+	return nil
+}
+
+func (m *SnapshotRound) GetMaxProposedWeight() uint64 {
+	if m != nil {
+		return m.MaxProposedWeight
+	}
+	return 0
+}
+
+// SnapshotParticipantChange defines a pending participant change in a snapshot
+type SnapshotParticipantChange struct {
+	Height               uint64   `protobuf:"varint,1,opt,name=Height,proto3" json:"Height,omitempty"`
+	Add                  [][]byte `protobuf:"bytes,2,rep,name=Add,proto3" json:"Add,omitempty"`
+	Remove               [][]byte `protobuf:"bytes,3,rep,name=Remove,proto3" json:"Remove,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SnapshotParticipantChange) Reset()         { *m = SnapshotParticipantChange{} }
+func (m *SnapshotParticipantChange) String() string { return proto.CompactTextString(m) }
+func (*SnapshotParticipantChange) ProtoMessage()    {}
+func (*SnapshotParticipantChange) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c8aab8e59648e0b, []int{1}
+}
+func (m *SnapshotParticipantChange) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *SnapshotParticipantChange) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_SnapshotParticipantChange.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *SnapshotParticipantChange) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SnapshotParticipantChange.Merge(m, src)
+}
+func (m *SnapshotParticipantChange) XXX_Size() int {
+	return m.Size()
+}
+func (m *SnapshotParticipantChange) XXX_DiscardUnknown() {
+	xxx_messageInfo_SnapshotParticipantChange.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SnapshotParticipantChange proto.InternalMessageInfo
+
+func (m *SnapshotParticipantChange) GetHeight() uint64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *SnapshotParticipantChange) GetAdd() [][]byte {
+	if m != nil {
+		return m.Add
+	}
+	return nil
+}
+
+func (m *SnapshotParticipantChange) GetRemove() [][]byte {
+	if m != nil {
+		return m.Remove
+	}
+	return nil
+}
+
+// SnapshotSeen defines a processed message in a snapshot, for replay protection
+type SnapshotSeen struct {
+	Identity             []byte      `protobuf:"bytes,1,opt,name=Identity,proto3" json:"Identity,omitempty"`
+	Height               uint64      `protobuf:"varint,2,opt,name=Height,proto3" json:"Height,omitempty"`
+	Round                uint64      `protobuf:"varint,3,opt,name=Round,proto3" json:"Round,omitempty"`
+	Type                 MessageType `protobuf:"varint,4,opt,name=Type,proto3,enum=bdls.MessageType" json:"Type,omitempty"`
+	Hash                 []byte      `protobuf:"bytes,5,opt,name=Hash,proto3" json:"Hash,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *SnapshotSeen) Reset()         { *m = SnapshotSeen{} }
+func (m *SnapshotSeen) String() string { return proto.CompactTextString(m) }
+func (*SnapshotSeen) ProtoMessage()    {}
+func (*SnapshotSeen) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c8aab8e59648e0b, []int{2}
+}
+func (m *SnapshotSeen) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *SnapshotSeen) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_SnapshotSeen.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *SnapshotSeen) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SnapshotSeen.Merge(m, src)
+}
+func (m *SnapshotSeen) XXX_Size() int {
+	return m.Size()
+}
+func (m *SnapshotSeen) XXX_DiscardUnknown() {
+	xxx_messageInfo_SnapshotSeen.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SnapshotSeen proto.InternalMessageInfo
+
+func (m *SnapshotSeen) GetIdentity() []byte {
+	if m != nil {
+		return m.Identity
+	}
+	return nil
+}
+
+func (m *SnapshotSeen) GetHeight() uint64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *SnapshotSeen) GetRound() uint64 {
+	if m != nil {
+		return m.Round
+	}
+	return 0
+}
+
+func (m *SnapshotSeen) GetType() MessageType {
+	if m != nil {
+		return m.Type
+	}
+	return MessageType_Nop
+}
+
+func (m *SnapshotSeen) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+// Snapshot defines the internal state of a consensus object
+type Snapshot struct {
+	Version      uint32       `protobuf:"varint,1,opt,name=Version,proto3" json:"Version,omitempty"`
+	LatestHeight uint64       `protobuf:"varint,2,opt,name=LatestHeight,proto3" json:"LatestHeight,omitempty"`
+	LatestRound  uint64       `protobuf:"varint,3,opt,name=LatestRound,proto3" json:"LatestRound,omitempty"`
+	LatestState  []byte       `protobuf:"bytes,4,opt,name=LatestState,proto3" json:"LatestState,omitempty"`
+	LatestProof  *SignedProto `protobuf:"bytes,5,opt,name=LatestProof,proto3" json:"LatestProof,omitempty"`
+	// states awaiting to be confirmed
+	Unconfirmed [][]byte `protobuf:"bytes,6,rep,name=Unconfirmed,proto3" json:"Unconfirmed,omitempty"`
+	// rounds at next height
+	Rounds       []*SnapshotRound `protobuf:"bytes,7,rep,name=Rounds,proto3" json:"Rounds,omitempty"`
+	CurrentRound uint64           `protobuf:"varint,8,opt,name=CurrentRound,proto3" json:"CurrentRound,omitempty"`
+	// timeouts in unix nano
+	RcTimeout          int64 `protobuf:"varint,9,opt,name=RcTimeout,proto3" json:"RcTimeout,omitempty"`
+	LockTimeout        int64 `protobuf:"varint,10,opt,name=LockTimeout,proto3" json:"LockTimeout,omitempty"`
+	CommitTimeout      int64 `protobuf:"varint,11,opt,name=CommitTimeout,proto3" json:"CommitTimeout,omitempty"`
+	LockReleaseTimeout int64 `protobuf:"varint,12,opt,name=LockReleaseTimeout,proto3" json:"LockReleaseTimeout,omitempty"`
+	// locked states with signatures
+	Locks                []*SignedProto `protobuf:"bytes,13,rep,name=Locks,proto3" json:"Locks,omitempty"`
+	LastRoundChangeProof []*SignedProto `protobuf:"bytes,14,rep,name=LastRoundChangeProof,proto3" json:"LastRoundChangeProof,omitempty"`
+	// consensus group & pending changes
+	Participants           [][]byte                     `protobuf:"bytes,15,rep,name=Participants,proto3" json:"Participants,omitempty"`
+	ParticipantChanges     []*SnapshotParticipantChange `protobuf:"bytes,16,rep,name=ParticipantChanges,proto3" json:"ParticipantChanges,omitempty"`
+	TransitionHeight       uint64                       `protobuf:"varint,17,opt,name=TransitionHeight,proto3" json:"TransitionHeight,omitempty"`
+	TransitionParticipants [][]byte                     `protobuf:"bytes,18,rep,name=TransitionParticipants,proto3" json:"TransitionParticipants,omitempty"`
+	Latency                int64                        `protobuf:"varint,19,opt,name=Latency,proto3" json:"Latency,omitempty"`
+	// messages being sent to myself
+	Loopback [][]byte `protobuf:"bytes,20,rep,name=Loopback,proto3" json:"Loopback,omitempty"`
+	// processed messages
+	Seen                 []*SnapshotSeen `protobuf:"bytes,21,rep,name=Seen,proto3" json:"Seen,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *Snapshot) Reset()         { *m = Snapshot{} }
+func (m *Snapshot) String() string { return proto.CompactTextString(m) }
+func (*Snapshot) ProtoMessage()    {}
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0c8aab8e59648e0b, []int{3}
+}
+func (m *Snapshot) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Snapshot) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Snapshot.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *Snapshot) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Snapshot.Merge(m, src)
+}
+func (m *Snapshot) XXX_Size() int {
+	return m.Size()
+}
+func (m *Snapshot) XXX_DiscardUnknown() {
+	xxx_messageInfo_Snapshot.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Snapshot proto.InternalMessageInfo
+
+func (m *Snapshot) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Snapshot) GetLatestHeight() uint64 {
+	if m != nil {
+		return m.LatestHeight
+	}
+	return 0
+}
+
+func (m *Snapshot) GetLatestRound() uint64 {
+	if m != nil {
+		return m.LatestRound
+	}
+	return 0
+}
+
+func (m *Snapshot) GetLatestState() []byte {
+	if m != nil {
+		return m.LatestState
+	}
+	return nil
+}
+
+func (m *Snapshot) GetLatestProof() *SignedProto {
+	if m != nil {
+		return m.LatestProof
+	}
+	return nil
+}
+
+func (m *Snapshot) GetUnconfirmed() [][]byte {
+	if m != nil {
+		return m.Unconfirmed
+	}
+	return nil
+}
+
+func (m *Snapshot) GetRounds() []*SnapshotRound {
+	if m != nil {
+		return m.Rounds
+	}
+	return nil
+}
+
+func (m *Snapshot) GetCurrentRound() uint64 {
+	if m != nil {
+		return m.CurrentRound
+	}
+	return 0
+}
+
+func (m *Snapshot) GetRcTimeout() int64 {
+	if m != nil {
+		return m.RcTimeout
+	}
+	return 0
+}
+
+func (m *Snapshot) GetLockTimeout() int64 {
+	if m != nil {
+		return m.LockTimeout
+	}
+	return 0
+}
+
+func (m *Snapshot) GetCommitTimeout() int64 {
+	if m != nil {
+		return m.CommitTimeout
+	}
+	return 0
+}
+
+func (m *Snapshot) GetLockReleaseTimeout() int64 {
+	if m != nil {
+		return m.LockReleaseTimeout
+	}
+	return 0
+}
+
+func (m *Snapshot) GetLocks() []*SignedProto {
+	if m != nil {
+		return m.Locks
+	}
+	return nil
+}
+
+func (m *Snapshot) GetLastRoundChangeProof() []*SignedProto {
+	if m != nil {
+		return m.LastRoundChangeProof
+	}
+	return nil
+}
+
+func (m *Snapshot) GetParticipants() [][]byte {
+	if m != nil {
+		return m.Participants
+	}
+	return nil
+}
+
+func (m *Snapshot) GetParticipantChanges() []*SnapshotParticipantChange {
+	if m != nil {
+		return m.ParticipantChanges
+	}
+	return nil
+}
+
+func (m *Snapshot) GetTransitionHeight() uint64 {
+	if m != nil {
+		return m.TransitionHeight
+	}
+	return 0
+}
+
+func (m *Snapshot) GetTransitionParticipants() [][]byte {
+	if m != nil {
+		return m.TransitionParticipants
+	}
+	return nil
+}
+
+func (m *Snapshot) GetLatency() int64 {
+	if m != nil {
+		return m.Latency
+	}
+	return 0
+}
+
+func (m *Snapshot) GetLoopback() [][]byte {
+	if m != nil {
+		return m.Loopback
+	}
+	return nil
+}
+
+func (m *Snapshot) GetSeen() []*SnapshotSeen {
+	if m != nil {
+		return m.Seen
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*SnapshotRound)(nil), "bdls.SnapshotRound")
+	proto.RegisterType((*SnapshotParticipantChange)(nil), "bdls.SnapshotParticipantChange")
+	proto.RegisterType((*SnapshotSeen)(nil), "bdls.SnapshotSeen")
+	proto.RegisterType((*Snapshot)(nil), "bdls.Snapshot")
+}
+
+func init() { proto.RegisterFile("snapshot.proto", fileDescriptor_0c8aab8e59648e0b) }
+
+var fileDescriptor_0c8aab8e59648e0b = []byte{
+	// 672 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x54, 0xdb, 0x6e, 0xd3, 0x4c,
+	0x10, 0x96, 0x13, 0x27, 0x4d, 0xa7, 0x4e, 0x0f, 0xd3, 0xfc, 0xd5, 0xfe, 0x15, 0x0a, 0x51, 0xc4,
+	0x21, 0xa2, 0x28, 0x17, 0x54, 0x70, 0x0f, 0x15, 0x52, 0x91, 0x52, 0x88, 0x36, 0x05, 0xae, 0xb8,
+	0x70, 0xe2, 0x6d, 0x62, 0xb5, 0xde, 0x8d, 0xbc, 0x1b, 0x44, 0x9f, 0x83, 0x97, 0xe2, 0x92, 0x47,
+	0x40, 0x7d, 0x83, 0xbe, 0x01, 0xda, 0x59, 0xbb, 0xb1, 0x49, 0x72, 0xe7, 0xf9, 0xe6, 0x9b, 0xd9,
+	0x39, 0x7c, 0x63, 0xd8, 0xd5, 0x32, 0x9c, 0xeb, 0x99, 0x32, 0xfd, 0x79, 0xaa, 0x8c, 0x42, 0x7f,
+	0x1c, 0xdd, 0xe8, 0xe3, 0x66, 0x22, 0xb4, 0x0e, 0xa7, 0xc2, 0x81, 0xdd, 0xfb, 0x0a, 0x34, 0x47,
+	0x19, 0x8f, 0xab, 0x85, 0x8c, 0xb0, 0x03, 0x3b, 0xf4, 0xf1, 0x71, 0x91, 0x8c, 0x45, 0xca, 0xbc,
+	0x8e, 0xd7, 0xf3, 0x79, 0x11, 0xc2, 0x16, 0xd4, 0x46, 0x26, 0x9c, 0x0a, 0x56, 0xe9, 0x78, 0xbd,
+	0x26, 0x77, 0x86, 0x8d, 0x1b, 0xa8, 0xc9, 0xb5, 0x88, 0x46, 0x26, 0x34, 0x82, 0x55, 0x3b, 0x5e,
+	0x2f, 0xe0, 0x45, 0x08, 0x7b, 0xb0, 0x47, 0x69, 0xce, 0x66, 0xa1, 0x9c, 0x8a, 0x91, 0x90, 0x86,
+	0xf9, 0x1d, 0xaf, 0xd7, 0xe0, 0xff, 0xc2, 0xd8, 0x06, 0x38, 0x53, 0x49, 0x12, 0x1b, 0x22, 0xd5,
+	0x88, 0x54, 0x40, 0xf0, 0x35, 0x04, 0x85, 0x10, 0xcd, 0xea, 0x9d, 0x6a, 0x6f, 0xe7, 0xd5, 0x41,
+	0xdf, 0x76, 0xd8, 0x1f, 0xc5, 0x53, 0x29, 0xa2, 0xa1, 0x6d, 0x8f, 0x97, 0x68, 0x78, 0x02, 0x5b,
+	0x2e, 0x89, 0x66, 0x5b, 0x9b, 0x22, 0x72, 0x06, 0xbe, 0x80, 0xfd, 0x8b, 0xf0, 0xc7, 0x30, 0x55,
+	0x73, 0xa5, 0xf3, 0xa6, 0x1a, 0xd4, 0xd4, 0x0a, 0x8e, 0x2f, 0xe1, 0xa0, 0x80, 0x7d, 0x15, 0xf1,
+	0x74, 0x66, 0xd8, 0x36, 0x4d, 0x6e, 0xd5, 0xd1, 0xfd, 0x06, 0xff, 0xe7, 0x23, 0x1f, 0x86, 0xa9,
+	0x89, 0x27, 0xf1, 0x3c, 0x94, 0xc6, 0x15, 0x89, 0x47, 0x50, 0x3f, 0x77, 0xf1, 0x6e, 0xf2, 0x99,
+	0x85, 0xfb, 0x50, 0x7d, 0x1b, 0x45, 0xac, 0xd2, 0xa9, 0xf6, 0x02, 0x6e, 0x3f, 0x2d, 0x93, 0x8b,
+	0x44, 0x7d, 0xb7, 0xb3, 0xb6, 0x60, 0x66, 0x75, 0x7f, 0x7a, 0x10, 0xe4, 0xf9, 0x47, 0x42, 0x48,
+	0x3c, 0x86, 0xc6, 0x87, 0x48, 0x48, 0x13, 0x9b, 0x5b, 0x4a, 0x1a, 0xf0, 0x07, 0xbb, 0xf0, 0x5c,
+	0xa5, 0xf4, 0x5c, 0x0b, 0x6a, 0x34, 0x3a, 0xda, 0xa3, 0xcf, 0x9d, 0x81, 0x4f, 0xc1, 0xbf, 0xbc,
+	0x9d, 0x0b, 0x5a, 0xdb, 0x6e, 0x3e, 0xbd, 0x0b, 0x27, 0x28, 0xeb, 0xe0, 0xe4, 0x46, 0x04, 0xff,
+	0x3c, 0xd4, 0x33, 0x5a, 0x5c, 0xc0, 0xe9, 0xbb, 0x7b, 0x5f, 0x87, 0x46, 0x5e, 0x15, 0x32, 0xd8,
+	0xfa, 0x22, 0x52, 0x1d, 0x2b, 0x49, 0x05, 0x35, 0x79, 0x6e, 0x62, 0x17, 0x82, 0x41, 0x68, 0x84,
+	0x36, 0xa5, 0xaa, 0x4a, 0x18, 0x29, 0x8d, 0xec, 0x62, 0x85, 0x45, 0x68, 0xc9, 0x70, 0x6b, 0xf3,
+	0x33, 0x2d, 0x2e, 0x21, 0x3c, 0xcd, 0x19, 0xc3, 0x54, 0xa9, 0x2b, 0xaa, 0x74, 0xad, 0x1c, 0x8a,
+	0x2c, 0x9b, 0xf6, 0xb3, 0x9c, 0x28, 0x79, 0x15, 0xa7, 0x89, 0x88, 0x48, 0x75, 0x01, 0x2f, 0x42,
+	0x78, 0x02, 0x75, 0xaa, 0x20, 0x17, 0xd8, 0x61, 0x96, 0xb1, 0x78, 0x61, 0x3c, 0xa3, 0xd8, 0x5e,
+	0xcf, 0x16, 0x69, 0x2a, 0x64, 0xd6, 0x48, 0xc3, 0xf5, 0x5a, 0xc4, 0xf0, 0x11, 0x6c, 0xf3, 0xc9,
+	0x65, 0x9c, 0x08, 0xb5, 0x70, 0x8a, 0xaa, 0xf2, 0x25, 0x90, 0xdf, 0x5c, 0xee, 0x07, 0xf2, 0x17,
+	0x21, 0x7c, 0x02, 0x4d, 0x27, 0xe8, 0x9c, 0xb3, 0x43, 0x9c, 0x32, 0x88, 0x7d, 0x40, 0x1b, 0xc4,
+	0xc5, 0x8d, 0x08, 0xb5, 0xc8, 0xa9, 0x01, 0x51, 0xd7, 0x78, 0xf0, 0x39, 0xd4, 0x2c, 0xaa, 0x59,
+	0x73, 0xd3, 0x19, 0x39, 0x3f, 0xbe, 0x87, 0xd6, 0x20, 0xcc, 0xb6, 0xe2, 0x04, 0xee, 0xe6, 0xbd,
+	0xbb, 0x29, 0x6e, 0x2d, 0xdd, 0x4e, 0xaa, 0x70, 0x29, 0x9a, 0xed, 0xd1, 0xe4, 0x4b, 0x18, 0x7e,
+	0x02, 0x5c, 0xb9, 0x26, 0xcd, 0xf6, 0xe9, 0xa1, 0xc7, 0xe5, 0x35, 0xac, 0xf0, 0xf8, 0x9a, 0x50,
+	0xfb, 0x03, 0xb8, 0x4c, 0x43, 0xa9, 0x63, 0x13, 0x2b, 0x99, 0xc9, 0xf1, 0x80, 0x56, 0xb4, 0x82,
+	0xe3, 0x1b, 0x38, 0x5a, 0x62, 0xa5, 0x52, 0x91, 0x4a, 0xdd, 0xe0, 0xb5, 0x87, 0x60, 0x05, 0x26,
+	0x27, 0xb7, 0xec, 0x90, 0xa6, 0x9d, 0x9b, 0xf6, 0x68, 0x07, 0x4a, 0xcd, 0xc7, 0xe1, 0xe4, 0x9a,
+	0xb5, 0x28, 0xc7, 0x83, 0x8d, 0xcf, 0xc0, 0xb7, 0x87, 0xcd, 0xfe, 0xa3, 0xe6, 0xb0, 0xdc, 0x9c,
+	0xf5, 0x70, 0xf2, 0xbf, 0x0b, 0x7e, 0xdd, 0xb5, 0xbd, 0xdf, 0x77, 0x6d, 0xef, 0xcf, 0x5d, 0xdb,
+	0x1b, 0xd7, 0xe9, 0x8f, 0x7f, 0xfa, 0x77, 0x00, 0x77, 0xdf, 0x04, 0x43, 0x18, 0x06, 0x00, 0x00,
+}
+
+func (m *SnapshotRound) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *SnapshotRound) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SnapshotRound) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.MaxProposedWeight != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.MaxProposedWeight))
+		i--
+		dAtA[i] = 0x48
+	}
+	if len(m.MaxProposedState) > 0 {
+		i -= len(m.MaxProposedState)
+		copy(dAtA[i:], m.MaxProposedState)
+		i = encodeVarintSnapshot(dAtA, i, uint64(len(m.MaxProposedState)))
+		i--
+		dAtA[i] = 0x42
+	}
+	if len(m.Commits) > 0 {
+		for iNdEx := len(m.Commits) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Commits[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintSnapshot(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x3a
+		}
+	}
+	if len(m.RoundChanges) > 0 {
+		for iNdEx := len(m.RoundChanges) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.RoundChanges[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintSnapshot(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x32
+		}
+	}
+	if m.CommitSent {
+		i--
+		if m.CommitSent {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.RoundChangeSent {
+		i--
+		if m.RoundChangeSent {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x20
+	}
+	if len(m.LockedState) > 0 {
+		i -= len(m.LockedState)
+		copy(dAtA[i:], m.LockedState)
+		i = encodeVarintSnapshot(dAtA, i, uint64(len(m.LockedState)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if m.Stage != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.Stage))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.RoundNumber != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.RoundNumber))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *SnapshotParticipantChange) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *SnapshotParticipantChange) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SnapshotParticipantChange) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Remove) > 0 {
+		for iNdEx := len(m.Remove) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Remove[iNdEx])
+			copy(dAtA[i:], m.Remove[iNdEx])
+			i = encodeVarintSnapshot(dAtA, i, uint64(len(m.Remove[iNdEx])))
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if len(m.Add) > 0 {
+		for iNdEx := len(m.Add) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Add[iNdEx])
+			copy(dAtA[i:], m.Add[iNdEx])
+			i = encodeVarintSnapshot(dAtA, i, uint64(len(m.Add[iNdEx])))
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if m.Height != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.Height))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *SnapshotSeen) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *SnapshotSeen) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SnapshotSeen) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Hash) > 0 {
+		i -= len(m.Hash)
+		copy(dAtA[i:], m.Hash)
+		i = encodeVarintSnapshot(dAtA, i, uint64(len(m.Hash)))
+		i--
+		dAtA[i] = 0x2a
+	}
+	if m.Type != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.Type))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.Round != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.Round))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.Height != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.Height))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Identity) > 0 {
+		i -= len(m.Identity)
+		copy(dAtA[i:], m.Identity)
+		i = encodeVarintSnapshot(dAtA, i, uint64(len(m.Identity)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *Snapshot) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Snapshot) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Snapshot) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Seen) > 0 {
+		for iNdEx := len(m.Seen) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Seen[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintSnapshot(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x1
+			i--
+			dAtA[i] = 0xaa
+		}
+	}
+	if len(m.Loopback) > 0 {
+		for iNdEx := len(m.Loopback) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Loopback[iNdEx])
+			copy(dAtA[i:], m.Loopback[iNdEx])
+			i = encodeVarintSnapshot(dAtA, i, uint64(len(m.Loopback[iNdEx])))
+			i--
+			dAtA[i] = 0x1
+			i--
+			dAtA[i] = 0xa2
+		}
+	}
+	if m.Latency != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.Latency))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x98
+	}
+	if len(m.TransitionParticipants) > 0 {
+		for iNdEx := len(m.TransitionParticipants) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.TransitionParticipants[iNdEx])
+			copy(dAtA[i:], m.TransitionParticipants[iNdEx])
+			i = encodeVarintSnapshot(dAtA, i, uint64(len(m.TransitionParticipants[iNdEx])))
+			i--
+			dAtA[i] = 0x1
+			i--
+			dAtA[i] = 0x92
+		}
+	}
+	if m.TransitionHeight != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.TransitionHeight))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x88
+	}
+	if len(m.ParticipantChanges) > 0 {
+		for iNdEx := len(m.ParticipantChanges) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.ParticipantChanges[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintSnapshot(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x1
+			i--
+			dAtA[i] = 0x82
+		}
+	}
+	if len(m.Participants) > 0 {
+		for iNdEx := len(m.Participants) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Participants[iNdEx])
+			copy(dAtA[i:], m.Participants[iNdEx])
+			i = encodeVarintSnapshot(dAtA, i, uint64(len(m.Participants[iNdEx])))
+			i--
+			dAtA[i] = 0x7a
+		}
+	}
+	if len(m.LastRoundChangeProof) > 0 {
+		for iNdEx := len(m.LastRoundChangeProof) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.LastRoundChangeProof[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintSnapshot(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x72
+		}
+	}
+	if len(m.Locks) > 0 {
+		for iNdEx := len(m.Locks) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Locks[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintSnapshot(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x6a
+		}
+	}
+	if m.LockReleaseTimeout != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.LockReleaseTimeout))
+		i--
+		dAtA[i] = 0x60
+	}
+	if m.CommitTimeout != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.CommitTimeout))
+		i--
+		dAtA[i] = 0x58
+	}
+	if m.LockTimeout != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.LockTimeout))
+		i--
+		dAtA[i] = 0x50
+	}
+	if m.RcTimeout != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.RcTimeout))
+		i--
+		dAtA[i] = 0x48
+	}
+	if m.CurrentRound != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.CurrentRound))
+		i--
+		dAtA[i] = 0x40
+	}
+	if len(m.Rounds) > 0 {
+		for iNdEx := len(m.Rounds) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Rounds[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintSnapshot(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x3a
+		}
+	}
+	if len(m.Unconfirmed) > 0 {
+		for iNdEx := len(m.Unconfirmed) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Unconfirmed[iNdEx])
+			copy(dAtA[i:], m.Unconfirmed[iNdEx])
+			i = encodeVarintSnapshot(dAtA, i, uint64(len(m.Unconfirmed[iNdEx])))
+			i--
+			dAtA[i] = 0x32
+		}
+	}
+	if m.LatestProof != nil {
+		{
+			size, err := m.LatestProof.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintSnapshot(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x2a
+	}
+	if len(m.LatestState) > 0 {
+		i -= len(m.LatestState)
+		copy(dAtA[i:], m.LatestState)
+		i = encodeVarintSnapshot(dAtA, i, uint64(len(m.LatestState)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if m.LatestRound != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.LatestRound))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.LatestHeight != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.LatestHeight))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.Version != 0 {
+		i = encodeVarintSnapshot(dAtA, i, uint64(m.Version))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintSnapshot(dAtA []byte, offset int, v uint64) int {
+	offset -= sovSnapshot(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *SnapshotRound) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.RoundNumber != 0 {
+		n += 1 + sovSnapshot(uint64(m.RoundNumber))
+	}
+	if m.Stage != 0 {
+		n += 1 + sovSnapshot(uint64(m.Stage))
+	}
+	l = len(m.LockedState)
+	if l > 0 {
+		n += 1 + l + sovSnapshot(uint64(l))
+	}
+	if m.RoundChangeSent {
+		n += 2
+	}
+	if m.CommitSent {
+		n += 2
+	}
+	if len(m.RoundChanges) > 0 {
+		for _, e := range m.RoundChanges {
+			l = e.Size()
+			n += 1 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if len(m.Commits) > 0 {
+		for _, e := range m.Commits {
+			l = e.Size()
+			n += 1 + l + sovSnapshot(uint64(l))
+		}
+	}
+	l = len(m.MaxProposedState)
+	if l > 0 {
+		n += 1 + l + sovSnapshot(uint64(l))
+	}
+	if m.MaxProposedWeight != 0 {
+		n += 1 + sovSnapshot(uint64(m.MaxProposedWeight))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *SnapshotParticipantChange) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Height != 0 {
+		n += 1 + sovSnapshot(uint64(m.Height))
+	}
+	if len(m.Add) > 0 {
+		for _, b := range m.Add {
+			l = len(b)
+			n += 1 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if len(m.Remove) > 0 {
+		for _, b := range m.Remove {
+			l = len(b)
+			n += 1 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *SnapshotSeen) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Identity)
+	if l > 0 {
+		n += 1 + l + sovSnapshot(uint64(l))
+	}
+	if m.Height != 0 {
+		n += 1 + sovSnapshot(uint64(m.Height))
+	}
+	if m.Round != 0 {
+		n += 1 + sovSnapshot(uint64(m.Round))
+	}
+	if m.Type != 0 {
+		n += 1 + sovSnapshot(uint64(m.Type))
+	}
+	l = len(m.Hash)
+	if l > 0 {
+		n += 1 + l + sovSnapshot(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *Snapshot) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Version != 0 {
+		n += 1 + sovSnapshot(uint64(m.Version))
+	}
+	if m.LatestHeight != 0 {
+		n += 1 + sovSnapshot(uint64(m.LatestHeight))
+	}
+	if m.LatestRound != 0 {
+		n += 1 + sovSnapshot(uint64(m.LatestRound))
+	}
+	l = len(m.LatestState)
+	if l > 0 {
+		n += 1 + l + sovSnapshot(uint64(l))
+	}
+	if m.LatestProof != nil {
+		l = m.LatestProof.Size()
+		n += 1 + l + sovSnapshot(uint64(l))
+	}
+	if len(m.Unconfirmed) > 0 {
+		for _, b := range m.Unconfirmed {
+			l = len(b)
+			n += 1 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if len(m.Rounds) > 0 {
+		for _, e := range m.Rounds {
+			l = e.Size()
+			n += 1 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if m.CurrentRound != 0 {
+		n += 1 + sovSnapshot(uint64(m.CurrentRound))
+	}
+	if m.RcTimeout != 0 {
+		n += 1 + sovSnapshot(uint64(m.RcTimeout))
+	}
+	if m.LockTimeout != 0 {
+		n += 1 + sovSnapshot(uint64(m.LockTimeout))
+	}
+	if m.CommitTimeout != 0 {
+		n += 1 + sovSnapshot(uint64(m.CommitTimeout))
+	}
+	if m.LockReleaseTimeout != 0 {
+		n += 1 + sovSnapshot(uint64(m.LockReleaseTimeout))
+	}
+	if len(m.Locks) > 0 {
+		for _, e := range m.Locks {
+			l = e.Size()
+			n += 1 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if len(m.LastRoundChangeProof) > 0 {
+		for _, e := range m.LastRoundChangeProof {
+			l = e.Size()
+			n += 1 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if len(m.Participants) > 0 {
+		for _, b := range m.Participants {
+			l = len(b)
+			n += 1 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if len(m.ParticipantChanges) > 0 {
+		for _, e := range m.ParticipantChanges {
+			l = e.Size()
+			n += 2 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if m.TransitionHeight != 0 {
+		n += 2 + sovSnapshot(uint64(m.TransitionHeight))
+	}
+	if len(m.TransitionParticipants) > 0 {
+		for _, b := range m.TransitionParticipants {
+			l = len(b)
+			n += 2 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if m.Latency != 0 {
+		n += 2 + sovSnapshot(uint64(m.Latency))
+	}
+	if len(m.Loopback) > 0 {
+		for _, b := range m.Loopback {
+			l = len(b)
+			n += 2 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if len(m.Seen) > 0 {
+		for _, e := range m.Seen {
+			l = e.Size()
+			n += 2 + l + sovSnapshot(uint64(l))
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func sovSnapshot(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozSnapshot(x uint64) (n int) {
+	return sovSnapshot(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *SnapshotRound) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSnapshot
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SnapshotRound: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SnapshotRound: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RoundNumber", wireType)
+			}
+			m.RoundNumber = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RoundNumber |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Stage", wireType)
+			}
+			m.Stage = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Stage |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LockedState", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LockedState = append(m.LockedState[:0], dAtA[iNdEx:postIndex]...)
+			if m.LockedState == nil {
+				m.LockedState = []byte{}
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RoundChangeSent", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.RoundChangeSent = bool(v != 0)
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CommitSent", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.CommitSent = bool(v != 0)
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RoundChanges", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.RoundChanges = append(m.RoundChanges, &SignedProto{})
+			if err := m.RoundChanges[len(m.RoundChanges)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Commits", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Commits = append(m.Commits, &SignedProto{})
+			if err := m.Commits[len(m.Commits)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxProposedState", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.MaxProposedState = append(m.MaxProposedState[:0], dAtA[iNdEx:postIndex]...)
+			if m.MaxProposedState == nil {
+				m.MaxProposedState = []byte{}
+			}
+			iNdEx = postIndex
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxProposedWeight", wireType)
+			}
+			m.MaxProposedWeight = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxProposedWeight |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSnapshot(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *SnapshotParticipantChange) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSnapshot
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SnapshotParticipantChange: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SnapshotParticipantChange: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Height", wireType)
+			}
+			m.Height = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Height |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Add", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Add = append(m.Add, make([]byte, postIndex-iNdEx))
+			copy(m.Add[len(m.Add)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Remove", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Remove = append(m.Remove, make([]byte, postIndex-iNdEx))
+			copy(m.Remove[len(m.Remove)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSnapshot(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *SnapshotSeen) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSnapshot
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SnapshotSeen: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SnapshotSeen: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Identity", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Identity = append(m.Identity[:0], dAtA[iNdEx:postIndex]...)
+			if m.Identity == nil {
+				m.Identity = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Height", wireType)
+			}
+			m.Height = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Height |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Round", wireType)
+			}
+			m.Round = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Round |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Type", wireType)
+			}
+			m.Type = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Type |= MessageType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Hash", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Hash = append(m.Hash[:0], dAtA[iNdEx:postIndex]...)
+			if m.Hash == nil {
+				m.Hash = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSnapshot(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Snapshot) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSnapshot
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Snapshot: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Snapshot: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			m.Version = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Version |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LatestHeight", wireType)
+			}
+			m.LatestHeight = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.LatestHeight |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LatestRound", wireType)
+			}
+			m.LatestRound = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.LatestRound |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LatestState", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LatestState = append(m.LatestState[:0], dAtA[iNdEx:postIndex]...)
+			if m.LatestState == nil {
+				m.LatestState = []byte{}
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LatestProof", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.LatestProof == nil {
+				m.LatestProof = &SignedProto{}
+			}
+			if err := m.LatestProof.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Unconfirmed", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Unconfirmed = append(m.Unconfirmed, make([]byte, postIndex-iNdEx))
+			copy(m.Unconfirmed[len(m.Unconfirmed)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Rounds", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Rounds = append(m.Rounds, &SnapshotRound{})
+			if err := m.Rounds[len(m.Rounds)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CurrentRound", wireType)
+			}
+			m.CurrentRound = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CurrentRound |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RcTimeout", wireType)
+			}
+			m.RcTimeout = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RcTimeout |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LockTimeout", wireType)
+			}
+			m.LockTimeout = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.LockTimeout |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CommitTimeout", wireType)
+			}
+			m.CommitTimeout = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CommitTimeout |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 12:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LockReleaseTimeout", wireType)
+			}
+			m.LockReleaseTimeout = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.LockReleaseTimeout |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 13:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Locks", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Locks = append(m.Locks, &SignedProto{})
+			if err := m.Locks[len(m.Locks)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 14:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastRoundChangeProof", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LastRoundChangeProof = append(m.LastRoundChangeProof, &SignedProto{})
+			if err := m.LastRoundChangeProof[len(m.LastRoundChangeProof)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 15:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Participants", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Participants = append(m.Participants, make([]byte, postIndex-iNdEx))
+			copy(m.Participants[len(m.Participants)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 16:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ParticipantChanges", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ParticipantChanges = append(m.ParticipantChanges, &SnapshotParticipantChange{})
+			if err := m.ParticipantChanges[len(m.ParticipantChanges)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 17:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TransitionHeight", wireType)
+			}
+			m.TransitionHeight = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.TransitionHeight |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 18:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TransitionParticipants", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.TransitionParticipants = append(m.TransitionParticipants, make([]byte, postIndex-iNdEx))
+			copy(m.TransitionParticipants[len(m.TransitionParticipants)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 19:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Latency", wireType)
+			}
+			m.Latency = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Latency |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 20:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Loopback", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Loopback = append(m.Loopback, make([]byte, postIndex-iNdEx))
+			copy(m.Loopback[len(m.Loopback)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 21:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Seen", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Seen = append(m.Seen, &SnapshotSeen{})
+			if err := m.Seen[len(m.Seen)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSnapshot(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthSnapshot
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipSnapshot(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	depth := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowSnapshot
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+		case 1:
+			iNdEx += 8
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowSnapshot
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if length < 0 {
+				return 0, ErrInvalidLengthSnapshot
+			}
+			iNdEx += length
+		case 3:
+			depth++
+		case 4:
+			if depth == 0 {
+				return 0, ErrUnexpectedEndOfGroupSnapshot
+			}
+			depth--
+		case 5:
+			iNdEx += 4
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+		if iNdEx < 0 {
+			return 0, ErrInvalidLengthSnapshot
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+var (
+	ErrInvalidLengthSnapshot        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowSnapshot          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupSnapshot = fmt.Errorf("proto: unexpected end of group")
+)
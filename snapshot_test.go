@@ -0,0 +1,185 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memMessage is a message in flight to the node at index to
+type memMessage struct {
+	to  int
+	bts []byte
+}
+
+// memPeer queues messages sent to the node at index to
+type memPeer struct {
+	to    int
+	key   *ecdsa.PublicKey
+	queue *[]memMessage
+}
+
+func (p *memPeer) GetPublicKey() *ecdsa.PublicKey { return p.key }
+func (p *memPeer) RemoteAddr() net.Addr          { return fakeAddress(fmt.Sprint(p.to)) }
+func (p *memPeer) Send(msg []byte) error {
+	*p.queue = append(*p.queue, memMessage{p.to, msg})
+	return nil
+}
+
+// memNetwork is a deterministic in-memory network of consensus nodes
+type memNetwork struct {
+	configs []*Config
+	nodes   []*Consensus
+	queue   []memMessage
+	now     time.Time
+}
+
+// newMemNetwork creates n connected nodes with default config
+func newMemNetwork(t *testing.T, n int) *memNetwork { return newMemNetworkConfig(t, n, nil) }
+
+// newMemNetworkConfig creates n connected nodes, with setup applied to the
+// config of each node if not nil
+func newMemNetworkConfig(t *testing.T, n int, setup func(*Config)) *memNetwork {
+	net := new(memNetwork)
+	net.now = time.Now()
+
+	var keys []*ecdsa.PrivateKey
+	var participants []Identity
+	for i := 0; i < n; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	for i := 0; i < n; i++ {
+		config := new(Config)
+		config.Epoch = net.now
+		config.PrivateKey = keys[i]
+		config.Participants = participants
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		if setup != nil {
+			setup(config)
+		}
+		consensus, err := NewConsensus(config)
+		assert.Nil(t, err)
+		net.configs = append(net.configs, config)
+		net.nodes = append(net.nodes, consensus)
+	}
+
+	for i := 0; i < n; i++ {
+		net.join(i)
+	}
+	return net
+}
+
+// join connects the node at index i to all other nodes
+func (net *memNetwork) join(i int) {
+	for j := range net.nodes {
+		if i != j {
+			net.nodes[i].Join(&memPeer{to: j, key: &net.configs[j].PrivateKey.PublicKey, queue: &net.queue})
+		}
+	}
+}
+
+// step delivers all messages in flight, and advances the clock
+func (net *memNetwork) step(d time.Duration) {
+	queue := net.queue
+	net.queue = nil
+	for _, m := range queue {
+		_ = net.nodes[m.to].ReceiveMessage(m.bts, net.now)
+	}
+
+	net.now = net.now.Add(d)
+	for _, node := range net.nodes {
+		_ = node.Update(net.now)
+	}
+}
+
+// decided checks if all nodes have decided at the given height
+func (net *memNetwork) decided(height uint64) bool {
+	for _, node := range net.nodes {
+		if h, _, _ := node.CurrentState(); h < height {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSnapshot(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	for _, node := range net.nodes {
+		node.Propose([]byte("state"))
+	}
+
+	// run until the first node has collected some messages mid-round
+	for i := 0; i < 1000 && net.nodes[0].currentRound.NumRoundChanges() < 2; i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.False(t, net.decided(1))
+	assert.True(t, net.nodes[0].currentRound.NumRoundChanges() >= 2)
+
+	// crash and restore node 0
+	snapshot, err := net.nodes[0].Snapshot()
+	assert.Nil(t, err)
+	restored, err := LoadConsensus(net.configs[0], snapshot)
+	assert.Nil(t, err)
+
+	// restored internal state is identical
+	again, err := restored.Snapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, snapshot, again)
+
+	net.nodes[0] = restored
+	net.join(0)
+
+	for i := 0; i < 1000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+	for _, node := range net.nodes {
+		_, _, state := node.CurrentState()
+		assert.Equal(t, State("state"), state)
+	}
+
+	// corrupted snapshot
+	_, err = LoadConsensus(net.configs[0], []byte{0xff})
+	assert.NotNil(t, err)
+}
+
+func TestSnapshotNoStaleMessage(t *testing.T) {
+	net := newMemNetwork(t, 4)
+	for h := uint64(1); h <= 2; h++ {
+		for _, node := range net.nodes {
+			node.Propose(State{byte(h)})
+		}
+		for i := 0; i < 10000 && !net.decided(h); i++ {
+			net.step(20 * time.Millisecond)
+		}
+		assert.True(t, net.decided(h))
+	}
+	net.nodes[0].Propose(State{3})
+	snapshot, err := net.nodes[0].Snapshot()
+	assert.Nil(t, err)
+
+	// no message of the initial height & round is sent while restoring, and
+	// the restored consensus resumes sending on the next Update
+	var sent []*Message
+	config := net.configs[0].Clone()
+	config.MessageOutCallback = func(m *Message, signed *SignedProto) { sent = append(sent, m) }
+	restored, err := LoadConsensus(config, snapshot)
+	assert.Nil(t, err)
+	assert.Empty(t, sent)
+	assert.Nil(t, restored.Update(net.now.Add(time.Minute)))
+	assert.NotEmpty(t, sent)
+	for _, m := range sent {
+		assert.Equal(t, uint64(3), m.Height)
+	}
+}
@@ -0,0 +1,173 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"sort"
+)
+
+const (
+	// staleRoundSlack is the number of rounds above the decided round of a
+	// height, whose stale messages are still accepted.
+	staleRoundSlack = 2
+	// maxStalePerSender limits the number of accepted stale messages from
+	// each sender at a decided height.
+	maxStalePerSender = 64
+)
+
+// lateCommits records the <commit> messages to the decision of a height
+// arriving after the height has been decided
+type lateCommits struct {
+	round     uint64
+	stateHash StateHash
+	signers   map[Identity]struct{}
+}
+
+// staleKey identifies the stale messages of a sender at a decided height
+type staleKey struct {
+	identity Identity
+	height   uint64
+}
+
+// isStale checks if a message is of a decided height within
+// Config.StaleAcceptWindow, and of a type counted for equivocation detection
+// or attribution.
+func (c *Consensus) isStale(m *Message) bool {
+	if c.staleAcceptWindow == 0 || m.Height > c.latestHeight || m.Height+c.staleAcceptWindow <= c.latestHeight {
+		return false
+	}
+
+	switch m.Type {
+	case MessageType_RoundChange, MessageType_Lock, MessageType_Select, MessageType_Commit:
+		return true
+	}
+	return false
+}
+
+// receiveStale processes a verified message of a decided height within
+// Config.StaleAcceptWindow, it's only recorded for equivocation detection and
+// attribution of late <commit> messages, the consensus of current height is
+// not affected. Only the messages at or below staleRoundSlack rounds above the
+// decided round are accepted, and at most maxStalePerSender messages from each
+// sender at a height.
+func (c *Consensus) receiveStale(m *Message, signed *SignedProto) error {
+	late, ok := c.lateCommits[m.Height]
+	if !ok || m.Round > late.round+staleRoundSlack {
+		return ErrStaleRound
+	}
+
+	key := staleKey{identity: c.pubKeyToIdentity(signed.PublicKey(c.curve)), height: m.Height}
+	if c.staleCounts[key] >= maxStalePerSender {
+		return ErrMessagePoolFull
+	}
+	if c.staleCounts == nil {
+		c.staleCounts = make(map[staleKey]int)
+	}
+	c.staleCounts[key]++
+
+	switch m.Type {
+	case MessageType_Lock, MessageType_Select, MessageType_Commit:
+		c.checkEquivocation(m, signed)
+	}
+
+	if m.Type == MessageType_Commit {
+		if m.Round == late.round && c.stateHash(m.State) == late.stateHash {
+			late.signers[key.identity] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// recordDecision prepares to record late <commit> messages to the decision
+// of a height, if stale messages are accepted.
+func (c *Consensus) recordDecision(height uint64, round uint64, s State) {
+	if c.staleAcceptWindow == 0 {
+		return
+	}
+
+	if c.lateCommits == nil {
+		c.lateCommits = make(map[uint64]*lateCommits)
+	}
+	c.lateCommits[height] = &lateCommits{round: round, stateHash: c.stateHash(s), signers: make(map[Identity]struct{})}
+}
+
+// pruneStale cleans the records of the heights out of Config.StaleAcceptWindow
+// after the height has been decided.
+func (c *Consensus) pruneStale(height uint64) {
+	if c.staleAcceptWindow == 0 {
+		c.signedMessages = nil
+		c.evidenceKeys = nil
+		c.staleCounts = nil
+		return
+	}
+
+	expired := func(h uint64) bool { return h+c.staleAcceptWindow <= height }
+	for key := range c.signedMessages {
+		if expired(key.height) {
+			delete(c.signedMessages, key)
+		}
+	}
+	for key := range c.evidenceKeys {
+		if expired(key.height) {
+			delete(c.evidenceKeys, key)
+		}
+	}
+	for key := range c.staleCounts {
+		if expired(key.height) {
+			delete(c.staleCounts, key)
+		}
+	}
+	for h := range c.lateCommits {
+		if expired(h) {
+			delete(c.lateCommits, h)
+		}
+	}
+}
+
+// LateCommits returns the identities of the participants whose <commit>
+// messages to the decision of a height arrived after it has been decided,
+// sorted by identity, to be attributed along with DecideSigners. Only the
+// heights decided by this participant within Config.StaleAcceptWindow are
+// recorded, returns false otherwise.
+func (c *Consensus) LateCommits(height uint64) ([]Identity, bool) {
+	late, ok := c.lateCommits[height]
+	if !ok {
+		return nil, false
+	}
+
+	signers := make([]Identity, 0, len(late.signers))
+	for id := range late.signers {
+		signers = append(signers, id)
+	}
+	sort.Slice(signers, func(i, j int) bool { return bytes.Compare(signers[i][:], signers[j][:]) < 0 })
+	return signers, true
+}
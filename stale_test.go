@@ -0,0 +1,103 @@
+package bdls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleAcceptWindow(t *testing.T) {
+	run := func(window uint64) {
+		net := newMemNetworkConfig(t, 4, func(config *Config) { config.StaleAcceptWindow = window })
+		decide := func(h uint64) {
+			for _, node := range net.nodes {
+				node.Propose([]byte{byte(h)})
+			}
+			for i := 0; i < 10000 && !net.decided(h); i++ {
+				net.step(20 * time.Millisecond)
+			}
+			assert.True(t, net.decided(h))
+		}
+		node := net.nodes[0]
+		voter := net.configs[3].PrivateKey
+		lateCommit := func(h uint64, round uint64, state State) error {
+			_, sp, _ := createCommitMessageSigner(t, h, round, state, voter)
+			return node.ReceiveMessage(sp.Bytes(), net.now)
+		}
+
+		decide(1)
+		_, round, state := node.CurrentState()
+		node.TakeEquivocations()
+
+		// a late vote within the window is counted
+		err := lateCommit(1, round, state)
+		signers, ok := node.LateCommits(1)
+		if window == 0 {
+			assert.NotNil(t, err)
+			assert.False(t, ok)
+		} else {
+			assert.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, []Identity{DefaultPubKeyToIdentity(&voter.PublicKey)}, signers)
+		}
+
+		// a conflicting late vote is an equivocation
+		_ = lateCommit(1, round, State("other"))
+		if window == 0 {
+			assert.Equal(t, 0, len(node.TakeEquivocations()))
+		} else {
+			assert.Equal(t, 1, len(node.TakeEquivocations()))
+			signers, _ = node.LateCommits(1)
+			assert.Equal(t, 1, len(signers))
+		}
+
+		// the current height progresses as usual
+		decide(2)
+
+		// a late vote outside the window is dropped
+		_ = lateCommit(1, round, state)
+		_, ok = node.LateCommits(1)
+		assert.False(t, ok)
+		_ = lateCommit(1, round, State("another"))
+		assert.Equal(t, 0, len(node.TakeEquivocations()))
+
+		decide(3)
+	}
+
+	run(0)
+	run(1)
+}
+
+func TestStaleBounds(t *testing.T) {
+	net := newMemNetworkConfig(t, 4, func(config *Config) { config.StaleAcceptWindow = 1 })
+	for _, node := range net.nodes {
+		node.Propose(State("state"))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	node := net.nodes[0]
+	_, round, state := node.CurrentState()
+	lateCommit := func(round uint64, voter int) error {
+		_, sp, _ := createCommitMessageSigner(t, 1, round, state, net.configs[voter].PrivateKey)
+		return node.ReceiveMessage(sp.Bytes(), net.now)
+	}
+
+	// rounds beyond the slack above the decided round are rejected
+	assert.Equal(t, ErrStaleRound, lateCommit(round+staleRoundSlack+1, 3))
+	assert.Nil(t, lateCommit(round+staleRoundSlack, 3))
+
+	// the messages from a sender are capped at a height, including those
+	// arrived after the decision
+	voter := staleKey{identity: DefaultPubKeyToIdentity(&net.configs[3].PrivateKey.PublicKey), height: 1}
+	for node.staleCounts[voter] < maxStalePerSender {
+		assert.Nil(t, lateCommit(round, 3))
+	}
+	assert.Equal(t, ErrMessagePoolFull, lateCommit(round, 3))
+	assert.Equal(t, maxStalePerSender, node.staleCounts[voter])
+	assert.Nil(t, lateCommit(round+1, 2))
+	assert.Equal(t, 1, node.staleCounts[staleKey{identity: DefaultPubKeyToIdentity(&net.configs[2].PrivateKey.PublicKey), height: 1}])
+}
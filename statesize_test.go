@@ -0,0 +1,80 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxStateSize(t *testing.T) {
+	t.Log("test oversize states are rejected by the proposer and the receiver")
+	net := newMemNetworkConfig(t, 4, func(config *Config) { config.MaxStateSize = 16 })
+	for _, node := range net.nodes {
+		assert.Equal(t, ErrStateTooLarge, node.Propose(make([]byte, 17)))
+		assert.Equal(t, ErrStateTooLarge, NewIPCPeer(node, 0).Propose(make([]byte, 17)))
+		assert.Equal(t, 0, len(node.unconfirmed))
+	}
+
+	// states at the limit are decided
+	for _, node := range net.nodes {
+		assert.Nil(t, node.Propose(make([]byte, 16)))
+	}
+	for i := 0; i < 10000 && !net.decided(1); i++ {
+		net.step(20 * time.Millisecond)
+	}
+	assert.True(t, net.decided(1))
+
+	// an oversize <roundchange> from a participant
+	_, sp, privateKey := createRoundChangeMessageState(t, 1, 0, make([]byte, 17))
+	consensus := createConsensus(t, 0, 0, []*ecdsa.PublicKey{&privateKey.PublicKey})
+	consensus.maxStateSize = 16
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrStateTooLarge, consensus.ReceiveMessage(bts, time.Now()))
+	consensus.maxStateSize = 17
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+
+	// an oversize state in the proofs of a <lock>
+	_, sp, privateKey, proofKeys := createLockMessage(t, 20, 1, 10, 1, 10)
+	consensus = createConsensus(t, 0, 1, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	consensus.AddParticipant(&privateKey.PublicKey)
+	m, err := DecodeMessage(sp.Message)
+	assert.Nil(t, err)
+	consensus.maxStateSize = len(m.State)
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.verifyLockMessage(m, sp))
+	consensus.maxStateSize = len(m.State) - 1
+	assert.Equal(t, ErrStateTooLarge, consensus.verifyLockMessage(m, sp))
+	assert.Equal(t, ErrStateTooLarge, consensus.ReceiveMessage(bts, time.Now()))
+
+	// rejected before verifying signatures
+	sp.R[0]++
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrStateTooLarge, consensus.ReceiveMessage(bts, time.Now()))
+	assert.Equal(t, ErrStateTooLarge, consensus.ReceiveMessages([][]byte{bts}, time.Now())[0])
+	consensus.maxStateSize = len(m.State)
+	assert.Equal(t, ErrMessageSignature, consensus.ReceiveMessage(bts, time.Now()))
+
+	// an oversize state in the nested proofs of a <lock-release>
+	_, sp, privateKey, proofKeys = createLockReleaseMessage(t, 20, 1, 10, 1, 10)
+	consensus = createConsensus(t, 0, 1, proofKeys)
+	consensus.AddParticipant(&privateKey.PublicKey)
+	m, err = DecodeMessage(sp.Message)
+	assert.Nil(t, err)
+	lock, err := DecodeMessage(m.LockRelease.Message)
+	assert.Nil(t, err)
+	consensus.maxStateSize = len(lock.State)
+	assert.False(t, consensus.stateTooLarge(sp.Message))
+	consensus.maxStateSize = len(lock.State) - 1
+	assert.True(t, consensus.stateTooLarge(sp.Message))
+	sp.R[0]++
+	bts, err = proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrStateTooLarge, consensus.ReceiveMessage(bts, time.Now()))
+}
@@ -0,0 +1,181 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package testnet provides an in-memory network of consensus participants
+// for tests, the messages are exchanged via Config.MessageOutCallback and
+// delivered explicitly, time is advanced by a simulated clock.
+package testnet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"time"
+
+	"github.com/Sperax/bdls"
+)
+
+// message is a message in flight, sent by the node at index from
+type message struct {
+	from int
+	bts  []byte
+}
+
+// clock is the simulated clock shared by all nodes of a network
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+// TestNetwork is a mesh of consensus participants connected in memory,
+// nothing happens until Deliver or Step is called, so tests are
+// deterministic apart from the keys generated.
+type TestNetwork struct {
+	// Configs are the configs of the nodes, indexed as Nodes
+	Configs []*bdls.Config
+	// Nodes are the consensus objects of the participants
+	Nodes []*bdls.Consensus
+
+	clock   *clock
+	pending []message
+	group   []int // partition group of each node, nil if not partitioned
+}
+
+// NewTestNetwork creates a network of n participants with the state compared
+// bytewise and all states considered valid, the network starts at the
+// current system time.
+func NewTestNetwork(n int) (*TestNetwork, error) {
+	net := new(TestNetwork)
+	net.clock = &clock{now: time.Now()}
+
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < n; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, privateKey)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	for i := 0; i < n; i++ {
+		from := i
+		config := new(bdls.Config)
+		config.Epoch = net.clock.now
+		config.Clock = net.clock
+		config.PrivateKey = keys[i]
+		config.Participants = participants
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(bdls.State) bool { return true }
+		config.MessageOutCallback = func(m *bdls.Message, signed *bdls.SignedProto) {
+			bts := make([]byte, len(signed.Bytes()))
+			copy(bts, signed.Bytes())
+			net.pending = append(net.pending, message{from, bts})
+		}
+
+		consensus, err := bdls.NewConsensus(config)
+		if err != nil {
+			return nil, err
+		}
+		net.Configs = append(net.Configs, config)
+		net.Nodes = append(net.Nodes, consensus)
+	}
+	return net, nil
+}
+
+// Now returns the current time of the network
+func (net *TestNetwork) Now() time.Time { return net.clock.now }
+
+// Pending returns the number of messages in flight
+func (net *TestNetwork) Pending() int { return len(net.pending) }
+
+// Deliver delivers all messages in flight to every other node reachable from
+// the sender, messages across a partition are dropped. Messages emitted
+// while delivering are kept in flight for the next call.
+func (net *TestNetwork) Deliver() {
+	pending := net.pending
+	net.pending = nil
+	for _, m := range pending {
+		for to, node := range net.Nodes {
+			if to != m.from && net.reachable(m.from, to) {
+				_ = node.ReceiveMessage(m.bts, net.clock.now)
+			}
+		}
+	}
+}
+
+// Step delivers all messages in flight, then advances the clock by d and
+// updates all nodes.
+func (net *TestNetwork) Step(d time.Duration) {
+	net.Deliver()
+	net.clock.now = net.clock.now.Add(d)
+	for _, node := range net.Nodes {
+		_ = node.Update(net.clock.now)
+	}
+}
+
+// Partition splits the network into the given groups of node indices, nodes
+// in different groups can not reach each other, nodes not listed in any
+// group are isolated. A later call replaces the partition.
+func (net *TestNetwork) Partition(groups ...[]int) {
+	net.group = make([]int, len(net.Nodes))
+	for i := range net.group {
+		net.group[i] = -1 - i
+	}
+	for g, indices := range groups {
+		for _, i := range indices {
+			net.group[i] = g
+		}
+	}
+}
+
+// Heal removes the partition, messages dropped before are not recovered.
+func (net *TestNetwork) Heal() { net.group = nil }
+
+// reachable checks if the messages from a can reach b
+func (net *TestNetwork) reachable(a, b int) bool {
+	return net.group == nil || net.group[a] == net.group[b]
+}
+
+// DecidedHeight returns the latest height decided by the node at index i
+func (net *TestNetwork) DecidedHeight(i int) uint64 {
+	height, _, _ := net.Nodes[i].CurrentState()
+	return height
+}
+
+// Decided checks if all nodes have decided at the given height
+func (net *TestNetwork) Decided(height uint64) bool {
+	for i := range net.Nodes {
+		if net.DecidedHeight(i) < height {
+			return false
+		}
+	}
+	return true
+}
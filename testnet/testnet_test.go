@@ -0,0 +1,48 @@
+package testnet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Sperax/bdls"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTestNetwork(t *testing.T) {
+	_, err := NewTestNetwork(3)
+	assert.True(t, errors.Is(err, bdls.ErrConfigParticipants))
+
+	net, err := NewTestNetwork(4)
+	assert.Nil(t, err)
+	for _, node := range net.Nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 1000 && !net.Decided(1); i++ {
+		net.Step(20 * time.Millisecond)
+	}
+	assert.True(t, net.Decided(1))
+}
+
+func TestNetworkPartition(t *testing.T) {
+	net, err := NewTestNetwork(4)
+	assert.Nil(t, err)
+
+	// no quorum on either side
+	net.Partition([]int{0, 1}, []int{2, 3})
+	for _, node := range net.Nodes {
+		node.Propose([]byte("state"))
+	}
+	for i := 0; i < 200; i++ {
+		net.Step(20 * time.Millisecond)
+	}
+	for i := range net.Nodes {
+		assert.Equal(t, uint64(0), net.DecidedHeight(i))
+	}
+
+	net.Heal()
+	for i := 0; i < 2000 && !net.Decided(1); i++ {
+		net.Step(20 * time.Millisecond)
+	}
+	assert.True(t, net.Decided(1))
+}
@@ -0,0 +1,142 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"container/list"
+	"encoding/binary"
+	"sync"
+
+	"github.com/Sperax/bdls/crypto/blake2b"
+)
+
+// DefaultVerifyCacheSize is the default number of signature verification
+// results kept in the package level verification cache
+const DefaultVerifyCacheSize = 4096
+
+// verifyCacheKey identifies a signature verification, it's derived
+// from the message hash along with the signature <r,s>.
+type verifyCacheKey [blake2b.Size256]byte
+
+// verifyCacheEntry is the element stored in the lru list
+type verifyCacheEntry struct {
+	key verifyCacheKey
+	err error // result of the verification, nil if valid
+}
+
+// verifyCache is a concurrent-safe LRU cache for signature verification results
+type verifyCache struct {
+	size    int
+	entries map[verifyCacheKey]*list.Element
+	lru     list.List // front is the most recently used
+	sync.Mutex
+}
+
+// the package level verification cache consulted by SignedProto.Verify
+var defaultVerifyCache = newVerifyCache(DefaultVerifyCacheSize)
+
+// newVerifyCache creates a verification cache with at most size entries
+func newVerifyCache(size int) *verifyCache {
+	c := new(verifyCache)
+	c.size = size
+	c.entries = make(map[verifyCacheKey]*list.Element)
+	return c
+}
+
+// SetVerifyCacheSize sets the maximum number of signature verification results
+// to be cached, least recently used results will be evicted if the cache shrinks,
+// n <= 0 disables the cache.
+func SetVerifyCacheSize(n int) { defaultVerifyCache.setSize(n) }
+
+// newVerifyCacheKey derives the cache key from a message hash and its signature
+func newVerifyCacheKey(hash []byte, R []byte, S []byte) verifyCacheKey {
+	bts := make([]byte, 0, len(hash)+4+len(R)+len(S))
+	bts = append(bts, hash...)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(R)))
+	bts = append(bts, length[:]...)
+	bts = append(bts, R...)
+	bts = append(bts, S...)
+	return blake2b.Sum256(bts)
+}
+
+// setSize changes the capacity of the cache
+func (c *verifyCache) setSize(n int) {
+	c.Lock()
+	defer c.Unlock()
+	c.size = n
+	c.evict()
+}
+
+// Get returns the cached verification result for the key, found will be false if not cached
+func (c *verifyCache) Get(key verifyCacheKey) (found bool, err error) {
+	c.Lock()
+	defer c.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		return true, elem.Value.(*verifyCacheEntry).err
+	}
+	return false, nil
+}
+
+// Put stores the verification result for the key
+func (c *verifyCache) Put(key verifyCacheKey, err error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.size <= 0 {
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*verifyCacheEntry).err = err
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&verifyCacheEntry{key: key, err: err})
+	c.evict()
+}
+
+// Len returns the number of cached results
+func (c *verifyCache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.lru.Len()
+}
+
+// evict removes least recently used entries until the cache fits its size
+func (c *verifyCache) evict() {
+	for c.lru.Len() > 0 && c.lru.Len() > c.size {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.entries, elem.Value.(*verifyCacheEntry).key)
+	}
+}
@@ -0,0 +1,72 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyCacheLRU(t *testing.T) {
+	c := newVerifyCache(2)
+	k1 := newVerifyCacheKey([]byte{1}, nil, nil)
+	k2 := newVerifyCacheKey([]byte{2}, nil, nil)
+	k3 := newVerifyCacheKey([]byte{3}, nil, nil)
+
+	c.Put(k1, nil)
+	c.Put(k2, ErrSigMismatch)
+	// touch k1, so k2 is the least recently used
+	ok, err := c.Get(k1)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	c.Put(k3, nil)
+	assert.Equal(t, 2, c.Len())
+	ok, _ = c.Get(k2)
+	assert.False(t, ok)
+	ok, _ = c.Get(k1)
+	assert.True(t, ok)
+
+	// shrink & disable
+	c.setSize(1)
+	assert.Equal(t, 1, c.Len())
+	c.setSize(0)
+	assert.Equal(t, 0, c.Len())
+	c.Put(k1, nil)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestVerifyCacheSignature(t *testing.T) {
+	_, sp, _ := createRoundChangeMessage(t, 1, 0)
+	assert.True(t, sp.Verify(S256Curve))
+	// cached result must not be reused for a different signature
+	sp.R[0]++
+	assert.False(t, sp.Verify(S256Curve))
+	sp.R[0]--
+	assert.True(t, sp.Verify(S256Curve))
+}
+
+func BenchmarkVerifyCache(b *testing.B) {
+	privateKey, _ := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	_, sp, _ := createRoundChangeMessageSigner(b, 1, 0, []byte("state"), privateKey)
+	defer SetVerifyCacheSize(DefaultVerifyCacheSize)
+
+	b.Run("NoCache", func(b *testing.B) {
+		SetVerifyCacheSize(0)
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < 1000; j++ {
+				sp.Verify(S256Curve)
+			}
+		}
+	})
+
+	b.Run("Cache", func(b *testing.B) {
+		SetVerifyCacheSize(DefaultVerifyCacheSize)
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < 1000; j++ {
+				sp.Verify(S256Curve)
+			}
+		}
+	})
+}